@@ -0,0 +1,92 @@
+/*
+Package cmd is the CLI package. This is the device cmds
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+
+	"github.com/spf13/cobra"
+
+	"github.com/shigmas/bluezog/pkg/zog"
+)
+
+// adaptersCmd represents the adapters command
+var adaptersCmd = &cobra.Command{
+	Use:   "adapters",
+	Short: "List the adapters",
+	Long:  `List the adapters with their address, alias, and power and discoverable settings.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runBus(func(bus zog.Bus) (zog.Result, error) {
+			return bus.Adapters()
+		})
+	},
+}
+
+// infoCmd represents the info command
+var infoCmd = &cobra.Command{
+	Use:   "info <device>",
+	Short: "Print the properties of a device",
+	Long:  `Print the properties of a device. The device is a path, an address, or a name.`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runBus(func(bus zog.Bus) (zog.Result, error) {
+			return bus.ObjectCommands(args[0], "dump")
+		})
+	},
+}
+
+// connectCmd represents the connect command
+var connectCmd = &cobra.Command{
+	Use:   "connect <device>",
+	Short: "Connect to a device",
+	Long: `Connect to a device. The device is a path, an address, or a name. The device stays
+connected after zogctl exits.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runBus(func(bus zog.Bus) (zog.Result, error) {
+			return bus.ObjectCommands(args[0], "connect")
+		})
+	},
+}
+
+// runBus runs the command with the bus, writes the result, and closes the bus
+func runBus(command func(zog.Bus) (zog.Result, error)) error {
+	formatter, err := newFormatter()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bus, closer, err := newBus(ctx, formatter)
+	if err != nil {
+		return err
+	}
+	defer closer()
+
+	result, err := command(bus)
+	if err != nil {
+		return err
+	}
+	return formatter.Write(result)
+}
+
+func init() {
+	rootCmd.AddCommand(adaptersCmd)
+	rootCmd.AddCommand(infoCmd)
+	rootCmd.AddCommand(connectCmd)
+}
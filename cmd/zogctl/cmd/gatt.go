@@ -0,0 +1,89 @@
+/*
+Package cmd is the CLI package. This is the gatt cmds
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/shigmas/bluezog/pkg/zog"
+)
+
+var (
+	// write type for write: command, request or reliable
+	writeType string
+)
+
+// readCmd represents the read command
+var readCmd = &cobra.Command{
+	Use:   "read <characteristic|descriptor>",
+	Short: "Read the value of a characteristic or descriptor",
+	Long: `Read the value of a GATT characteristic or descriptor, by its path. The device must be
+connected.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runBus(func(bus zog.Bus) (zog.Result, error) {
+			return bus.Gatt(args[0])
+		})
+	},
+}
+
+// writeCmd represents the write command
+var writeCmd = &cobra.Command{
+	Use:   "write <characteristic|descriptor> <hex>",
+	Short: "Write a value to a characteristic or descriptor",
+	Long: `Write the hex bytes, like 0102ff or 0x0102ff, to a GATT characteristic or descriptor,
+by its path. The device must be connected.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data := args[1]
+		if !strings.HasPrefix(strings.ToLower(data), "0x") {
+			data = "0x" + data
+		}
+		gattArgs := []interface{}{args[0], "write", data}
+		if writeType != "" {
+			gattArgs = append(gattArgs, writeType)
+		}
+		return runBus(func(bus zog.Bus) (zog.Result, error) {
+			return bus.Gatt(gattArgs...)
+		})
+	},
+}
+
+// notifyCmd represents the notify command
+var notifyCmd = &cobra.Command{
+	Use:   "notify <characteristic>",
+	Short: "Print the notifications from a characteristic",
+	Long: `Print the notifications from a GATT characteristic, by its path, until interrupted.
+The device must be connected.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runBus(func(bus zog.Bus) (zog.Result, error) {
+			return bus.Gatt(args[0], "notify")
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(readCmd)
+	rootCmd.AddCommand(writeCmd)
+	rootCmd.AddCommand(notifyCmd)
+
+	writeCmd.Flags().StringVar(&writeType, "type", "",
+		"write type: command, request or reliable. By default, bluez chooses")
+}
@@ -0,0 +1,74 @@
+/*
+Package cmd is the CLI package. This is the monitor cmd
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/shigmas/bluezog/pkg/zog"
+)
+
+var (
+	// flags for monitor
+	monitorPaths       []string
+	monitorInterfaces  []string
+	monitorProperties  []string
+	monitorCaptureFile string
+)
+
+// monitorCmd represents the monitor command
+var monitorCmd = &cobra.Command{
+	Use:   "monitor",
+	Short: "Print the bluez signals as they happen",
+	Long: `Print every InterfacesAdded, InterfacesRemoved and PropertiesChanged signal from bluez,
+like dbus-monitor, with the values decoded. Stop with Ctrl-C.
+
+The flags can be repeated. --path is a glob, like '/org/bluez/hci0/dev_*', which also
+matches the objects under the paths it matches. --capture tees the signals to a session
+log, like --record.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var monitorArgs []interface{}
+		for _, filter := range []struct {
+			key    string
+			values []string
+		}{
+			{"path", monitorPaths},
+			{"interface", monitorInterfaces},
+			{"property", monitorProperties},
+		} {
+			for _, value := range filter.values {
+				monitorArgs = append(monitorArgs, filter.key, value)
+			}
+		}
+		if monitorCaptureFile != "" {
+			monitorArgs = append(monitorArgs, "capture", monitorCaptureFile)
+		}
+		return runBus(func(bus zog.Bus) (zog.Result, error) {
+			return bus.Monitor(monitorArgs...)
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(monitorCmd)
+	flags := monitorCmd.Flags()
+	flags.StringArrayVar(&monitorPaths, "path", nil, "only the objects that match the glob")
+	flags.StringArrayVar(&monitorInterfaces, "interface", nil, "only the interface, like org.bluez.Device1")
+	flags.StringArrayVar(&monitorProperties, "property", nil, "only the property, like RSSI")
+	flags.StringVar(&monitorCaptureFile, "capture", "", "tee the signals to the session log file")
+}
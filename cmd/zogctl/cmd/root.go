@@ -18,16 +18,36 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/spf13/cobra"
 
+	"github.com/chzyer/readline"
 	homedir "github.com/mitchellh/go-homedir"
+	"github.com/shigmas/bluezog/pkg/base"
+	"github.com/shigmas/bluezog/pkg/bus"
+	"github.com/shigmas/bluezog/pkg/capture"
+	"github.com/shigmas/bluezog/pkg/logger"
+	"github.com/shigmas/bluezog/pkg/zog"
 	"github.com/spf13/viper"
 )
 
-var cfgFile string
+var (
+	cfgFile string
+	// session log to write, or to replay instead of using the bus
+	recordFile  string
+	replayFile  string
+	fastForward bool
+	// output format: text, json, jsonl or table
+	outputFormat string
+	// no colors, even on a terminal
+	noColor bool
+)
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
@@ -35,20 +55,18 @@ var rootCmd = &cobra.Command{
 	Short: "Go version of bluetoothctl",
 	Long: `Instructions
 
-Obviously, cite the flags.`,
-	// Uncomment the following line if your bare application
-	// has an action associated with it:
-	Run: func(cmd *cobra.Command, args []string) {
-		//bus := core.NewBus()
-		//bus.GetInterface()
-	},
+Obviously, cite the flags. shell is interactive. The other commands run once, so they can
+be used in scripts. They exit with 1 if they fail.`,
+	// We print the error in Execute, and the usage is only printed for usage errors
+	SilenceErrors: true,
+	SilenceUsage:  true,
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
@@ -61,10 +79,11 @@ func init() {
 	// will be global for your application.
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.zogctl.yaml)")
-
-	// Cobra also supports local flags, which will only run
-	// when this action is called directly.
-	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	rootCmd.PersistentFlags().StringVar(&recordFile, "record", "", "record the bus traffic to the session log file")
+	rootCmd.PersistentFlags().StringVar(&replayFile, "replay", "", "replay the session log file instead of using the bus")
+	rootCmd.PersistentFlags().BoolVar(&fastForward, "fast-forward", false, "replay the signals without the recorded delays")
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", string(zog.FormatText), "output format: text, json, jsonl or table")
+	rootCmd.PersistentFlags().BoolVar(&noColor, "no-color", false, "don't color the text, even on a terminal")
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -89,6 +108,95 @@ func initConfig() {
 
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
+		logger.Info("Using config file: %s", viper.ConfigFileUsed())
+	}
+}
+
+// newOperations connects to the system bus, or replays the session log. If we're recording,
+// the operations are wrapped with the recorder. The returned function closes the log.
+func newOperations() (base.Operations, func(), error) {
+	var ops base.Operations
+	closer := func() {}
+	if replayFile != "" {
+		timing := capture.RealTime
+		if fastForward {
+			timing = capture.FastForward
+		}
+		replayer, err := capture.LoadReplayer(replayFile, timing)
+		if err != nil {
+			return nil, nil, err
+		}
+		ops = replayer
+		closer = replayer.Close
+	} else {
+		ops = bus.NewDbusOperations()
+		if ops == nil {
+			return nil, nil, errors.New("Unable to connect to the system bus")
+		}
+	}
+
+	if recordFile != "" {
+		f, err := os.Create(recordFile)
+		if err != nil {
+			closer()
+			return nil, nil, err
+		}
+		ops = capture.NewRecorder(ops, f)
+		replayCloser := closer
+		closer = func() {
+			replayCloser()
+			f.Close()
+		}
 	}
+
+	return ops, closer, nil
+}
+
+// newFormatter writes to stdout in the --output format. The text is colored if stdout is a
+// terminal.
+func newFormatter() (*zog.Formatter, error) {
+	format, err := zog.ParseFormat(outputFormat)
+	if err != nil {
+		return nil, err
+	}
+	formatter := zog.NewFormatter(os.Stdout, format)
+	formatter.SetColor(!noColor && readline.IsTerminal(int(os.Stdout.Fd())))
+	return formatter, nil
+}
+
+// newBus connects to bluez, and finds the default adapter. The event streams are written
+// with the formatter. The returned function closes the connection.
+func newBus(ctx context.Context, formatter *zog.Formatter) (zog.Bus, func(), error) {
+	ops, closer, err := newOperations()
+	if err != nil {
+		return nil, nil, err
+	}
+	bus := zog.NewBus(ctx, ops, zog.WithFormatter(formatter))
+	if bus == nil {
+		closer()
+		return nil, nil, errors.New("Unable to initialize bluez")
+	}
+	if _, err := bus.GetInterface(); err != nil {
+		closer()
+		return nil, nil, err
+	}
+
+	return bus, closer, nil
+}
+
+// interruptContext returns a context that is cancelled on Ctrl-C, or when systemd stops us
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		defer signal.Stop(interrupt)
+		select {
+		case <-interrupt:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
 }
@@ -0,0 +1,197 @@
+/*
+Package cmd is the CLI package. This is the scan cmd
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/shigmas/bluezog/pkg/beacon"
+	"github.com/shigmas/bluezog/pkg/protocol"
+	"github.com/shigmas/bluezog/pkg/zog"
+)
+
+var (
+	// how long to scan. Zero scans until interrupted.
+	scanDuration time.Duration
+	// flags for scan beacons
+	beaconFilter           string
+	beaconWindow           int
+	beaconProcessNoise     float64
+	beaconMeasurementNoise float64
+	beaconExitTimeout      time.Duration
+	beaconNearestTimeout   time.Duration
+	beaconExponent         float64
+	beaconRefresh          time.Duration
+)
+
+const (
+	// the number of events shown under the table
+	beaconEventLines = 5
+	// moves the cursor to the top left, and clears the screen
+	clearScreen = "\033[H\033[2J"
+)
+
+// scanCmd represents the scan command
+var scanCmd = &cobra.Command{
+	Use:   "scan",
+	Short: "Scan for devices",
+	Long: `Scan for devices with the default adapter. The devices are printed as they're found,
+until the duration is over, or until interrupted. Each device is a line with --output jsonl.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		formatter, err := newFormatter()
+		if err != nil {
+			return err
+		}
+		ctx, cancel := interruptContext()
+		defer cancel()
+		bus, closer, err := newBus(ctx, formatter)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		if scanDuration > 0 {
+			var timeoutCancel context.CancelFunc
+			ctx, timeoutCancel = context.WithTimeout(ctx, scanDuration)
+			defer timeoutCancel()
+		}
+		if _, err := bus.StartDiscovery(); err != nil {
+			return err
+		}
+		<-ctx.Done()
+		_, err = bus.StopDiscovery()
+		return err
+	},
+}
+
+// scanBeaconsCmd represents the scan beacons command
+var scanBeaconsCmd = &cobra.Command{
+	Use:   "beacons",
+	Short: "Track the beacons in a live table",
+	Long: `Track the iBeacon, AltBeacon and Eddystone beacons, with their smoothed RSSI and
+estimated distance, nearest first. The table is updated until interrupted. With the other
+--output formats, the beacons that enter, exit, or become the nearest are written instead.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var newFilter func() beacon.RSSIFilter
+		switch beaconFilter {
+		case "average":
+			newFilter = func() beacon.RSSIFilter { return beacon.NewMovingAverage(beaconWindow) }
+		case "kalman":
+			newFilter = func() beacon.RSSIFilter {
+				return beacon.NewKalman(beaconProcessNoise, beaconMeasurementNoise)
+			}
+		default:
+			return fmt.Errorf("Unknown filter %s. Use average or kalman", beaconFilter)
+		}
+		if beaconRefresh <= 0 {
+			return fmt.Errorf("Refresh interval %s must be more than 0", beaconRefresh)
+		}
+
+		formatter, err := newFormatter()
+		if err != nil {
+			return err
+		}
+		ctx, cancel := interruptContext()
+		defer cancel()
+		ops, closer, err := newOperations()
+		if err != nil {
+			return err
+		}
+		defer closer()
+		bluez, err := protocol.InitializeBluez(ctx, ops)
+		if err != nil {
+			return err
+		}
+		adapters := bluez.FindAdapters()
+		if len(adapters) == 0 {
+			return fmt.Errorf("No adapters found")
+		}
+		scanner := beacon.NewScanner(bluez, adapters[0],
+			beacon.WithFilter(newFilter),
+			beacon.WithExitTimeout(beaconExitTimeout),
+			beacon.WithNearestTimeout(beaconNearestTimeout),
+			beacon.WithPathLossExponent(beaconExponent))
+		events, err := scanner.Start(ctx)
+		if err != nil {
+			return err
+		}
+
+		// The live table is for people. Scripts get the events.
+		live := formatter.Format() == zog.FormatText
+		var recent []zog.Result
+		ticker := time.NewTicker(beaconRefresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					return nil
+				}
+				beaconEvent := zog.NewBeaconEvent(&event)
+				if !live {
+					if err := formatter.WriteEvent(beaconEvent); err != nil {
+						return err
+					}
+					continue
+				}
+				recent = append(recent, beaconEvent)
+				if len(recent) > beaconEventLines {
+					recent = recent[len(recent)-beaconEventLines:]
+				}
+			case <-ticker.C:
+				if !live {
+					continue
+				}
+				fmt.Print(clearScreen)
+				if err := formatter.Write(zog.NewBeaconList(scanner.Beacons())); err != nil {
+					return err
+				}
+				fmt.Println()
+				for _, beaconEvent := range recent {
+					if err := formatter.WriteEvent(beaconEvent); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(scanCmd)
+	scanCmd.AddCommand(scanBeaconsCmd)
+	scanCmd.Flags().DurationVar(&scanDuration, "duration", 0,
+		"how long to scan, like 10s. By default, until interrupted")
+
+	flags := scanBeaconsCmd.Flags()
+	flags.StringVar(&beaconFilter, "filter", "average", "RSSI filter: average or kalman")
+	flags.IntVar(&beaconWindow, "window", beacon.DefaultWindow, "measurements in the moving average")
+	flags.Float64Var(&beaconProcessNoise, "process-noise", 0.01, "Kalman process noise")
+	flags.Float64Var(&beaconMeasurementNoise, "measurement-noise", 4, "Kalman measurement noise")
+	flags.DurationVar(&beaconExitTimeout, "exit-timeout", beacon.DefaultExitTimeout,
+		"time a beacon isn't seen before it exits")
+	flags.DurationVar(&beaconNearestTimeout, "nearest-timeout", beacon.DefaultNearestTimeout,
+		"time a beacon must be the nearest before it's reported")
+	flags.Float64Var(&beaconExponent, "exponent", beacon.DefaultPathLossExponent,
+		"path loss exponent for the distance")
+	flags.DurationVar(&beaconRefresh, "refresh", 500*time.Millisecond, "table refresh interval")
+}
@@ -21,65 +21,214 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/spf13/cobra"
 
 	"github.com/chzyer/readline"
-	"github.com/shigmas/bluezog/pkg/bus"
 	"github.com/shigmas/bluezog/pkg/zog"
 )
 
 // shellCmd represents the shell command
 var shellCmd = &cobra.Command{
 	Use:   "shell",
-	Short: "A brief description of your command",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
+	Short: "Interactive shell",
+	Long: `Interactive shell, like bluetoothctl. The commands are the zog.BusCommand names, like
+adapter, start, object and gatt. help lists them, and help <command> shows the usage.
+Arguments with spaces can be quoted, and data for writes can be hex, like 0x0102ff.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		fmt.Println("---------------------")
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
-		bus := zog.NewBus(ctx, bus.NewDbusOperations())
-		rl, err := readline.New("zogctl> ")
+		formatter, err := newFormatter()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		ops, closer, err := newOperations()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		defer closer()
+		bus := zog.NewBus(ctx, ops, zog.WithFormatter(formatter))
+		rl, err := readline.NewEx(&readline.Config{
+			Prompt:       shellPrompt,
+			AutoComplete: &shellCompleter{bus: bus},
+			HistoryFile:  historyFile(),
+		})
 		if err != nil {
 			os.Exit(0)
 		}
 		defer rl.Close()
+		prompter := &shellPrompter{rl: rl, askCh: make(chan struct{}, 1)}
+		bus.SetPrompter(prompter.prompt)
 
 		for {
 			text, err := rl.Readline()
 			if err == io.EOF {
 				os.Exit(0)
 			}
+			if prompter.answer(text) {
+				continue
+			}
 
-			// This should handle multiple spaces, but save 10 minutes...
-			cmdAndArgs := strings.Split(text, " ")
-			command := cmdAndArgs[0]
-			var args []interface{}
-			if len(cmdAndArgs) > 1 {
-				for _, a := range cmdAndArgs[1:] {
-					args = append(args, a)
-				}
+			command, args, err := zog.ParseCommand(text)
+			if err != nil {
+				fmt.Println(err)
+				continue
 			}
-			val, ok := zog.BusCommand[command]
-			if ok {
-				err := val(bus, args...)
+			if command == "" {
+				continue
+			}
+			prompter.run(func() {
+				result, err := zog.BusCommand[command](bus, args...)
+				if err == nil {
+					err = formatter.Write(result)
+				}
 				if err != nil {
 					fmt.Printf("command %s returned error [%s]\n", command, err)
 				}
-			} else {
-				fmt.Printf("No command [%s]\n", command)
-			}
-
+			})
 		}
 	},
 }
 
+const shellPrompt = "zogctl> "
+
+// shellCompleter completes the commands and their arguments with the Bus
+type shellCompleter struct {
+	bus zog.Bus
+}
+
+// Do returns the rest of each candidate for the word at the cursor, and the length of the
+// word so far.
+func (c *shellCompleter) Do(line []rune, pos int) ([][]rune, int) {
+	text := string(line[:pos])
+	partial := ""
+	if fields := strings.Fields(text); len(fields) > 0 && !strings.HasSuffix(text, " ") {
+		partial = fields[len(fields)-1]
+	}
+	candidates := c.bus.Complete(text)
+	suffixes := make([][]rune, len(candidates))
+	for i, candidate := range candidates {
+		suffix := strings.TrimPrefix(candidate, partial)
+		// Paths that end in / have more to complete
+		if !strings.HasSuffix(candidate, "/") {
+			suffix += " "
+		}
+		suffixes[i] = []rune(suffix)
+	}
+	return suffixes, len([]rune(partial))
+}
+
+// historyFile is the shell's history in the config directory. It's empty, so there's no
+// history, if there's no config directory.
+func historyFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	dir = filepath.Join(dir, "zogctl")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "history")
+}
+
+// shellPrompter lets the agent ask questions through the shell. The agent is called from
+// the dbus goroutine, so the question replaces the prompt, and the next line the user
+// enters is the answer instead of a command. The questions usually come while a command,
+// like pair, is waiting for bluez, so the commands are run with run.
+type shellPrompter struct {
+	rl *readline.Instance
+	// one question at a time
+	askMux   sync.Mutex
+	mux      sync.Mutex
+	answerCh chan string
+	// askCh tells run that there's a question
+	askCh chan struct{}
+}
+
+func (p *shellPrompter) prompt(ctx context.Context, question string) (string, error) {
+	p.askMux.Lock()
+	defer p.askMux.Unlock()
+
+	ch := make(chan string, 1)
+	p.mux.Lock()
+	p.answerCh = ch
+	p.mux.Unlock()
+	p.rl.SetPrompt(question + " ")
+	p.rl.Refresh()
+	select {
+	case p.askCh <- struct{}{}:
+	default:
+	}
+	defer func() {
+		p.mux.Lock()
+		p.answerCh = nil
+		p.mux.Unlock()
+		p.rl.SetPrompt(shellPrompt)
+		p.rl.Refresh()
+	}()
+
+	select {
+	case answer := <-ch:
+		return answer, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// run runs the command on another goroutine, and reads the answers to the questions until
+// it's done. We only read a line when there's a question, so Ctrl-C still stops commands
+// like monitor.
+func (p *shellPrompter) run(command func()) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		command()
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		case <-p.askCh:
+			if !p.waiting() {
+				// It was answered at the prompt, before the command
+				continue
+			}
+			// Ctrl-C and Ctrl-D are an empty answer, which rejects
+			line, _ := p.rl.Readline()
+			if !p.answer(line) {
+				fmt.Println("The question was canceled")
+			}
+		}
+	}
+}
+
+// waiting is true if there's a question that hasn't been answered
+func (p *shellPrompter) waiting() bool {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return p.answerCh != nil
+}
+
+// answer sends the line to the question that is waiting. It returns false if there isn't
+// one, so the line is a command.
+func (p *shellPrompter) answer(line string) bool {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if p.answerCh == nil {
+		return false
+	}
+	p.answerCh <- line
+	p.answerCh = nil
+	return true
+}
+
 func init() {
 	rootCmd.AddCommand(shellCmd)
 
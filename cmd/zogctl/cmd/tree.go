@@ -0,0 +1,42 @@
+/*
+Package cmd is the CLI package. This is the tree cmd
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/shigmas/bluezog/pkg/zog"
+)
+
+// treeCmd represents the tree command
+var treeCmd = &cobra.Command{
+	Use:   "tree <device>",
+	Short: "Print the GATT services, characteristics and descriptors of a device",
+	Long: `Print the GATT hierarchy of a device, like gatttool's primary and characteristics
+listings. The device is a path, an address, or a name. If the services aren't resolved,
+the device is connected first.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runBus(func(bus zog.Bus) (zog.Result, error) {
+			return bus.Tree(args[0])
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(treeCmd)
+}
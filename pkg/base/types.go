@@ -2,12 +2,14 @@ package base
 
 import (
 	"context"
+	"os"
 
 	"github.com/godbus/dbus/v5"
 )
 
 var (
-	// DumpData should be set to true to capture sample data for testing.
+	// DumpData should be set to true to capture sample data for testing. This writes the
+	// files for the fixtures in testdata. To capture a whole session, use capture.Recorder.
 	DumpData = false
 )
 
@@ -53,6 +55,7 @@ type (
 	Operations interface {
 		IntrospectObject(dest string, objPath dbus.ObjectPath) (*Node, error)
 		GetObjectProperty(dest string, objPath dbus.ObjectPath, propName string) (interface{}, error)
+		SetObjectProperty(dest string, objPath dbus.ObjectPath, propName string, value interface{}) error
 		GetManagedObjects(dest string, objPath dbus.ObjectPath) (map[dbus.ObjectPath]ObjectMap, error)
 		CallFunction(
 			ctx context.Context,
@@ -66,10 +69,28 @@ type (
 			objPath dbus.ObjectPath,
 			funcName string,
 			args ...interface{}) error
+		// CallFunctionForFd calls a function that returns a Unix file descriptor and a uint16,
+		// like AcquireNotify and AcquireWrite.
+		CallFunctionForFd(
+			ctx context.Context,
+			dest string,
+			objPath dbus.ObjectPath,
+			funcName string,
+			args ...interface{}) (*os.File, uint16, error)
+
+		// Export makes the methods of obj available on the bus as iface at the path. Methods
+		// must return *dbus.Error as the last value. Unexport removes it.
+		Export(obj interface{}, path dbus.ObjectPath, iface string) error
+		Unexport(path dbus.ObjectPath, iface string) error
 
 		RegisterSignalChannel(ch chan<- *dbus.Signal)
 		Watch(path dbus.ObjectPath, iface string, method string) error
 		UnWatch(path dbus.ObjectPath, iface string, method string) error
+		// WatchNamespace is Watch for the path and all the paths under it
+		WatchNamespace(namespace dbus.ObjectPath, iface string, method string) error
+		// WatchNameOwner watches NameOwnerChanged for the bus name, which is sent when the
+		// service starts or stops.
+		WatchNameOwner(name string) error
 	}
 )
 
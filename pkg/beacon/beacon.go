@@ -0,0 +1,199 @@
+// Package beacon decodes the ManufacturerData and ServiceData in advertisements into typed
+// frames, like iBeacon and Eddystone. The decoders are in a Registry, keyed by the company
+// ID or the service UUID, so other formats can be added.
+package beacon
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/shigmas/bluezog/pkg/protocol"
+)
+
+type (
+	// Frame is a decoded advertisement
+	Frame interface {
+		// Kind is the name of the format, like "iBeacon" or "Eddystone-URL"
+		Kind() string
+		fmt.Stringer
+	}
+
+	// Ranger is a Frame with the calibrated power, so the distance can be estimated
+	Ranger interface {
+		Frame
+		// ReferencePower is the RSSI at 1 meter
+		ReferencePower() int8
+	}
+
+	// ManufacturerDecoder decodes the ManufacturerData for a company. The data doesn't
+	// include the company ID, since bluez uses it as the key. It returns ErrNotMatched if
+	// the data isn't the format it decodes.
+	ManufacturerDecoder func(companyID uint16, data []byte) (Frame, error)
+
+	// ServiceDecoder decodes the ServiceData for a service UUID. It returns ErrNotMatched
+	// if the data isn't the format it decodes.
+	ServiceDecoder func(uuid string, data []byte) (Frame, error)
+
+	// Registry has the decoders. The decoders for a key are tried in the order they were
+	// registered.
+	Registry struct {
+		mux          sync.RWMutex
+		manufacturer map[uint16][]ManufacturerDecoder
+		// tried for any company, after the ones for the company
+		anyCompany []ManufacturerDecoder
+		service    map[string][]ServiceDecoder
+	}
+)
+
+const (
+	// AppleCompanyID is the Bluetooth SIG company ID for Apple, for iBeacon
+	AppleCompanyID uint16 = 0x004c
+	// EddystoneUUID is the service UUID for Eddystone
+	EddystoneUUID = "0000feaa-0000-1000-8000-00805f9b34fb"
+
+	// the Bluetooth base UUID, for the 16 bit UUIDs
+	baseUUIDSuffix = "-0000-1000-8000-00805f9b34fb"
+	// Eddystone has the power at 0 meters. The signal loses about 41dB in the first meter.
+	lossAt1m = 41
+)
+
+var (
+	// ErrNotMatched is returned by a decoder when the data isn't its format
+	ErrNotMatched = errors.New("Data doesn't match the format")
+	// ErrNoDecoder is returned when no decoder matched the data
+	ErrNoDecoder = errors.New("No decoder for the data")
+
+	// DefaultRegistry has the decoders for iBeacon, AltBeacon and Eddystone
+	DefaultRegistry = NewDefaultRegistry()
+)
+
+// NewRegistry returns an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{
+		manufacturer: make(map[uint16][]ManufacturerDecoder),
+		service:      make(map[string][]ServiceDecoder),
+	}
+}
+
+// NewDefaultRegistry returns a Registry with the decoders in this package
+func NewDefaultRegistry() *Registry {
+	r := NewRegistry()
+	r.RegisterManufacturer(AppleCompanyID, DecodeIBeacon)
+	r.RegisterAnyManufacturer(DecodeAltBeacon)
+	r.RegisterService(EddystoneUUID, DecodeEddystone)
+	return r
+}
+
+// NormalizeUUID returns the full lower case UUID. 16 and 32 bit UUIDs, like "feaa", are
+// expanded with the Bluetooth base UUID.
+func NormalizeUUID(uuid string) string {
+	uuid = strings.ToLower(uuid)
+	switch len(uuid) {
+	case 4:
+		return "0000" + uuid + baseUUIDSuffix
+	case 8:
+		return uuid + baseUUIDSuffix
+	}
+	return uuid
+}
+
+// RegisterManufacturer adds the decoder for the company ID
+func (r *Registry) RegisterManufacturer(companyID uint16, decoder ManufacturerDecoder) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.manufacturer[companyID] = append(r.manufacturer[companyID], decoder)
+}
+
+// RegisterAnyManufacturer adds the decoder for formats that can use any company ID, like
+// AltBeacon
+func (r *Registry) RegisterAnyManufacturer(decoder ManufacturerDecoder) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.anyCompany = append(r.anyCompany, decoder)
+}
+
+// RegisterService adds the decoder for the service UUID
+func (r *Registry) RegisterService(uuid string, decoder ServiceDecoder) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	uuid = NormalizeUUID(uuid)
+	r.service[uuid] = append(r.service[uuid], decoder)
+}
+
+// DecodeManufacturer decodes the ManufacturerData for the company ID
+func (r *Registry) DecodeManufacturer(companyID uint16, data []byte) (Frame, error) {
+	r.mux.RLock()
+	decoders := append(append([]ManufacturerDecoder(nil), r.manufacturer[companyID]...),
+		r.anyCompany...)
+	r.mux.RUnlock()
+	for _, decoder := range decoders {
+		frame, err := decoder(companyID, data)
+		if err == ErrNotMatched {
+			continue
+		}
+		return frame, err
+	}
+
+	return nil, ErrNoDecoder
+}
+
+// DecodeService decodes the ServiceData for the service UUID
+func (r *Registry) DecodeService(uuid string, data []byte) (Frame, error) {
+	uuid = NormalizeUUID(uuid)
+	r.mux.RLock()
+	decoders := append([]ServiceDecoder(nil), r.service[uuid]...)
+	r.mux.RUnlock()
+	for _, decoder := range decoders {
+		frame, err := decoder(uuid, data)
+		if err == ErrNotMatched {
+			continue
+		}
+		return frame, err
+	}
+
+	return nil, ErrNoDecoder
+}
+
+// Decode returns the frames from all the data that can be decoded. The data that no
+// decoder matches, or that is malformed, is skipped.
+func (r *Registry) Decode(mfgData map[uint16][]byte, serviceData map[string][]byte) []Frame {
+	frames := make([]Frame, 0)
+	for id, data := range mfgData {
+		frame, err := r.DecodeManufacturer(id, data)
+		if err == nil {
+			frames = append(frames, frame)
+		}
+	}
+	for uuid, data := range serviceData {
+		frame, err := r.DecodeService(uuid, data)
+		if err == nil {
+			frames = append(frames, frame)
+		}
+	}
+
+	return frames
+}
+
+// DecodeDevice returns the frames from the device's cached ManufacturerData and ServiceData
+func (r *Registry) DecodeDevice(device *protocol.Device) []Frame {
+	mfgData, _ := device.ManufacturerData()
+	serviceData, _ := device.ServiceData()
+	return r.Decode(mfgData, serviceData)
+}
+
+// Decode uses the DefaultRegistry
+func Decode(mfgData map[uint16][]byte, serviceData map[string][]byte) []Frame {
+	return DefaultRegistry.Decode(mfgData, serviceData)
+}
+
+// DecodeDevice uses the DefaultRegistry
+func DecodeDevice(device *protocol.Device) []Frame {
+	return DefaultRegistry.DecodeDevice(device)
+}
+
+// formatUUID formats the 16 bytes like 8-4-4-4-12
+func formatUUID(b []byte) string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,143 @@
+package beacon
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/shigmas/bluezog/test"
+	"github.com/stretchr/testify/assert"
+)
+
+// advertisement reads the ManufacturerData and ServiceData from a captured PropertiesChanged
+// signal
+func advertisement(t *testing.T, fname string) (map[uint16][]byte, map[string][]byte) {
+	sig, err := test.UnmarshalSignal(fname)
+	if !assert.NoError(t, err, "Unexpected error reading %s", fname) {
+		t.FailNow()
+	}
+	changed := sig.Body[1].(map[string]dbus.Variant)
+	mfgData := make(map[uint16][]byte)
+	if v, ok := changed["ManufacturerData"]; ok {
+		for id, data := range v.Value().(map[uint16]dbus.Variant) {
+			mfgData[id] = data.Value().([]byte)
+		}
+	}
+	serviceData := make(map[string][]byte)
+	if v, ok := changed["ServiceData"]; ok {
+		for uuid, data := range v.Value().(map[string]dbus.Variant) {
+			serviceData[uuid] = data.Value().([]byte)
+		}
+	}
+	return mfgData, serviceData
+}
+
+func decodeOne(t *testing.T, fname string) Frame {
+	frames := Decode(advertisement(t, fname))
+	if !assert.Len(t, frames, 1, "Expected one frame in %s", fname) {
+		t.FailNow()
+	}
+	return frames[0]
+}
+
+func TestIBeacon(t *testing.T) {
+	frame := decodeOne(t, "signal-PropertiesChanged-ibeacon")
+	assert.Equal(t, "iBeacon", frame.Kind())
+	assert.Equal(t, &IBeacon{
+		UUID:          "f7826da6-4fa2-4e98-8024-bc5b71e0893e",
+		Major:         100,
+		Minor:         2,
+		MeasuredPower: -59,
+	}, frame)
+
+	_, err := DecodeIBeacon(AppleCompanyID, []byte{0x02, 0x15, 0xf7})
+	assert.Error(t, err, "Expected error for truncated data")
+	_, err = DecodeIBeacon(AppleCompanyID, []byte{0x10, 0x05, 0x03, 0x18})
+	assert.Equal(t, ErrNotMatched, err, "Other Apple data shouldn't match")
+}
+
+func TestAltBeacon(t *testing.T) {
+	frame := decodeOne(t, "signal-PropertiesChanged-altbeacon")
+	altBeacon, ok := frame.(*AltBeacon)
+	if !assert.True(t, ok, "Expected AltBeacon, not %T", frame) {
+		return
+	}
+	assert.Equal(t, uint16(0x0118), altBeacon.CompanyID)
+	assert.Equal(t, "2f234454-cf6d-4a0f-adf2-f4911ba9ffa6", altBeacon.UUID)
+	assert.Equal(t, uint16(1), altBeacon.Major)
+	assert.Equal(t, uint16(2), altBeacon.Minor)
+	assert.Equal(t, int8(-59), altBeacon.ReferenceRSSI)
+	assert.Len(t, altBeacon.ID, 20)
+}
+
+func TestEddystone(t *testing.T) {
+	frame := decodeOne(t, "signal-PropertiesChanged-eddystone-uid")
+	assert.Equal(t, &EddystoneUID{
+		TxPower:   -25,
+		Namespace: []byte{0xed, 0xd1, 0xeb, 0xea, 0xc0, 0x4e, 0x5d, 0xef, 0xa0, 0x17},
+		Instance:  []byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xab},
+	}, frame)
+
+	frame = decodeOne(t, "signal-PropertiesChanged-eddystone-url")
+	assert.Equal(t, &EddystoneURL{TxPower: -25, URL: "https://www.google.com/"}, frame)
+
+	frame = decodeOne(t, "signal-PropertiesChanged-eddystone-tlm")
+	assert.Equal(t, &EddystoneTLM{
+		BatteryVoltage:   3000,
+		Temperature:      23.5,
+		AdvertisingCount: 1234,
+		Uptime:           1234500 * time.Millisecond,
+	}, frame)
+	noTemp, err := DecodeEddystone(EddystoneUUID,
+		[]byte{0x20, 0x00, 0x00, 0x00, 0x80, 0x00, 0, 0, 0, 1, 0, 0, 0, 1})
+	assert.NoError(t, err, "Unexpected error decoding TLM")
+	assert.True(t, math.IsNaN(noTemp.(*EddystoneTLM).Temperature), "Expected no temperature")
+
+	frame = decodeOne(t, "signal-PropertiesChanged-eddystone-eid")
+	assert.Equal(t, "Eddystone-EID", frame.Kind())
+	assert.Equal(t, []byte{0xa1, 0xb2, 0xc3, 0xd4, 0xe5, 0xf6, 0x07, 0x18},
+		frame.(*EddystoneEID).EID)
+
+	_, err = DecodeEddystone(EddystoneUUID, []byte{0x10, 0xe7, 0x09, 'a'})
+	assert.Error(t, err, "Expected error for an invalid URL scheme")
+}
+
+type testFrame struct {
+	data []byte
+}
+
+func (f *testFrame) Kind() string {
+	return "test"
+}
+
+func (f *testFrame) String() string {
+	return "test"
+}
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+	_, err := registry.DecodeService("feaa", []byte{0x00})
+	assert.Equal(t, ErrNoDecoder, err, "Empty registry shouldn't decode")
+
+	registry.RegisterService("180F", func(uuid string, data []byte) (Frame, error) {
+		return &testFrame{data: data}, nil
+	})
+	frame, err := registry.DecodeService("0000180f-0000-1000-8000-00805f9b34fb", []byte{0x5a})
+	assert.NoError(t, err, "Unexpected error decoding the service data")
+	assert.Equal(t, &testFrame{data: []byte{0x5a}}, frame)
+
+	registry.RegisterManufacturer(0xffff, func(id uint16, data []byte) (Frame, error) {
+		if len(data) == 0 {
+			return nil, ErrNotMatched
+		}
+		return &testFrame{data: data}, nil
+	})
+	registry.RegisterAnyManufacturer(DecodeAltBeacon)
+	mfgData, _ := advertisement(t, "signal-PropertiesChanged-altbeacon")
+	mfgData[0xffff] = []byte{0x01}
+	frames := registry.Decode(mfgData, map[string][]byte{EddystoneUUID: {0x00}})
+	assert.Len(t, frames, 2, "Expected the test and AltBeacon frames")
+	_, err = registry.DecodeManufacturer(0xffff, nil)
+	assert.Equal(t, ErrNoDecoder, err, "Expected the any company decoder to not match")
+}
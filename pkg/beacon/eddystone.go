@@ -0,0 +1,205 @@
+package beacon
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+type (
+	// EddystoneUID is the Eddystone frame with a namespace and instance
+	EddystoneUID struct {
+		// TxPower is the power at 0 meters
+		TxPower   int8
+		Namespace []byte
+		Instance  []byte
+	}
+
+	// EddystoneURL is the Eddystone frame with a compressed URL
+	EddystoneURL struct {
+		TxPower int8
+		URL     string
+	}
+
+	// EddystoneTLM is the Eddystone telemetry frame. Only the unencrypted version is
+	// decoded.
+	EddystoneTLM struct {
+		Version byte
+		// BatteryVoltage is in millivolts. 0 if the beacon isn't battery powered.
+		BatteryVoltage uint16
+		// Temperature is in Celsius. NaN if the beacon doesn't support it.
+		Temperature float64
+		// AdvertisingCount is the number of advertisements since it was powered on
+		AdvertisingCount uint32
+		// Uptime is the time since it was powered on
+		Uptime time.Duration
+	}
+
+	// EddystoneEID is the Eddystone frame with an ephemeral ID
+	EddystoneEID struct {
+		TxPower int8
+		EID     []byte
+	}
+)
+
+const (
+	eddystoneUID = 0x00
+	eddystoneURL = 0x10
+	eddystoneTLM = 0x20
+	eddystoneEID = 0x30
+
+	// The temperature is 8.8 fixed point, with this for not supported
+	tlmNoTemperature = 0x8000
+)
+
+var (
+	urlSchemes = []string{"http://www.", "https://www.", "http://", "https://"}
+	// the bytes that are expanded in the URL
+	urlExpansions = []string{".com/", ".org/", ".edu/", ".net/", ".info/", ".biz/", ".gov/",
+		".com", ".org", ".edu", ".net", ".info", ".biz", ".gov"}
+)
+
+// DecodeEddystone decodes the ServiceData for the Eddystone UUID. The first byte is the
+// frame type.
+func DecodeEddystone(uuid string, data []byte) (Frame, error) {
+	if len(data) < 1 {
+		return nil, ErrNotMatched
+	}
+	switch data[0] {
+	case eddystoneUID:
+		// The last 2 bytes are reserved, and may be left off
+		if len(data) != 18 && len(data) != 20 {
+			return nil, fmt.Errorf("Eddystone-UID is %d bytes, not 18 or 20", len(data))
+		}
+		return &EddystoneUID{
+			TxPower:   int8(data[1]),
+			Namespace: append([]byte(nil), data[2:12]...),
+			Instance:  append([]byte(nil), data[12:18]...),
+		}, nil
+	case eddystoneURL:
+		if len(data) < 3 {
+			return nil, fmt.Errorf("Eddystone-URL is %d bytes", len(data))
+		}
+		url, err := decodeURL(data[2], data[3:])
+		if err != nil {
+			return nil, err
+		}
+		return &EddystoneURL{
+			TxPower: int8(data[1]),
+			URL:     url,
+		}, nil
+	case eddystoneTLM:
+		if len(data) != 14 {
+			return nil, fmt.Errorf("Eddystone-TLM is %d bytes, not 14", len(data))
+		}
+		if data[1] != 0 {
+			return nil, fmt.Errorf("Eddystone-TLM version %d is not supported", data[1])
+		}
+		temp := math.NaN()
+		if raw := binary.BigEndian.Uint16(data[4:6]); raw != tlmNoTemperature {
+			temp = float64(int16(raw)) / 256
+		}
+		return &EddystoneTLM{
+			Version:          data[1],
+			BatteryVoltage:   binary.BigEndian.Uint16(data[2:4]),
+			Temperature:      temp,
+			AdvertisingCount: binary.BigEndian.Uint32(data[6:10]),
+			// The count is in tenths of a second
+			Uptime: time.Duration(binary.BigEndian.Uint32(data[10:14])) * 100 * time.Millisecond,
+		}, nil
+	case eddystoneEID:
+		if len(data) != 10 {
+			return nil, fmt.Errorf("Eddystone-EID is %d bytes, not 10", len(data))
+		}
+		return &EddystoneEID{
+			TxPower: int8(data[1]),
+			EID:     append([]byte(nil), data[2:10]...),
+		}, nil
+	}
+
+	return nil, ErrNotMatched
+}
+
+// eddystonePower converts the power at 0 meters to 1 meter
+func eddystonePower(txPower int8) int8 {
+	if int(txPower)-lossAt1m < math.MinInt8 {
+		return math.MinInt8
+	}
+	return txPower - lossAt1m
+}
+
+func decodeURL(scheme byte, encoded []byte) (string, error) {
+	if int(scheme) >= len(urlSchemes) {
+		return "", fmt.Errorf("Eddystone-URL scheme %d is not valid", scheme)
+	}
+	var b strings.Builder
+	b.WriteString(urlSchemes[scheme])
+	for _, c := range encoded {
+		switch {
+		case int(c) < len(urlExpansions):
+			b.WriteString(urlExpansions[c])
+		case c > 0x20 && c < 0x7f:
+			b.WriteByte(c)
+		default:
+			return "", fmt.Errorf("Eddystone-URL has invalid character 0x%02x", c)
+		}
+	}
+
+	return b.String(), nil
+}
+
+// Kind is "Eddystone-UID"
+func (f *EddystoneUID) Kind() string {
+	return "Eddystone-UID"
+}
+
+// ReferencePower is the TxPower at 1 meter
+func (f *EddystoneUID) ReferencePower() int8 {
+	return eddystonePower(f.TxPower)
+}
+
+func (f *EddystoneUID) String() string {
+	return fmt.Sprintf("Eddystone-UID %s %s power %d", hex.EncodeToString(f.Namespace),
+		hex.EncodeToString(f.Instance), f.TxPower)
+}
+
+// Kind is "Eddystone-URL"
+func (f *EddystoneURL) Kind() string {
+	return "Eddystone-URL"
+}
+
+// ReferencePower is the TxPower at 1 meter
+func (f *EddystoneURL) ReferencePower() int8 {
+	return eddystonePower(f.TxPower)
+}
+
+func (f *EddystoneURL) String() string {
+	return fmt.Sprintf("Eddystone-URL %s power %d", f.URL, f.TxPower)
+}
+
+// Kind is "Eddystone-TLM"
+func (f *EddystoneTLM) Kind() string {
+	return "Eddystone-TLM"
+}
+
+func (f *EddystoneTLM) String() string {
+	return fmt.Sprintf("Eddystone-TLM battery %dmV temperature %.2fC count %d uptime %s",
+		f.BatteryVoltage, f.Temperature, f.AdvertisingCount, f.Uptime)
+}
+
+// Kind is "Eddystone-EID"
+func (f *EddystoneEID) Kind() string {
+	return "Eddystone-EID"
+}
+
+// ReferencePower is the TxPower at 1 meter
+func (f *EddystoneEID) ReferencePower() int8 {
+	return eddystonePower(f.TxPower)
+}
+
+func (f *EddystoneEID) String() string {
+	return fmt.Sprintf("Eddystone-EID %s power %d", hex.EncodeToString(f.EID), f.TxPower)
+}
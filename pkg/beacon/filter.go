@@ -0,0 +1,91 @@
+package beacon
+
+import (
+	"math"
+)
+
+type (
+	// RSSIFilter smooths the RSSI of a beacon. Each beacon has its own filter.
+	RSSIFilter interface {
+		// Update adds the measurement, and returns the filtered value
+		Update(rssi float64) float64
+	}
+
+	// movingAverage is the average of the last window measurements
+	movingAverage struct {
+		window  []float64
+		next    int
+		count   int
+		average float64
+	}
+
+	// kalman is a one dimensional Kalman filter, where we expect the RSSI to stay the same
+	kalman struct {
+		processNoise     float64
+		measurementNoise float64
+		estimate         float64
+		// the error covariance. Negative until the first measurement.
+		covariance float64
+	}
+)
+
+const (
+	// DefaultPathLossExponent is for free space. Indoors, it's usually 2 to 4.
+	DefaultPathLossExponent = 2.0
+)
+
+// NewMovingAverage returns the filter for the average of the last window measurements
+func NewMovingAverage(window int) RSSIFilter {
+	if window < 1 {
+		window = 1
+	}
+	return &movingAverage{window: make([]float64, window)}
+}
+
+// Update adds the measurement, and returns the average
+func (m *movingAverage) Update(rssi float64) float64 {
+	m.window[m.next] = rssi
+	m.next = (m.next + 1) % len(m.window)
+	if m.count < len(m.window) {
+		m.count++
+	}
+	sum := 0.0
+	for i := 0; i < m.count; i++ {
+		sum += m.window[i]
+	}
+	m.average = sum / float64(m.count)
+
+	return m.average
+}
+
+// NewKalman returns the Kalman filter. processNoise is how much we expect the RSSI to
+// change between measurements, and measurementNoise is how noisy the measurements are.
+// Something like 0.01 and 4 works for a beacon that isn't moving.
+func NewKalman(processNoise, measurementNoise float64) RSSIFilter {
+	return &kalman{
+		processNoise:     processNoise,
+		measurementNoise: measurementNoise,
+		covariance:       -1,
+	}
+}
+
+// Update adds the measurement, and returns the estimate
+func (k *kalman) Update(rssi float64) float64 {
+	if k.covariance < 0 {
+		k.estimate = rssi
+		k.covariance = k.measurementNoise
+		return k.estimate
+	}
+	covariance := k.covariance + k.processNoise
+	gain := covariance / (covariance + k.measurementNoise)
+	k.estimate += gain * (rssi - k.estimate)
+	k.covariance = (1 - gain) * covariance
+
+	return k.estimate
+}
+
+// Distance estimates the distance in meters from the RSSI, and the RSSI at 1 meter. The
+// exponent is the path loss exponent, like DefaultPathLossExponent.
+func Distance(rssi, referencePower, exponent float64) float64 {
+	return math.Pow(10, (referencePower-rssi)/(10*exponent))
+}
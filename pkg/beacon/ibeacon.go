@@ -0,0 +1,110 @@
+package beacon
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+type (
+	// IBeacon is Apple's iBeacon
+	IBeacon struct {
+		UUID  string
+		Major uint16
+		Minor uint16
+		// MeasuredPower is the RSSI at 1 meter
+		MeasuredPower int8
+	}
+
+	// AltBeacon is the open beacon format from Radius Networks. The company ID is the
+	// manufacturer of the beacon.
+	AltBeacon struct {
+		CompanyID uint16
+		// ID is the 20 byte beacon ID. Usually, it's a 16 byte UUID, and two uint16s, like
+		// iBeacon, which are in UUID, Major and Minor.
+		ID    []byte
+		UUID  string
+		Major uint16
+		Minor uint16
+		// ReferenceRSSI is the RSSI at 1 meter
+		ReferenceRSSI int8
+		Reserved      byte
+	}
+)
+
+const (
+	// The data starts with the type and the length of the rest
+	iBeaconType   = 0x02
+	iBeaconLength = 0x15
+
+	altBeaconCode   = 0xbeac
+	altBeaconLength = 24
+)
+
+// DecodeIBeacon decodes the ManufacturerData for Apple
+func DecodeIBeacon(companyID uint16, data []byte) (Frame, error) {
+	if companyID != AppleCompanyID || len(data) < 2 ||
+		data[0] != iBeaconType || data[1] != iBeaconLength {
+		return nil, ErrNotMatched
+	}
+	if len(data) != iBeaconLength+2 {
+		return nil, fmt.Errorf("iBeacon data is %d bytes, not %d", len(data), iBeaconLength+2)
+	}
+
+	return &IBeacon{
+		UUID:          formatUUID(data[2:18]),
+		Major:         binary.BigEndian.Uint16(data[18:20]),
+		Minor:         binary.BigEndian.Uint16(data[20:22]),
+		MeasuredPower: int8(data[22]),
+	}, nil
+}
+
+// Kind is "iBeacon"
+func (b *IBeacon) Kind() string {
+	return "iBeacon"
+}
+
+// ReferencePower is the MeasuredPower
+func (b *IBeacon) ReferencePower() int8 {
+	return b.MeasuredPower
+}
+
+func (b *IBeacon) String() string {
+	return fmt.Sprintf("iBeacon %s major %d minor %d power %d", b.UUID, b.Major, b.Minor,
+		b.MeasuredPower)
+}
+
+// DecodeAltBeacon decodes the ManufacturerData for any company
+func DecodeAltBeacon(companyID uint16, data []byte) (Frame, error) {
+	if len(data) < 2 || binary.BigEndian.Uint16(data[0:2]) != altBeaconCode {
+		return nil, ErrNotMatched
+	}
+	if len(data) != altBeaconLength {
+		return nil, fmt.Errorf("AltBeacon data is %d bytes, not %d", len(data), altBeaconLength)
+	}
+
+	id := append([]byte(nil), data[2:22]...)
+	return &AltBeacon{
+		CompanyID:     companyID,
+		ID:            id,
+		UUID:          formatUUID(id[0:16]),
+		Major:         binary.BigEndian.Uint16(id[16:18]),
+		Minor:         binary.BigEndian.Uint16(id[18:20]),
+		ReferenceRSSI: int8(data[22]),
+		Reserved:      data[23],
+	}, nil
+}
+
+// Kind is "AltBeacon"
+func (b *AltBeacon) Kind() string {
+	return "AltBeacon"
+}
+
+// ReferencePower is the ReferenceRSSI
+func (b *AltBeacon) ReferencePower() int8 {
+	return b.ReferenceRSSI
+}
+
+func (b *AltBeacon) String() string {
+	return fmt.Sprintf("AltBeacon %04x %s major %d minor %d rssi %d", b.CompanyID, b.UUID,
+		b.Major, b.Minor, b.ReferenceRSSI)
+}
@@ -0,0 +1,458 @@
+package beacon
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+
+	"github.com/shigmas/bluezog/pkg/protocol"
+)
+
+type (
+	// ScanEventKind is the kind of the ScanEvent
+	ScanEventKind int
+
+	// ScanEvent is sent by the Scanner when a beacon comes or goes, or the nearest beacon
+	// changes
+	ScanEvent struct {
+		Kind ScanEventKind
+		// Beacon is the beacon that entered, exited, or is now the nearest. For
+		// NearestChanged, it's empty if there are no beacons left.
+		Beacon Beacon
+		Time   time.Time
+	}
+
+	// Beacon is what the Scanner knows about a beacon
+	Beacon struct {
+		Path    dbus.ObjectPath
+		Address string
+		Name    string
+		Frames  []Frame
+		// RSSI is the last measurement
+		RSSI int16
+		// FilteredRSSI is the RSSI from the filter
+		FilteredRSSI float64
+		// Distance is the estimate in meters. It's 0 if none of the frames have the
+		// reference power.
+		Distance  float64
+		FirstSeen time.Time
+		LastSeen  time.Time
+	}
+
+	// ScannerOption sets an option for NewScanner
+	ScannerOption func(*scannerOptions)
+
+	scannerOptions struct {
+		newFilter      func() RSSIFilter
+		exitTimeout    time.Duration
+		nearestTimeout time.Duration
+		exponent       float64
+		registry       *Registry
+	}
+
+	// Scanner tracks the beacons seen by an adapter. It uses discovery with DuplicateData,
+	// so that every advertisement updates the RSSI.
+	Scanner struct {
+		bluez   protocol.Bluez
+		adapter *protocol.Adapter
+		opts    scannerOptions
+
+		mux     sync.RWMutex
+		beacons map[dbus.ObjectPath]*trackedBeacon
+		nearest dbus.ObjectPath
+		// the beacon that is nearer than the nearest, and since when, for nearestTimeout
+		candidate      dbus.ObjectPath
+		candidateSince time.Time
+	}
+
+	trackedBeacon struct {
+		Beacon
+		filter RSSIFilter
+	}
+)
+
+const (
+	// BeaconEntered is sent when a beacon is first seen
+	BeaconEntered ScanEventKind = iota
+	// BeaconExited is sent when a beacon hasn't been seen for the exit timeout, or the
+	// device is removed
+	BeaconExited
+	// NearestChanged is sent when a different beacon is the nearest
+	NearestChanged
+
+	// DefaultExitTimeout is how long a beacon isn't seen before it exits
+	DefaultExitTimeout = 10 * time.Second
+	// DefaultNearestTimeout is how long a beacon must be the nearest before NearestChanged
+	DefaultNearestTimeout = 2 * time.Second
+	// DefaultWindow is the window of the default moving average
+	DefaultWindow = 5
+)
+
+var (
+	scanEventKindNames = map[ScanEventKind]string{
+		BeaconEntered:  "Entered",
+		BeaconExited:   "Exited",
+		NearestChanged: "NearestChanged",
+	}
+
+	// the device properties that are updated by an advertisement
+	advertisementProps = []string{
+		protocol.BluezDevice.RSSIProp,
+		protocol.BluezDevice.ManufacturerDataProp,
+		protocol.BluezDevice.ServiceDataProp,
+	}
+)
+
+func (k ScanEventKind) String() string {
+	name, ok := scanEventKindNames[k]
+	if !ok {
+		return fmt.Sprintf("ScanEventKind(%d)", int(k))
+	}
+	return name
+}
+
+// WithFilter sets the function that returns the RSSI filter for each beacon. The default is
+// a moving average of DefaultWindow measurements.
+func WithFilter(newFilter func() RSSIFilter) ScannerOption {
+	return func(o *scannerOptions) {
+		o.newFilter = newFilter
+	}
+}
+
+// WithExitTimeout sets how long a beacon isn't seen before it exits
+func WithExitTimeout(timeout time.Duration) ScannerOption {
+	return func(o *scannerOptions) {
+		o.exitTimeout = timeout
+	}
+}
+
+// WithNearestTimeout sets how long a beacon must be the nearest before NearestChanged is
+// sent, so a noisy RSSI doesn't switch back and forth. 0 sends it right away.
+func WithNearestTimeout(timeout time.Duration) ScannerOption {
+	return func(o *scannerOptions) {
+		o.nearestTimeout = timeout
+	}
+}
+
+// WithPathLossExponent sets the exponent for Distance
+func WithPathLossExponent(exponent float64) ScannerOption {
+	return func(o *scannerOptions) {
+		o.exponent = exponent
+	}
+}
+
+// WithRegistry sets the decoders. The default is the DefaultRegistry.
+func WithRegistry(registry *Registry) ScannerOption {
+	return func(o *scannerOptions) {
+		o.registry = registry
+	}
+}
+
+// NewScanner returns the Scanner for the adapter
+func NewScanner(bluez protocol.Bluez, adapter *protocol.Adapter, opts ...ScannerOption) *Scanner {
+	s := &Scanner{
+		bluez:   bluez,
+		adapter: adapter,
+		opts: scannerOptions{
+			newFilter:      func() RSSIFilter { return NewMovingAverage(DefaultWindow) },
+			exitTimeout:    DefaultExitTimeout,
+			nearestTimeout: DefaultNearestTimeout,
+			exponent:       DefaultPathLossExponent,
+			registry:       DefaultRegistry,
+		},
+		beacons: make(map[dbus.ObjectPath]*trackedBeacon),
+	}
+	for _, opt := range opts {
+		opt(&s.opts)
+	}
+
+	return s
+}
+
+// Start starts discovery, and returns the events. Discovery is stopped, and the channel is
+// closed, when the context is done.
+func (s *Scanner) Start(ctx context.Context) (<-chan ScanEvent, error) {
+	duplicates := true
+	err := s.adapter.SetDiscoveryFilter(ctx, protocol.DiscoveryFilter{
+		Transport:     protocol.TransportLE,
+		DuplicateData: &duplicates,
+	})
+	if err != nil {
+		return nil, err
+	}
+	subCtx, cancel := context.WithCancel(ctx)
+	events, err := s.bluez.Subscribe(subCtx, protocol.EventFilter{
+		Interfaces: []string{protocol.BluezInterface.Device},
+		Kinds: []protocol.EventKind{protocol.EventDeviceFound, protocol.EventDeviceLost,
+			protocol.EventPropertyChanged},
+	})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	discoveryCh, err := s.adapter.StartDiscovery()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// We use the events, but the channel still has to be read
+	go func() {
+		for range discoveryCh {
+		}
+	}()
+
+	out := make(chan ScanEvent, protocol.ChannelBufferSize)
+	go s.run(subCtx, cancel, events, out)
+
+	return out, nil
+}
+
+// Beacons returns the beacons that are being tracked, nearest first
+func (s *Scanner) Beacons() []Beacon {
+	s.mux.RLock()
+	beacons := make([]Beacon, 0, len(s.beacons))
+	for _, b := range s.beacons {
+		beacons = append(beacons, b.copy())
+	}
+	s.mux.RUnlock()
+	sort.Slice(beacons, func(i, j int) bool {
+		return nearer(&beacons[i], &beacons[j])
+	})
+
+	return beacons
+}
+
+// Nearest returns the nearest beacon, from the last NearestChanged. It's false if there
+// isn't one.
+func (s *Scanner) Nearest() (Beacon, bool) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	b, ok := s.beacons[s.nearest]
+	if !ok {
+		return Beacon{}, false
+	}
+	return b.copy(), true
+}
+
+func (s *Scanner) run(
+	ctx context.Context,
+	cancel func(),
+	events <-chan protocol.Event,
+	out chan<- ScanEvent) {
+	defer close(out)
+	defer cancel()
+	ticker := time.NewTicker(s.tickInterval())
+	defer ticker.Stop()
+	send := func(scanEvents []ScanEvent) bool {
+		for _, e := range scanEvents {
+			select {
+			case out <- e:
+			case <-ctx.Done():
+				return false
+			}
+		}
+		return true
+	}
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				s.adapter.StopDiscovery()
+				return
+			}
+			if !send(s.handleEvent(&event)) {
+				s.adapter.StopDiscovery()
+				return
+			}
+		case now := <-ticker.C:
+			if !send(s.expire(now)) {
+				s.adapter.StopDiscovery()
+				return
+			}
+		case <-ctx.Done():
+			s.adapter.StopDiscovery()
+			return
+		}
+	}
+}
+
+// tickInterval is how often we check for the beacons that exited
+func (s *Scanner) tickInterval() time.Duration {
+	interval := s.opts.exitTimeout / 4
+	if s.opts.nearestTimeout > 0 && s.opts.nearestTimeout/2 < interval {
+		interval = s.opts.nearestTimeout / 2
+	}
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+	return interval
+}
+
+// handleEvent updates the beacon for the device, and returns the events
+func (s *Scanner) handleEvent(event *protocol.Event) []ScanEvent {
+	now := time.Now()
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if event.Kind == protocol.EventDeviceLost {
+		return s.exit(event.Path, now)
+	}
+	device, ok := event.Object.(*protocol.Device)
+	if !ok {
+		return nil
+	}
+	if event.Kind == protocol.EventPropertyChanged && !containsProp(event.Property) {
+		return nil
+	}
+	rssi, ok := device.RSSI()
+	if !ok {
+		// The RSSI is invalidated when the device isn't being seen
+		return nil
+	}
+
+	var scanEvents []ScanEvent
+	tracked, ok := s.beacons[event.Path]
+	if ok {
+		if event.Kind != protocol.EventPropertyChanged ||
+			event.Property == protocol.BluezDevice.RSSIProp {
+			s.measure(tracked, rssi, now)
+		} else {
+			// bluez doesn't send the RSSI when it's steady, but the advertisement is still
+			// a sighting
+			tracked.LastSeen = now
+		}
+		tracked.Frames = s.opts.registry.DecodeDevice(device)
+	} else {
+		frames := s.opts.registry.DecodeDevice(device)
+		if len(frames) == 0 {
+			return nil
+		}
+		tracked = &trackedBeacon{
+			Beacon: Beacon{
+				Path:      event.Path,
+				Address:   device.Address(),
+				Frames:    frames,
+				FirstSeen: now,
+			},
+			filter: s.opts.newFilter(),
+		}
+		tracked.Name, _ = device.Name()
+		s.beacons[event.Path] = tracked
+		s.measure(tracked, rssi, now)
+		scanEvents = append(scanEvents, ScanEvent{Kind: BeaconEntered, Beacon: tracked.copy(), Time: now})
+	}
+
+	return append(scanEvents, s.updateNearest(now)...)
+}
+
+func containsProp(name string) bool {
+	for _, prop := range advertisementProps {
+		if prop == name {
+			return true
+		}
+	}
+	return false
+}
+
+// measure adds the RSSI, and updates the distance
+func (s *Scanner) measure(tracked *trackedBeacon, rssi int16, now time.Time) {
+	tracked.RSSI = rssi
+	tracked.FilteredRSSI = tracked.filter.Update(float64(rssi))
+	tracked.LastSeen = now
+	tracked.Distance = 0
+	for _, frame := range tracked.Frames {
+		if ranger, ok := frame.(Ranger); ok {
+			tracked.Distance = Distance(tracked.FilteredRSSI, float64(ranger.ReferencePower()),
+				s.opts.exponent)
+			break
+		}
+	}
+}
+
+// expire removes the beacons that haven't been seen for the exit timeout
+func (s *Scanner) expire(now time.Time) []ScanEvent {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	var scanEvents []ScanEvent
+	for path, tracked := range s.beacons {
+		if now.Sub(tracked.LastSeen) >= s.opts.exitTimeout {
+			scanEvents = append(scanEvents, s.exit(path, now)...)
+		}
+	}
+
+	return append(scanEvents, s.updateNearest(now)...)
+}
+
+// exit removes the beacon. The caller has the lock.
+func (s *Scanner) exit(path dbus.ObjectPath, now time.Time) []ScanEvent {
+	tracked, ok := s.beacons[path]
+	if !ok {
+		return nil
+	}
+	delete(s.beacons, path)
+	scanEvents := []ScanEvent{{Kind: BeaconExited, Beacon: tracked.copy(), Time: now}}
+	if path == s.nearest {
+		// There's no point waiting when the nearest is gone
+		s.nearest = ""
+		s.candidate = ""
+		scanEvents = append(scanEvents, s.updateNearest(now)...)
+		if s.nearest == "" {
+			scanEvents = append(scanEvents, ScanEvent{Kind: NearestChanged, Time: now})
+		}
+	}
+
+	return scanEvents
+}
+
+// updateNearest returns NearestChanged if a different beacon has been the nearest for the
+// nearest timeout. The caller has the lock.
+func (s *Scanner) updateNearest(now time.Time) []ScanEvent {
+	var nearest *trackedBeacon
+	for _, tracked := range s.beacons {
+		if nearest == nil || nearer(&tracked.Beacon, &nearest.Beacon) {
+			nearest = tracked
+		}
+	}
+	if nearest == nil || nearest.Path == s.nearest {
+		s.candidate = ""
+		return nil
+	}
+	if s.nearest != "" && s.opts.nearestTimeout > 0 {
+		if s.candidate != nearest.Path {
+			s.candidate = nearest.Path
+			s.candidateSince = now
+			return nil
+		}
+		if now.Sub(s.candidateSince) < s.opts.nearestTimeout {
+			return nil
+		}
+	}
+	s.nearest = nearest.Path
+	s.candidate = ""
+
+	return []ScanEvent{{Kind: NearestChanged, Beacon: nearest.copy(), Time: now}}
+}
+
+// nearer is true if a is nearer than b. The beacons without a distance are after the ones
+// with, by RSSI.
+func nearer(a, b *Beacon) bool {
+	switch {
+	case a.Distance > 0 && b.Distance > 0:
+		return a.Distance < b.Distance
+	case a.Distance > 0:
+		return true
+	case b.Distance > 0:
+		return false
+	}
+	return a.FilteredRSSI > b.FilteredRSSI
+}
+
+func (t *trackedBeacon) copy() Beacon {
+	b := t.Beacon
+	b.Frames = append([]Frame(nil), t.Frames...)
+	return b
+}
@@ -0,0 +1,208 @@
+package beacon
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/shigmas/bluezog/pkg/protocol"
+	"github.com/shigmas/bluezog/test/scenario"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	adapterPath   = dbus.ObjectPath("/org/bluez/hci0")
+	iBeaconPath   = dbus.ObjectPath("/org/bluez/hci0/dev_F4_B8_5E_1A_30_6C")
+	eddystonePath = dbus.ObjectPath("/org/bluez/hci0/dev_E1_9A_2B_30_11_4D")
+)
+
+func receiveScanEvent(t *testing.T, ch <-chan ScanEvent) ScanEvent {
+	select {
+	case event, ok := <-ch:
+		if !assert.True(t, ok, "Channel was closed") {
+			t.FailNow()
+		}
+		return event
+	case <-time.After(time.Second):
+		assert.FailNow(t, "Didn't receive scan event")
+	}
+	return ScanEvent{}
+}
+
+func TestFilters(t *testing.T) {
+	average := NewMovingAverage(3)
+	assert.Equal(t, -60.0, average.Update(-60))
+	assert.Equal(t, -65.0, average.Update(-70))
+	assert.Equal(t, -70.0, average.Update(-80))
+	assert.Equal(t, -80.0, average.Update(-90), "The first measurement should be dropped")
+
+	kalman := NewKalman(0.01, 4)
+	assert.Equal(t, -60.0, kalman.Update(-60), "The first measurement is the estimate")
+	for i := 0; i < 20; i++ {
+		kalman.Update(-60)
+	}
+	estimate := kalman.Update(-80)
+	assert.True(t, estimate < -60 && estimate > -65, "Estimate %f should move a little", estimate)
+
+	assert.InDelta(t, 1.0, Distance(-59, -59, DefaultPathLossExponent), 0.001)
+	assert.InDelta(t, 10.0, Distance(-79, -59, DefaultPathLossExponent), 0.001)
+	assert.InDelta(t, math.Sqrt(10), Distance(-79, -59, 4), 0.001)
+}
+
+func TestScanner(t *testing.T) {
+	ops, err := scenario.LoadScenarioOperations("../../testdata/scenario-beacons.yaml")
+	assert.NoError(t, err, "Unexpected error loading scenario")
+	defer ops.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bluez, err := protocol.InitializeBluez(ctx, ops)
+	if !assert.NoError(t, err, "Unexpected error initializing bluez") {
+		return
+	}
+	scanner := NewScanner(bluez, bluez.FindAdapters()[0],
+		WithFilter(func() RSSIFilter { return NewMovingAverage(2) }),
+		WithExitTimeout(300*time.Millisecond),
+		WithNearestTimeout(0))
+	scanCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	events, err := scanner.Start(scanCtx)
+	if !assert.NoError(t, err, "Unexpected error in Start") {
+		return
+	}
+	calls := ops.Calls(adapterPath, protocol.BluezAdapter.SetDiscoveryFilter)
+	if assert.Len(t, calls, 1) {
+		filter := calls[0].Args[0].(map[string]interface{})
+		assert.Equal(t, true, filter["DuplicateData"])
+		assert.Equal(t, "le", filter["Transport"])
+	}
+
+	assert.NoError(t, ops.Emit("ibeacon"))
+	event := receiveScanEvent(t, events)
+	assert.Equal(t, BeaconEntered, event.Kind)
+	assert.Equal(t, iBeaconPath, event.Beacon.Path)
+	assert.Equal(t, "F4:B8:5E:1A:30:6C", event.Beacon.Address)
+	assert.InDelta(t, Distance(-70, -59, DefaultPathLossExponent), event.Beacon.Distance, 0.001)
+	event = receiveScanEvent(t, events)
+	assert.Equal(t, NearestChanged, event.Kind)
+	assert.Equal(t, iBeaconPath, event.Beacon.Path)
+
+	// Neither of these are events. The RSSI is averaged.
+	assert.NoError(t, ops.Emit("ibeacon-rssi"))
+	averaged := false
+	for start := time.Now(); !averaged && time.Since(start) < time.Second; {
+		time.Sleep(5 * time.Millisecond)
+		beacons := scanner.Beacons()
+		averaged = len(beacons) == 1 && beacons[0].FilteredRSSI == -65
+	}
+	assert.True(t, averaged, "Expected the RSSI to be averaged")
+	assert.NoError(t, ops.Emit("keyboard"))
+	assert.NoError(t, ops.Emit("eddystone"))
+	event = receiveScanEvent(t, events)
+	assert.Equal(t, BeaconEntered, event.Kind)
+	assert.Equal(t, eddystonePath, event.Beacon.Path)
+	assert.Equal(t, "Eddystone", event.Beacon.Name)
+	event = receiveScanEvent(t, events)
+	assert.Equal(t, NearestChanged, event.Kind)
+	assert.Equal(t, eddystonePath, event.Beacon.Path)
+
+	beacons := scanner.Beacons()
+	if assert.Len(t, beacons, 2, "The keyboard isn't a beacon") {
+		assert.Equal(t, eddystonePath, beacons[0].Path, "Nearest should be first")
+		assert.IsType(t, &IBeacon{}, beacons[1].Frames[0])
+	}
+
+	assert.NoError(t, ops.Emit("ibeacon-gone"))
+	event = receiveScanEvent(t, events)
+	assert.Equal(t, BeaconExited, event.Kind)
+	assert.Equal(t, iBeaconPath, event.Beacon.Path)
+
+	// The Eddystone beacon isn't seen again
+	event = receiveScanEvent(t, events)
+	assert.Equal(t, BeaconExited, event.Kind)
+	assert.Equal(t, eddystonePath, event.Beacon.Path)
+	event = receiveScanEvent(t, events)
+	assert.Equal(t, NearestChanged, event.Kind)
+	assert.Empty(t, event.Beacon.Path, "There should be no nearest beacon")
+	_, ok := scanner.Nearest()
+	assert.False(t, ok)
+
+	stop()
+	for range events {
+	}
+	ops.AssertExpectations(t)
+}
+
+func TestSteadyRSSI(t *testing.T) {
+	ops, err := scenario.LoadScenarioOperations("../../testdata/scenario-beacons.yaml")
+	assert.NoError(t, err, "Unexpected error loading scenario")
+	defer ops.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bluez, err := protocol.InitializeBluez(ctx, ops)
+	if !assert.NoError(t, err, "Unexpected error initializing bluez") {
+		return
+	}
+	scanner := NewScanner(bluez, bluez.FindAdapters()[0],
+		WithExitTimeout(200*time.Millisecond),
+		WithNearestTimeout(0))
+	scanCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	events, err := scanner.Start(scanCtx)
+	if !assert.NoError(t, err, "Unexpected error in Start") {
+		return
+	}
+
+	assert.NoError(t, ops.Emit("ibeacon"))
+	assert.Equal(t, BeaconEntered, receiveScanEvent(t, events).Kind)
+	assert.Equal(t, NearestChanged, receiveScanEvent(t, events).Kind)
+
+	// The advertisements keep coming, but the RSSI doesn't change, so bluez doesn't send it
+	for i := 0; i < 6; i++ {
+		assert.NoError(t, ops.Emit("ibeacon-advertisement"))
+		select {
+		case event := <-events:
+			assert.Fail(t, "Unexpected scan event", "%s for %s", event.Kind, event.Beacon.Path)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	if beacons := scanner.Beacons(); assert.Len(t, beacons, 1, "The beacon should be seen") {
+		assert.Equal(t, iBeaconPath, beacons[0].Path)
+	}
+
+	// When they stop, it exits
+	event := receiveScanEvent(t, events)
+	assert.Equal(t, BeaconExited, event.Kind)
+	assert.Equal(t, iBeaconPath, event.Beacon.Path)
+
+	stop()
+	for range events {
+	}
+}
+
+func TestNearestTimeout(t *testing.T) {
+	scanner := NewScanner(nil, nil, WithNearestTimeout(time.Second))
+	now := time.Now()
+	scanner.beacons["/a"] = &trackedBeacon{Beacon: Beacon{Path: "/a", Distance: 2}}
+	events := scanner.updateNearest(now)
+	if assert.Len(t, events, 1, "The first beacon is the nearest right away") {
+		assert.Equal(t, dbus.ObjectPath("/a"), events[0].Beacon.Path)
+	}
+
+	scanner.beacons["/b"] = &trackedBeacon{Beacon: Beacon{Path: "/b", Distance: 1}}
+	assert.Empty(t, scanner.updateNearest(now))
+	assert.Empty(t, scanner.updateNearest(now.Add(500*time.Millisecond)))
+	events = scanner.updateNearest(now.Add(time.Second))
+	if assert.Len(t, events, 1, "Expected NearestChanged after the timeout") {
+		assert.Equal(t, dbus.ObjectPath("/b"), events[0].Beacon.Path)
+	}
+
+	// If it's not the nearest for the whole timeout, it doesn't change
+	scanner.beacons["/c"] = &trackedBeacon{Beacon: Beacon{Path: "/c", Distance: 0.5}}
+	assert.Empty(t, scanner.updateNearest(now.Add(2*time.Second)))
+	scanner.beacons["/c"].Distance = 3
+	assert.Empty(t, scanner.updateNearest(now.Add(3*time.Second)))
+	scanner.beacons["/c"].Distance = 0.5
+	assert.Empty(t, scanner.updateNearest(now.Add(3500*time.Millisecond)))
+}
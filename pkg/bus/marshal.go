@@ -0,0 +1,71 @@
+package bus
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/godbus/dbus/v5"
+
+	"github.com/shigmas/bluezog/pkg/base"
+)
+
+// The Marshal functions write the data from the bus to testdata, when base.DumpData is set.
+// The test package reads them back.
+
+func writeBytes(b []byte, prefix string) (string, error) {
+	f, err := ioutil.TempFile("./testdata", prefix)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = f.Write(b)
+	return f.Name(), err
+}
+
+// MarshalRaw writes the raw bytes and returns the file name or error
+func MarshalRaw(b []byte, prefix string) (string, error) {
+	return writeBytes(b, fmt.Sprintf("raw-%s-", prefix))
+}
+
+// MarshalIntrospect writes the introspect data and returns the file name or error
+func MarshalIntrospect(n *base.Node) (string, error) {
+	introBytes, err := json.Marshal(n)
+	if err != nil {
+		return "", err
+	}
+
+	return writeBytes(introBytes, "introspect-")
+}
+
+// MarshalManagedObjects writes the managed object data and returns the file name or error
+func MarshalManagedObjects(s map[dbus.ObjectPath]base.ObjectMap) (string, error) {
+	mged, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+
+	return writeBytes(mged, "managed-")
+}
+
+// MarshalSignal writes the signal data and returns the file name or error. For
+// PropertiesChanged, the variants are written in the dbus text format, so the types survive
+// the round trip.
+func MarshalSignal(signal *dbus.Signal) (string, error) {
+	toMarshal := *signal
+	if signal.Name == Properties+"."+PropertiesFuncs.PropertiesChanged && len(signal.Body) == 3 {
+		if changed, ok := signal.Body[1].(map[string]dbus.Variant); ok {
+			varStrings := make(map[string]string)
+			for k, v := range changed {
+				varStrings[k] = v.String()
+			}
+			toMarshal.Body = []interface{}{signal.Body[0], varStrings, signal.Body[2]}
+		}
+	}
+	sigBytes, err := json.Marshal(toMarshal)
+	if err != nil {
+		return "", err
+	}
+
+	return writeBytes(sigBytes, "signal-")
+}
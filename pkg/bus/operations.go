@@ -11,13 +11,12 @@ import (
 	"context"
 	"encoding/xml"
 	"errors"
-	"fmt"
+	"os"
 
 	"github.com/godbus/dbus/v5"
 
 	"github.com/shigmas/bluezog/pkg/base"
 	"github.com/shigmas/bluezog/pkg/logger"
-	"github.com/shigmas/bluezog/test"
 )
 
 type (
@@ -25,16 +24,45 @@ type (
 	DbusOperations struct {
 		conn *dbus.Conn
 	}
+
+	// Option changes how NewDbusOperations connects
+	Option func(*options)
+
+	options struct {
+		address string
+	}
 )
 
 var (
 	_ base.Operations = (*DbusOperations)(nil)
 )
 
-// NewDbusOperations creates a DbusOperations instance which implements Operations
-func NewDbusOperations() base.Operations {
-	conn, err := dbus.SystemBus()
+// WithBusAddress connects to the bus at the address, like
+// unix:path=/tmp/dbus-test, instead of the system bus. This is for a private bus, like
+// in the tests.
+func WithBusAddress(address string) Option {
+	return func(o *options) {
+		o.address = address
+	}
+}
+
+// NewDbusOperations creates a DbusOperations instance which implements Operations. It
+// connects to the system bus, unless an Option says otherwise.
+func NewDbusOperations(opts ...Option) base.Operations {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var conn *dbus.Conn
+	var err error
+	if o.address == "" {
+		conn, err = dbus.SystemBus()
+	} else {
+		conn, err = dialBus(o.address)
+	}
 	if err != nil {
+		logger.Error("Unable to connect to the bus: %s", err)
 		return nil
 	}
 	return &DbusOperations{
@@ -42,6 +70,25 @@ func NewDbusOperations() base.Operations {
 	}
 }
 
+// dialBus connects to a private bus, doing the authentication and Hello that SystemBus
+// does for us.
+func dialBus(address string) (*dbus.Conn, error) {
+	conn, err := dbus.Dial(address)
+	if err != nil {
+		return nil, err
+	}
+	err = conn.Auth(nil)
+	if err == nil {
+		err = conn.Hello()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
 func callWithTimeout(ctx context.Context, f func() error) error {
 	ch := make(chan error)
 
@@ -75,7 +122,7 @@ func (d *DbusOperations) IntrospectObject(dest string, objPath dbus.ObjectPath)
 		return nil, err
 	}
 	if base.DumpData {
-		_, err := test.MarshalIntrospect(&node)
+		_, err := MarshalIntrospect(&node)
 		if err != nil {
 			logger.Info("Unable to marshal introspect: %s", err)
 		}
@@ -94,6 +141,13 @@ func (d *DbusOperations) GetObjectProperty(dest string, objPath dbus.ObjectPath,
 	return val.Value(), nil
 }
 
+// SetObjectProperty for the specified object and property name. The property name is
+// interface.property, like GetObjectProperty. The value is wrapped in a variant for
+// org.freedesktop.DBus.Properties.Set.
+func (d *DbusOperations) SetObjectProperty(dest string, objPath dbus.ObjectPath, propName string, value interface{}) error {
+	return d.conn.Object(dest, objPath).SetProperty(propName, dbus.MakeVariant(value))
+}
+
 // GetManagedObjects retrieves the paths of the objects managed by this object
 func (d *DbusOperations) GetManagedObjects(dest string, objPath dbus.ObjectPath) (map[dbus.ObjectPath]base.ObjectMap, error) {
 	var s map[dbus.ObjectPath]base.ObjectMap
@@ -104,7 +158,7 @@ func (d *DbusOperations) GetManagedObjects(dest string, objPath dbus.ObjectPath)
 	}
 
 	if base.DumpData {
-		_, err := test.MarshalManagedObjects(s)
+		_, err := MarshalManagedObjects(s)
 		if err != nil {
 			logger.Info("Unable to marshal ManagedObjects: %s", err)
 		}
@@ -130,7 +184,8 @@ func (d *DbusOperations) CallFunction(
 		})
 }
 
-// CallFunctionWithArgs is simply CallFunction with arbitrary arguments
+// CallFunctionWithArgs is simply CallFunction with arbitrary arguments. retVal may be
+// nil if the function doesn't return anything.
 func (d *DbusOperations) CallFunctionWithArgs(
 	ctx context.Context,
 	retVal interface{},
@@ -139,15 +194,50 @@ func (d *DbusOperations) CallFunctionWithArgs(
 	funcName string,
 	args ...interface{}) error {
 	logger.Debug("%s: CallWithArgs parameters %s, %s", funcName, dest, string(objPath))
-	var flags dbus.Flags
-	if retVal == nil {
-		fmt.Println("retVal is nil")
-		flags = dbus.FlagNoReplyExpected
-	}
 	return callWithTimeout(ctx,
 		func() error {
-			return d.conn.Object(dest, objPath).Call(funcName, flags, args...).Store(retVal)
+			call := d.conn.Object(dest, objPath).Call(funcName, 0, args...)
+			// Without a return value, we still wait for the reply so errors are returned.
+			if retVal == nil {
+				return call.Err
+			}
+			return call.Store(retVal)
+		})
+}
+
+// Export makes the object available to other clients on the bus, like bluez calling an agent
+func (d *DbusOperations) Export(obj interface{}, path dbus.ObjectPath, iface string) error {
+	return d.conn.Export(obj, path, iface)
+}
+
+// Unexport removes an object exported through Export
+func (d *DbusOperations) Unexport(path dbus.ObjectPath, iface string) error {
+	return d.conn.Export(nil, path, iface)
+}
+
+// CallFunctionForFd calls the function, returning the file descriptor and the uint16 from
+// the reply. The connection must support passing Unix file descriptors.
+func (d *DbusOperations) CallFunctionForFd(
+	ctx context.Context,
+	dest string,
+	objPath dbus.ObjectPath,
+	funcName string,
+	args ...interface{}) (*os.File, uint16, error) {
+	logger.Debug("%s: CallForFd parameters %s, %s", funcName, dest, string(objPath))
+	if !d.conn.SupportsUnixFDs() {
+		return nil, 0, errors.New("Connection does not support passing file descriptors")
+	}
+	var fd dbus.UnixFD
+	var val uint16
+	err := callWithTimeout(ctx,
+		func() error {
+			return d.conn.Object(dest, objPath).Call(funcName, 0, args...).Store(&fd, &val)
 		})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return os.NewFile(uintptr(fd), string(objPath)), val, nil
 }
 
 // RegisterSignalChannel passes the signal to DBus
@@ -170,3 +260,21 @@ func (d *DbusOperations) UnWatch(path dbus.ObjectPath, iface string, method stri
 		dbus.WithMatchInterface(iface),
 		dbus.WithMatchMember(method))
 }
+
+// WatchNameOwner adds the match for NameOwnerChanged from the bus, for only the name
+func (d *DbusOperations) WatchNameOwner(name string) error {
+	return d.conn.AddMatchSignal(
+		dbus.WithMatchObjectPath(DBusPath),
+		dbus.WithMatchInterface(DBus),
+		dbus.WithMatchMember(DBusFuncs.NameOwnerChanged),
+		dbus.WithMatchOption("arg0", name))
+}
+
+// WatchNamespace is a simplified version of AddMatchsignal, matching the path and everything
+// under it
+func (d *DbusOperations) WatchNamespace(namespace dbus.ObjectPath, iface string, method string) error {
+	return d.conn.AddMatchSignal(
+		dbus.WithMatchPathNamespace(namespace),
+		dbus.WithMatchInterface(iface),
+		dbus.WithMatchMember(method))
+}
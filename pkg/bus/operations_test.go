@@ -4,23 +4,44 @@ import (
 	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/godbus/dbus/v5"
 
+	"github.com/shigmas/bluezog/test/scenario"
 	"github.com/stretchr/testify/assert"
 )
 
+// startFakeBluez starts the fake bluez on a private bus, and connects to it. The test is
+// skipped if there's no dbus-daemon.
+func startFakeBluez(t *testing.T, managedType string) (*scenario.FakeBluez, *DbusOperations) {
+	fake, err := scenario.StartFakeBluez(managedType)
+	if err == scenario.ErrNoDaemon {
+		t.Skip("dbus-daemon is not installed")
+	}
+	if !assert.NoError(t, err, "Unable to start the fake bluez") {
+		t.FailNow()
+	}
+	ops := NewDbusOperations(WithBusAddress(fake.Address))
+	// This is the only error that can be returned. Of course, the user doesn't have that
+	// insight into the implementation.
+	if !assert.NotNil(t, ops, "Unable to connect to the private d-bus") {
+		fake.Close()
+		t.FailNow()
+	}
+
+	return fake, ops.(*DbusOperations)
+}
+
 func TestObject(t *testing.T) {
 	badDest := "org.noservice"
 	noPath := dbus.ObjectPath("/foo/bar")
 	objDest := "org.bluez"
 	objPath := dbus.ObjectPath("/org/bluez")
-	ops := NewDbusOperations()
+	fake, ops := startFakeBluez(t, "gatt")
+	defer fake.Close()
+	defer ops.conn.Close()
 	ctx := context.Background()
-
-	// This is the only error that can be returned. Of course, the user doesn't have that
-	// insight into the implementation.
-	assert.NotNil(t, ops, "Unable to connect to system d-bus")
 	t.Run("GetObject", func(t *testing.T) {
 		t.Run("Failure", func(t *testing.T) {
 			node, err := ops.IntrospectObject(badDest, noPath)
@@ -80,10 +101,52 @@ func TestObject(t *testing.T) {
 			prop, err := ops.GetObjectProperty(objDest, adapterPath, propPath)
 			assert.NoError(t, err, "Error for service %s and path %s: err: %s",
 				objDest, objPath, err)
-			assert.NotNil(t, prop)
+			assert.Equal(t, scenario.FakeAdapterAddress, prop)
 		})
 	})
 
+	t.Run("SetObjectProperty", func(t *testing.T) {
+		adapterPath := dbus.ObjectPath("/org/bluez/hci0")
+		err := ops.SetObjectProperty(objDest, adapterPath, "org.bluez.Adapter1.Alias", "zog")
+		assert.NoError(t, err, "Unexpected error setting Alias")
+		prop, err := ops.GetObjectProperty(objDest, adapterPath, "org.bluez.Adapter1.Alias")
+		assert.NoError(t, err, "Unexpected error getting Alias")
+		assert.Equal(t, "zog", prop)
+
+		err = ops.SetObjectProperty(objDest, adapterPath, "org.bluez.Adapter1.Alias", 12)
+		assert.Error(t, err, "Expected error setting Alias to the wrong type")
+	})
+
+	t.Run("GetManagedObjects", func(t *testing.T) {
+		objs, err := ops.GetManagedObjects(objDest, RootPath)
+		assert.NoError(t, err, "Unexpected error in GetManagedObjects")
+		device, ok := objs["/org/bluez/hci0/dev_D1_40_FD_DE_C6_1C"]
+		if assert.True(t, ok, "Device missing from managed objects") {
+			assert.Equal(t, "D1:40:FD:DE:C6:1C",
+				device["org.bluez.Device1"]["Address"].Value())
+		}
+	})
+
+	t.Run("CallFunctionWithArgs", func(t *testing.T) {
+		charPath := dbus.ObjectPath("/org/bluez/hci0/dev_D1_40_FD_DE_C6_1C/service0008/char0009")
+		err := ops.CallFunctionWithArgs(ctx, nil, objDest, charPath,
+			"org.bluez.GattCharacteristic1.WriteValue", []byte{0x01, 0x02},
+			map[string]interface{}{})
+		assert.NoError(t, err, "Unexpected error in WriteValue")
+
+		var val []byte
+		err = ops.CallFunctionWithArgs(ctx, &val, objDest, charPath,
+			"org.bluez.GattCharacteristic1.ReadValue",
+			map[string]interface{}{"offset": uint16(1)})
+		assert.NoError(t, err, "Unexpected error in ReadValue")
+		assert.Equal(t, []byte{0x02}, val)
+
+		// Without the options, the signature is wrong
+		err = ops.CallFunctionWithArgs(ctx, &val, objDest, charPath,
+			"org.bluez.GattCharacteristic1.ReadValue")
+		assert.Error(t, err, "Expected error calling ReadValue without options")
+	})
+
 	t.Run("Watch", func(t *testing.T) {
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
@@ -109,3 +172,51 @@ func TestObject(t *testing.T) {
 		assert.NoError(t, err, "Unexpected Error in Watch")
 	})
 }
+
+func TestSignals(t *testing.T) {
+	fake, ops := startFakeBluez(t, "gatt")
+	defer fake.Close()
+	defer ops.conn.Close()
+	devicePath := dbus.ObjectPath("/org/bluez/hci0/dev_D1_40_FD_DE_C6_1C")
+
+	signalCh := make(chan *dbus.Signal, 10)
+	ops.RegisterSignalChannel(signalCh)
+	// receive skips the other signals, like the ones for the children of the device
+	receive := func(name string, path dbus.ObjectPath) *dbus.Signal {
+		timeout := time.After(time.Second)
+		for {
+			select {
+			case sig := <-signalCh:
+				if sig.Name != name {
+					continue
+				}
+				if sig.Path == path || (len(sig.Body) > 0 && sig.Body[0] == path) {
+					return sig
+				}
+			case <-timeout:
+				assert.Fail(t, "Didn't receive signal", name)
+				return nil
+			}
+		}
+	}
+
+	err := ops.WatchNamespace("/org/bluez", Properties, PropertiesFuncs.PropertiesChanged)
+	assert.NoError(t, err, "Unexpected error in WatchNamespace")
+	err = ops.Watch(RootPath, ObjectManager, ObjectManagerFuncs.InterfacesRemoved)
+	assert.NoError(t, err, "Unexpected error in Watch")
+
+	err = ops.CallFunction(context.Background(), "org.bluez", devicePath, "org.bluez.Device1.Connect")
+	assert.NoError(t, err, "Unexpected error in Connect")
+	sig := receive(Properties+"."+PropertiesFuncs.PropertiesChanged, devicePath)
+	if sig != nil {
+		assert.Equal(t, "org.bluez.Device1", sig.Body[0])
+	}
+
+	err = ops.CallFunctionWithArgs(context.Background(), nil, "org.bluez", "/org/bluez/hci0",
+		"org.bluez.Adapter1.RemoveDevice", devicePath)
+	assert.NoError(t, err, "Unexpected error in RemoveDevice")
+	sig = receive(ObjectManager+"."+ObjectManagerFuncs.InterfacesRemoved, devicePath)
+	if sig != nil {
+		assert.Contains(t, sig.Body[1], "org.bluez.Device1")
+	}
+}
@@ -9,6 +9,10 @@ const (
 	Introspectable = "org.freedesktop.DBus.Introspectable"
 	// RootPath is the object path of the root
 	RootPath = "/"
+	// DBus is the interface of the bus itself
+	DBus = "org.freedesktop.DBus"
+	// DBusPath is the object path of the bus itself
+	DBusPath = "/org/freedesktop/DBus"
 )
 
 type (
@@ -30,6 +34,10 @@ type (
 	introspectableFuncs struct {
 		Introspect string
 	}
+	dbusFuncs struct {
+		// Actually, a signal
+		NameOwnerChanged string
+	}
 )
 
 var (
@@ -51,4 +59,8 @@ var (
 	IntrospectableFuncs = introspectableFuncs{
 		Introspect: Introspectable + ".Introspect",
 	}
+	// DBusFuncs are the signals provided by the bus
+	DBusFuncs = dbusFuncs{
+		NameOwnerChanged: "NameOwnerChanged",
+	}
 )
@@ -0,0 +1,198 @@
+package capture
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/shigmas/bluezog/pkg/base"
+	"github.com/shigmas/bluezog/pkg/protocol"
+	"github.com/shigmas/bluezog/test"
+	"github.com/shigmas/bluezog/test/scenario"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	thermometerPath = dbus.ObjectPath("/org/bluez/hci0/dev_C4_7C_8D_6A_3F_01")
+	temperaturePath = thermometerPath + "/service0010/char0011"
+)
+
+// session is what we saw in the thermometer scenario
+type session struct {
+	connected    bool
+	pairErr      error
+	value        []byte
+	notification []byte
+}
+
+func receiveEvent(t *testing.T, ch <-chan protocol.Event) protocol.Event {
+	select {
+	case event := <-ch:
+		return event
+	case <-time.After(time.Second):
+		assert.FailNow(t, "Didn't receive event")
+	}
+	return protocol.Event{}
+}
+
+// runSession uses the thermometer from testdata/scenario-thermometer.yaml
+func runSession(t *testing.T, ops base.Operations) *session {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bluez, err := protocol.InitializeBluez(ctx, ops)
+	if !assert.NoError(t, err, "Unexpected error initializing bluez") {
+		t.FailNow()
+	}
+	deviceEvents, err := bluez.Subscribe(ctx, protocol.EventFilter{PathPrefix: thermometerPath})
+	assert.NoError(t, err, "Unexpected error in Subscribe")
+
+	s := &session{}
+	objs := bluez.FindObjects(string(thermometerPath), true)
+	if !assert.Len(t, objs, 1) {
+		t.FailNow()
+	}
+	device := objs[0].(*protocol.Device)
+	assert.NoError(t, device.Connect(ctx), "Unexpected error in Connect")
+	// The order of the events from one signal isn't fixed
+	for !s.connected {
+		s.connected = receiveEvent(t, deviceEvents).Kind == protocol.EventConnected
+	}
+	s.pairErr = device.Pair(ctx)
+
+	objs = bluez.FindObjects(string(temperaturePath), true)
+	if !assert.Len(t, objs, 1) {
+		t.FailNow()
+	}
+	characteristic := objs[0].(*protocol.GattCharacteristic)
+	s.value, err = characteristic.ReadValue(ctx, protocol.ReadOptions{})
+	assert.NoError(t, err, "Unexpected error in ReadValue")
+	notifications, err := characteristic.StartNotify(ctx)
+	assert.NoError(t, err, "Unexpected error in StartNotify")
+	select {
+	case n := <-notifications:
+		s.notification = n.Value
+	case <-time.After(time.Second):
+		assert.Fail(t, "Didn't receive notification")
+	}
+	assert.NoError(t, characteristic.StopNotify(ctx), "Unexpected error in StopNotify")
+
+	return s
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	ops, err := scenario.LoadScenarioOperations("../../testdata/scenario-thermometer.yaml")
+	assert.NoError(t, err, "Unexpected error loading scenario")
+	defer ops.Close()
+	var log bytes.Buffer
+	recorder := NewRecorder(ops, &log)
+	recorded := runSession(t, recorder)
+	assert.NoError(t, recorder.Err(), "Unexpected error writing the log")
+	assert.True(t, errors.Is(recorded.pairErr, protocol.ErrAuthenticationFailed))
+
+	// The subscriptions are still being removed in the background
+	recorder.mux.Lock()
+	data := append([]byte(nil), log.Bytes()...)
+	recorder.mux.Unlock()
+	entries, err := ReadLog(bytes.NewReader(data))
+	assert.NoError(t, err, "Unexpected error reading the log")
+	for i, entry := range entries {
+		assert.Equal(t, i+1, entry.Seq, "Entries should be in order")
+	}
+
+	replayer := NewReplayer(entries, FastForward)
+	defer replayer.Close()
+	replayed := runSession(t, replayer)
+	assert.Equal(t, recorded, replayed, "Replay should be the same as the recording")
+
+	_, err = replayer.GetObjectProperty(protocol.BluezDest, thermometerPath, "org.bluez.Device1.Name")
+	assert.Error(t, err, "Expected error for an operation that wasn't recorded")
+}
+
+func TestLogTypes(t *testing.T) {
+	var log bytes.Buffer
+	recorder := NewRecorder(test.NewBusMock("gatt"), &log)
+	recorder.record(&Entry{
+		Kind: KindSignal,
+		Path: thermometerPath,
+		Name: "org.freedesktop.DBus.Properties.PropertiesChanged",
+		Args: recordValues([]interface{}{
+			"org.bluez.Device1",
+			map[string]dbus.Variant{
+				"RSSI":             dbus.MakeVariant(int16(-60)),
+				"Name":             dbus.MakeVariant(`Sensor "0x1e"`),
+				"ManufacturerData": dbus.MakeVariant(map[uint16]dbus.Variant{76: dbus.MakeVariant([]byte{0x02, 0x15, 0x1e})}),
+			},
+			[]string{},
+		}),
+	})
+	recorder.record(&Entry{
+		Kind:  KindCall,
+		Path:  thermometerPath,
+		Name:  "org.bluez.Device1.Pair",
+		Error: newError(dbus.Error{Name: "org.bluez.Error.Failed", Body: []interface{}{"Failed"}}),
+	})
+
+	entries, err := ReadLog(&log)
+	if !assert.NoError(t, err, "Unexpected error reading the log") || !assert.Len(t, entries, 2) {
+		return
+	}
+	body, err := decodeValues(entries[0].Args)
+	assert.NoError(t, err, "Unexpected error decoding the signal")
+	changed := body[1].(map[string]dbus.Variant)
+	assert.Equal(t, int16(-60), changed["RSSI"].Value())
+	assert.Equal(t, `Sensor "0x1e"`, changed["Name"].Value(), "Strings should be unchanged")
+	assert.Equal(t, map[uint16]dbus.Variant{76: dbus.MakeVariant([]byte{0x02, 0x15, 0x1e})},
+		changed["ManufacturerData"].Value())
+	assert.Equal(t, []string{}, body[2])
+	assert.Equal(t, dbus.Error{Name: "org.bluez.Error.Failed", Body: []interface{}{"Failed"}},
+		entries[1].Error.err())
+}
+
+func TestSignalLog(t *testing.T) {
+	var log bytes.Buffer
+	signalLog := NewSignalLog(&log)
+	signalLog.Record(&dbus.Signal{
+		Sender: ":1.5",
+		Path:   "/",
+		Name:   "org.freedesktop.DBus.ObjectManager.InterfacesRemoved",
+		Body:   []interface{}{thermometerPath, []string{"org.bluez.Device1"}},
+	})
+	assert.NoError(t, signalLog.Err())
+
+	entries, err := ReadLog(&log)
+	if !assert.NoError(t, err, "Unexpected error reading the log") || !assert.Len(t, entries, 1) {
+		return
+	}
+	assert.Equal(t, KindSignal, entries[0].Kind)
+	body, err := decodeValues(entries[0].Args)
+	assert.NoError(t, err, "Unexpected error decoding the signal")
+	assert.Equal(t, []interface{}{thermometerPath, []string{"org.bluez.Device1"}}, body)
+}
+
+func TestReplayRealTime(t *testing.T) {
+	now := time.Now()
+	entries := []Entry{
+		{Seq: 1, Time: now, Kind: KindWatch, Path: "/", Name: "InterfacesAdded"},
+		{Seq: 2, Time: now.Add(50 * time.Millisecond), Kind: KindSignal, Path: "/",
+			Name: "org.freedesktop.DBus.ObjectManager.InterfacesRemoved",
+			Args: []string{`@o "/org/bluez/hci0/dev_C4_7C_8D_6A_3F_01"`, `["org.bluez.Device1"]`}},
+	}
+	start := time.Now()
+	replayer := NewReplayer(entries, RealTime)
+	signals := make(chan *dbus.Signal, 1)
+	replayer.RegisterSignalChannel(signals)
+	select {
+	case sig := <-signals:
+		assert.True(t, time.Since(start) >= 50*time.Millisecond, "Signal was sent too soon")
+		assert.Equal(t, thermometerPath, sig.Body[0])
+		assert.Equal(t, []string{"org.bluez.Device1"}, sig.Body[1])
+	case <-time.After(time.Second):
+		assert.Fail(t, "Didn't receive signal")
+	}
+	replayer.Close()
+	_, ok := <-signals
+	assert.False(t, ok, "Close should close the signal channel")
+}
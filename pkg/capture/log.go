@@ -0,0 +1,265 @@
+package capture
+
+// The session log is JSON lines, one Entry per line, in the order they happened. The values
+// are written in the dbus text format (the same as dbus.Variant.String()), so the types
+// survive the round trip. e.g. a []byte is "@ay [1, 2]", and an ObjectPath is
+// "@o \"/org/bluez/hci0\"".
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+
+	"github.com/shigmas/bluezog/pkg/base"
+)
+
+type (
+	// Kind is the operation of an Entry
+	Kind string
+
+	// Entry is one operation in the session log
+	Entry struct {
+		// Seq is the order of the entry in the session
+		Seq int `json:"seq"`
+		// Time is when the operation finished, or the signal was received
+		Time time.Time       `json:"time"`
+		Kind Kind            `json:"kind"`
+		Dest string          `json:"dest,omitempty"`
+		Path dbus.ObjectPath `json:"path,omitempty"`
+		// Name is the function, property or signal name
+		Name string `json:"name,omitempty"`
+		// Interface is for the watches and exports
+		Interface string `json:"interface,omitempty"`
+		// Sender of the signal
+		Sender string `json:"sender,omitempty"`
+		// Args are the arguments of the call, or the body of the signal
+		Args []string `json:"args,omitempty"`
+		// Reply is the return values
+		Reply []string `json:"reply,omitempty"`
+		// Node is the reply to IntrospectObject
+		Node *base.Node `json:"node,omitempty"`
+		// Error is set if the operation failed
+		Error *Error `json:"error,omitempty"`
+	}
+
+	// Error is an error returned from an operation. D-Bus errors have the Name and Body.
+	// Other errors only have the Message.
+	Error struct {
+		Name    string   `json:"name,omitempty"`
+		Body    []string `json:"body,omitempty"`
+		Message string   `json:"message,omitempty"`
+	}
+)
+
+const (
+	// KindIntrospect is IntrospectObject
+	KindIntrospect Kind = "introspect"
+	// KindGetProperty is GetObjectProperty
+	KindGetProperty Kind = "get"
+	// KindSetProperty is SetObjectProperty
+	KindSetProperty Kind = "set"
+	// KindManagedObjects is GetManagedObjects
+	KindManagedObjects Kind = "managed"
+	// KindCall is CallFunction and CallFunctionWithArgs
+	KindCall Kind = "call"
+	// KindCallForFd is CallFunctionForFd. Only the uint16 from the reply is recorded.
+	KindCallForFd Kind = "fd"
+	// KindExport is Export. The object isn't recorded.
+	KindExport Kind = "export"
+	// KindUnexport is Unexport
+	KindUnexport Kind = "unexport"
+	// KindWatch is Watch
+	KindWatch Kind = "watch"
+	// KindUnWatch is UnWatch
+	KindUnWatch Kind = "unwatch"
+	// KindWatchNamespace is WatchNamespace
+	KindWatchNamespace Kind = "watch-namespace"
+	// KindWatchNameOwner is WatchNameOwner
+	KindWatchNameOwner Kind = "watch-name-owner"
+	// KindSignal is a signal received from the bus
+	KindSignal Kind = "signal"
+)
+
+// ReadLog reads the entries written by a Recorder
+func ReadLog(r io.Reader) ([]Entry, error) {
+	entries := make([]Entry, 0)
+	scanner := bufio.NewScanner(r)
+	// The managed objects can be a long line
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry Entry
+		err := json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			return nil, fmt.Errorf("Line %d: %s", line, err)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, scanner.Err()
+}
+
+// LoadLog reads the entries from the file
+func LoadLog(fname string) ([]Entry, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadLog(f)
+}
+
+// encodeValue writes the value in the dbus text format. The a{sv} arguments are usually
+// map[string]interface{}, which godbus sends as variants, so we do the same.
+func encodeValue(value interface{}) (str string, err error) {
+	if m, ok := value.(map[string]interface{}); ok {
+		variants := make(map[string]dbus.Variant, len(m))
+		for k, v := range m {
+			variants[k] = dbus.MakeVariant(v)
+		}
+		value = variants
+	}
+	defer func() {
+		// MakeVariant panics on the types that dbus can't send
+		if r := recover(); r != nil {
+			err = fmt.Errorf("Unable to encode %T: %v", value, r)
+		}
+	}()
+
+	return decimalBytes(dbus.MakeVariant(value).String()), nil
+}
+
+// decimalBytes rewrites the hex bytes, like 0x1e, as decimal. godbus can't parse the hex
+// that ends in e in an array, since it looks like a float.
+func decimalBytes(str string) string {
+	var b strings.Builder
+	quoted := false
+	for i := 0; i < len(str); i++ {
+		c := str[i]
+		switch {
+		case quoted && c == '\\' && i+1 < len(str):
+			b.WriteByte(c)
+			i++
+			c = str[i]
+		case c == '"':
+			quoted = !quoted
+		case !quoted && strings.HasPrefix(str[i:], "0x") && (i == 0 || !isHexDigit(str[i-1])):
+			end := i + 2
+			for end < len(str) && isHexDigit(str[end]) {
+				end++
+			}
+			if n, err := strconv.ParseUint(str[i+2:end], 16, 64); err == nil {
+				b.WriteString(strconv.FormatUint(n, 10))
+				i = end - 1
+				continue
+			}
+		}
+		b.WriteByte(c)
+	}
+
+	return b.String()
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func encodeValues(values []interface{}) ([]string, error) {
+	strs := make([]string, len(values))
+	for i, v := range values {
+		str, err := encodeValue(v)
+		if err != nil {
+			return nil, err
+		}
+		strs[i] = str
+	}
+
+	return strs, nil
+}
+
+func decodeValue(str string) (interface{}, error) {
+	variant, err := dbus.ParseVariant(str, dbus.Signature{})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to decode %s: %s", str, err)
+	}
+
+	return variant.Value(), nil
+}
+
+func decodeValues(strs []string) ([]interface{}, error) {
+	values := make([]interface{}, len(strs))
+	for i, s := range strs {
+		v, err := decodeValue(s)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+
+	return values, nil
+}
+
+// newError converts the error for the log. nil stays nil.
+func newError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+	var dbusErr dbus.Error
+	switch e := err.(type) {
+	case dbus.Error:
+		dbusErr = e
+	case *dbus.Error:
+		dbusErr = *e
+	default:
+		return &Error{Message: err.Error()}
+	}
+	body, encErr := encodeValues(dbusErr.Body)
+	if encErr != nil {
+		return &Error{Name: dbusErr.Name, Message: dbusErr.Error()}
+	}
+
+	return &Error{Name: dbusErr.Name, Body: body}
+}
+
+// err converts the logged error back, to a dbus.Error if it was one
+func (e *Error) err() error {
+	if e == nil {
+		return nil
+	}
+	if e.Name == "" {
+		return errors.New(e.Message)
+	}
+	body, err := decodeValues(e.Body)
+	if err != nil {
+		body = []interface{}{e.Message}
+	}
+
+	return dbus.Error{Name: e.Name, Body: body}
+}
+
+// storeReply stores the decoded reply in the pointer, like dbus.Call.Store
+func storeReply(reply []string, retVal interface{}) error {
+	if retVal == nil || len(reply) == 0 {
+		return nil
+	}
+	values, err := decodeValues(reply)
+	if err != nil {
+		return err
+	}
+	if len(values) != 1 {
+		return fmt.Errorf("Recorded reply has %d values", len(values))
+	}
+
+	return dbus.Store(values, retVal)
+}
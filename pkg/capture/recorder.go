@@ -0,0 +1,316 @@
+package capture
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+
+	"github.com/shigmas/bluezog/pkg/base"
+	"github.com/shigmas/bluezog/pkg/logger"
+)
+
+type (
+	// Recorder wraps the Operations, and writes every operation and signal to the session
+	// log. It can wrap the real bus, or any of the mocks.
+	Recorder struct {
+		ops base.Operations
+		mux sync.Mutex
+		enc *json.Encoder
+		seq int
+		// the first error writing the log
+		err error
+
+		sigMux sync.Mutex
+		// the channel we register with ops, and the channels registered with us
+		signalCh  chan *dbus.Signal
+		listeners []chan<- *dbus.Signal
+	}
+)
+
+var (
+	_ base.Operations = (*Recorder)(nil)
+)
+
+// SignalLog writes only signals to the session log, for tools that watch the bus without
+// calling it, like zogctl monitor. ReadLog reads it like any other session log.
+type SignalLog struct {
+	rec *Recorder
+}
+
+// NewSignalLog returns the SignalLog that writes to the writer
+func NewSignalLog(w io.Writer) *SignalLog {
+	return &SignalLog{rec: NewRecorder(nil, w)}
+}
+
+// Record writes the signal
+func (l *SignalLog) Record(sig *dbus.Signal) {
+	l.rec.record(newSignalEntry(sig))
+}
+
+// Err returns the first error writing the log, if any
+func (l *SignalLog) Err() error {
+	return l.rec.Err()
+}
+
+// NewRecorder returns the Operations that records to the writer
+func NewRecorder(ops base.Operations, w io.Writer) *Recorder {
+	return &Recorder{
+		ops: ops,
+		enc: json.NewEncoder(w),
+	}
+}
+
+// Err returns the first error writing the log, if any
+func (r *Recorder) Err() error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return r.err
+}
+
+// record writes the entry, in the order of the calls
+func (r *Recorder) record(entry *Entry) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.seq++
+	entry.Seq = r.seq
+	entry.Time = time.Now()
+	err := r.enc.Encode(entry)
+	if err != nil && r.err == nil {
+		logger.Error("Unable to write session log: %s", err)
+		r.err = err
+	}
+}
+
+// recordValues encodes the values for the log. If it can't, we still record the operation.
+func recordValues(values []interface{}) []string {
+	strs, err := encodeValues(values)
+	if err != nil {
+		logger.Error("Unable to record values: %s", err)
+	}
+	return strs
+}
+
+// IntrospectObject records the node
+func (r *Recorder) IntrospectObject(dest string, objPath dbus.ObjectPath) (*base.Node, error) {
+	node, err := r.ops.IntrospectObject(dest, objPath)
+	r.record(&Entry{
+		Kind:  KindIntrospect,
+		Dest:  dest,
+		Path:  objPath,
+		Node:  node,
+		Error: newError(err),
+	})
+	return node, err
+}
+
+// GetObjectProperty records the value
+func (r *Recorder) GetObjectProperty(dest string, objPath dbus.ObjectPath, propName string) (interface{}, error) {
+	val, err := r.ops.GetObjectProperty(dest, objPath, propName)
+	entry := &Entry{
+		Kind:  KindGetProperty,
+		Dest:  dest,
+		Path:  objPath,
+		Name:  propName,
+		Error: newError(err),
+	}
+	if err == nil && val != nil {
+		entry.Reply = recordValues([]interface{}{val})
+	}
+	r.record(entry)
+	return val, err
+}
+
+// SetObjectProperty records the value
+func (r *Recorder) SetObjectProperty(dest string, objPath dbus.ObjectPath, propName string, value interface{}) error {
+	err := r.ops.SetObjectProperty(dest, objPath, propName, value)
+	r.record(&Entry{
+		Kind:  KindSetProperty,
+		Dest:  dest,
+		Path:  objPath,
+		Name:  propName,
+		Args:  recordValues([]interface{}{value}),
+		Error: newError(err),
+	})
+	return err
+}
+
+// GetManagedObjects records the objects
+func (r *Recorder) GetManagedObjects(dest string, objPath dbus.ObjectPath) (map[dbus.ObjectPath]base.ObjectMap, error) {
+	objs, err := r.ops.GetManagedObjects(dest, objPath)
+	entry := &Entry{
+		Kind:  KindManagedObjects,
+		Dest:  dest,
+		Path:  objPath,
+		Error: newError(err),
+	}
+	if err == nil {
+		// ObjectMap is a named type, which would change the signature
+		plain := make(map[dbus.ObjectPath]map[string]map[string]dbus.Variant, len(objs))
+		for path, ifaceMap := range objs {
+			plain[path] = ifaceMap
+		}
+		entry.Reply = recordValues([]interface{}{plain})
+	}
+	r.record(entry)
+	return objs, err
+}
+
+// CallFunction records the call
+func (r *Recorder) CallFunction(
+	ctx context.Context,
+	dest string,
+	objPath dbus.ObjectPath,
+	funcName string) error {
+	err := r.ops.CallFunction(ctx, dest, objPath, funcName)
+	r.record(&Entry{
+		Kind:  KindCall,
+		Dest:  dest,
+		Path:  objPath,
+		Name:  funcName,
+		Error: newError(err),
+	})
+	return err
+}
+
+// CallFunctionWithArgs records the call and the reply
+func (r *Recorder) CallFunctionWithArgs(
+	ctx context.Context,
+	retVal interface{},
+	dest string,
+	objPath dbus.ObjectPath,
+	funcName string,
+	args ...interface{}) error {
+	err := r.ops.CallFunctionWithArgs(ctx, retVal, dest, objPath, funcName, args...)
+	entry := &Entry{
+		Kind:  KindCall,
+		Dest:  dest,
+		Path:  objPath,
+		Name:  funcName,
+		Args:  recordValues(args),
+		Error: newError(err),
+	}
+	if err == nil && retVal != nil {
+		entry.Reply = recordValues([]interface{}{reflect.ValueOf(retVal).Elem().Interface()})
+	}
+	r.record(entry)
+	return err
+}
+
+// CallFunctionForFd records the call and the uint16. The file descriptor can't be recorded.
+func (r *Recorder) CallFunctionForFd(
+	ctx context.Context,
+	dest string,
+	objPath dbus.ObjectPath,
+	funcName string,
+	args ...interface{}) (*os.File, uint16, error) {
+	f, val, err := r.ops.CallFunctionForFd(ctx, dest, objPath, funcName, args...)
+	entry := &Entry{
+		Kind:  KindCallForFd,
+		Dest:  dest,
+		Path:  objPath,
+		Name:  funcName,
+		Args:  recordValues(args),
+		Error: newError(err),
+	}
+	if err == nil {
+		entry.Reply = recordValues([]interface{}{val})
+	}
+	r.record(entry)
+	return f, val, err
+}
+
+// Export records the path and interface
+func (r *Recorder) Export(obj interface{}, path dbus.ObjectPath, iface string) error {
+	err := r.ops.Export(obj, path, iface)
+	r.record(&Entry{Kind: KindExport, Path: path, Interface: iface, Error: newError(err)})
+	return err
+}
+
+// Unexport records the path and interface
+func (r *Recorder) Unexport(path dbus.ObjectPath, iface string) error {
+	err := r.ops.Unexport(path, iface)
+	r.record(&Entry{Kind: KindUnexport, Path: path, Interface: iface, Error: newError(err)})
+	return err
+}
+
+// RegisterSignalChannel records the signals before passing them to the channel
+func (r *Recorder) RegisterSignalChannel(ch chan<- *dbus.Signal) {
+	r.sigMux.Lock()
+	defer r.sigMux.Unlock()
+	r.listeners = append(r.listeners, ch)
+	if r.signalCh != nil {
+		return
+	}
+	r.signalCh = make(chan *dbus.Signal, 10)
+	r.ops.RegisterSignalChannel(r.signalCh)
+	go r.handleSignals()
+}
+
+func (r *Recorder) handleSignals() {
+	for sig := range r.signalCh {
+		r.record(newSignalEntry(sig))
+		r.sigMux.Lock()
+		listeners := r.listeners
+		r.sigMux.Unlock()
+		for _, ch := range listeners {
+			ch <- sig
+		}
+	}
+	// Like the connection, close the channels when the signals stop
+	r.sigMux.Lock()
+	for _, ch := range r.listeners {
+		close(ch)
+	}
+	r.listeners = nil
+	r.sigMux.Unlock()
+}
+
+func newSignalEntry(sig *dbus.Signal) *Entry {
+	return &Entry{
+		Kind:   KindSignal,
+		Sender: sig.Sender,
+		Path:   sig.Path,
+		Name:   sig.Name,
+		Args:   recordValues(sig.Body),
+	}
+}
+
+// Watch records the match rule
+func (r *Recorder) Watch(path dbus.ObjectPath, iface string, method string) error {
+	err := r.ops.Watch(path, iface, method)
+	r.record(&Entry{Kind: KindWatch, Path: path, Interface: iface, Name: method, Error: newError(err)})
+	return err
+}
+
+// UnWatch records the match rule
+func (r *Recorder) UnWatch(path dbus.ObjectPath, iface string, method string) error {
+	err := r.ops.UnWatch(path, iface, method)
+	r.record(&Entry{Kind: KindUnWatch, Path: path, Interface: iface, Name: method, Error: newError(err)})
+	return err
+}
+
+// WatchNamespace records the match rule
+func (r *Recorder) WatchNamespace(namespace dbus.ObjectPath, iface string, method string) error {
+	err := r.ops.WatchNamespace(namespace, iface, method)
+	r.record(&Entry{
+		Kind:      KindWatchNamespace,
+		Path:      namespace,
+		Interface: iface,
+		Name:      method,
+		Error:     newError(err),
+	})
+	return err
+}
+
+// WatchNameOwner records the name
+func (r *Recorder) WatchNameOwner(name string) error {
+	err := r.ops.WatchNameOwner(name)
+	r.record(&Entry{Kind: KindWatchNameOwner, Name: name, Error: newError(err)})
+	return err
+}
@@ -0,0 +1,377 @@
+package capture
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+
+	"github.com/shigmas/bluezog/pkg/base"
+)
+
+type (
+	// Timing is how the Replayer sends the signals
+	Timing int
+
+	// Replayer implements Operations from a session log. Each operation returns the reply
+	// of the next entry in the log with the same kind, path and name. The match rules and
+	// exports are accepted even if they weren't recorded.
+	Replayer struct {
+		timing  Timing
+		entries []Entry
+		mux     sync.Mutex
+		// signalled when an entry is used, or we're closed
+		cond   *sync.Cond
+		used   []bool
+		closed bool
+		start  time.Time
+
+		sigMux    sync.Mutex
+		listeners []chan<- *dbus.Signal
+		sending   sync.WaitGroup
+		done      chan struct{}
+		// our end of the sockets returned from CallFunctionForFd, keyed by path
+		peers map[dbus.ObjectPath]*os.File
+	}
+)
+
+const (
+	// RealTime sends each signal at the same time after the start of the replay as it was
+	// received after the start of the recording.
+	RealTime Timing = iota
+	// FastForward sends each signal as soon as the calls before it in the log have been
+	// replayed. If the calls aren't made, the signals after them are never sent.
+	FastForward
+)
+
+var (
+	_ base.Operations = (*Replayer)(nil)
+)
+
+// NewReplayer returns the Operations that replay the entries
+func NewReplayer(entries []Entry, timing Timing) *Replayer {
+	r := &Replayer{
+		timing:  timing,
+		entries: entries,
+		used:    make([]bool, len(entries)),
+		start:   time.Now(),
+		done:    make(chan struct{}),
+		peers:   make(map[dbus.ObjectPath]*os.File),
+	}
+	r.cond = sync.NewCond(&r.mux)
+	return r
+}
+
+// LoadReplayer reads the session log from the file, and returns the Replayer for it
+func LoadReplayer(fname string, timing Timing) (*Replayer, error) {
+	entries, err := LoadLog(fname)
+	if err != nil {
+		return nil, err
+	}
+	return NewReplayer(entries, timing), nil
+}
+
+// Close stops sending signals, and closes the channels, like closing the connection
+func (r *Replayer) Close() {
+	r.mux.Lock()
+	if r.closed {
+		r.mux.Unlock()
+		return
+	}
+	r.closed = true
+	close(r.done)
+	r.cond.Broadcast()
+	r.mux.Unlock()
+	r.sending.Wait()
+
+	r.sigMux.Lock()
+	for _, ch := range r.listeners {
+		close(ch)
+	}
+	r.listeners = nil
+	for _, peer := range r.peers {
+		peer.Close()
+	}
+	r.sigMux.Unlock()
+}
+
+// Peer returns our end of the socket returned by CallFunctionForFd for the path
+func (r *Replayer) Peer(objPath dbus.ObjectPath) (*os.File, error) {
+	r.sigMux.Lock()
+	defer r.sigMux.Unlock()
+	peer, ok := r.peers[objPath]
+	if !ok {
+		return nil, fmt.Errorf("No socket for %s", objPath)
+	}
+	return peer, nil
+}
+
+// next finds the first unused entry that matches, and marks it used
+func (r *Replayer) next(kind Kind, objPath dbus.ObjectPath, name string) (*Entry, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	for i := range r.entries {
+		entry := &r.entries[i]
+		if r.used[i] || entry.Kind != kind || entry.Path != objPath || entry.Name != name {
+			continue
+		}
+		r.used[i] = true
+		r.cond.Broadcast()
+		return entry, nil
+	}
+
+	return nil, fmt.Errorf("No recorded %s for %s %s", kind, objPath, name)
+}
+
+// nextError is for the operations that only return an error. If there's no entry, it
+// succeeds.
+func (r *Replayer) nextError(kind Kind, objPath dbus.ObjectPath, name string) error {
+	entry, err := r.next(kind, objPath, name)
+	if err != nil {
+		return nil
+	}
+	return entry.Error.err()
+}
+
+// IntrospectObject returns the recorded node
+func (r *Replayer) IntrospectObject(dest string, objPath dbus.ObjectPath) (*base.Node, error) {
+	entry, err := r.next(KindIntrospect, objPath, "")
+	if err != nil {
+		return nil, err
+	}
+	return entry.Node, entry.Error.err()
+}
+
+// GetObjectProperty returns the recorded value
+func (r *Replayer) GetObjectProperty(dest string, objPath dbus.ObjectPath, propName string) (interface{}, error) {
+	entry, err := r.next(KindGetProperty, objPath, propName)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Error != nil || len(entry.Reply) == 0 {
+		return nil, entry.Error.err()
+	}
+	return decodeValue(entry.Reply[0])
+}
+
+// SetObjectProperty returns the recorded error
+func (r *Replayer) SetObjectProperty(dest string, objPath dbus.ObjectPath, propName string, value interface{}) error {
+	entry, err := r.next(KindSetProperty, objPath, propName)
+	if err != nil {
+		return err
+	}
+	return entry.Error.err()
+}
+
+// GetManagedObjects returns the recorded objects
+func (r *Replayer) GetManagedObjects(dest string, objPath dbus.ObjectPath) (map[dbus.ObjectPath]base.ObjectMap, error) {
+	entry, err := r.next(KindManagedObjects, objPath, "")
+	if err != nil {
+		return nil, err
+	}
+	if entry.Error != nil {
+		return nil, entry.Error.err()
+	}
+	if len(entry.Reply) != 1 {
+		return nil, fmt.Errorf("Recorded managed objects have %d values", len(entry.Reply))
+	}
+	value, err := decodeValue(entry.Reply[0])
+	if err != nil {
+		return nil, err
+	}
+	plain, ok := value.(map[dbus.ObjectPath]map[string]map[string]dbus.Variant)
+	if !ok {
+		return nil, fmt.Errorf("Recorded managed objects are %T", value)
+	}
+	objs := make(map[dbus.ObjectPath]base.ObjectMap, len(plain))
+	for path, ifaceMap := range plain {
+		objs[path] = ifaceMap
+	}
+
+	return objs, nil
+}
+
+// CallFunction returns the recorded error
+func (r *Replayer) CallFunction(
+	ctx context.Context,
+	dest string,
+	objPath dbus.ObjectPath,
+	funcName string) error {
+	entry, err := r.next(KindCall, objPath, funcName)
+	if err != nil {
+		return err
+	}
+	return entry.Error.err()
+}
+
+// CallFunctionWithArgs stores the recorded reply in retVal
+func (r *Replayer) CallFunctionWithArgs(
+	ctx context.Context,
+	retVal interface{},
+	dest string,
+	objPath dbus.ObjectPath,
+	funcName string,
+	args ...interface{}) error {
+	entry, err := r.next(KindCall, objPath, funcName)
+	if err != nil {
+		return err
+	}
+	if entry.Error != nil {
+		return entry.Error.err()
+	}
+	return storeReply(entry.Reply, retVal)
+}
+
+// CallFunctionForFd returns one end of a new socket, with the recorded uint16. The other
+// end is from Peer.
+func (r *Replayer) CallFunctionForFd(
+	ctx context.Context,
+	dest string,
+	objPath dbus.ObjectPath,
+	funcName string,
+	args ...interface{}) (*os.File, uint16, error) {
+	entry, err := r.next(KindCallForFd, objPath, funcName)
+	if err != nil {
+		return nil, 0, err
+	}
+	if entry.Error != nil {
+		return nil, 0, entry.Error.err()
+	}
+	var val uint16
+	err = storeReply(entry.Reply, &val)
+	if err != nil {
+		return nil, 0, err
+	}
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_SEQPACKET, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+	r.sigMux.Lock()
+	if old, ok := r.peers[objPath]; ok {
+		old.Close()
+	}
+	r.peers[objPath] = os.NewFile(uintptr(fds[1]), string(objPath)+"-peer")
+	r.sigMux.Unlock()
+
+	return os.NewFile(uintptr(fds[0]), string(objPath)), val, nil
+}
+
+// Export returns the recorded error
+func (r *Replayer) Export(obj interface{}, path dbus.ObjectPath, iface string) error {
+	return r.nextError(KindExport, path, "")
+}
+
+// Unexport returns the recorded error
+func (r *Replayer) Unexport(path dbus.ObjectPath, iface string) error {
+	return r.nextError(KindUnexport, path, "")
+}
+
+// RegisterSignalChannel sends the recorded signals to the channel. The signals start when
+// the first channel is registered.
+func (r *Replayer) RegisterSignalChannel(ch chan<- *dbus.Signal) {
+	r.sigMux.Lock()
+	defer r.sigMux.Unlock()
+	r.listeners = append(r.listeners, ch)
+	if len(r.listeners) == 1 {
+		r.sending.Add(1)
+		go r.sendSignals()
+	}
+}
+
+func (r *Replayer) sendSignals() {
+	defer r.sending.Done()
+	first := time.Time{}
+	if len(r.entries) > 0 {
+		first = r.entries[0].Time
+	}
+	for i := range r.entries {
+		entry := &r.entries[i]
+		if entry.Kind != KindSignal {
+			continue
+		}
+		if !r.waitFor(i, entry.Time.Sub(first)) {
+			return
+		}
+		body, err := decodeValues(entry.Args)
+		if err != nil {
+			continue
+		}
+		sig := &dbus.Signal{
+			Sender: entry.Sender,
+			Path:   entry.Path,
+			Name:   entry.Name,
+			Body:   body,
+		}
+		r.sigMux.Lock()
+		listeners := r.listeners
+		r.sigMux.Unlock()
+		for _, ch := range listeners {
+			select {
+			case ch <- sig:
+			case <-r.done:
+				return
+			}
+		}
+	}
+}
+
+// waitFor waits until it's time to send the signal at index. It returns false if we were
+// closed.
+func (r *Replayer) waitFor(index int, offset time.Duration) bool {
+	if r.timing == RealTime {
+		select {
+		case <-time.After(time.Until(r.start.Add(offset))):
+			return true
+		case <-r.done:
+			return false
+		}
+	}
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	for !r.closed && !r.replayedBefore(index) {
+		r.cond.Wait()
+	}
+	return !r.closed
+}
+
+// replayedBefore is true if the calls before the index have been replayed. The match rules
+// and exports don't have to be.
+func (r *Replayer) replayedBefore(index int) bool {
+	for i := 0; i < index; i++ {
+		if r.used[i] {
+			continue
+		}
+		switch r.entries[i].Kind {
+		case KindSignal, KindExport, KindUnexport, KindWatch, KindUnWatch, KindWatchNamespace,
+			KindWatchNameOwner:
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// Watch returns the recorded error
+func (r *Replayer) Watch(path dbus.ObjectPath, iface string, method string) error {
+	return r.nextError(KindWatch, path, method)
+}
+
+// UnWatch returns the recorded error
+func (r *Replayer) UnWatch(path dbus.ObjectPath, iface string, method string) error {
+	return r.nextError(KindUnWatch, path, method)
+}
+
+// WatchNamespace returns the recorded error
+func (r *Replayer) WatchNamespace(namespace dbus.ObjectPath, iface string, method string) error {
+	return r.nextError(KindWatchNamespace, namespace, method)
+}
+
+// WatchNameOwner returns the recorded error
+func (r *Replayer) WatchNameOwner(name string) error {
+	return r.nextError(KindWatchNameOwner, "", name)
+}
@@ -2,6 +2,7 @@ package logger
 
 import (
 	"fmt"
+	"os"
 	//"log"
 )
 
@@ -23,8 +24,9 @@ var (
 func logPrint(level LogLevel, format string, values ...interface{}) {
 	if level <= logLevel {
 		//log.Printf(format, values)
-		fmt.Printf(format, values...)
-		fmt.Println()
+		// stderr, so the output of the commands can be piped
+		fmt.Fprintf(os.Stderr, format, values...)
+		fmt.Fprintln(os.Stderr)
 	}
 }
 
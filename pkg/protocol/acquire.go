@@ -0,0 +1,162 @@
+package protocol
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+type (
+	// AcquiredSocket is the socket from AcquireNotify or AcquireWrite. bluez sends each
+	// notification as a packet, so each Read returns one notification, and each Write
+	// sends one value. Close releases the socket, which also tells bluez we're done.
+	AcquiredSocket struct {
+		file *os.File
+		// MTU is the maximum size of a packet
+		MTU uint16
+	}
+
+	// notifyReader is the io.ReadCloser for characteristics that don't support
+	// AcquireNotify. It reads the notifications from StartNotify.
+	notifyReader struct {
+		gc            *GattCharacteristic
+		notifications <-chan Notification
+		closeOnce     sync.Once
+	}
+
+	// commandWriter is the io.WriteCloser for characteristics that don't support
+	// AcquireWrite. Each Write is a WriteValue without response.
+	commandWriter struct {
+		ctx context.Context
+		gc  *GattCharacteristic
+	}
+)
+
+var (
+	_ io.ReadWriteCloser = (*AcquiredSocket)(nil)
+	_ io.ReadCloser      = (*notifyReader)(nil)
+	_ io.WriteCloser     = (*commandWriter)(nil)
+)
+
+// Read reads one packet. If p is smaller than the packet, the rest of the packet is lost,
+// so p should be at least MTU bytes.
+func (s *AcquiredSocket) Read(p []byte) (int, error) {
+	if len(p) < int(s.MTU) {
+		return 0, io.ErrShortBuffer
+	}
+	return s.file.Read(p)
+}
+
+// Write sends p as one packet. p can't be larger than the MTU.
+func (s *AcquiredSocket) Write(p []byte) (int, error) {
+	if len(p) > int(s.MTU) {
+		return 0, fmt.Errorf("Write of %d bytes is larger than the MTU %d", len(p), s.MTU)
+	}
+	return s.file.Write(p)
+}
+
+// Close the socket
+func (s *AcquiredSocket) Close() error {
+	return s.file.Close()
+}
+
+func (gc *GattCharacteristic) acquire(ctx context.Context, funcName string) (*AcquiredSocket, error) {
+	// The options are only used by servers.
+	file, mtu, err := gc.bluez.ops.CallFunctionForFd(ctx, BluezDest, gc.Path, funcName,
+		map[string]interface{}{})
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	return &AcquiredSocket{
+		file: file,
+		MTU:  mtu,
+	}, nil
+}
+
+// AcquireNotify returns a socket that receives the notifications, which is faster than a
+// PropertiesChanged signal for each notification.
+func (gc *GattCharacteristic) AcquireNotify(ctx context.Context) (*AcquiredSocket, error) {
+	return gc.acquire(ctx, BluezGATTCharacteristic.AcquireNotify)
+}
+
+// AcquireWrite returns a socket for writing without response.
+func (gc *GattCharacteristic) AcquireWrite(ctx context.Context) (*AcquiredSocket, error) {
+	return gc.acquire(ctx, BluezGATTCharacteristic.AcquireWrite)
+}
+
+// acquireAvailable checks the NotifyAcquired or WriteAcquired property. bluez only has the
+// property if the characteristic supports it, and it's true if someone else acquired it.
+func (gc *GattCharacteristic) acquireAvailable(propName string) bool {
+	acquired, err := gc.fetchBool(propName)
+	return err == nil && !acquired
+}
+
+// OpenNotify returns a reader for the notifications. If the characteristic supports
+// AcquireNotify, it's the socket. Otherwise, it reads the notifications from StartNotify.
+// Either way, each Read returns one notification.
+func (gc *GattCharacteristic) OpenNotify(ctx context.Context) (io.ReadCloser, error) {
+	if gc.acquireAvailable(BluezGATTCharacteristic.NotifyAcquiredProp) {
+		return gc.AcquireNotify(ctx)
+	}
+	notifications, err := gc.StartNotify(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &notifyReader{
+		gc:            gc,
+		notifications: notifications,
+	}, nil
+}
+
+// OpenWrite returns a writer for writing without response. If the characteristic supports
+// AcquireWrite, it's the socket. Otherwise, each Write is a WriteValue.
+func (gc *GattCharacteristic) OpenWrite(ctx context.Context) (io.WriteCloser, error) {
+	if gc.acquireAvailable(BluezGATTCharacteristic.WriteAcquiredProp) {
+		return gc.AcquireWrite(ctx)
+	}
+
+	return &commandWriter{
+		ctx: ctx,
+		gc:  gc,
+	}, nil
+}
+
+// Read returns the next notification. Like the socket, the notification is truncated if p
+// is too small.
+func (r *notifyReader) Read(p []byte) (int, error) {
+	n, ok := <-r.notifications
+	if !ok {
+		return 0, io.EOF
+	}
+	if len(p) < len(n.Value) {
+		return copy(p, n.Value), io.ErrShortBuffer
+	}
+	return copy(p, n.Value), nil
+}
+
+// Close stops the notifications
+func (r *notifyReader) Close() error {
+	var err error
+	r.closeOnce.Do(func() {
+		err = r.gc.StopNotify(context.Background())
+	})
+	return err
+}
+
+// Write sends p as a WriteValue without response
+func (w *commandWriter) Write(p []byte) (int, error) {
+	err := w.gc.WriteValue(w.ctx, p, WriteOptions{Type: WriteTypeCommand})
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close doesn't need to do anything
+func (w *commandWriter) Close() error {
+	return nil
+}
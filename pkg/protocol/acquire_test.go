@@ -0,0 +1,98 @@
+package protocol
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/shigmas/bluezog/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcquire(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ops := test.NewBusMock("gatt")
+	bluez, err := InitializeBluez(ctx, ops)
+	assert.NoError(t, err, "Unexpected error initializing adapter")
+	characteristic, _ := findGattObjects(t, bluez)
+	buf := make([]byte, test.MockMTU)
+
+	t.Run("Notify", func(t *testing.T) {
+		sock, err := characteristic.AcquireNotify(ctx)
+		assert.NoError(t, err, "Unexpected error in AcquireNotify")
+		defer sock.Close()
+		assert.Equal(t, uint16(test.MockMTU), sock.MTU)
+		peer, err := test.PeerSocket(ops, testCharPath)
+		assert.NoError(t, err, "No peer socket")
+		defer peer.Close()
+
+		// Two writes should be two reads
+		peer.Write([]byte{0x01, 0x02})
+		peer.Write([]byte{0x03, 0x04, 0x05})
+		n, err := sock.Read(buf)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{0x01, 0x02}, buf[:n])
+		n, err = sock.Read(buf)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{0x03, 0x04, 0x05}, buf[:n])
+
+		_, err = sock.Read(make([]byte, 2))
+		assert.Equal(t, io.ErrShortBuffer, err, "Expected short buffer error")
+	})
+	t.Run("Write", func(t *testing.T) {
+		sock, err := characteristic.AcquireWrite(ctx)
+		assert.NoError(t, err, "Unexpected error in AcquireWrite")
+		defer sock.Close()
+		peer, err := test.PeerSocket(ops, testCharPath)
+		assert.NoError(t, err, "No peer socket")
+		defer peer.Close()
+
+		_, err = sock.Write([]byte{0x10, 0x20})
+		assert.NoError(t, err)
+		n, err := peer.Read(buf)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{0x10, 0x20}, buf[:n])
+		_, err = sock.Write(make([]byte, test.MockMTU+1))
+		assert.Error(t, err, "Expected error writing more than the MTU")
+	})
+	t.Run("OpenNotifyFallback", func(t *testing.T) {
+		// NotifyAcquired isn't available, so this uses StartNotify
+		reader, err := characteristic.OpenNotify(ctx)
+		assert.NoError(t, err, "Unexpected error in OpenNotify")
+		_, ok := reader.(*notifyReader)
+		assert.True(t, ok, "Expected the StartNotify reader")
+		bluez.(*bluezConn).busSignalCh <- &dbus.Signal{
+			Path: testCharPath,
+			Name: "org.freedesktop.DBus.Properties.PropertiesChanged",
+			Body: []interface{}{
+				BluezInterface.GATTCharacteristic,
+				map[string]dbus.Variant{"Value": dbus.MakeVariant([]byte{0x42})},
+				[]string{},
+			},
+		}
+		readCh := make(chan []byte)
+		go func() {
+			n, _ := reader.Read(buf)
+			readCh <- buf[:n]
+		}()
+		select {
+		case val := <-readCh:
+			assert.Equal(t, []byte{0x42}, val)
+		case <-time.After(time.Second):
+			assert.Fail(t, "No notification read")
+		}
+		assert.NoError(t, reader.Close(), "Unexpected error closing reader")
+	})
+	t.Run("OpenNotifyAcquired", func(t *testing.T) {
+		ops.SetObjectProperty(BluezDest, testCharPath,
+			BluezInterface.GATTCharacteristic+"."+BluezGATTCharacteristic.NotifyAcquiredProp, false)
+		reader, err := characteristic.OpenNotify(ctx)
+		assert.NoError(t, err, "Unexpected error in OpenNotify")
+		_, ok := reader.(*AcquiredSocket)
+		assert.True(t, ok, "Expected the acquired socket")
+		assert.NoError(t, reader.Close())
+	})
+}
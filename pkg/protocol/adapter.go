@@ -23,7 +23,41 @@ type (
 		discoveryCh  ObjectChangedChan
 		cancelDisc   func()
 		discoveryMux sync.Mutex
+		// the last filter that was set, so we can set it again if bluez restarts
+		discoveryFilter *DiscoveryFilter
 	}
+
+	// DiscoveryTransport is the Transport for a DiscoveryFilter
+	DiscoveryTransport string
+
+	// DiscoveryFilter limits the devices reported by discovery. Zero values are not sent to
+	// bluez, so they keep the bluez defaults. RSSI and Pathloss can't both be set.
+	DiscoveryFilter struct {
+		// UUIDs are the service UUIDs that devices must advertise
+		UUIDs []string
+		// RSSI is the minimum signal strength, in dBm
+		RSSI int16
+		// Pathloss is the maximum path loss, in dB
+		Pathloss uint16
+		// Transport is the kind of scan
+		Transport DiscoveryTransport
+		// DuplicateData, if false, will only report a device's data when it changes.
+		// bluez defaults to true.
+		DuplicateData *bool
+		// Discoverable only reports devices in discoverable mode.
+		Discoverable *bool
+		// Pattern is a prefix that the device address or name must match
+		Pattern string
+	}
+)
+
+const (
+	// TransportAuto interleaves LE and BR/EDR scanning, based on the adapter
+	TransportAuto DiscoveryTransport = "auto"
+	// TransportBREDR scans for classic devices only
+	TransportBREDR DiscoveryTransport = "bredr"
+	// TransportLE scans for low energy devices only
+	TransportLE DiscoveryTransport = "le"
 )
 
 func init() {
@@ -40,6 +74,77 @@ func newAdapter(conn *bluezConn, name dbus.ObjectPath, data base.ObjectMap) *Ada
 	}
 }
 
+// toDict converts the filter into the a{sv} argument of SetDiscoveryFilter
+func (f *DiscoveryFilter) toDict() map[string]interface{} {
+	dict := make(map[string]interface{})
+	if len(f.UUIDs) > 0 {
+		dict["UUIDs"] = f.UUIDs
+	}
+	if f.RSSI != 0 {
+		dict["RSSI"] = f.RSSI
+	}
+	if f.Pathloss != 0 {
+		dict["Pathloss"] = f.Pathloss
+	}
+	if f.Transport != "" {
+		dict["Transport"] = string(f.Transport)
+	}
+	if f.DuplicateData != nil {
+		dict["DuplicateData"] = *f.DuplicateData
+	}
+	if f.Discoverable != nil {
+		dict["Discoverable"] = *f.Discoverable
+	}
+	if f.Pattern != "" {
+		dict["Pattern"] = f.Pattern
+	}
+
+	return dict
+}
+
+// SetDiscoveryFilter sets the filter for the next StartDiscovery. An empty filter clears
+// the filter.
+func (a *Adapter) SetDiscoveryFilter(ctx context.Context, filter DiscoveryFilter) error {
+	if filter.RSSI != 0 && filter.Pathloss != 0 {
+		return fmt.Errorf("RSSI and Pathloss can't both be set")
+	}
+	switch filter.Transport {
+	case "", TransportAuto, TransportBREDR, TransportLE:
+	default:
+		return fmt.Errorf("Unknown transport %s", filter.Transport)
+	}
+
+	err := a.bluez.ops.CallFunctionWithArgs(ctx, nil, BluezDest, a.Path,
+		BluezAdapter.SetDiscoveryFilter, filter.toDict())
+	if err != nil {
+		return convertError(err)
+	}
+	a.discoveryMux.Lock()
+	defer a.discoveryMux.Unlock()
+	if len(filter.toDict()) == 0 {
+		a.discoveryFilter = nil
+	} else {
+		a.discoveryFilter = &filter
+	}
+
+	return nil
+}
+
+// GetDiscoveryFilters returns the names of the filters that the adapter supports
+func (a *Adapter) GetDiscoveryFilters(ctx context.Context) ([]string, error) {
+	var filters []string
+	err := a.bluez.ops.CallFunctionWithArgs(ctx, &filters, BluezDest, a.Path,
+		BluezAdapter.GetDiscoveryFilters)
+
+	return filters, convertError(err)
+}
+
+// RemoveDevice removes the device and its pairing information from the adapter
+func (a *Adapter) RemoveDevice(ctx context.Context, devicePath dbus.ObjectPath) error {
+	return convertError(a.bluez.ops.CallFunctionWithArgs(ctx, nil, BluezDest, a.Path,
+		BluezAdapter.RemoveDevice, devicePath))
+}
+
 // StartDiscovery on the adapter
 func (a *Adapter) StartDiscovery() (ObjectChangedChan, error) {
 	a.discoveryMux.Lock()
@@ -87,3 +192,85 @@ func (a *Adapter) StopDiscovery() error {
 	return a.bluez.ops.CallFunction(context.Background(),
 		BluezDest, a.Path, BluezAdapter.StopDiscovery)
 }
+
+// restartDiscovery starts discovery again, with the last filter, if it was started. This
+// is for when bluez restarts.
+func (a *Adapter) restartDiscovery(ctx context.Context) error {
+	a.discoveryMux.Lock()
+	defer a.discoveryMux.Unlock()
+	if a.discoveryCh == nil {
+		return nil
+	}
+	if a.discoveryFilter != nil {
+		err := a.bluez.ops.CallFunctionWithArgs(ctx, nil, BluezDest, a.Path,
+			BluezAdapter.SetDiscoveryFilter, a.discoveryFilter.toDict())
+		if err != nil {
+			return err
+		}
+	}
+
+	return a.bluez.ops.CallFunction(ctx, BluezDest, a.Path, BluezAdapter.StartDiscovery)
+}
+
+// Powered fetches whether the adapter is powered on
+func (a *Adapter) Powered() (bool, error) {
+	return a.fetchBool(BluezAdapter.PoweredProp)
+}
+
+// SetPowered switches the adapter on or off
+func (a *Adapter) SetPowered(powered bool) error {
+	return a.SetProperty(BluezAdapter.PoweredProp, powered)
+}
+
+// Discoverable fetches whether the adapter is visible to other devices
+func (a *Adapter) Discoverable() (bool, error) {
+	return a.fetchBool(BluezAdapter.DiscoverableProp)
+}
+
+// SetDiscoverable makes the adapter visible to other devices, or not.
+func (a *Adapter) SetDiscoverable(discoverable bool) error {
+	return a.SetProperty(BluezAdapter.DiscoverableProp, discoverable)
+}
+
+// DiscoverableTimeout fetches the number of seconds the adapter stays discoverable.
+func (a *Adapter) DiscoverableTimeout() (uint32, error) {
+	return a.fetchUint32(BluezAdapter.DiscoverableTimeoutProp)
+}
+
+// SetDiscoverableTimeout sets the number of seconds the adapter stays discoverable. Zero
+// means forever.
+func (a *Adapter) SetDiscoverableTimeout(seconds uint32) error {
+	return a.SetProperty(BluezAdapter.DiscoverableTimeoutProp, seconds)
+}
+
+// Pairable fetches whether the adapter accepts pairing requests
+func (a *Adapter) Pairable() (bool, error) {
+	return a.fetchBool(BluezAdapter.PairableProp)
+}
+
+// SetPairable sets whether the adapter accepts pairing requests
+func (a *Adapter) SetPairable(pairable bool) error {
+	return a.SetProperty(BluezAdapter.PairableProp, pairable)
+}
+
+// PairableTimeout fetches the number of seconds the adapter stays pairable.
+func (a *Adapter) PairableTimeout() (uint32, error) {
+	return a.fetchUint32(BluezAdapter.PairableTimeoutProp)
+}
+
+// SetPairableTimeout sets the number of seconds the adapter stays pairable. Zero means
+// forever.
+func (a *Adapter) SetPairableTimeout(seconds uint32) error {
+	return a.SetProperty(BluezAdapter.PairableTimeoutProp, seconds)
+}
+
+// Alias fetches the friendly name of the adapter
+func (a *Adapter) Alias() (string, error) {
+	return a.fetchString(BluezAdapter.AliasProp)
+}
+
+// SetAlias sets the friendly name of the adapter. An empty string resets it to the
+// system name.
+func (a *Adapter) SetAlias(alias string) error {
+	return a.SetProperty(BluezAdapter.AliasProp, alias)
+}
@@ -2,6 +2,7 @@ package protocol
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"testing"
 	"time"
@@ -83,3 +84,72 @@ func TestAdapter(t *testing.T) {
 	})
 
 }
+
+func TestAdapterSettings(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bluez, err := InitializeBluez(ctx, test.NewBusMock("simple"))
+	assert.NoError(t, err, "Unexpected error initializing adapter")
+	adapters := bluez.FindAdapters()
+	assert.GreaterOrEqual(t, len(adapters), 1)
+	adapter := adapters[0]
+
+	t.Run("Powered", func(t *testing.T) {
+		assert.NoError(t, adapter.SetPowered(true), "Unexpected error in SetPowered")
+		powered, err := adapter.Powered()
+		assert.NoError(t, err, "Unexpected error in Powered")
+		assert.True(t, powered, "Adapter should be powered")
+		assert.Equal(t, true, adapter.Property(BluezAdapter.PoweredProp), "Cached value not updated")
+	})
+	t.Run("Discoverable", func(t *testing.T) {
+		assert.NoError(t, adapter.SetDiscoverableTimeout(30), "Unexpected error in SetDiscoverableTimeout")
+		assert.NoError(t, adapter.SetDiscoverable(true), "Unexpected error in SetDiscoverable")
+		timeout, err := adapter.DiscoverableTimeout()
+		assert.NoError(t, err, "Unexpected error in DiscoverableTimeout")
+		assert.Equal(t, uint32(30), timeout)
+	})
+	t.Run("Alias", func(t *testing.T) {
+		assert.NoError(t, adapter.SetAlias("zog"), "Unexpected error in SetAlias")
+		alias, err := adapter.Alias()
+		assert.NoError(t, err, "Unexpected error in Alias")
+		assert.Equal(t, "zog", alias)
+	})
+}
+
+func TestAdapterDiscoveryFilter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bluez, err := InitializeBluez(ctx, test.NewBusMock("simple"))
+	assert.NoError(t, err, "Unexpected error initializing adapter")
+	adapter := bluez.FindAdapters()[0]
+
+	t.Run("Dict", func(t *testing.T) {
+		duplicates := false
+		filter := DiscoveryFilter{
+			UUIDs:         []string{"0000180a-0000-1000-8000-00805f9b34fb"},
+			RSSI:          -70,
+			Transport:     TransportLE,
+			DuplicateData: &duplicates,
+		}
+		dict := filter.toDict()
+		assert.Len(t, dict, 4, "Only set fields should be in the dict")
+		assert.Equal(t, int16(-70), dict["RSSI"])
+		assert.Equal(t, "le", dict["Transport"])
+		assert.Equal(t, false, dict["DuplicateData"])
+		assert.Empty(t, (&DiscoveryFilter{}).toDict(), "Empty filter should be an empty dict")
+	})
+	t.Run("Set", func(t *testing.T) {
+		assert.NoError(t, adapter.SetDiscoveryFilter(ctx, DiscoveryFilter{Transport: TransportLE}))
+		assert.Error(t, adapter.SetDiscoveryFilter(ctx, DiscoveryFilter{RSSI: -70, Pathloss: 10}),
+			"RSSI and Pathloss together should fail")
+		assert.Error(t, adapter.SetDiscoveryFilter(ctx, DiscoveryFilter{Transport: "usb"}),
+			"Unknown transport should fail")
+		err := adapter.SetDiscoveryFilter(ctx, DiscoveryFilter{UUIDs: []string{"battery"}})
+		assert.True(t, errors.Is(err, ErrInvalidArguments), "Expected ErrInvalidArguments, not %v", err)
+	})
+	t.Run("Get", func(t *testing.T) {
+		filters, err := adapter.GetDiscoveryFilters(ctx)
+		assert.NoError(t, err, "Unexpected error in GetDiscoveryFilters")
+		assert.Contains(t, filters, "Transport")
+	})
+}
@@ -0,0 +1,176 @@
+package protocol
+
+import (
+	"errors"
+
+	"github.com/godbus/dbus/v5"
+)
+
+type (
+	// AgentCapability is the input and output capability of an agent, which bluez uses to
+	// choose the pairing method.
+	AgentCapability string
+
+	// Agent handles the requests from bluez when pairing needs the user. Implementations
+	// return ErrRejected to reject the request, or ErrCanceled if the user canceled. Any
+	// other error is treated as a rejection. The device is the path of the device
+	// that is pairing.
+	Agent interface {
+		// Release is called when bluez unregisters the agent
+		Release()
+		// RequestPinCode returns the PIN code for legacy pairing. 1 to 16 characters.
+		RequestPinCode(device dbus.ObjectPath) (string, error)
+		// DisplayPinCode shows the PIN code that the user needs to enter on the device
+		DisplayPinCode(device dbus.ObjectPath, pinCode string) error
+		// RequestPasskey returns the passkey, between 0 and 999999
+		RequestPasskey(device dbus.ObjectPath) (uint32, error)
+		// DisplayPasskey shows the passkey. entered is the number of digits typed on the
+		// remote side so far.
+		DisplayPasskey(device dbus.ObjectPath, passkey uint32, entered uint16) error
+		// RequestConfirmation asks the user to confirm that the passkey matches the device
+		RequestConfirmation(device dbus.ObjectPath, passkey uint32) error
+		// RequestAuthorization asks the user to allow pairing without any other input
+		RequestAuthorization(device dbus.ObjectPath) error
+		// AuthorizeService asks the user to allow the device to connect to the service
+		AuthorizeService(device dbus.ObjectPath, uuid string) error
+		// Cancel is called when bluez cancels an outstanding request
+		Cancel()
+	}
+
+	// AutoAcceptAgent accepts everything, for headless gateways where there is no user.
+	// The PinCode (0000 if it's empty) and Passkey are returned when the device asks for
+	// them.
+	AutoAcceptAgent struct {
+		PinCode string
+		Passkey uint32
+	}
+
+	// agentExporter is the object that we export on the bus. It converts the calls to the
+	// Agent, which is a more natural Go interface.
+	agentExporter struct {
+		agent Agent
+	}
+)
+
+const (
+	// CapabilityDisplayOnly can only display a passkey
+	CapabilityDisplayOnly AgentCapability = "DisplayOnly"
+	// CapabilityDisplayYesNo can display a passkey and confirm it
+	CapabilityDisplayYesNo AgentCapability = "DisplayYesNo"
+	// CapabilityKeyboardOnly can only enter a passkey
+	CapabilityKeyboardOnly AgentCapability = "KeyboardOnly"
+	// CapabilityNoInputNoOutput has no user, so it can only "just work"
+	CapabilityNoInputNoOutput AgentCapability = "NoInputNoOutput"
+	// CapabilityKeyboardDisplay can display and enter a passkey
+	CapabilityKeyboardDisplay AgentCapability = "KeyboardDisplay"
+)
+
+var (
+	_ Agent = (*AutoAcceptAgent)(nil)
+)
+
+// agentError converts the error returned from the Agent into the error bluez expects
+func agentError(err error) *dbus.Error {
+	if err == nil {
+		return nil
+	}
+	var bluezErr *Error
+	if errors.As(err, &bluezErr) &&
+		(bluezErr.Is(ErrRejected) || bluezErr.Is(ErrCanceled)) {
+		return bluezErr.dbusError()
+	}
+	return (&Error{Name: ErrRejected.Name, Message: err.Error()}).dbusError()
+}
+
+// Release is called by bluez through dbus
+func (e *agentExporter) Release() *dbus.Error {
+	e.agent.Release()
+	return nil
+}
+
+// RequestPinCode is called by bluez through dbus
+func (e *agentExporter) RequestPinCode(device dbus.ObjectPath) (string, *dbus.Error) {
+	pinCode, err := e.agent.RequestPinCode(device)
+	return pinCode, agentError(err)
+}
+
+// DisplayPinCode is called by bluez through dbus
+func (e *agentExporter) DisplayPinCode(device dbus.ObjectPath, pinCode string) *dbus.Error {
+	return agentError(e.agent.DisplayPinCode(device, pinCode))
+}
+
+// RequestPasskey is called by bluez through dbus
+func (e *agentExporter) RequestPasskey(device dbus.ObjectPath) (uint32, *dbus.Error) {
+	passkey, err := e.agent.RequestPasskey(device)
+	return passkey, agentError(err)
+}
+
+// DisplayPasskey is called by bluez through dbus
+func (e *agentExporter) DisplayPasskey(device dbus.ObjectPath, passkey uint32, entered uint16) *dbus.Error {
+	return agentError(e.agent.DisplayPasskey(device, passkey, entered))
+}
+
+// RequestConfirmation is called by bluez through dbus
+func (e *agentExporter) RequestConfirmation(device dbus.ObjectPath, passkey uint32) *dbus.Error {
+	return agentError(e.agent.RequestConfirmation(device, passkey))
+}
+
+// RequestAuthorization is called by bluez through dbus
+func (e *agentExporter) RequestAuthorization(device dbus.ObjectPath) *dbus.Error {
+	return agentError(e.agent.RequestAuthorization(device))
+}
+
+// AuthorizeService is called by bluez through dbus
+func (e *agentExporter) AuthorizeService(device dbus.ObjectPath, uuid string) *dbus.Error {
+	return agentError(e.agent.AuthorizeService(device, uuid))
+}
+
+// Cancel is called by bluez through dbus
+func (e *agentExporter) Cancel() *dbus.Error {
+	e.agent.Cancel()
+	return nil
+}
+
+// Release does nothing
+func (a *AutoAcceptAgent) Release() {}
+
+// RequestPinCode returns the PinCode
+func (a *AutoAcceptAgent) RequestPinCode(device dbus.ObjectPath) (string, error) {
+	if a.PinCode == "" {
+		return "0000", nil
+	}
+	return a.PinCode, nil
+}
+
+// DisplayPinCode accepts the PIN code
+func (a *AutoAcceptAgent) DisplayPinCode(device dbus.ObjectPath, pinCode string) error {
+	return nil
+}
+
+// RequestPasskey returns the Passkey
+func (a *AutoAcceptAgent) RequestPasskey(device dbus.ObjectPath) (uint32, error) {
+	return a.Passkey, nil
+}
+
+// DisplayPasskey accepts the passkey
+func (a *AutoAcceptAgent) DisplayPasskey(device dbus.ObjectPath, passkey uint32, entered uint16) error {
+	return nil
+}
+
+// RequestConfirmation confirms any passkey
+func (a *AutoAcceptAgent) RequestConfirmation(device dbus.ObjectPath, passkey uint32) error {
+	return nil
+}
+
+// RequestAuthorization authorizes any device
+func (a *AutoAcceptAgent) RequestAuthorization(device dbus.ObjectPath) error {
+	return nil
+}
+
+// AuthorizeService authorizes any service
+func (a *AutoAcceptAgent) AuthorizeService(device dbus.ObjectPath, uuid string) error {
+	return nil
+}
+
+// Cancel does nothing, since we never wait
+func (a *AutoAcceptAgent) Cancel() {}
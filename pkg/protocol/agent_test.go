@@ -0,0 +1,57 @@
+package protocol
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/shigmas/bluezog/test"
+	"github.com/stretchr/testify/assert"
+)
+
+type rejectAgent struct {
+	AutoAcceptAgent
+}
+
+func (r *rejectAgent) RequestConfirmation(device dbus.ObjectPath, passkey uint32) error {
+	return ErrCanceled
+}
+
+func (r *rejectAgent) AuthorizeService(device dbus.ObjectPath, uuid string) error {
+	return errors.New("not this one")
+}
+
+func TestAgent(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bluez, err := InitializeBluez(ctx, test.NewBusMock("simple"))
+	assert.NoError(t, err, "Unexpected error initializing adapter")
+
+	agentPath := dbus.ObjectPath("/org/bluezog/test")
+	t.Run("Register", func(t *testing.T) {
+		manager, err := bluez.FindAgentManager()
+		assert.NoError(t, err, "Unexpected error finding the agent manager")
+		err = manager.RegisterAgent(ctx, agentPath, CapabilityNoInputNoOutput, &AutoAcceptAgent{})
+		assert.NoError(t, err, "Unexpected error in RegisterAgent")
+		assert.NoError(t, manager.RequestDefaultAgent(ctx, agentPath), "Unexpected error in RequestDefaultAgent")
+		assert.NoError(t, manager.UnregisterAgent(ctx, agentPath), "Unexpected error in UnregisterAgent")
+	})
+
+	t.Run("Exporter", func(t *testing.T) {
+		exporter := &agentExporter{agent: &AutoAcceptAgent{Passkey: 123456}}
+		passkey, dbusErr := exporter.RequestPasskey(agentPath)
+		assert.Nil(t, dbusErr)
+		assert.Equal(t, uint32(123456), passkey)
+		pinCode, dbusErr := exporter.RequestPinCode(agentPath)
+		assert.Nil(t, dbusErr)
+		assert.Equal(t, "0000", pinCode)
+
+		exporter = &agentExporter{agent: &rejectAgent{}}
+		dbusErr = exporter.RequestConfirmation(agentPath, 1234)
+		assert.Equal(t, "org.bluez.Error.Canceled", dbusErr.Name)
+		dbusErr = exporter.AuthorizeService(agentPath, "0000180a-0000-1000-8000-00805f9b34fb")
+		assert.Equal(t, "org.bluez.Error.Rejected", dbusErr.Name)
+		assert.Nil(t, exporter.RequestAuthorization(agentPath))
+	})
+}
@@ -1,12 +1,14 @@
 package protocol
 
 import (
+	"context"
+
 	"github.com/godbus/dbus/v5"
 	"github.com/shigmas/bluezog/pkg/base"
 )
 
 type (
-	// AgentManager is a bluetooth device associated with an adapter
+	// AgentManager registers the agents that bluez calls when pairing needs the user
 	AgentManager struct {
 		BaseObject
 	}
@@ -25,3 +27,42 @@ func newAgentManager(conn *bluezConn, name dbus.ObjectPath, data base.ObjectMap)
 		BaseObject: *newBaseObject(conn, name, BluezInterface.AgentManager, data),
 	}
 }
+
+// RegisterAgent exports the agent on the bus at agentPath and registers it with bluez.
+// The path is ours to choose, like /org/bluezog/agent.
+func (am *AgentManager) RegisterAgent(
+	ctx context.Context,
+	agentPath dbus.ObjectPath,
+	capability AgentCapability,
+	agent Agent) error {
+	err := am.bluez.ops.Export(&agentExporter{agent: agent}, agentPath, BluezInterface.Agent)
+	if err != nil {
+		return err
+	}
+	err = am.bluez.ops.CallFunctionWithArgs(ctx, nil, BluezDest, am.Path,
+		BluezAgentManager.RegisterAgent, agentPath, string(capability))
+	if err != nil {
+		am.bluez.ops.Unexport(agentPath, BluezInterface.Agent)
+		return convertError(err)
+	}
+
+	return nil
+}
+
+// RequestDefaultAgent makes the registered agent the one that is used for all pairing, not
+// just for the pairing requested through this connection.
+func (am *AgentManager) RequestDefaultAgent(ctx context.Context, agentPath dbus.ObjectPath) error {
+	return convertError(am.bluez.ops.CallFunctionWithArgs(ctx, nil, BluezDest, am.Path,
+		BluezAgentManager.RequestDefaultAgent, agentPath))
+}
+
+// UnregisterAgent unregisters the agent with bluez and removes it from the bus
+func (am *AgentManager) UnregisterAgent(ctx context.Context, agentPath dbus.ObjectPath) error {
+	err := am.bluez.ops.CallFunctionWithArgs(ctx, nil, BluezDest, am.Path,
+		BluezAgentManager.UnregisterAgent, agentPath)
+	if err != nil {
+		return convertError(err)
+	}
+
+	return am.bluez.ops.Unexport(agentPath, BluezInterface.Agent)
+}
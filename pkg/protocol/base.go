@@ -3,6 +3,10 @@ package protocol
 import (
 	"context"
 	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"sync"
 
 	"github.com/godbus/dbus/v5"
 	"github.com/shigmas/bluezog/pkg/base"
@@ -19,12 +23,23 @@ type (
 		AllProperties() map[string]dbus.Variant
 		// Typically, calls through to dbus to get the property
 		FetchProperty(propName string) (interface{}, error)
+		// SetProperty writes the property through dbus, and updates the in memory value
+		// if it succeeded.
+		SetProperty(propName string, value interface{}) error
 		// In GetManagedObjects, the data has several interfaces, but only one is populated (so far).
 		// That interface is the bluez interface (as opposed to the generic dbus interfaces).
 		GetBluezInterface() string
 		GetInterfaces() []string
 		// Update is called from the main signal handler for updates to the objects in the registry
 		Update(data base.ObjectMap) error
+		// UpdateProperties is called from the main signal handler for PropertiesChanged. The
+		// changed properties are merged, and the invalidated properties are removed. It
+		// returns false if the interface is not the bluez interface for this object.
+		UpdateProperties(iface string, changed map[string]dbus.Variant, invalidated []string) bool
+		// RemoveInterfaces is called from the main signal handler for InterfacesRemoved. It
+		// returns true if the bluez interface was removed, so the object should be removed
+		// from the registry.
+		RemoveInterfaces(ifaces []string) bool
 	}
 
 	Connectable interface {
@@ -47,6 +62,9 @@ type (
 		// provide an implementation for one
 		interfaces []string
 		properties map[string]dbus.Variant
+		// protects the interfaces and properties, which are updated from the signal handler.
+		// A pointer so the 'derived' constructors can copy the BaseObject.
+		propMux *sync.RWMutex
 	}
 )
 
@@ -72,20 +90,94 @@ func newBaseObject(
 		childType:  mainInterface,
 		interfaces: iFaces,
 		properties: props,
+		propMux:    &sync.RWMutex{},
 	}
 }
 
-// Update is called from the main signal handler for updates to the objects in the registry
+// Update is called from the main signal handler for updates to the objects in the registry.
+// The properties are merged with the ones we have, and any new interfaces are added.
 func (b *BaseObject) Update(data base.ObjectMap) error {
-	props, ok := data[BluezInterface.Adapter]
+	b.propMux.Lock()
+	defer b.propMux.Unlock()
+	for iface := range data {
+		found := false
+		for _, i := range b.interfaces {
+			if i == iface {
+				found = true
+				break
+			}
+		}
+		if !found {
+			b.interfaces = append(b.interfaces, iface)
+		}
+	}
+	props, ok := data[b.childType]
 	if !ok {
-		return fmt.Errorf("Data did not contain properties")
+		return nil
+	}
+	for k, v := range props {
+		b.properties[k] = v
 	}
-	b.properties = props
 
 	return nil
 }
 
+// UpdateProperties merges the changed properties and removes the invalidated ones.
+func (b *BaseObject) UpdateProperties(iface string, changed map[string]dbus.Variant, invalidated []string) bool {
+	if iface != b.childType {
+		return false
+	}
+	b.propMux.Lock()
+	defer b.propMux.Unlock()
+	for k, v := range changed {
+		b.properties[k] = v
+	}
+	for _, k := range invalidated {
+		delete(b.properties, k)
+	}
+
+	return true
+}
+
+// reset replaces the interfaces and properties with the data, like the object was just
+// created. It returns false if the data doesn't have our bluez interface.
+func (b *BaseObject) reset(data base.ObjectMap) bool {
+	props, ok := data[b.childType]
+	if !ok {
+		return false
+	}
+	iFaces := make([]string, 0, len(data))
+	for i := range data {
+		iFaces = append(iFaces, i)
+	}
+	b.propMux.Lock()
+	defer b.propMux.Unlock()
+	b.interfaces = iFaces
+	b.properties = props
+
+	return true
+}
+
+// RemoveInterfaces removes the interfaces from the ones this object provides
+func (b *BaseObject) RemoveInterfaces(ifaces []string) bool {
+	b.propMux.Lock()
+	defer b.propMux.Unlock()
+	removedBluez := false
+	for _, iface := range ifaces {
+		if iface == b.childType {
+			removedBluez = true
+		}
+		for i, existing := range b.interfaces {
+			if existing == iface {
+				b.interfaces = append(b.interfaces[:i], b.interfaces[i+1:]...)
+				break
+			}
+		}
+	}
+
+	return removedBluez
+}
+
 // GetPath returns the unique path for this object
 func (b *BaseObject) GetPath() dbus.ObjectPath {
 	return b.Path
@@ -94,6 +186,8 @@ func (b *BaseObject) GetPath() dbus.ObjectPath {
 // Property returns the property value variant as an interface. nil if it wasn't
 // found locally
 func (b *BaseObject) Property(propName string) interface{} {
+	b.propMux.RLock()
+	defer b.propMux.RUnlock()
 	prop, ok := b.properties[propName]
 	if !ok {
 		return nil
@@ -102,9 +196,15 @@ func (b *BaseObject) Property(propName string) interface{} {
 	return prop.Value()
 }
 
-// AllProperties returns all (cached) properties
+// AllProperties returns a copy of all (cached) properties
 func (b *BaseObject) AllProperties() map[string]dbus.Variant {
-	return b.properties
+	b.propMux.RLock()
+	defer b.propMux.RUnlock()
+	props := make(map[string]dbus.Variant, len(b.properties))
+	for k, v := range b.properties {
+		props[k] = v
+	}
+	return props
 }
 
 // FetchProperty for a type. Uses the childType member
@@ -113,6 +213,59 @@ func (b *BaseObject) FetchProperty(propName string) (interface{}, error) {
 	return b.bluez.ops.GetObjectProperty(BluezDest, b.Path, propPath)
 }
 
+// SetProperty for a type. Uses the childType member, like FetchProperty
+func (b *BaseObject) SetProperty(propName string, value interface{}) error {
+	propPath := fmt.Sprintf("%s.%s", b.childType, propName)
+	err := b.bluez.ops.SetObjectProperty(BluezDest, b.Path, propPath, value)
+	if err != nil {
+		return convertError(err)
+	}
+	b.propMux.Lock()
+	b.properties[propName] = dbus.MakeVariant(value)
+	b.propMux.Unlock()
+
+	return nil
+}
+
+func (b *BaseObject) fetchBool(propName string) (bool, error) {
+	val, err := b.FetchProperty(propName)
+	if err != nil {
+		return false, err
+	}
+	v, ok := val.(bool)
+	if !ok {
+		return false, fmt.Errorf("Property %s is %T, not bool", propName, val)
+	}
+
+	return v, nil
+}
+
+func (b *BaseObject) fetchUint32(propName string) (uint32, error) {
+	val, err := b.FetchProperty(propName)
+	if err != nil {
+		return 0, err
+	}
+	v, ok := val.(uint32)
+	if !ok {
+		return 0, fmt.Errorf("Property %s is %T, not uint32", propName, val)
+	}
+
+	return v, nil
+}
+
+func (b *BaseObject) fetchString(propName string) (string, error) {
+	val, err := b.FetchProperty(propName)
+	if err != nil {
+		return "", err
+	}
+	v, ok := val.(string)
+	if !ok {
+		return "", fmt.Errorf("Property %s is %T, not string", propName, val)
+	}
+
+	return v, nil
+}
+
 // GetBluezInterface returns the bluez type that this object was created as. (
 // Always (or at least, usually), there is only one applicable bluez type
 func (b *BaseObject) GetBluezInterface() string {
@@ -121,7 +274,58 @@ func (b *BaseObject) GetBluezInterface() string {
 
 // GetInterfaces retries the interfaces that this object provides
 func (b *BaseObject) GetInterfaces() []string {
-	return b.interfaces
+	b.propMux.RLock()
+	defer b.propMux.RUnlock()
+	return append([]string(nil), b.interfaces...)
+}
+
+// stringsProp returns the []string property, or nil
+func (b *BaseObject) stringsProp(propName string) []string {
+	v, _ := b.Property(propName).([]string)
+	return append([]string(nil), v...)
+}
+
+// handle returns the Handle property. Older versions of bluez don't have it, so it falls
+// back to the handle at the end of the path, like service001f.
+func (b *BaseObject) handle(propName string) uint16 {
+	if v, ok := b.Property(propName).(uint16); ok {
+		return v
+	}
+	element := path.Base(string(b.Path))
+	if len(element) < 4 {
+		return 0
+	}
+	v, err := strconv.ParseUint(element[len(element)-4:], 16, 16)
+	if err != nil {
+		return 0
+	}
+	return uint16(v)
+}
+
+// children returns the objects with the bluez interface whose parent property, like
+// Service for a characteristic, is this object. They are sorted by path, which is the
+// handle order.
+func (b *BaseObject) children(iface, parentProp string) []Base {
+	b.bluez.registryMux.RLock()
+	results := make([]Base, 0)
+	for objPath, obj := range b.bluez.objectRegistry {
+		if obj.GetBluezInterface() != iface {
+			continue
+		}
+		parent, ok := obj.Property(parentProp).(dbus.ObjectPath)
+		if !ok {
+			parent = dbus.ObjectPath(path.Dir(string(objPath)))
+		}
+		if parent == b.Path {
+			results = append(results, obj)
+		}
+	}
+	b.bluez.registryMux.RUnlock()
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].GetPath() < results[j].GetPath()
+	})
+
+	return results
 }
 
 // GetDevicePath will build the dbus.ObjectPath from the data.
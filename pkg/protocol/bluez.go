@@ -14,12 +14,14 @@ import (
 	"github.com/shigmas/bluezog/pkg/base"
 	"github.com/shigmas/bluezog/pkg/bus"
 	"github.com/shigmas/bluezog/pkg/logger"
-	"github.com/shigmas/bluezog/test"
 )
 
 var (
 	// ChannelBufferSize specifies the efault sizes of the ChannelBuffer for all channels
 	ChannelBufferSize = 8
+	// SubscriberBufferSize is the size of the channel for each watch. When it's full, the
+	// changes are dropped, so one slow subscriber can't hold up the others.
+	SubscriberBufferSize = 64
 )
 
 type (
@@ -40,7 +42,8 @@ type (
 
 	// ObjectChangedData is the data that we write to any listeners of signals that we
 	// get from dbus. This data is usually triggered through a dbus function, such as
-	// discovery (called through the adapter) or on a device.
+	// discovery (called through the adapter) or on a device. This is the raw change for the
+	// watches. Most listeners should use Subscribe, which sends typed Events.
 	ObjectChangedData struct {
 		// Path is the dbus.ObjectPath
 		Path dbus.ObjectPath
@@ -48,9 +51,24 @@ type (
 		Object Base
 		// Signal is the name of the signal that triggered this
 		Signal string
-		// Maybe we might need the original data. Like an updated property or something
+		// Type is the kind of change to the object
+		Type ChangeType
+		// Interface is the interface of the changed properties, for PropertiesChanged
+		Interface string
+		// Properties are the changed properties, for PropertiesChanged
+		Properties map[string]dbus.Variant
+		// Invalidated are the names of the properties that were removed, for PropertiesChanged
+		Invalidated []string
+		// Interfaces are the interfaces that were removed, for InterfacesRemoved
+		Interfaces []string
+		// Dropped is the number of changes that were dropped before this one, because the
+		// subscriber didn't keep up
+		Dropped int
 	}
 
+	// ChangeType is the kind of change that the ObjectChangedData describes
+	ChangeType int
+
 	// ObjectChangedChan receives data from a signal watcher
 	ObjectChangedChan chan ObjectChangedData
 
@@ -60,7 +78,12 @@ type (
 	Bluez interface {
 		// FindAdapters thcat exist
 		FindAdapters() []*Adapter
+		// FindAgentManager returns the agent manager, which is needed to register an Agent
+		FindAgentManager() (*AgentManager, error)
 		GetObjectsByType(oType string) []Base
+		// Available is false when bluez has stopped. The registry is empty until it starts
+		// again.
+		Available() bool
 
 		IntrospectPath(path string) (*base.Node, error)
 		GetManagedObjects(path string) (map[dbus.ObjectPath]base.ObjectMap, error)
@@ -74,15 +97,30 @@ type (
 		FindObjects(pattern string, firstOnly bool) []Base
 		//IntrospectObject()
 
+		// Subscribe returns the typed events that match the filter. The channel is closed
+		// when the context is done. The channel must be drained promptly: events are
+		// dropped when it's full.
+		Subscribe(ctx context.Context, filter EventFilter) (<-chan Event, error)
+		// Monitor returns the InterfacesAdded, InterfacesRemoved and PropertiesChanged
+		// signals of all the objects, like dbus-monitor. The channel is closed when the
+		// context is done.
+		Monitor(ctx context.Context) (<-chan MonitoredSignal, error)
+		// Watch will watch a path on the signals. The Subscription has the channel that we
+		// will use to communicate the data to the listener. Any number of subscriptions can
+		// watch the same path. The subscription is removed when the context is done. The
+		// channel must be drained promptly: changes are dropped when it's full.
+		Watch(
+			ctx context.Context,
+			path dbus.ObjectPath,
+			signalMap []InterfaceSignalPair) (*Subscription, error)
 		// AddWatch will watch a path on the signals and will return a channel that we will use
-		// to communicate the data to the listener.
+		// to communicate the data to the listener. The watch lasts until RemoveWatch. Like
+		// Watch, changes are dropped when the channel is full.
 		AddWatch(
 			path dbus.ObjectPath,
 			signalMap []InterfaceSignalPair) (ObjectChangedChan, error)
-		// RemoveWatch will remove listener on the path.
-		// XXX: Implementation hole: We won't actually remove the watch. But no one will be
-		// notified because no one is listening. We should reference count the signals, and stop
-		// watching when it reaches zero.
+		// RemoveWatch will remove the listener on the path, and close the channel. Other
+		// listeners on the path are not affected.
 		RemoveWatch(
 			path dbus.ObjectPath,
 			ch ObjectChangedChan,
@@ -107,10 +145,14 @@ type (
 		// Objects known to this connection.
 		objectRegistry map[dbus.ObjectPath]Base
 		registryMux    sync.RWMutex
-		busSignalCh    chan *dbus.Signal
-		// Should be a map to slice
-		signalWatchers map[dbus.ObjectPath]ObjectChangedChan
-		sigWatchersMux sync.RWMutex
+		// false when bluez has stopped. The objects are moved to lostRegistry until it
+		// starts again.
+		available    bool
+		lostRegistry map[dbus.ObjectPath]Base
+		busSignalCh  chan *dbus.Signal
+		watches      *watchRegistry
+		events       *eventBus
+		monitors     *monitorRegistry
 	}
 
 	typeConstructorFn func(*bluezConn, dbus.ObjectPath, base.ObjectMap) Base
@@ -127,12 +169,41 @@ func AddressToPath(parent string, address string) dbus.ObjectPath {
 	return dbus.ObjectPath(path.Join(parent, strings.ReplaceAll(address, ":", "_")))
 }
 
-func newObjectChangedData(path dbus.ObjectPath, obj Base, sigName string) ObjectChangedData {
+func newObjectChangedData(path dbus.ObjectPath, obj Base, sigName string, changeType ChangeType) ObjectChangedData {
 	return ObjectChangedData{
 		Path:   path,
 		Object: obj,
 		Signal: sigName,
+		Type:   changeType,
+	}
+}
+
+const (
+	// ObjectAdded is sent for InterfacesAdded. The object may have already existed, and
+	// gained interfaces.
+	ObjectAdded ChangeType = iota
+	// ObjectPropertiesChanged is sent for PropertiesChanged
+	ObjectPropertiesChanged
+	// ObjectInterfacesRemoved is sent when the object lost some interfaces, but it is still in
+	// the registry
+	ObjectInterfacesRemoved
+	// ObjectRemoved is sent when the object was removed from the registry. The children of
+	// the object are removed with it.
+	ObjectRemoved
+)
+
+func (c ChangeType) String() string {
+	switch c {
+	case ObjectAdded:
+		return "added"
+	case ObjectPropertiesChanged:
+		return "changed"
+	case ObjectInterfacesRemoved:
+		return "interfaces removed"
+	case ObjectRemoved:
+		return "removed"
 	}
+	return fmt.Sprintf("ChangeType(%d)", int(c))
 }
 
 // InitializeBluez creates a Bluez implementation
@@ -153,7 +224,10 @@ func InitializeBluez(ctx context.Context, ops base.Operations) (Bluez, error) {
 		root:           node,
 		objectRegistry: make(map[dbus.ObjectPath]Base, len(objMap)),
 		busSignalCh:    make(chan *dbus.Signal, 10),
-		signalWatchers: make(map[dbus.ObjectPath]ObjectChangedChan, 10),
+		watches:        newWatchRegistry(ops),
+		events:         newEventBus(),
+		monitors:       newMonitorRegistry(),
+		available:      true,
 	}
 
 	// we're locking too long, but no one else has object yet
@@ -161,13 +235,25 @@ func InitializeBluez(ctx context.Context, ops base.Operations) (Bluez, error) {
 	for path, ifaceMap := range objMap {
 		newObj := bluezObj.createObject(path, ifaceMap)
 		if newObj == nil {
-			fmt.Printf("No interface constructor found: %s: %s\n", path, ifaceMap)
+			logger.Debug("No interface constructor found: %s: %s", path, ifaceMap)
 		} else {
 			bluezObj.objectRegistry[path] = newObj
 		}
 	}
 	bluezObj.registryMux.Unlock()
 
+	// Keep the cached properties of all the objects up to date.
+	err = ops.WatchNamespace(BluezRootPath, bus.Properties, bus.PropertiesFuncs.PropertiesChanged)
+	if err != nil {
+		return nil, err
+	}
+
+	// Recover when bluetoothd restarts
+	err = ops.WatchNameOwner(BluezDest)
+	if err != nil {
+		return nil, err
+	}
+
 	bluezObj.ops.RegisterSignalChannel(bluezObj.busSignalCh)
 	go bluezObj.handleSignals(ctx)
 
@@ -191,50 +277,35 @@ func (b *bluezConn) createObject(path dbus.ObjectPath, data base.ObjectMap) Base
 	return newObj
 }
 
+func (b *bluezConn) Watch(
+	ctx context.Context,
+	path dbus.ObjectPath,
+	signalMap []InterfaceSignalPair) (*Subscription, error) {
+	logger.Info("Watch %s", path)
+	return b.watches.subscribe(ctx, path, signalMap)
+}
+
 func (b *bluezConn) AddWatch(
 	path dbus.ObjectPath,
 	signalMap []InterfaceSignalPair) (ObjectChangedChan, error) {
-
-	for _, pair := range signalMap {
-		err := b.ops.Watch(bus.RootPath, pair.Interface, pair.SignalName)
-		if err != nil {
-			return nil, err
-		}
+	sub, err := b.Watch(context.Background(), path, signalMap)
+	if err != nil {
+		return nil, err
 	}
 
-	ch := make(ObjectChangedChan, 2)
-	logger.Info("AddWatch %s", path)
-	b.sigWatchersMux.Lock()
-	defer b.sigWatchersMux.Unlock()
-	b.signalWatchers[path] = ch
-
-	return ch, nil
+	return sub.C, nil
 }
 
 func (b *bluezConn) RemoveWatch(
 	path dbus.ObjectPath,
 	ch ObjectChangedChan,
 	signalMap []InterfaceSignalPair) error {
-	b.sigWatchersMux.Lock()
-	ch, ok := b.signalWatchers[path]
-	if !ok {
+	sub := b.watches.find(path, ch)
+	if sub == nil {
 		return fmt.Errorf("No channel found for %s", path)
 	}
-	delete(b.signalWatchers, path)
-	close(ch)
-	logger.Info("RemoveWatch %s", path)
-	b.sigWatchersMux.Unlock()
-	for _, pair := range signalMap {
-		// We should replace the channel in the map value with a slice, and
-		// remove the channel from the slice. When the slice is zero, we
-		// call the UnWatch. (It means, we need to store the interfaceName).
-		// But, this will do for now.
-		err := b.ops.UnWatch(bus.RootPath, pair.Interface, pair.SignalName)
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+
+	return sub.Unsubscribe()
 }
 
 func (b *bluezConn) FindAdapters() []*Adapter {
@@ -244,7 +315,7 @@ func (b *bluezConn) FindAdapters() []*Adapter {
 		a, ok := o.(*Adapter)
 		if !ok {
 			// This is an internal consistency problem. i.e. a bug
-			fmt.Printf("Object registered as Adapter, but could not cast as adapter\n")
+			logger.Error("Object registered as Adapter, but could not cast as adapter")
 		} else {
 			adapters[i] = a
 		}
@@ -252,6 +323,24 @@ func (b *bluezConn) FindAdapters() []*Adapter {
 	return adapters
 }
 
+func (b *bluezConn) Available() bool {
+	b.registryMux.RLock()
+	defer b.registryMux.RUnlock()
+	return b.available
+}
+
+func (b *bluezConn) FindAgentManager() (*AgentManager, error) {
+	objects := b.GetObjectsByType(BluezInterface.AgentManager)
+	if len(objects) == 0 {
+		return nil, fmt.Errorf("No %s found", BluezInterface.AgentManager)
+	}
+	am, ok := objects[0].(*AgentManager)
+	if !ok {
+		return nil, fmt.Errorf("Object registered as AgentManager, but could not cast as AgentManager")
+	}
+	return am, nil
+}
+
 func (b *bluezConn) IntrospectPath(path string) (*base.Node, error) {
 	return b.ops.IntrospectObject(BluezDest, dbus.ObjectPath(path))
 }
@@ -263,20 +352,20 @@ func (b *bluezConn) GetManagedObjects(path string) (map[dbus.ObjectPath]base.Obj
 func (b *bluezConn) GetObjectsByType(oType string) []Base {
 	objects := make([]Base, 0)
 	b.registryMux.RLock()
-	defer b.registryMux.RLock()
+	defer b.registryMux.RUnlock()
 	for _, v := range b.objectRegistry {
 		if v.GetBluezInterface() == oType {
 			objects = append(objects, v)
 		}
 	}
-	fmt.Printf("Found %d objects of type %s\n", len(objects), oType)
+	logger.Debug("Found %d objects of type %s", len(objects), oType)
 	return objects
 }
 
 func (b *bluezConn) GetObjectsByInterface(interfaceName string) []Base {
 	results := make([]Base, 0)
 	b.registryMux.RLock()
-	defer b.registryMux.RLock()
+	defer b.registryMux.RUnlock()
 	for _, obj := range b.objectRegistry {
 		ifaces := obj.GetInterfaces()
 		for _, i := range ifaces {
@@ -293,14 +382,14 @@ func (b *bluezConn) GetObjectsByInterface(interfaceName string) []Base {
 func (b *bluezConn) FindObjects(pattern string, firstOnly bool) []Base {
 	// If pattern is a regex, then it can match more than one
 	if len(pattern) == 0 {
-		fmt.Println("Pattern is empty")
+		logger.Debug("Pattern is empty")
 		return nil
 	}
 	end := string(pattern[len(pattern)-1])
 	withoutEnd := string(pattern[:len(pattern)-1])
 	results := make([]Base, 0)
 	b.registryMux.RLock()
-	defer b.registryMux.RLock()
+	defer b.registryMux.RUnlock()
 	for path, obj := range b.objectRegistry {
 		if end == "*" && strings.HasPrefix(string(path), withoutEnd) {
 			results = append(results, obj)
@@ -316,12 +405,13 @@ func (b *bluezConn) FindObjects(pattern string, firstOnly bool) []Base {
 }
 
 // while it's just a slice of interfaces, it seems like the data is a slice of:
-// - the dbus.ObjectdPath,
-// - map of interfaces (string) to properties (map of property names to dbus.Variant), which we've
-//   typed to bus.ObjectMap
+//   - the dbus.ObjectdPath,
+//   - map of interfaces (string) to properties (map of property names to dbus.Variant), which we've
+//     typed to bus.ObjectMap
+//
 // So, we'll go with this assumption, and throw and error if it's not, and record when it fails
 // our expectations and deal with them later.
-func (b *bluezConn) parseSignalBody(signalBody []interface{}) (dbus.ObjectPath, base.ObjectMap, error) {
+func parseSignalBody(signalBody []interface{}) (dbus.ObjectPath, base.ObjectMap, error) {
 	var path dbus.ObjectPath
 	var props base.ObjectMap
 	for _, i := range signalBody {
@@ -342,69 +432,207 @@ func (b *bluezConn) parseSignalBody(signalBody []interface{}) (dbus.ObjectPath,
 	return path, props, nil
 }
 
+// PropertiesChanged has a different body: the interface name, the map of changed properties,
+// and the names of the invalidated properties.
+func parsePropertiesChanged(signalBody []interface{}) (string, map[string]dbus.Variant, []string, error) {
+	if len(signalBody) != 3 {
+		return "", nil, nil, fmt.Errorf("PropertiesChanged body had %d items, not 3", len(signalBody))
+	}
+	iface, ok := signalBody[0].(string)
+	if !ok {
+		return "", nil, nil, fmt.Errorf("PropertiesChanged interface was %s", reflect.TypeOf(signalBody[0]))
+	}
+	changed, ok := signalBody[1].(map[string]dbus.Variant)
+	if !ok {
+		return "", nil, nil, fmt.Errorf("PropertiesChanged properties were %s", reflect.TypeOf(signalBody[1]))
+	}
+	invalidated, ok := signalBody[2].([]string)
+	if !ok {
+		return "", nil, nil, fmt.Errorf("PropertiesChanged invalidated were %s", reflect.TypeOf(signalBody[2]))
+	}
+
+	return iface, changed, invalidated, nil
+}
+
+// InterfacesRemoved has the object path, and the names of the interfaces that were removed.
+func parseInterfacesRemoved(signalBody []interface{}) (dbus.ObjectPath, []string, error) {
+	if len(signalBody) != 2 {
+		return "", nil, fmt.Errorf("InterfacesRemoved body had %d items, not 2", len(signalBody))
+	}
+	path, ok := signalBody[0].(dbus.ObjectPath)
+	if !ok {
+		return "", nil, fmt.Errorf("InterfacesRemoved path was %s", reflect.TypeOf(signalBody[0]))
+	}
+	ifaces, ok := signalBody[1].([]string)
+	if !ok {
+		return "", nil, fmt.Errorf("InterfacesRemoved interfaces were %s", reflect.TypeOf(signalBody[1]))
+	}
+
+	return path, ifaces, nil
+}
+
+// removeObjects removes the object and its children from the registry. The registry lock
+// must be held. The removed objects are returned.
+func (b *bluezConn) removeObjects(path dbus.ObjectPath) map[dbus.ObjectPath]Base {
+	removed := make(map[dbus.ObjectPath]Base)
+	prefix := string(path) + "/"
+	for p, obj := range b.objectRegistry {
+		if p == path || strings.HasPrefix(string(p), prefix) {
+			removed[p] = obj
+			delete(b.objectRegistry, p)
+		}
+	}
+
+	return removed
+}
+
+// handleInterfacesRemoved removes the interfaces from the object. If the object lost its
+// bluez interface, it is removed from the registry, along with its children. The adapter
+// listeners get the change to the object, and the listeners on the paths of any removed
+// object get the removed event.
+func (b *bluezConn) handleInterfacesRemoved(sigData *dbus.Signal) {
+	path, ifaces, err := parseInterfacesRemoved(sigData.Body)
+	if err != nil {
+		logger.Info("Signal Body unhandled: %s: %s", err, sigData.Body)
+		return
+	}
+	b.registryMux.Lock()
+	obj, ok := b.objectRegistry[path]
+	if !ok {
+		b.registryMux.Unlock()
+		logger.Debug("InterfacesRemoved for unknown path %s", path)
+		return
+	}
+	var removed map[dbus.ObjectPath]Base
+	changeType := ObjectInterfacesRemoved
+	if obj.RemoveInterfaces(ifaces) {
+		removed = b.removeObjects(path)
+		changeType = ObjectRemoved
+	}
+	b.registryMux.Unlock()
+	for p, o := range removed {
+		b.events.publish(deviceEvent(EventDeviceLost, p, o)...)
+	}
+
+	data := newObjectChangedData(path, obj, sigData.Name, changeType)
+	data.Interfaces = ifaces
+	subs := b.watches.matching(func(sub *Subscription) bool {
+		_, ok := removed[sub.path]
+		return ok || sub.watchesAncestor(path) &&
+			sub.wants(bus.ObjectManager, bus.ObjectManagerFuncs.InterfacesRemoved)
+	})
+	for _, sub := range subs {
+		if child, ok := removed[sub.path]; ok && sub.path != path {
+			sub.send(newObjectChangedData(sub.path, child, sigData.Name, ObjectRemoved))
+		} else {
+			sub.send(data)
+		}
+	}
+}
+
+// handlePropertiesChanged updates the cached properties of the object, and forwards the
+// changes to the listener on the path
+func (b *bluezConn) handlePropertiesChanged(sigData *dbus.Signal) {
+	iface, changed, invalidated, err := parsePropertiesChanged(sigData.Body)
+	if err != nil {
+		logger.Info("Signal Body unhandled: %s: %s", err, sigData.Body)
+		return
+	}
+	b.registryMux.RLock()
+	obj, ok := b.objectRegistry[sigData.Path]
+	b.registryMux.RUnlock()
+	old := make(map[string]interface{})
+	if ok && obj.GetBluezInterface() == iface {
+		for name := range changed {
+			old[name] = obj.Property(name)
+		}
+		for _, name := range invalidated {
+			old[name] = obj.Property(name)
+		}
+		obj.UpdateProperties(iface, changed, invalidated)
+	}
+	b.events.publish(propertyEvents(sigData.Path, obj, iface, old, changed, invalidated)...)
+
+	subs := b.watches.matching(func(sub *Subscription) bool {
+		return sub.path == sigData.Path &&
+			sub.wants(bus.Properties, bus.PropertiesFuncs.PropertiesChanged)
+	})
+	data := newObjectChangedData(sigData.Path, obj, sigData.Name, ObjectPropertiesChanged)
+	data.Interface = iface
+	data.Properties = changed
+	data.Invalidated = invalidated
+	for _, sub := range subs {
+		sub.send(data)
+	}
+}
+
 // While this reads channel that is passed to dbus, any other gooutine can pass the
 // same data.
 func (b *bluezConn) handleSignals(ctx context.Context) {
 	cancelled := false
 	for !cancelled {
 		select {
-		case sigData := <-b.busSignalCh:
+		case sigData, ok := <-b.busSignalCh:
+			if !ok {
+				// The connection closes the channel when it's closed
+				return
+			}
 			if base.DumpData {
-				_, err := test.MarshalSignal(sigData)
+				_, err := bus.MarshalSignal(sigData)
 				if err != nil {
 					logger.Info("Unable to marshal signal: %s", err)
 				}
 			}
-			path, data, err := b.parseSignalBody(sigData.Body)
+			b.monitors.publish(sigData)
+			if sigData.Name == bus.Properties+"."+bus.PropertiesFuncs.PropertiesChanged {
+				b.handlePropertiesChanged(sigData)
+				continue
+			}
+			if sigData.Name == bus.DBus+"."+bus.DBusFuncs.NameOwnerChanged {
+				b.handleNameOwnerChanged(ctx, sigData)
+				continue
+			}
+			if sigData.Name == bus.ObjectManager+"."+bus.ObjectManagerFuncs.InterfacesRemoved {
+				b.handleInterfacesRemoved(sigData)
+				continue
+			}
+			path, data, err := parseSignalBody(sigData.Body)
 			if err != nil {
 				logger.Info("Signal Body unhandled: %s: %s", err, sigData.Body)
 				continue
 			}
-			b.registryMux.RLock()
+			b.registryMux.Lock()
 			obj, ok := b.objectRegistry[path]
-			b.registryMux.RUnlock()
 			if ok {
-				//logger.Info("Updating path %s", path)
 				obj.Update(data)
-			}
-			// Doesn't exist. Create the new object
-			//logger.Info("Creating new path %s", path)
-			obj = b.createObject(path, data)
-			if obj == nil {
-				logger.Info("Unable to create object with path %s", path)
-			}
-			b.registryMux.RLock()
-			b.objectRegistry[path] = obj
-			b.registryMux.RUnlock()
-			// Now, forward this to anyone listening on this path.
-			sent := false
-			b.sigWatchersMux.RLock()
-			for p, listener := range b.signalWatchers {
-				if listener == nil {
-					logger.Info("nil listener")
-					continue
-				}
-				// the Added and Removed are for the adapter, so all of them
-				// will get sent do the channel.
-				trimmed := strings.TrimPrefix(sigData.Name, bus.ObjectManager+".")
-				if trimmed == bus.ObjectManagerFuncs.InterfacesAdded ||
-					trimmed == bus.ObjectManagerFuncs.InterfacesRemoved {
-					if len(strings.Split(string(p), "/")) == 4 { // /org/bluez/hci0
-						listener <- newObjectChangedData(path, obj, sigData.Name)
-						sent = true
-					}
-				} else if path == p {
-					fmt.Println("Non newObjectChangedData channel data")
+			} else {
+				// Doesn't exist. Create the new object
+				obj = b.createObject(path, data)
+				if obj == nil {
+					logger.Info("Unable to create object with path %s", path)
 				} else {
-					fmt.Printf("%s: Non handled data: %s", sigData.Name, path)
+					b.objectRegistry[path] = obj
 				}
 			}
-			b.sigWatchersMux.RUnlock()
-			if !sent {
+			b.registryMux.Unlock()
+			if !ok {
+				b.events.publish(deviceEvent(EventDeviceFound, path, obj)...)
+			}
+			// Now, forward this to anyone listening on this path, or its parents. (The
+			// adapter listens for the devices.)
+			subs := b.watches.matching(func(sub *Subscription) bool {
+				return sub.watchesAncestor(path) &&
+					sub.wants(bus.ObjectManager, bus.ObjectManagerFuncs.InterfacesAdded)
+			})
+			if len(subs) == 0 {
 				logger.Info("No listeners %s sending %s to %s", sigData.Sender,
 					path, sigData.Name)
 				continue
 			}
+			changed := newObjectChangedData(path, obj, sigData.Name, ObjectAdded)
+			for _, sub := range subs {
+				sub.send(changed)
+			}
 		case <-ctx.Done():
 			// the conn will close the channel, so don't do this
 			//close(b.busSignalCh)
@@ -4,7 +4,10 @@ import (
 	"context"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/godbus/dbus/v5"
+	"github.com/shigmas/bluezog/pkg/bus"
 	"github.com/shigmas/bluezog/test"
 	"github.com/stretchr/testify/assert"
 )
@@ -77,3 +80,112 @@ func TestBluezGattObjects(t *testing.T) {
 	assert.NotEmpty(t, descriptors, "Expected to find descriptors")
 	verifyPath(t, descriptors[0], 8)
 }
+
+func TestBluezPropertiesChanged(t *testing.T) {
+	bluez, cancel := createBluez(t, "gatt")
+	defer cancel()
+
+	devicePath := dbus.ObjectPath("/org/bluez/hci0/dev_D1_40_FD_DE_C6_1C")
+	objs := bluez.FindObjects(string(devicePath), true)
+	assert.Len(t, objs, 1, "Expected to find the device")
+	device := objs[0]
+	pairs := []InterfaceSignalPair{
+		InterfaceSignalPair{bus.Properties, bus.PropertiesFuncs.PropertiesChanged},
+	}
+	ch, err := bluez.AddWatch(devicePath, pairs)
+	assert.NoError(t, err, "Unexpected error AddWatch")
+	defer bluez.RemoveWatch(devicePath, ch, pairs)
+
+	receive := func(fname string) ObjectChangedData {
+		sig, err := test.UnmarshalSignal(fname)
+		assert.NoError(t, err, "Unexpected error reading %s", fname)
+		bluez.(*bluezConn).busSignalCh <- sig
+		select {
+		case data := <-ch:
+			return data
+		case <-time.After(time.Second):
+			assert.FailNow(t, "No change received for "+fname)
+			return ObjectChangedData{}
+		}
+	}
+
+	data := receive("signal-PropertiesChanged-rssi")
+	assert.Equal(t, BluezInterface.Device, data.Interface)
+	assert.Equal(t, device, data.Object)
+	assert.Equal(t, int16(-52), data.Properties["RSSI"].Value())
+	assert.Equal(t, int16(-52), device.Property("RSSI"))
+
+	data = receive("signal-PropertiesChanged-connected")
+	assert.Len(t, data.Properties, 2)
+	assert.Equal(t, true, device.Property("Connected"))
+	assert.Equal(t, true, device.Property("ServicesResolved"))
+
+	data = receive("signal-PropertiesChanged-invalidated")
+	assert.Equal(t, []string{"RSSI"}, data.Invalidated)
+	assert.Nil(t, device.Property("RSSI"), "RSSI should have been invalidated")
+	assert.Equal(t, true, device.Property("Connected"), "Other properties should remain")
+}
+
+func TestBluezInterfacesRemoved(t *testing.T) {
+	bluez, cancel := createBluez(t, "gatt")
+	defer cancel()
+
+	adapterPath := dbus.ObjectPath("/org/bluez/hci0")
+	devicePath := dbus.ObjectPath("/org/bluez/hci0/dev_D1_40_FD_DE_C6_1C")
+	adapterPairs := []InterfaceSignalPair{
+		InterfaceSignalPair{bus.ObjectManager, bus.ObjectManagerFuncs.InterfacesAdded},
+		InterfaceSignalPair{bus.ObjectManager, bus.ObjectManagerFuncs.InterfacesRemoved},
+	}
+	adapterCh, err := bluez.AddWatch(adapterPath, adapterPairs)
+	assert.NoError(t, err, "Unexpected error AddWatch")
+	defer bluez.RemoveWatch(adapterPath, adapterCh, adapterPairs)
+	charPairs := []InterfaceSignalPair{
+		InterfaceSignalPair{bus.Properties, bus.PropertiesFuncs.PropertiesChanged},
+	}
+	charCh, err := bluez.AddWatch(testCharPath, charPairs)
+	assert.NoError(t, err, "Unexpected error AddWatch")
+	defer bluez.RemoveWatch(testCharPath, charCh, charPairs)
+
+	// The mock sends InterfacesAdded for the adapter watch, so skip those
+	receive := func(ch ObjectChangedChan) ObjectChangedData {
+		for {
+			select {
+			case data := <-ch:
+				if data.Type != ObjectAdded {
+					return data
+				}
+			case <-time.After(time.Second):
+				assert.FailNow(t, "No removal received")
+				return ObjectChangedData{}
+			}
+		}
+	}
+	send := func(fname string) {
+		sig, err := test.UnmarshalSignal(fname)
+		assert.NoError(t, err, "Unexpected error reading %s", fname)
+		bluez.(*bluezConn).busSignalCh <- sig
+	}
+
+	send("signal-InterfacesRemoved-mediacontrol")
+	data := receive(adapterCh)
+	assert.Equal(t, ObjectInterfacesRemoved, data.Type)
+	assert.Equal(t, []string{"org.bluez.MediaControl1"}, data.Interfaces)
+	objs := bluez.FindObjects("/org/bluez/hci0/dev_08_EB_ED_9D_D6_C7", true)
+	assert.Len(t, objs, 1, "Device should still be in the registry")
+	assert.NotContains(t, objs[0].GetInterfaces(), "org.bluez.MediaControl1")
+	assert.Contains(t, objs[0].GetInterfaces(), BluezInterface.Device)
+
+	assert.NotEmpty(t, bluez.GetObjectsByInterface(BluezInterface.GATTService))
+	send("signal-InterfacesRemoved-device")
+	data = receive(adapterCh)
+	assert.Equal(t, ObjectRemoved, data.Type)
+	assert.Equal(t, devicePath, data.Path)
+	data = receive(charCh)
+	assert.Equal(t, ObjectRemoved, data.Type)
+	assert.Equal(t, dbus.ObjectPath(testCharPath), data.Path)
+
+	assert.Empty(t, bluez.FindObjects(string(devicePath)+"*", false), "Device and children should be removed")
+	assert.Empty(t, bluez.GetObjectsByInterface(BluezInterface.GATTService))
+	assert.Len(t, bluez.FindObjects("/org/bluez/hci0/dev_08_EB_ED_9D_D6_C7", true), 1,
+		"Other devices should remain")
+}
@@ -29,6 +29,7 @@ type (
 		Adapter            string
 		Device             string
 		AgentManager       string
+		Agent              string
 		MediaTransport     string
 		GATTService        string
 		GATTCharacteristic string
@@ -36,11 +37,19 @@ type (
 	}
 
 	bluezAdapter struct {
-		StartDiscovery string
-		StopDiscovery  string
-		Connect        string
-		AddressProp    string
-		AliasProp      string
+		StartDiscovery          string
+		StopDiscovery           string
+		SetDiscoveryFilter      string
+		GetDiscoveryFilters     string
+		RemoveDevice            string
+		Connect                 string
+		AddressProp             string
+		AliasProp               string
+		PoweredProp             string
+		DiscoverableProp        string
+		DiscoverableTimeoutProp string
+		PairableProp            string
+		PairableTimeoutProp     string
 	}
 
 	bluezDevice struct {
@@ -49,6 +58,7 @@ type (
 		ConnectProfile       string
 		DisconnectProfile    string
 		Pair                 string
+		CancelPairing        string
 		AddressProp          string
 		AddressTypeProp      string
 		BlockedProp          string
@@ -62,6 +72,23 @@ type (
 		LegacyPairingProp    string
 		RSSIProp             string
 		ServicesResolvedProp string
+		NameProp             string
+		IconProp             string
+		ClassProp            string
+		AppearanceProp       string
+		BondedProp           string
+		WakeAllowedProp      string
+		ModaliasProp         string
+		TxPowerProp          string
+		ManufacturerDataProp string
+		AdvertisingFlagsProp string
+		AdvertisingDataProp  string
+	}
+
+	bluezAgentManager struct {
+		RegisterAgent       string
+		UnregisterAgent     string
+		RequestDefaultAgent string
 	}
 
 	bluezGATTService struct {
@@ -69,17 +96,32 @@ type (
 		PrimaryProp  string
 		IncludesProp string
 		HandleProp   string
+		DeviceProp   string
 	}
 
 	bluezGATTCharacteristic struct {
-		ReadValue   string
-		WriteValue  string
-		StartNotify string
-		StopNotify  string
+		ReadValue          string
+		WriteValue         string
+		StartNotify        string
+		StopNotify         string
+		AcquireNotify      string
+		AcquireWrite       string
+		ValueProp          string
+		NotifyAcquiredProp string
+		WriteAcquiredProp  string
+		UUIDProp           string
+		ServiceProp        string
+		FlagsProp          string
+		HandleProp         string
+		NotifyingProp      string
 	}
 	bluezGATTDescriptor struct {
-		ReadValue  string
-		WriteValue string
+		ReadValue          string
+		WriteValue         string
+		UUIDProp           string
+		CharacteristicProp string
+		FlagsProp          string
+		HandleProp         string
 	}
 )
 
@@ -89,6 +131,7 @@ var (
 		Adapter:            BluezDest + ".Adapter1",
 		Device:             BluezDest + ".Device1",
 		AgentManager:       BluezDest + ".AgentManager1",
+		Agent:              BluezDest + ".Agent1",
 		MediaTransport:     BluezDest + ".MediaTransport1",
 		GATTService:        BluezDest + ".GattService1",
 		GATTCharacteristic: BluezDest + ".GattCharacteristic1",
@@ -97,13 +140,21 @@ var (
 
 	// BluezAdapter are the constants for the adapter
 	BluezAdapter = bluezAdapter{
-		StartDiscovery: BluezInterface.Adapter + ".StartDiscovery",
-		StopDiscovery:  BluezInterface.Adapter + ".StopDiscovery",
-		Connect:        BluezInterface.Adapter + ".Connect",
+		StartDiscovery:      BluezInterface.Adapter + ".StartDiscovery",
+		StopDiscovery:       BluezInterface.Adapter + ".StopDiscovery",
+		SetDiscoveryFilter:  BluezInterface.Adapter + ".SetDiscoveryFilter",
+		GetDiscoveryFilters: BluezInterface.Adapter + ".GetDiscoveryFilters",
+		RemoveDevice:        BluezInterface.Adapter + ".RemoveDevice",
+		Connect:             BluezInterface.Adapter + ".Connect",
 		// Address:        BluezInterface.Adapter + ".Address",
 		// Alias:          BluezInterface.Adapter + ".Alias",
-		AddressProp: "Address",
-		AliasProp:   "Alias",
+		AddressProp:             "Address",
+		AliasProp:               "Alias",
+		PoweredProp:             "Powered",
+		DiscoverableProp:        "Discoverable",
+		DiscoverableTimeoutProp: "DiscoverableTimeout",
+		PairableProp:            "Pairable",
+		PairableTimeoutProp:     "PairableTimeout",
 	}
 
 	// BluezDevice are the constants in the BluezInterface.Device interface
@@ -113,6 +164,7 @@ var (
 		ConnectProfile:       BluezInterface.Device + ".ConnectProfile",
 		DisconnectProfile:    BluezInterface.Device + ".DisconnectProfile",
 		Pair:                 BluezInterface.Device + ".Pair",
+		CancelPairing:        BluezInterface.Device + ".CancelPairing",
 		AddressProp:          "Address",
 		AddressTypeProp:      "AddressType",
 		BlockedProp:          "Blocked",
@@ -126,6 +178,24 @@ var (
 		LegacyPairingProp:    "LegacyPairing",
 		RSSIProp:             "RSSI",
 		ServicesResolvedProp: "ServicesResolved",
+		NameProp:             "Name",
+		IconProp:             "Icon",
+		ClassProp:            "Class",
+		AppearanceProp:       "Appearance",
+		BondedProp:           "Bonded",
+		WakeAllowedProp:      "WakeAllowed",
+		ModaliasProp:         "Modalias",
+		TxPowerProp:          "TxPower",
+		ManufacturerDataProp: "ManufacturerData",
+		AdvertisingFlagsProp: "AdvertisingFlags",
+		AdvertisingDataProp:  "AdvertisingData",
+	}
+
+	// BluezAgentManager are the constants for the agent manager
+	BluezAgentManager = bluezAgentManager{
+		RegisterAgent:       BluezInterface.AgentManager + ".RegisterAgent",
+		UnregisterAgent:     BluezInterface.AgentManager + ".UnregisterAgent",
+		RequestDefaultAgent: BluezInterface.AgentManager + ".RequestDefaultAgent",
 	}
 
 	// BluezGATTService are the constants for the GATT service
@@ -134,19 +204,34 @@ var (
 		PrimaryProp:  "Primary",
 		IncludesProp: "Includes",
 		HandleProp:   "Handle",
+		DeviceProp:   "Device",
 	}
 
 	// BluezGATTCharacteristic are the constants for the GATT characteristic
 	BluezGATTCharacteristic = bluezGATTCharacteristic{
-		ReadValue:   BluezInterface.GATTCharacteristic + ".ReadValue",
-		WriteValue:  BluezInterface.GATTCharacteristic + ".WriteValue",
-		StartNotify: BluezInterface.GATTCharacteristic + ".StartNotify",
-		StopNotify:  BluezInterface.GATTCharacteristic + ".StopNotify",
+		ReadValue:          BluezInterface.GATTCharacteristic + ".ReadValue",
+		WriteValue:         BluezInterface.GATTCharacteristic + ".WriteValue",
+		StartNotify:        BluezInterface.GATTCharacteristic + ".StartNotify",
+		StopNotify:         BluezInterface.GATTCharacteristic + ".StopNotify",
+		AcquireNotify:      BluezInterface.GATTCharacteristic + ".AcquireNotify",
+		AcquireWrite:       BluezInterface.GATTCharacteristic + ".AcquireWrite",
+		ValueProp:          "Value",
+		NotifyAcquiredProp: "NotifyAcquired",
+		WriteAcquiredProp:  "WriteAcquired",
+		UUIDProp:           "UUID",
+		ServiceProp:        "Service",
+		FlagsProp:          "Flags",
+		HandleProp:         "Handle",
+		NotifyingProp:      "Notifying",
 	}
 
 	// BluezGATTDescriptor are the constants for the GATT descriptor
 	BluezGATTDescriptor = bluezGATTDescriptor{
-		ReadValue:  "ReadValue",
-		WriteValue: "WriteValue",
+		ReadValue:          BluezInterface.GATTDescriptor + ".ReadValue",
+		WriteValue:         BluezInterface.GATTDescriptor + ".WriteValue",
+		UUIDProp:           "UUID",
+		CharacteristicProp: "Characteristic",
+		FlagsProp:          "Flags",
+		HandleProp:         "Handle",
 	}
 )
@@ -2,19 +2,56 @@ package protocol
 
 import (
 	"context"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 
 	"github.com/godbus/dbus/v5"
 	"github.com/shigmas/bluezog/pkg/base"
-	"github.com/shigmas/bluezog/pkg/bus"
 )
 
 type (
 	// Device is a bluetooth device associated with an adapter
 	Device struct {
 		BaseObject
-		discoveryCh ObjectChangedChan
 	}
+
+	// DeviceSnapshot is a copy of the cached properties of the Device, with the types
+	// converted. Changing it doesn't change the Device. The properties that the device
+	// doesn't have are omitted from the JSON.
+	DeviceSnapshot struct {
+		Path             dbus.ObjectPath     `json:"path"`
+		Adapter          dbus.ObjectPath     `json:"adapter,omitempty"`
+		Address          string              `json:"address"`
+		AddressType      string              `json:"addressType,omitempty"`
+		Name             string              `json:"name,omitempty"`
+		Alias            string              `json:"alias,omitempty"`
+		Icon             string              `json:"icon,omitempty"`
+		Class            *uint32             `json:"class,omitempty"`
+		Appearance       *uint16             `json:"appearance,omitempty"`
+		Modalias         string              `json:"modalias,omitempty"`
+		UUIDs            []string            `json:"uuids,omitempty"`
+		Paired           bool                `json:"paired"`
+		Bonded           bool                `json:"bonded"`
+		Trusted          bool                `json:"trusted"`
+		Blocked          bool                `json:"blocked"`
+		WakeAllowed      bool                `json:"wakeAllowed"`
+		LegacyPairing    bool                `json:"legacyPairing"`
+		Connected        bool                `json:"connected"`
+		ServicesResolved bool                `json:"servicesResolved"`
+		RSSI             *int16              `json:"rssi,omitempty"`
+		TxPower          *int16              `json:"txPower,omitempty"`
+		ManufacturerData map[uint16]HexBytes `json:"manufacturerData,omitempty"`
+		ServiceData      map[string]HexBytes `json:"serviceData,omitempty"`
+		AdvertisingFlags HexBytes            `json:"advertisingFlags,omitempty"`
+		AdvertisingData  map[byte]HexBytes   `json:"advertisingData,omitempty"`
+		// Other has the properties that aren't above, like ones added in newer versions of
+		// bluez. The values are in the dbus text format, like "@n -60".
+		Other map[string]string `json:"other,omitempty"`
+	}
+
+	// HexBytes is written to JSON as a hex string, instead of base64
+	HexBytes []byte
 )
 
 var (
@@ -38,34 +75,15 @@ func newDevice(conn *bluezConn, name dbus.ObjectPath, data base.ObjectMap) *Devi
 	return &d
 }
 
-// Connect to the device
+// Connect to the device. The Connected and ServicesResolved properties are updated by the
+// PropertiesChanged signals.
 func (d *Device) Connect(ctx context.Context) error {
-	err := d.bluez.ops.CallFunction(ctx, BluezDest, d.Path, BluezDevice.Connect)
-	if err != nil {
-		return err
-	}
-	d.discoveryCh, err = d.bluez.AddWatch(d.Path,
-		[]InterfaceSignalPair{
-			InterfaceSignalPair{bus.Properties,
-				bus.PropertiesFuncs.PropertiesChanged},
-		})
-
-	return err
+	return convertError(d.bluez.ops.CallFunction(ctx, BluezDest, d.Path, BluezDevice.Connect))
 }
 
 // Disconnect from the device
 func (d *Device) Disconnect(ctx context.Context) error {
-	err := d.bluez.ops.CallFunction(ctx, BluezDest, d.Path, BluezDevice.Disconnect)
-	if err != nil {
-		return err
-	}
-	d.discoveryCh, err = d.bluez.AddWatch(d.Path,
-		[]InterfaceSignalPair{
-			InterfaceSignalPair{bus.Properties,
-				bus.PropertiesFuncs.PropertiesChanged},
-		})
-
-	return err
+	return convertError(d.bluez.ops.CallFunction(ctx, BluezDest, d.Path, BluezDevice.Disconnect))
 }
 
 // ConnectProfile connects to the device for the specificed UUID
@@ -73,11 +91,6 @@ func (d *Device) ConnectProfile(ctx context.Context, uuid string) error {
 	// The specs don't have a return value, but we get one. So, let's see what this is.
 	var ret int
 	err := d.bluez.ops.CallFunctionWithArgs(ctx, &ret, BluezDest, d.Path, BluezDevice.ConnectProfile, uuid)
-	// d.discoveryCh, err = d.bluez.AddWatch(d.Path,
-	// 	[]InterfaceSignalPair{
-	// 		InterfaceSignalPair{bus.Properties,
-	// 			bus.PropertiesFuncs.PropertiesChanged},
-	// 	})
 
 	return err
 }
@@ -87,8 +100,33 @@ func (d *Device) DisconnectProfile(ctx context.Context, uuid string) error {
 	return d.bluez.ops.CallFunctionWithArgs(ctx, nil, BluezDest, d.Path, BluezDevice.DisconnectProfile, uuid)
 }
 
+// Pair with the device. This can take a while, since the user may need to confirm or enter
+// a passkey through the registered agent. If the device is already paired, the error
+// is ErrAlreadyExists.
+func (d *Device) Pair(ctx context.Context) error {
+	return convertError(d.bluez.ops.CallFunction(ctx, BluezDest, d.Path, BluezDevice.Pair))
+}
+
+// CancelPairing cancels a Pair that is in progress. If there isn't one, the error is
+// ErrDoesNotExist.
+func (d *Device) CancelPairing(ctx context.Context) error {
+	return convertError(d.bluez.ops.CallFunction(ctx, BluezDest, d.Path, BluezDevice.CancelPairing))
+}
+
+// SetTrusted marks the device as trusted, so it can connect without authorization
+func (d *Device) SetTrusted(trusted bool) error {
+	return d.SetProperty(BluezDevice.TrustedProp, trusted)
+}
+
+// SetBlocked blocks the device, disconnecting it and rejecting any connections.
+func (d *Device) SetBlocked(blocked bool) error {
+	return d.SetProperty(BluezDevice.BlockedProp, blocked)
+}
+
 // GetProperty gets the property by key
 func (d *Device) GetProperty(prop string) (interface{}, error) {
+	d.propMux.RLock()
+	defer d.propMux.RUnlock()
 	variant, ok := d.properties[prop]
 	if !ok {
 		return nil, fmt.Errorf("No property %s", prop)
@@ -96,3 +134,306 @@ func (d *Device) GetProperty(prop string) (interface{}, error) {
 
 	return variant.Value(), nil
 }
+
+// The accessors use the cached properties, which are kept up to date by PropertiesChanged.
+// The properties that are optional, like RSSI, which is only there while the device is
+// advertising, also return false if the device doesn't have them.
+
+// Address returns the bluetooth address, like 00:11:22:33:44:55
+func (d *Device) Address() string {
+	v, _ := d.Property(BluezDevice.AddressProp).(string)
+	return v
+}
+
+// AddressType returns "public" or "random"
+func (d *Device) AddressType() string {
+	v, _ := d.Property(BluezDevice.AddressTypeProp).(string)
+	return v
+}
+
+// Adapter returns the path of the adapter the device belongs to
+func (d *Device) Adapter() dbus.ObjectPath {
+	v, _ := d.Property(BluezDevice.AdapterProp).(dbus.ObjectPath)
+	return v
+}
+
+// Name returns the name the device advertised
+func (d *Device) Name() (string, bool) {
+	v, ok := d.Property(BluezDevice.NameProp).(string)
+	return v, ok
+}
+
+// Alias returns the name to show. It is the Name, unless it was set.
+func (d *Device) Alias() string {
+	v, _ := d.Property(BluezDevice.AliasProp).(string)
+	return v
+}
+
+// Class returns the class of device, for classic devices
+func (d *Device) Class() (uint32, bool) {
+	v, ok := d.Property(BluezDevice.ClassProp).(uint32)
+	return v, ok
+}
+
+// Appearance returns the external appearance of the device, for LE devices
+func (d *Device) Appearance() (uint16, bool) {
+	v, ok := d.Property(BluezDevice.AppearanceProp).(uint16)
+	return v, ok
+}
+
+// Icon returns the freedesktop icon name, like "phone"
+func (d *Device) Icon() (string, bool) {
+	v, ok := d.Property(BluezDevice.IconProp).(string)
+	return v, ok
+}
+
+// RSSI returns the signal strength from the inquiry or advertisement
+func (d *Device) RSSI() (int16, bool) {
+	v, ok := d.Property(BluezDevice.RSSIProp).(int16)
+	return v, ok
+}
+
+// TxPower returns the advertised transmit power
+func (d *Device) TxPower() (int16, bool) {
+	v, ok := d.Property(BluezDevice.TxPowerProp).(int16)
+	return v, ok
+}
+
+// Paired returns true if the device is paired
+func (d *Device) Paired() bool {
+	v, _ := d.Property(BluezDevice.PairedProp).(bool)
+	return v
+}
+
+// Trusted returns true if the device is trusted
+func (d *Device) Trusted() bool {
+	v, _ := d.Property(BluezDevice.TrustedProp).(bool)
+	return v
+}
+
+// Blocked returns true if the device is blocked
+func (d *Device) Blocked() bool {
+	v, _ := d.Property(BluezDevice.BlockedProp).(bool)
+	return v
+}
+
+// Connected returns true if the device is connected
+func (d *Device) Connected() bool {
+	v, _ := d.Property(BluezDevice.ConnectedProp).(bool)
+	return v
+}
+
+// ServicesResolved returns true if the GATT services have been discovered
+func (d *Device) ServicesResolved() bool {
+	v, _ := d.Property(BluezDevice.ServicesResolvedProp).(bool)
+	return v
+}
+
+// Services returns the GATT services of the device, in handle order. They are only in the
+// registry after the services are resolved.
+func (d *Device) Services() []*GattService {
+	children := d.children(BluezInterface.GATTService, BluezGATTService.DeviceProp)
+	services := make([]*GattService, 0, len(children))
+	for _, child := range children {
+		if s, ok := child.(*GattService); ok {
+			services = append(services, s)
+		}
+	}
+	return services
+}
+
+// WaitServicesResolved waits until the GATT services have been discovered, after Connect.
+// It returns right away if they already are.
+func (d *Device) WaitServicesResolved(ctx context.Context) error {
+	subCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// Subscribe before checking, so we can't miss the change
+	events, err := d.bluez.Subscribe(subCtx, EventFilter{
+		PathPrefix: d.Path,
+		Kinds:      []EventKind{EventServicesResolved, EventDeviceLost},
+	})
+	if err != nil {
+		return err
+	}
+	if d.ServicesResolved() {
+		return nil
+	}
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return ctx.Err()
+			}
+			if event.Path != d.Path {
+				continue
+			}
+			if event.Kind == EventDeviceLost {
+				return fmt.Errorf("Device %s was removed", d.Path)
+			}
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// UUIDs returns the service UUIDs of the device
+func (d *Device) UUIDs() []string {
+	v, _ := d.Property(BluezDevice.UUIDsProp).([]string)
+	return append([]string(nil), v...)
+}
+
+// ManufacturerData returns the advertised data, keyed by the company ID
+func (d *Device) ManufacturerData() (map[uint16][]byte, bool) {
+	v, ok := d.Property(BluezDevice.ManufacturerDataProp).(map[uint16]dbus.Variant)
+	if !ok {
+		return nil, false
+	}
+	data := make(map[uint16][]byte, len(v))
+	for k, variant := range v {
+		data[k] = variantBytes(variant)
+	}
+	return data, true
+}
+
+// ServiceData returns the advertised data, keyed by the service UUID
+func (d *Device) ServiceData() (map[string][]byte, bool) {
+	v, ok := d.Property(BluezDevice.ServiceDataProp).(map[string]dbus.Variant)
+	if !ok {
+		return nil, false
+	}
+	data := make(map[string][]byte, len(v))
+	for k, variant := range v {
+		data[k] = variantBytes(variant)
+	}
+	return data, true
+}
+
+// AdvertisingFlags returns the flags from the advertisement
+func (d *Device) AdvertisingFlags() ([]byte, bool) {
+	v, ok := d.Property(BluezDevice.AdvertisingFlagsProp).([]byte)
+	return append([]byte(nil), v...), ok
+}
+
+// variantBytes is the []byte in the variant. The data in the advertisements is always
+// bytes, but we don't panic if it's not.
+func variantBytes(variant dbus.Variant) []byte {
+	b, _ := variant.Value().([]byte)
+	return append([]byte(nil), b...)
+}
+
+// Snapshot returns a copy of all the cached properties
+func (d *Device) Snapshot() DeviceSnapshot {
+	snap := DeviceSnapshot{Path: d.Path}
+	for name, variant := range d.AllProperties() {
+		value := variant.Value()
+		switch name {
+		case BluezDevice.AdapterProp:
+			snap.Adapter, _ = value.(dbus.ObjectPath)
+		case BluezDevice.AddressProp:
+			snap.Address, _ = value.(string)
+		case BluezDevice.AddressTypeProp:
+			snap.AddressType, _ = value.(string)
+		case BluezDevice.NameProp:
+			snap.Name, _ = value.(string)
+		case BluezDevice.AliasProp:
+			snap.Alias, _ = value.(string)
+		case BluezDevice.IconProp:
+			snap.Icon, _ = value.(string)
+		case BluezDevice.ClassProp:
+			if v, ok := value.(uint32); ok {
+				snap.Class = &v
+			}
+		case BluezDevice.AppearanceProp:
+			if v, ok := value.(uint16); ok {
+				snap.Appearance = &v
+			}
+		case BluezDevice.ModaliasProp:
+			snap.Modalias, _ = value.(string)
+		case BluezDevice.UUIDsProp:
+			v, _ := value.([]string)
+			snap.UUIDs = append([]string(nil), v...)
+		case BluezDevice.PairedProp:
+			snap.Paired, _ = value.(bool)
+		case BluezDevice.BondedProp:
+			snap.Bonded, _ = value.(bool)
+		case BluezDevice.TrustedProp:
+			snap.Trusted, _ = value.(bool)
+		case BluezDevice.BlockedProp:
+			snap.Blocked, _ = value.(bool)
+		case BluezDevice.WakeAllowedProp:
+			snap.WakeAllowed, _ = value.(bool)
+		case BluezDevice.LegacyPairingProp:
+			snap.LegacyPairing, _ = value.(bool)
+		case BluezDevice.ConnectedProp:
+			snap.Connected, _ = value.(bool)
+		case BluezDevice.ServicesResolvedProp:
+			snap.ServicesResolved, _ = value.(bool)
+		case BluezDevice.RSSIProp:
+			if v, ok := value.(int16); ok {
+				snap.RSSI = &v
+			}
+		case BluezDevice.TxPowerProp:
+			if v, ok := value.(int16); ok {
+				snap.TxPower = &v
+			}
+		case BluezDevice.ManufacturerDataProp:
+			if v, ok := value.(map[uint16]dbus.Variant); ok {
+				snap.ManufacturerData = make(map[uint16]HexBytes, len(v))
+				for k, variant := range v {
+					snap.ManufacturerData[k] = variantBytes(variant)
+				}
+			}
+		case BluezDevice.ServiceDataProp:
+			if v, ok := value.(map[string]dbus.Variant); ok {
+				snap.ServiceData = make(map[string]HexBytes, len(v))
+				for k, variant := range v {
+					snap.ServiceData[k] = variantBytes(variant)
+				}
+			}
+		case BluezDevice.AdvertisingFlagsProp:
+			if v, ok := value.([]byte); ok {
+				snap.AdvertisingFlags = append(HexBytes(nil), v...)
+			}
+		case BluezDevice.AdvertisingDataProp:
+			if v, ok := value.(map[byte]dbus.Variant); ok {
+				snap.AdvertisingData = make(map[byte]HexBytes, len(v))
+				for k, variant := range v {
+					snap.AdvertisingData[k] = variantBytes(variant)
+				}
+			}
+		default:
+			if snap.Other == nil {
+				snap.Other = make(map[string]string)
+			}
+			snap.Other[name] = variant.String()
+		}
+	}
+
+	return snap
+}
+
+// String is the bytes in hex
+func (h HexBytes) String() string {
+	return hex.EncodeToString(h)
+}
+
+// MarshalJSON writes the bytes as a hex string
+func (h HexBytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(hex.EncodeToString(h))
+}
+
+// UnmarshalJSON reads the hex string written by MarshalJSON
+func (h *HexBytes) UnmarshalJSON(data []byte) error {
+	var str string
+	err := json.Unmarshal(data, &str)
+	if err != nil {
+		return err
+	}
+	b, err := hex.DecodeString(str)
+	if err != nil {
+		return err
+	}
+	*h = b
+	return nil
+}
@@ -0,0 +1,105 @@
+package protocol
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/shigmas/bluezog/pkg/base"
+	"github.com/shigmas/bluezog/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDevicePairing(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bluez, err := InitializeBluez(ctx, test.NewBusMock("simple"))
+	assert.NoError(t, err, "Unexpected error initializing adapter")
+
+	objs := bluez.FindObjects("/org/bluez/hci0/dev_D1_40_FD_DE_C6_1C", true)
+	assert.Len(t, objs, 1, "Expected to find the device")
+	device, ok := objs[0].(*Device)
+	assert.True(t, ok, "Object was not a device")
+
+	t.Run("Pair", func(t *testing.T) {
+		assert.NoError(t, device.Pair(ctx), "Unexpected error in Pair")
+		err := device.CancelPairing(ctx)
+		assert.True(t, errors.Is(err, ErrDoesNotExist), "Expected ErrDoesNotExist, not %s", err)
+	})
+	t.Run("Trust", func(t *testing.T) {
+		assert.NoError(t, device.SetTrusted(true), "Unexpected error in SetTrusted")
+		assert.Equal(t, true, device.Property(BluezDevice.TrustedProp))
+		assert.NoError(t, device.SetBlocked(false), "Unexpected error in SetBlocked")
+		assert.Equal(t, false, device.Property(BluezDevice.BlockedProp))
+	})
+	t.Run("Remove", func(t *testing.T) {
+		adapter := bluez.FindAdapters()[0]
+		assert.NoError(t, adapter.RemoveDevice(ctx, device.GetPath()), "Unexpected error in RemoveDevice")
+	})
+}
+
+func TestConvertError(t *testing.T) {
+	err := convertError(dbus.Error{
+		Name: "org.bluez.Error.AuthenticationFailed",
+		Body: []interface{}{"Authentication Failed"},
+	})
+	assert.True(t, errors.Is(err, ErrAuthenticationFailed), "Expected ErrAuthenticationFailed")
+	assert.False(t, errors.Is(err, ErrAlreadyExists), "Should not match ErrAlreadyExists")
+	var bluezErr *Error
+	assert.True(t, errors.As(err, &bluezErr), "Expected an Error")
+	assert.Equal(t, "Authentication Failed", bluezErr.Message)
+
+	other := dbus.Error{Name: "org.freedesktop.DBus.Error.UnknownMethod"}
+	assert.Equal(t, other, convertError(other), "Non bluez errors should be unchanged")
+	assert.Nil(t, convertError(nil))
+}
+
+func TestDeviceProperties(t *testing.T) {
+	path := dbus.ObjectPath("/org/bluez/hci0/dev_C4_7C_8D_6A_3F_01")
+	device := newDevice(nil, path, base.ObjectMap{
+		BluezInterface.Device: {
+			"Address":          dbus.MakeVariant("C4:7C:8D:6A:3F:01"),
+			"AddressType":      dbus.MakeVariant("random"),
+			"Adapter":          dbus.MakeVariant(dbus.ObjectPath("/org/bluez/hci0")),
+			"Alias":            dbus.MakeVariant("Thermometer"),
+			"Appearance":       dbus.MakeVariant(uint16(0x0300)),
+			"Paired":           dbus.MakeVariant(false),
+			"Connected":        dbus.MakeVariant(true),
+			"RSSI":             dbus.MakeVariant(int16(-58)),
+			"UUIDs":            dbus.MakeVariant([]string{"00001809-0000-1000-8000-00805f9b34fb"}),
+			"ManufacturerData": dbus.MakeVariant(map[uint16]dbus.Variant{0x004c: dbus.MakeVariant([]byte{0x02, 0x15})}),
+			"ServiceData":      dbus.MakeVariant(map[string]dbus.Variant{"0000feaa-0000-1000-8000-00805f9b34fb": dbus.MakeVariant([]byte{0x10})}),
+			"AdvertisingFlags": dbus.MakeVariant([]byte{0x06}),
+			"Sets":             dbus.MakeVariant(uint32(3)),
+		},
+	})
+
+	assert.Equal(t, "C4:7C:8D:6A:3F:01", device.Address())
+	assert.Equal(t, dbus.ObjectPath("/org/bluez/hci0"), device.Adapter())
+	assert.True(t, device.Connected())
+	assert.False(t, device.Trusted(), "Missing properties should be false")
+	rssi, ok := device.RSSI()
+	assert.True(t, ok)
+	assert.Equal(t, int16(-58), rssi)
+	_, ok = device.TxPower()
+	assert.False(t, ok, "TxPower wasn't advertised")
+	_, ok = device.Name()
+	assert.False(t, ok, "Name wasn't advertised")
+	mfgData, ok := device.ManufacturerData()
+	assert.True(t, ok)
+	assert.Equal(t, map[uint16][]byte{0x004c: {0x02, 0x15}}, mfgData)
+
+	snap := device.Snapshot()
+	assert.Equal(t, path, snap.Path)
+	assert.Equal(t, int16(-58), *snap.RSSI)
+	assert.Nil(t, snap.TxPower)
+	assert.Equal(t, "@u 3", snap.Other["Sets"], "Unknown properties should be kept")
+	b, err := json.Marshal(snap)
+	assert.NoError(t, err, "Unexpected error marshalling snapshot")
+	var unmarshalled DeviceSnapshot
+	assert.NoError(t, json.Unmarshal(b, &unmarshalled), "Unexpected error unmarshalling snapshot")
+	assert.Equal(t, snap, unmarshalled)
+	assert.Contains(t, string(b), `"manufacturerData":{"76":"0215"}`)
+}
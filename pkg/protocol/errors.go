@@ -0,0 +1,116 @@
+package protocol
+
+import (
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// BluezErrorPrefix is the prefix of the names of the errors returned by bluez
+const BluezErrorPrefix = BluezDest + ".Error."
+
+type (
+	// Error is an error returned by bluez over dbus. The bluez name, without the prefix,
+	// is in Name. Use errors.Is with the Err* values to check for a particular error.
+	Error struct {
+		// Name is the bluez error name, like AuthenticationFailed
+		Name string
+		// Message is the (optional) message that bluez sent with the error
+		Message string
+	}
+)
+
+var (
+	// ErrFailed is the generic bluez failure
+	ErrFailed = &Error{Name: "Failed"}
+	// ErrInProgress is returned when the operation is already in progress
+	ErrInProgress = &Error{Name: "InProgress"}
+	// ErrAlreadyExists is returned when pairing with a device that is already paired
+	ErrAlreadyExists = &Error{Name: "AlreadyExists"}
+	// ErrAlreadyConnected is returned when connecting to a connected device
+	ErrAlreadyConnected = &Error{Name: "AlreadyConnected"}
+	// ErrDoesNotExist is returned when the object (or pairing attempt) doesn't exist
+	ErrDoesNotExist = &Error{Name: "DoesNotExist"}
+	// ErrInvalidArguments is returned when the arguments weren't accepted
+	ErrInvalidArguments = &Error{Name: "InvalidArguments"}
+	// ErrNotReady is returned when the adapter isn't powered
+	ErrNotReady = &Error{Name: "NotReady"}
+	// ErrNotSupported is returned when the operation isn't supported by the device
+	ErrNotSupported = &Error{Name: "NotSupported"}
+	// ErrNotConnected is returned when the device needs to be connected first
+	ErrNotConnected = &Error{Name: "NotConnected"}
+	// ErrNotAvailable is returned when the operation is not available
+	ErrNotAvailable = &Error{Name: "NotAvailable"}
+	// ErrAuthenticationFailed is returned when pairing fails, like a wrong PIN
+	ErrAuthenticationFailed = &Error{Name: "AuthenticationFailed"}
+	// ErrAuthenticationCanceled is returned when pairing was canceled
+	ErrAuthenticationCanceled = &Error{Name: "AuthenticationCanceled"}
+	// ErrAuthenticationRejected is returned when the other side rejected pairing
+	ErrAuthenticationRejected = &Error{Name: "AuthenticationRejected"}
+	// ErrAuthenticationTimeout is returned when the pairing timed out
+	ErrAuthenticationTimeout = &Error{Name: "AuthenticationTimeout"}
+	// ErrConnectionAttemptFailed is returned when pairing couldn't connect to the device
+	ErrConnectionAttemptFailed = &Error{Name: "ConnectionAttemptFailed"}
+	// ErrNotPermitted is returned when the attribute doesn't allow the read or write
+	ErrNotPermitted = &Error{Name: "NotPermitted"}
+	// ErrNotAuthorized is returned when the attribute needs authorization, like pairing
+	ErrNotAuthorized = &Error{Name: "NotAuthorized"}
+	// ErrInvalidOffset is returned when the offset is past the end of the value
+	ErrInvalidOffset = &Error{Name: "InvalidOffset"}
+	// ErrInvalidValueLength is returned when the value written is the wrong length
+	ErrInvalidValueLength = &Error{Name: "InvalidValueLength"}
+
+	// ErrRejected is returned by an Agent to reject the request
+	ErrRejected = &Error{Name: "Rejected"}
+	// ErrCanceled is returned by an Agent when the request was canceled
+	ErrCanceled = &Error{Name: "Canceled"}
+)
+
+func (e *Error) Error() string {
+	if e.Message != "" {
+		return BluezErrorPrefix + e.Name + ": " + e.Message
+	}
+	return BluezErrorPrefix + e.Name
+}
+
+// Is matches on the Name, so the error from bluez matches the Err* values.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Name == e.Name
+}
+
+// dbusError converts the error back to the dbus error, for the methods that we export.
+func (e *Error) dbusError() *dbus.Error {
+	var body []interface{}
+	if e.Message != "" {
+		body = []interface{}{e.Message}
+	}
+	return dbus.NewError(BluezErrorPrefix+e.Name, body)
+}
+
+// convertError converts the dbus errors from bluez to our Error type. Any other error is
+// returned unchanged.
+func convertError(err error) error {
+	var dbusErr dbus.Error
+	switch e := err.(type) {
+	case dbus.Error:
+		dbusErr = e
+	case *dbus.Error:
+		dbusErr = *e
+	default:
+		return err
+	}
+	if !strings.HasPrefix(dbusErr.Name, BluezErrorPrefix) {
+		return err
+	}
+	bluezErr := &Error{
+		Name: strings.TrimPrefix(dbusErr.Name, BluezErrorPrefix),
+	}
+	if len(dbusErr.Body) > 0 {
+		if msg, ok := dbusErr.Body[0].(string); ok {
+			bluezErr.Message = msg
+		}
+	}
+
+	return bluezErr
+}
@@ -0,0 +1,340 @@
+package protocol
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/shigmas/bluezog/pkg/bus"
+	"github.com/shigmas/bluezog/pkg/logger"
+)
+
+type (
+	// EventKind is the kind of the Event
+	EventKind int
+
+	// Event is a typed change to the objects on the bus. Only the fields for the Kind are
+	// set.
+	Event struct {
+		Kind EventKind
+		// Path of the object that changed
+		Path dbus.ObjectPath
+		// Interface of the object that changed. e.g. org.bluez.Device1
+		Interface string
+		// Object that changed. For DeviceLost, it has already been removed from the registry.
+		Object Base
+		// Property is the name of the property, for PropertyChanged
+		Property string
+		// Old is the cached value of the property, or nil if we didn't have it
+		Old interface{}
+		// New is the value of the property, or nil if it was invalidated
+		New interface{}
+		// Value is the value of the characteristic, for NotificationReceived
+		Value []byte
+		// Time is when we received the signal
+		Time time.Time
+		// Dropped is the number of events that were dropped before this one, because the
+		// subscriber didn't keep up
+		Dropped int
+	}
+
+	// EventFilter selects the events for Subscribe. Each field that is empty matches all
+	// events, otherwise the event must match one of the values in every non-empty field.
+	EventFilter struct {
+		// PathPrefix matches the object path, and all the paths under it
+		PathPrefix dbus.ObjectPath
+		// Interfaces matches the interface of the object that changed
+		Interfaces []string
+		// Kinds matches the kind of event
+		Kinds []EventKind
+		// Properties matches the property name. Only events that have a property (
+		// PropertyChanged, Connected, Disconnected, ServicesResolved and
+		// NotificationReceived) will match.
+		Properties []string
+	}
+
+	// eventSubscriber is one call to Subscribe
+	eventSubscriber struct {
+		filter  EventFilter
+		ch      chan Event
+		done    chan struct{}
+		sendMux sync.RWMutex
+		closed  bool
+		// dropped is only used by the signal goroutine
+		dropped int
+	}
+
+	// eventBus sends the events to the subscribers
+	eventBus struct {
+		mux         sync.RWMutex
+		subscribers map[*eventSubscriber]struct{}
+	}
+)
+
+const (
+	// EventDeviceFound is sent when a device is added to the registry
+	EventDeviceFound EventKind = iota
+	// EventDeviceLost is sent when a device is removed from the registry
+	EventDeviceLost
+	// EventPropertyChanged is sent for each property in PropertiesChanged
+	EventPropertyChanged
+	// EventConnected is sent when the device's Connected property becomes true
+	EventConnected
+	// EventDisconnected is sent when the device's Connected property becomes false
+	EventDisconnected
+	// EventServicesResolved is sent when the device's GATT services have been discovered
+	EventServicesResolved
+	// EventNotificationReceived is sent when a characteristic's Value changes
+	EventNotificationReceived
+	// EventServiceLost is sent when bluez stops, like when bluetoothd restarts. The
+	// registry is empty until EventServiceRestored.
+	EventServiceLost
+	// EventServiceRestored is sent when bluez is available again, and the registry has
+	// been rebuilt.
+	EventServiceRestored
+)
+
+var (
+	eventKindNames = map[EventKind]string{
+		EventDeviceFound:          "DeviceFound",
+		EventDeviceLost:           "DeviceLost",
+		EventPropertyChanged:      "PropertyChanged",
+		EventConnected:            "Connected",
+		EventDisconnected:         "Disconnected",
+		EventServicesResolved:     "ServicesResolved",
+		EventNotificationReceived: "NotificationReceived",
+		EventServiceLost:          "ServiceLost",
+		EventServiceRestored:      "ServiceRestored",
+	}
+
+	// The events for devices coming and going need the ObjectManager signals
+	objectManagerSignals = []InterfaceSignalPair{
+		{bus.ObjectManager, bus.ObjectManagerFuncs.InterfacesAdded},
+		{bus.ObjectManager, bus.ObjectManagerFuncs.InterfacesRemoved},
+	}
+)
+
+func (k EventKind) String() string {
+	name, ok := eventKindNames[k]
+	if !ok {
+		return fmt.Sprintf("EventKind(%d)", int(k))
+	}
+	return name
+}
+
+// ParseEventKind returns the EventKind for the name, as returned by String. The case is
+// ignored.
+func ParseEventKind(name string) (EventKind, error) {
+	for k, n := range eventKindNames {
+		if strings.EqualFold(n, name) {
+			return k, nil
+		}
+	}
+	return 0, fmt.Errorf("Unknown event kind %s", name)
+}
+
+// Match returns true if the event passes the filter
+func (f *EventFilter) Match(event *Event) bool {
+	if f.PathPrefix != "" && event.Path != f.PathPrefix &&
+		!strings.HasPrefix(string(event.Path), strings.TrimSuffix(string(f.PathPrefix), "/")+"/") {
+		return false
+	}
+	if len(f.Interfaces) > 0 && !containsString(f.Interfaces, event.Interface) {
+		return false
+	}
+	if len(f.Kinds) > 0 {
+		found := false
+		for _, k := range f.Kinds {
+			if k == event.Kind {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(f.Properties) > 0 && !containsString(f.Properties, event.Property) {
+		return false
+	}
+
+	return true
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{
+		subscribers: make(map[*eventSubscriber]struct{}),
+	}
+}
+
+func (e *eventBus) subscribe(filter EventFilter) *eventSubscriber {
+	sub := &eventSubscriber{
+		filter: filter,
+		ch:     make(chan Event, SubscriberBufferSize),
+		done:   make(chan struct{}),
+	}
+	e.mux.Lock()
+	e.subscribers[sub] = struct{}{}
+	e.mux.Unlock()
+
+	return sub
+}
+
+func (e *eventBus) unsubscribe(sub *eventSubscriber) {
+	close(sub.done)
+	e.mux.Lock()
+	delete(e.subscribers, sub)
+	e.mux.Unlock()
+
+	sub.sendMux.Lock()
+	sub.closed = true
+	close(sub.ch)
+	sub.sendMux.Unlock()
+}
+
+// publish sends the events to the subscribers whose filter matches. Like the watches, we
+// don't hold the lock while we send.
+func (e *eventBus) publish(events ...Event) {
+	if len(events) == 0 {
+		return
+	}
+	e.mux.RLock()
+	subs := make([]*eventSubscriber, 0, len(e.subscribers))
+	for sub := range e.subscribers {
+		subs = append(subs, sub)
+	}
+	e.mux.RUnlock()
+
+	for _, sub := range subs {
+		for i := range events {
+			if sub.filter.Match(&events[i]) {
+				sub.send(events[i])
+			}
+		}
+	}
+}
+
+// send doesn't wait for the subscriber. Like the watches, the event is dropped if the
+// channel is full, and counted in the next one.
+func (s *eventSubscriber) send(event Event) {
+	s.sendMux.RLock()
+	defer s.sendMux.RUnlock()
+	if s.closed {
+		return
+	}
+	event.Dropped = s.dropped
+	select {
+	case s.ch <- event:
+		s.dropped = 0
+	default:
+		if s.dropped == 0 {
+			logger.Warn("Event subscriber is full. Dropping events")
+		}
+		s.dropped++
+	}
+}
+
+// Subscribe returns the events that match the filter. The channel is closed when the
+// context is done. It holds SubscriberBufferSize events, and the rest are dropped until
+// there is room, so read it promptly.
+func (b *bluezConn) Subscribe(ctx context.Context, filter EventFilter) (<-chan Event, error) {
+	// We need the ObjectManager signals for the devices, which we share with the watches.
+	b.watches.mux.Lock()
+	err := b.watches.addRules(BluezRootPath, objectManagerSignals)
+	b.watches.mux.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	sub := b.events.subscribe(filter)
+	go func() {
+		<-ctx.Done()
+		b.events.unsubscribe(sub)
+		b.watches.mux.Lock()
+		b.watches.removeRules(BluezRootPath, objectManagerSignals)
+		b.watches.mux.Unlock()
+	}()
+
+	return sub.ch, nil
+}
+
+// propertyEvents are the events for the changed properties. old has the cached values
+// from before the change.
+func propertyEvents(
+	path dbus.ObjectPath,
+	obj Base,
+	iface string,
+	old map[string]interface{},
+	changed map[string]dbus.Variant,
+	invalidated []string) []Event {
+	now := time.Now()
+	events := make([]Event, 0, len(changed)+len(invalidated))
+	newEvent := func(kind EventKind, name string, value interface{}) Event {
+		return Event{
+			Kind:      kind,
+			Path:      path,
+			Interface: iface,
+			Object:    obj,
+			Property:  name,
+			Old:       old[name],
+			New:       value,
+			Time:      now,
+		}
+	}
+
+	for name, variant := range changed {
+		value := variant.Value()
+		events = append(events, newEvent(EventPropertyChanged, name, value))
+		switch {
+		case iface == BluezInterface.Device && name == BluezDevice.ConnectedProp:
+			if connected, ok := value.(bool); ok && connected {
+				events = append(events, newEvent(EventConnected, name, value))
+			} else if ok {
+				events = append(events, newEvent(EventDisconnected, name, value))
+			}
+		case iface == BluezInterface.Device && name == BluezDevice.ServicesResolvedProp:
+			if resolved, ok := value.(bool); ok && resolved {
+				events = append(events, newEvent(EventServicesResolved, name, value))
+			}
+		case iface == BluezInterface.GATTCharacteristic && name == BluezGATTCharacteristic.ValueProp:
+			if bytes, ok := value.([]byte); ok {
+				event := newEvent(EventNotificationReceived, name, value)
+				event.Value = bytes
+				events = append(events, event)
+			}
+		}
+	}
+	for _, name := range invalidated {
+		events = append(events, newEvent(EventPropertyChanged, name, nil))
+	}
+
+	return events
+}
+
+// deviceEvent is DeviceFound or DeviceLost if the object is a device
+func deviceEvent(kind EventKind, path dbus.ObjectPath, obj Base) []Event {
+	if obj == nil || obj.GetBluezInterface() != BluezInterface.Device {
+		return nil
+	}
+	return []Event{
+		{
+			Kind:      kind,
+			Path:      path,
+			Interface: BluezInterface.Device,
+			Object:    obj,
+			Time:      time.Now(),
+		},
+	}
+}
@@ -0,0 +1,170 @@
+package protocol
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/shigmas/bluezog/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func receiveEvent(t *testing.T, ch <-chan Event) Event {
+	select {
+	case event, ok := <-ch:
+		assert.True(t, ok, "Event channel closed")
+		return event
+	case <-time.After(2 * time.Second):
+		assert.FailNow(t, "No event received")
+	}
+	return Event{}
+}
+
+func TestEventFilter(t *testing.T) {
+	event := Event{
+		Kind:      EventPropertyChanged,
+		Path:      "/org/bluez/hci0/dev_D1_40_FD_DE_C6_1C",
+		Interface: BluezInterface.Device,
+		Property:  "RSSI",
+	}
+	assert.True(t, (&EventFilter{}).Match(&event), "Empty filter should match everything")
+	assert.True(t, (&EventFilter{PathPrefix: "/org/bluez/hci0"}).Match(&event))
+	assert.True(t, (&EventFilter{PathPrefix: "/org/bluez/hci0/"}).Match(&event))
+	assert.False(t, (&EventFilter{PathPrefix: "/org/bluez/hci0/dev_D1"}).Match(&event),
+		"Prefix should only match whole path elements")
+	assert.True(t, (&EventFilter{Interfaces: []string{BluezInterface.Device}}).Match(&event))
+	assert.False(t, (&EventFilter{Interfaces: []string{BluezInterface.Adapter}}).Match(&event))
+	assert.True(t, (&EventFilter{Kinds: []EventKind{EventConnected, EventPropertyChanged}}).Match(&event))
+	assert.False(t, (&EventFilter{Kinds: []EventKind{EventDeviceFound}}).Match(&event))
+	assert.True(t, (&EventFilter{Properties: []string{"RSSI"}}).Match(&event))
+	assert.False(t, (&EventFilter{Properties: []string{"Connected"}, Kinds: []EventKind{EventPropertyChanged}}).Match(&event))
+
+	kind, err := ParseEventKind("devicefound")
+	assert.NoError(t, err, "Unexpected error parsing kind")
+	assert.Equal(t, EventDeviceFound, kind)
+	assert.Equal(t, "DeviceFound", kind.String())
+	_, err = ParseEventKind("nope")
+	assert.Error(t, err, "Expected error for unknown kind")
+}
+
+func TestEventSubscribe(t *testing.T) {
+	bluez, cancel := createBluez(t, "gatt")
+	defer cancel()
+	sendSignal := func(fname string) {
+		sig, err := test.UnmarshalSignal(fname)
+		assert.NoError(t, err, "Unexpected error reading %s", fname)
+		bluez.(*bluezConn).busSignalCh <- sig
+	}
+
+	devicePath := dbus.ObjectPath("/org/bluez/hci0/dev_D1_40_FD_DE_C6_1C")
+	ctx, subCancel := context.WithCancel(context.Background())
+	rssi, err := bluez.Subscribe(ctx, EventFilter{
+		PathPrefix: devicePath,
+		Properties: []string{"RSSI"},
+	})
+	assert.NoError(t, err, "Unexpected error in Subscribe")
+	connections, err := bluez.Subscribe(ctx, EventFilter{
+		Kinds: []EventKind{EventConnected, EventDisconnected, EventServicesResolved, EventDeviceLost},
+	})
+	assert.NoError(t, err, "Unexpected error in Subscribe")
+
+	sendSignal("signal-PropertiesChanged-rssi")
+	event := receiveEvent(t, rssi)
+	assert.Equal(t, EventPropertyChanged, event.Kind)
+	assert.Equal(t, devicePath, event.Path)
+	assert.Equal(t, BluezInterface.Device, event.Interface)
+	assert.Equal(t, int16(-52), event.New)
+
+	sendSignal("signal-PropertiesChanged-invalidated")
+	event = receiveEvent(t, rssi)
+	assert.Equal(t, int16(-52), event.Old)
+	assert.Nil(t, event.New, "Invalidated property should have no value")
+
+	sendSignal("signal-PropertiesChanged-connected")
+	kinds := []EventKind{receiveEvent(t, connections).Kind, receiveEvent(t, connections).Kind}
+	assert.ElementsMatch(t, []EventKind{EventConnected, EventServicesResolved}, kinds)
+
+	bluez.(*bluezConn).busSignalCh <- &dbus.Signal{
+		Path: testCharPath,
+		Name: "org.freedesktop.DBus.Properties.PropertiesChanged",
+		Body: []interface{}{
+			BluezInterface.GATTCharacteristic,
+			map[string]dbus.Variant{"Value": dbus.MakeVariant([]byte{0x0a})},
+			[]string{},
+		},
+	}
+	sendSignal("signal-InterfacesRemoved-device")
+	event = receiveEvent(t, connections)
+	assert.Equal(t, EventDeviceLost, event.Kind, "Notification should have been filtered out")
+	assert.Equal(t, devicePath, event.Path)
+
+	subCancel()
+	for range rssi {
+	}
+	for range connections {
+	}
+}
+
+func TestEventSlowSubscriber(t *testing.T) {
+	bluez, cancel := createBluez(t, "gatt")
+	defer cancel()
+	rssi, err := test.UnmarshalSignal("signal-PropertiesChanged-rssi")
+	assert.NoError(t, err, "Unexpected error reading the signal")
+
+	ctx, subCancel := context.WithCancel(context.Background())
+	defer subCancel()
+	slow, err := bluez.Subscribe(ctx, EventFilter{})
+	assert.NoError(t, err, "Unexpected error in Subscribe")
+	prompt, err := bluez.Subscribe(ctx, EventFilter{})
+	assert.NoError(t, err, "Unexpected error in Subscribe")
+
+	// No one reads slow, so its events are dropped once the buffer is full, but the other
+	// subscriber still gets them
+	for i := 0; i < SubscriberBufferSize+2; i++ {
+		bluez.(*bluezConn).busSignalCh <- rssi
+		receiveEvent(t, prompt)
+	}
+	for i := 0; i < SubscriberBufferSize; i++ {
+		assert.Zero(t, receiveEvent(t, slow).Dropped)
+	}
+	bluez.(*bluezConn).busSignalCh <- rssi
+	assert.Equal(t, 2, receiveEvent(t, slow).Dropped, "Expected the dropped events")
+}
+
+func TestEventDeviceFound(t *testing.T) {
+	bluez, cancel := createBluez(t, "gatt")
+	defer cancel()
+
+	ctx, subCancel := context.WithCancel(context.Background())
+	defer subCancel()
+	found, err := bluez.Subscribe(ctx, EventFilter{
+		PathPrefix: "/org/bluez/hci0/dev_C8_D0_83_D0_4A_FE",
+		Kinds:      []EventKind{EventDeviceFound},
+	})
+	assert.NoError(t, err, "Unexpected error in Subscribe")
+	notifications, err := bluez.Subscribe(ctx, EventFilter{
+		Kinds: []EventKind{EventNotificationReceived},
+	})
+	assert.NoError(t, err, "Unexpected error in Subscribe")
+
+	sig, err := test.UnmarshalSignal("signal-InterfacesAdded-741522808")
+	assert.NoError(t, err, "Unexpected error reading signal")
+	bluez.(*bluezConn).busSignalCh <- sig
+	event := receiveEvent(t, found)
+	assert.Equal(t, EventDeviceFound, event.Kind)
+	assert.NotNil(t, event.Object, "Found device should be in the event")
+
+	bluez.(*bluezConn).busSignalCh <- &dbus.Signal{
+		Path: testCharPath,
+		Name: "org.freedesktop.DBus.Properties.PropertiesChanged",
+		Body: []interface{}{
+			BluezInterface.GATTCharacteristic,
+			map[string]dbus.Variant{"Value": dbus.MakeVariant([]byte{0x0a, 0x0b})},
+			[]string{},
+		},
+	}
+	event = receiveEvent(t, notifications)
+	assert.Equal(t, dbus.ObjectPath(testCharPath), event.Path)
+	assert.Equal(t, []byte{0x0a, 0x0b}, event.Value)
+}
@@ -0,0 +1,265 @@
+package protocol
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+
+	"github.com/shigmas/bluezog/test"
+	"github.com/shigmas/bluezog/test/scenario"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testCharPath = "/org/bluez/hci0/dev_D1_40_FD_DE_C6_1C/service0017/char0023"
+	testDescPath = "/org/bluez/hci0/dev_D1_40_FD_DE_C6_1C/service0017/char0023/desc0025"
+)
+
+func findGattObjects(t *testing.T, bluez Bluez) (*GattCharacteristic, *GattDescriptor) {
+	objs := bluez.FindObjects(testCharPath, true)
+	assert.Len(t, objs, 1, "Expected to find the characteristic")
+	characteristic, ok := objs[0].(*GattCharacteristic)
+	assert.True(t, ok, "Object was not a characteristic")
+	objs = bluez.FindObjects(testDescPath, true)
+	assert.Len(t, objs, 1, "Expected to find the descriptor")
+	descriptor, ok := objs[0].(*GattDescriptor)
+	assert.True(t, ok, "Object was not a descriptor")
+
+	return characteristic, descriptor
+}
+
+func TestGattWrite(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bluez, err := InitializeBluez(ctx, test.NewBusMock("gatt"))
+	assert.NoError(t, err, "Unexpected error initializing adapter")
+	characteristic, descriptor := findGattObjects(t, bluez)
+
+	t.Run("Options", func(t *testing.T) {
+		opts := WriteOptions{Offset: 2, Type: WriteTypeCommand}
+		dict := opts.toDict()
+		assert.Equal(t, uint16(2), dict["offset"])
+		assert.Equal(t, "command", dict["type"])
+		assert.NotContains(t, dict, "prepare-authorize")
+	})
+	t.Run("Characteristic", func(t *testing.T) {
+		err := characteristic.WriteValue(ctx, []byte{0x01, 0x3c}, WriteOptions{Type: WriteTypeRequest})
+		assert.NoError(t, err, "Unexpected error in WriteValue")
+		err = characteristic.WriteValue(ctx, []byte{0x01}, WriteOptions{Type: "sometimes"})
+		assert.Error(t, err, "Expected error for unknown write type")
+	})
+	t.Run("Descriptor", func(t *testing.T) {
+		err := descriptor.WriteValue(ctx, []byte{0x01, 0x00}, WriteOptions{})
+		assert.NoError(t, err, "Unexpected error in WriteValue")
+	})
+}
+
+func TestGattRead(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bluez, err := InitializeBluez(ctx, test.NewBusMock("gatt"))
+	assert.NoError(t, err, "Unexpected error initializing adapter")
+	characteristic, descriptor := findGattObjects(t, bluez)
+
+	t.Run("NotPermitted", func(t *testing.T) {
+		_, err := characteristic.ReadValue(ctx, ReadOptions{})
+		assert.True(t, errors.Is(err, ErrNotPermitted), "Expected ErrNotPermitted, not %s", err)
+	})
+
+	for _, length := range []int{0, 1, 4, 20, 512} {
+		payload := make([]byte, length)
+		for i := range payload {
+			payload[i] = byte(i)
+		}
+		t.Run(fmt.Sprintf("Characteristic%d", length), func(t *testing.T) {
+			assert.NoError(t, characteristic.WriteValue(ctx, payload, WriteOptions{}))
+			val, err := characteristic.ReadValue(ctx, ReadOptions{})
+			assert.NoError(t, err, "Unexpected error in ReadValue")
+			assert.Equal(t, payload, val)
+		})
+		t.Run(fmt.Sprintf("Descriptor%d", length), func(t *testing.T) {
+			assert.NoError(t, descriptor.WriteValue(ctx, payload, WriteOptions{}))
+			val, err := descriptor.ReadValue(ctx, ReadOptions{})
+			assert.NoError(t, err, "Unexpected error in ReadValue")
+			assert.Equal(t, payload, val)
+		})
+	}
+
+	t.Run("Offset", func(t *testing.T) {
+		assert.NoError(t, characteristic.WriteValue(ctx, []byte("EnvSensor"), WriteOptions{}))
+		val, err := characteristic.ReadValue(ctx, ReadOptions{Offset: 3})
+		assert.NoError(t, err, "Unexpected error in ReadValue")
+		assert.Equal(t, []byte("Sensor"), val)
+		_, err = characteristic.ReadValue(ctx, ReadOptions{Offset: 10})
+		assert.True(t, errors.Is(err, ErrInvalidOffset), "Expected ErrInvalidOffset, not %s", err)
+	})
+
+	t.Run("Options", func(t *testing.T) {
+		opts := ReadOptions{Offset: 1, MTU: 23, Device: "/org/bluez/hci0/dev_D1_40_FD_DE_C6_1C"}
+		dict := opts.toDict()
+		assert.Len(t, dict, 3)
+		assert.Equal(t, uint16(23), dict["mtu"])
+		assert.Empty(t, (&ReadOptions{}).toDict())
+	})
+}
+
+func TestGattNotify(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bluez, err := InitializeBluez(ctx, test.NewBusMock("gatt"))
+	assert.NoError(t, err, "Unexpected error initializing adapter")
+	characteristic, _ := findGattObjects(t, bluez)
+
+	notifications, err := characteristic.StartNotify(ctx)
+	assert.NoError(t, err, "Unexpected error in StartNotify")
+	_, err = characteristic.StartNotify(ctx)
+	assert.Error(t, err, "Expected error starting notify twice")
+
+	bluez.(*bluezConn).busSignalCh <- &dbus.Signal{
+		Path: testCharPath,
+		Name: "org.freedesktop.DBus.Properties.PropertiesChanged",
+		Body: []interface{}{
+			BluezInterface.GATTCharacteristic,
+			map[string]dbus.Variant{"Value": dbus.MakeVariant([]byte{0x0a, 0x0b})},
+			[]string{},
+		},
+	}
+	select {
+	case n := <-notifications:
+		assert.Equal(t, dbus.ObjectPath(testCharPath), n.Path)
+		assert.Equal(t, []byte{0x0a, 0x0b}, n.Value)
+		assert.False(t, n.Time.IsZero(), "Notification should have a time")
+	case <-time.After(time.Second):
+		assert.Fail(t, "No notification received")
+	}
+
+	assert.NoError(t, characteristic.StopNotify(ctx), "Unexpected error in StopNotify")
+	_, ok := <-notifications
+	assert.False(t, ok, "Channel should be closed after StopNotify")
+	assert.Error(t, characteristic.StopNotify(ctx), "Expected error stopping notify twice")
+}
+
+func TestGattNotifyStoppedReader(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bluez, err := InitializeBluez(ctx, test.NewBusMock("gatt"))
+	assert.NoError(t, err, "Unexpected error initializing adapter")
+	characteristic, _ := findGattObjects(t, bluez)
+
+	notifications, err := characteristic.StartNotify(ctx)
+	assert.NoError(t, err, "Unexpected error in StartNotify")
+	// Nobody reads, so the channel fills up, and the rest wait
+	for i := 0; i < ChannelBufferSize+2; i++ {
+		bluez.(*bluezConn).busSignalCh <- &dbus.Signal{
+			Path: testCharPath,
+			Name: "org.freedesktop.DBus.Properties.PropertiesChanged",
+			Body: []interface{}{
+				BluezInterface.GATTCharacteristic,
+				map[string]dbus.Variant{"Value": dbus.MakeVariant([]byte{byte(i)})},
+				[]string{},
+			},
+		}
+	}
+	deadline := time.Now().Add(time.Second)
+	for len(notifications) < ChannelBufferSize && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	assert.NoError(t, characteristic.StopNotify(ctx), "Unexpected error in StopNotify")
+	received := 0
+	for {
+		select {
+		case _, ok := <-notifications:
+			if ok {
+				received++
+				continue
+			}
+		case <-time.After(time.Second):
+			assert.Fail(t, "Channel should be closed after StopNotify")
+		}
+		break
+	}
+	assert.Equal(t, ChannelBufferSize, received, "The waiting notifications should be dropped")
+}
+
+func TestGattTree(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bluez, err := InitializeBluez(ctx, test.NewBusMock("gatt"))
+	assert.NoError(t, err, "Unexpected error initializing adapter")
+	objs := bluez.FindObjects("/org/bluez/hci0/dev_D1_40_FD_DE_C6_1C", true)
+	if !assert.Len(t, objs, 1, "Expected to find the device") {
+		return
+	}
+	device := objs[0].(*Device)
+
+	services := device.Services()
+	if !assert.Len(t, services, 6) {
+		return
+	}
+	handles := make([]uint16, len(services))
+	for i, s := range services {
+		handles[i] = s.Handle()
+	}
+	assert.Equal(t, []uint16{0x0008, 0x000c, 0x0017, 0x0026, 0x003b, 0x0044}, handles,
+		"Services should be in handle order, from the paths")
+
+	characteristics := services[2].Characteristics()
+	if !assert.Len(t, characteristics, 6) {
+		return
+	}
+	assert.Equal(t, dbus.ObjectPath(testCharPath), characteristics[5].GetPath())
+	assert.Equal(t, uint16(0x0023), characteristics[5].Handle())
+	descriptors := characteristics[5].Descriptors()
+	if assert.Len(t, descriptors, 1) {
+		assert.Equal(t, dbus.ObjectPath(testDescPath), descriptors[0].GetPath())
+	}
+	assert.Empty(t, characteristics[1].Descriptors())
+	assert.Empty(t, services[2].IncludedServices())
+
+	// Another device's services aren't ours
+	objs = bluez.FindObjects("/org/bluez/hci0/dev_08_EB_ED_9D_D6_C7", true)
+	if assert.Len(t, objs, 1) {
+		assert.Empty(t, objs[0].(*Device).Services())
+	}
+}
+
+func TestWaitServicesResolved(t *testing.T) {
+	ops, err := scenario.LoadScenarioOperations("../../testdata/scenario-thermometer.yaml")
+	assert.NoError(t, err, "Unexpected error loading scenario")
+	defer ops.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bluez, err := InitializeBluez(ctx, ops)
+	assert.NoError(t, err, "Unexpected error initializing bluez")
+	device := bluez.FindObjects(string(thermometerPath), true)[0].(*Device)
+
+	timeoutCtx, timeoutCancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer timeoutCancel()
+	err = device.WaitServicesResolved(timeoutCtx)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "Expected timeout, not %v", err)
+
+	assert.NoError(t, device.Connect(ctx), "Unexpected error in Connect")
+	waitCtx, waitCancel := context.WithTimeout(ctx, time.Second)
+	defer waitCancel()
+	assert.NoError(t, device.WaitServicesResolved(waitCtx), "Unexpected error waiting")
+	assert.True(t, device.ServicesResolved())
+	assert.NoError(t, device.WaitServicesResolved(waitCtx), "Should return when resolved")
+
+	services := device.Services()
+	if assert.Len(t, services, 1) {
+		assert.Equal(t, "00001809-0000-1000-8000-00805f9b34fb", services[0].UUID())
+		assert.True(t, services[0].Primary())
+		assert.Equal(t, thermometerPath, services[0].Device())
+		characteristics := services[0].Characteristics()
+		if assert.Len(t, characteristics, 1) {
+			assert.Equal(t, []string{"read", "indicate"}, characteristics[0].Flags())
+			assert.Equal(t, "00002a1c-0000-1000-8000-00805f9b34fb", characteristics[0].UUID())
+			assert.False(t, characteristics[0].Notifying())
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/godbus/dbus/v5"
 	"github.com/shigmas/bluezog/pkg/base"
@@ -16,7 +17,59 @@ type (
 		BaseObject
 		notifyMux sync.Mutex
 		notifyCh  ObjectChangedChan
+		// notifyDone is closed by StopNotify, so we don't wait on a reader that stopped
+		notifyDone chan struct{}
 	}
+
+	// Notification is a value sent by the characteristic after StartNotify
+	Notification struct {
+		// Path of the characteristic
+		Path dbus.ObjectPath
+		// Value is the new value of the characteristic
+		Value []byte
+		// Time that we received the notification
+		Time time.Time
+	}
+
+	// ReadOptions are the options for ReadValue. Zero values are not sent to bluez.
+	ReadOptions struct {
+		// Offset to start reading at
+		Offset uint16
+		// MTU is the exchanged MTU. bluez uses this for the server, so clients don't
+		// usually need it.
+		MTU uint16
+		// Device is the path of the device requesting the read, for the server.
+		Device dbus.ObjectPath
+	}
+
+	// WriteType is the kind of write for WriteValue
+	WriteType string
+
+	// WriteOptions are the options for WriteValue. Zero values are not sent to bluez.
+	WriteOptions struct {
+		// Offset to start writing at
+		Offset uint16
+		// Type of the write. bluez chooses if it's empty.
+		Type WriteType
+		// PrepareAuthorize is set for a prepared write, when the server needs to
+		// authorize it first.
+		PrepareAuthorize bool
+	}
+)
+
+var (
+	notifySignals = []InterfaceSignalPair{
+		{bus.Properties, bus.PropertiesFuncs.PropertiesChanged},
+	}
+)
+
+const (
+	// WriteTypeCommand writes without a response
+	WriteTypeCommand WriteType = "command"
+	// WriteTypeRequest writes and waits for the response
+	WriteTypeRequest WriteType = "request"
+	// WriteTypeReliable writes and verifies the value that was written
+	WriteTypeReliable WriteType = "reliable"
 )
 
 func init() {
@@ -33,53 +86,183 @@ func newGattCharacteristic(conn *bluezConn, name dbus.ObjectPath, data base.Obje
 	}
 }
 
-// ReadValue reads the value from the characteristic. The function takes a dict,
-// but since the client only takes the offset, that's all we provide here.
-func (gc *GattCharacteristic) ReadValue(ctx context.Context, offset uint16) ([]byte, error) {
-	// gatt /org/bluez/hci0/dev_D1_40_FD_DE_C6_1C/service0026/char0035
-	// command gatt returned error [Method "ReadValue" with signature "a{sv}" on interface "(null)" doesn't exist
-	// ]
-	// zogctl> gatt /org/bluez/hci0/dev_D1_40_FD_DE_C6_1C/service0026/char0031
-	// command gatt returned error [Method "ReadValue" with signature "a{sv}" on interface "(null)" doesn't exist
-	// ]
-
-	args := map[string]interface{}{
-		"offset": offset,
-	}
-	// This works for the ALP's sensor (SNM00). Hard to add this as a CLI, so hardcoding it for now,
-	// but is one of the last things that should be hardcoded.
-	val := make([]byte, 4)
-	err := gc.bluez.ops.CallFunctionWithArgs(ctx, val, BluezDest, gc.Path,
-		BluezGATTCharacteristic.ReadValue, args)
-
-	return val, err
+// ReadValue reads the value from the characteristic. The value can be any length.
+func (gc *GattCharacteristic) ReadValue(ctx context.Context, opts ReadOptions) ([]byte, error) {
+	var val []byte
+	err := gc.bluez.ops.CallFunctionWithArgs(ctx, &val, BluezDest, gc.Path,
+		BluezGATTCharacteristic.ReadValue, opts.toDict())
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	return val, nil
+}
+
+// toDict converts the options to the a{sv} argument of ReadValue
+func (o *ReadOptions) toDict() map[string]interface{} {
+	dict := make(map[string]interface{})
+	if o.Offset != 0 {
+		dict["offset"] = o.Offset
+	}
+	if o.MTU != 0 {
+		dict["mtu"] = o.MTU
+	}
+	if o.Device != "" {
+		dict["device"] = o.Device
+	}
+
+	return dict
+}
+
+// toDict converts the options to the a{sv} argument of WriteValue
+func (o *WriteOptions) toDict() map[string]interface{} {
+	dict := make(map[string]interface{})
+	if o.Offset != 0 {
+		dict["offset"] = o.Offset
+	}
+	if o.Type != "" {
+		dict["type"] = string(o.Type)
+	}
+	if o.PrepareAuthorize {
+		dict["prepare-authorize"] = true
+	}
+
+	return dict
+}
+
+// WriteValue writes the data to the characteristic.
+func (gc *GattCharacteristic) WriteValue(ctx context.Context, data []byte, opts WriteOptions) error {
+	switch opts.Type {
+	case "", WriteTypeCommand, WriteTypeRequest, WriteTypeReliable:
+	default:
+		return fmt.Errorf("Unknown write type %s", opts.Type)
+	}
+
+	return convertError(gc.bluez.ops.CallFunctionWithArgs(ctx, nil, BluezDest, gc.Path,
+		BluezGATTCharacteristic.WriteValue, data, opts.toDict()))
 }
 
-// StartNotify will start receiving notifications for this characteristic
-func (gc *GattCharacteristic) StartNotify() error {
+// StartNotify will start receiving notifications for this characteristic. The
+// notifications are sent on the returned channel until StopNotify, which closes it.
+func (gc *GattCharacteristic) StartNotify(ctx context.Context) (<-chan Notification, error) {
 	gc.notifyMux.Lock()
 	defer gc.notifyMux.Unlock()
 	if gc.notifyCh != nil {
-		return fmt.Errorf("Discovery already started")
+		return nil, fmt.Errorf("Notify already started")
 	}
 
-	ch, err := gc.bluez.AddWatch(gc.Path,
-		[]InterfaceSignalPair{
-			{bus.Properties,
-				bus.PropertiesFuncs.PropertiesChanged},
-		})
+	ch, err := gc.bluez.AddWatch(gc.Path, notifySignals)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	err = gc.bluez.ops.CallFunction(ctx, BluezDest, gc.Path,
+		BluezGATTCharacteristic.StartNotify)
+	if err != nil {
+		gc.bluez.RemoveWatch(gc.Path, ch, notifySignals)
+		return nil, convertError(err)
 	}
 	gc.notifyCh = ch
+	done := make(chan struct{})
+	gc.notifyDone = done
 
-	return gc.bluez.ops.CallFunction(context.Background(), BluezDest, gc.Path,
-		BluezGATTCharacteristic.StartNotify)
+	notifications := make(chan Notification, ChannelBufferSize)
+	go func() {
+		// RemoveWatch closes ch, so we close ours when it's done, or when StopNotify is
+		// called while we're waiting for the reader.
+		defer close(notifications)
+		for data := range ch {
+			value, ok := data.Properties[BluezGATTCharacteristic.ValueProp]
+			if !ok {
+				continue
+			}
+			bytes, ok := value.Value().([]byte)
+			if !ok {
+				continue
+			}
+			select {
+			case notifications <- Notification{
+				Path:  gc.Path,
+				Value: bytes,
+				Time:  time.Now(),
+			}:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return notifications, nil
+}
+
+// restartNotify calls StartNotify again if notifications were started. This is for when
+// bluez restarts, and the watch is still there.
+func (gc *GattCharacteristic) restartNotify(ctx context.Context) error {
+	gc.notifyMux.Lock()
+	defer gc.notifyMux.Unlock()
+	if gc.notifyCh == nil {
+		return nil
+	}
 
+	return convertError(gc.bluez.ops.CallFunction(ctx, BluezDest, gc.Path,
+		BluezGATTCharacteristic.StartNotify))
 }
 
-// StopNotify will stop receiving notifications for this characteristic
-func (gc *GattCharacteristic) StopNotify() error {
-	return gc.bluez.ops.CallFunction(context.Background(), BluezDest, gc.Path,
-		BluezGATTCharacteristic.StopNotify)
+// StopNotify will stop receiving notifications for this characteristic, and close the
+// channel returned from StartNotify.
+func (gc *GattCharacteristic) StopNotify(ctx context.Context) error {
+	gc.notifyMux.Lock()
+	defer gc.notifyMux.Unlock()
+	if gc.notifyCh == nil {
+		return fmt.Errorf("Notify not started")
+	}
+	close(gc.notifyDone)
+	err := gc.bluez.RemoveWatch(gc.Path, gc.notifyCh, notifySignals)
+	gc.notifyCh = nil
+	gc.notifyDone = nil
+	if err != nil {
+		return err
+	}
+
+	return convertError(gc.bluez.ops.CallFunction(ctx, BluezDest, gc.Path,
+		BluezGATTCharacteristic.StopNotify))
+}
+
+// UUID returns the UUID of the characteristic
+func (gc *GattCharacteristic) UUID() string {
+	v, _ := gc.Property(BluezGATTCharacteristic.UUIDProp).(string)
+	return v
+}
+
+// Handle returns the attribute handle of the characteristic
+func (gc *GattCharacteristic) Handle() uint16 {
+	return gc.handle(BluezGATTCharacteristic.HandleProp)
+}
+
+// Flags returns how the characteristic can be used, like "read", "write" and "notify"
+func (gc *GattCharacteristic) Flags() []string {
+	return gc.stringsProp(BluezGATTCharacteristic.FlagsProp)
+}
+
+// Service returns the path of the service the characteristic belongs to
+func (gc *GattCharacteristic) Service() dbus.ObjectPath {
+	v, _ := gc.Property(BluezGATTCharacteristic.ServiceProp).(dbus.ObjectPath)
+	return v
+}
+
+// Notifying returns true if notifications or indications are enabled
+func (gc *GattCharacteristic) Notifying() bool {
+	v, _ := gc.Property(BluezGATTCharacteristic.NotifyingProp).(bool)
+	return v
+}
+
+// Descriptors returns the descriptors of the characteristic, in handle order
+func (gc *GattCharacteristic) Descriptors() []*GattDescriptor {
+	children := gc.children(BluezInterface.GATTDescriptor, BluezGATTDescriptor.CharacteristicProp)
+	descriptors := make([]*GattDescriptor, 0, len(children))
+	for _, child := range children {
+		if d, ok := child.(*GattDescriptor); ok {
+			descriptors = append(descriptors, d)
+		}
+	}
+	return descriptors
 }
@@ -28,14 +28,44 @@ func newGattDescriptor(conn *bluezConn, name dbus.ObjectPath, data base.ObjectMa
 	}
 }
 
-// ReadValue reads the value from the descriptor. The function takes a dict,
-// but since the client only takes the offset, that's all we provide here.
-func (gc *GattDescriptor) ReadValue(ctx context.Context, offset uint16) ([]byte, error) {
-	args := map[string]interface{}{
-		"offset": offset,
-	}
+// ReadValue reads the value from the descriptor. The value can be any length.
+func (gc *GattDescriptor) ReadValue(ctx context.Context, opts ReadOptions) ([]byte, error) {
 	var val []byte
-	err := gc.bluez.ops.CallFunctionWithArgs(ctx, val, BluezDest, gc.Path, BluezGATTDescriptor.ReadValue, args)
+	err := gc.bluez.ops.CallFunctionWithArgs(ctx, &val, BluezDest, gc.Path,
+		BluezGATTDescriptor.ReadValue, opts.toDict())
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	return val, nil
+}
+
+// WriteValue writes the data to the descriptor. The Type in the options doesn't apply to
+// descriptors, so it isn't sent.
+func (gc *GattDescriptor) WriteValue(ctx context.Context, data []byte, opts WriteOptions) error {
+	opts.Type = ""
+	return convertError(gc.bluez.ops.CallFunctionWithArgs(ctx, nil, BluezDest, gc.Path,
+		BluezGATTDescriptor.WriteValue, data, opts.toDict()))
+}
+
+// UUID returns the UUID of the descriptor
+func (gc *GattDescriptor) UUID() string {
+	v, _ := gc.Property(BluezGATTDescriptor.UUIDProp).(string)
+	return v
+}
+
+// Handle returns the attribute handle of the descriptor
+func (gc *GattDescriptor) Handle() uint16 {
+	return gc.handle(BluezGATTDescriptor.HandleProp)
+}
+
+// Flags returns how the descriptor can be used, like "read" and "write"
+func (gc *GattDescriptor) Flags() []string {
+	return gc.stringsProp(BluezGATTDescriptor.FlagsProp)
+}
 
-	return val, err
+// Characteristic returns the path of the characteristic the descriptor belongs to
+func (gc *GattDescriptor) Characteristic() dbus.ObjectPath {
+	v, _ := gc.Property(BluezGATTDescriptor.CharacteristicProp).(dbus.ObjectPath)
+	return v
 }
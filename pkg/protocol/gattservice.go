@@ -26,3 +26,57 @@ func newGattService(conn *bluezConn, name dbus.ObjectPath, data base.ObjectMap)
 		BaseObject: *newBaseObject(conn, name, BluezInterface.GATTService, data),
 	}
 }
+
+// UUID returns the UUID of the service
+func (s *GattService) UUID() string {
+	v, _ := s.Property(BluezGATTService.UUIDProp).(string)
+	return v
+}
+
+// Handle returns the attribute handle of the service
+func (s *GattService) Handle() uint16 {
+	return s.handle(BluezGATTService.HandleProp)
+}
+
+// Primary returns true if this is a primary service, not just included by others
+func (s *GattService) Primary() bool {
+	v, _ := s.Property(BluezGATTService.PrimaryProp).(bool)
+	return v
+}
+
+// Device returns the path of the device the service belongs to
+func (s *GattService) Device() dbus.ObjectPath {
+	v, _ := s.Property(BluezGATTService.DeviceProp).(dbus.ObjectPath)
+	return v
+}
+
+// Includes returns the paths of the services included by this service
+func (s *GattService) Includes() []dbus.ObjectPath {
+	v, _ := s.Property(BluezGATTService.IncludesProp).([]dbus.ObjectPath)
+	return append([]dbus.ObjectPath(nil), v...)
+}
+
+// Characteristics returns the characteristics of the service, in handle order
+func (s *GattService) Characteristics() []*GattCharacteristic {
+	children := s.children(BluezInterface.GATTCharacteristic, BluezGATTCharacteristic.ServiceProp)
+	characteristics := make([]*GattCharacteristic, 0, len(children))
+	for _, child := range children {
+		if c, ok := child.(*GattCharacteristic); ok {
+			characteristics = append(characteristics, c)
+		}
+	}
+	return characteristics
+}
+
+// IncludedServices returns the services in Includes that are in the registry
+func (s *GattService) IncludedServices() []*GattService {
+	services := make([]*GattService, 0)
+	s.bluez.registryMux.RLock()
+	defer s.bluez.registryMux.RUnlock()
+	for _, included := range s.Includes() {
+		if service, ok := s.bluez.objectRegistry[included].(*GattService); ok {
+			services = append(services, service)
+		}
+	}
+	return services
+}
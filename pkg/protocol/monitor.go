@@ -0,0 +1,200 @@
+package protocol
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/shigmas/bluezog/pkg/bus"
+	"github.com/shigmas/bluezog/pkg/logger"
+)
+
+// Monitor sends every bluez signal that changes the objects, decoded, for tools like
+// dbus-monitor. The Events and the watches are better for everything else.
+
+// MonitorBufferSize is the number of signals that a monitor holds for its reader. When it's
+// full, the signals are dropped, so a slow monitor can't hold up the connection.
+const MonitorBufferSize = 256
+
+type (
+	// MonitoredSignal is an InterfacesAdded, InterfacesRemoved or PropertiesChanged signal
+	MonitoredSignal struct {
+		// Signal is the signal from the bus
+		Signal *dbus.Signal
+		// Name is the name of the signal, without the interface. e.g. PropertiesChanged
+		Name string
+		// Path of the object. For the ObjectManager signals, it's from the body.
+		Path dbus.ObjectPath
+		// Interfaces that were added or removed, or the interface of the changed properties
+		Interfaces []string
+		// Properties of the added interfaces, or the changed properties, by interface
+		Properties map[string]map[string]dbus.Variant
+		// Invalidated are the names of the properties that were removed, for
+		// PropertiesChanged
+		Invalidated []string
+		// Time is when we received the signal
+		Time time.Time
+		// Dropped is the number of signals that were dropped before this one, because the
+		// reader didn't keep up
+		Dropped int
+	}
+
+	// signalMonitor is one call to Monitor
+	signalMonitor struct {
+		ch      chan MonitoredSignal
+		done    chan struct{}
+		sendMux sync.RWMutex
+		closed  bool
+		// dropped is only used by the signal goroutine
+		dropped int
+	}
+
+	// monitorRegistry sends the signals to the monitors
+	monitorRegistry struct {
+		mux      sync.RWMutex
+		monitors map[*signalMonitor]struct{}
+	}
+)
+
+func newMonitorRegistry() *monitorRegistry {
+	return &monitorRegistry{
+		monitors: make(map[*signalMonitor]struct{}),
+	}
+}
+
+// newMonitoredSignal decodes the signal. It returns false for the other signals, and the
+// ones that aren't for bluez's objects.
+func newMonitoredSignal(sig *dbus.Signal) (MonitoredSignal, bool, error) {
+	monitored := MonitoredSignal{Signal: sig, Time: time.Now()}
+	var err error
+	switch sig.Name {
+	case bus.ObjectManager + "." + bus.ObjectManagerFuncs.InterfacesAdded:
+		monitored.Name = bus.ObjectManagerFuncs.InterfacesAdded
+		var added map[string]map[string]dbus.Variant
+		monitored.Path, added, err = parseSignalBody(sig.Body)
+		monitored.Properties = added
+		for iface := range added {
+			monitored.Interfaces = append(monitored.Interfaces, iface)
+		}
+		sort.Strings(monitored.Interfaces)
+	case bus.ObjectManager + "." + bus.ObjectManagerFuncs.InterfacesRemoved:
+		monitored.Name = bus.ObjectManagerFuncs.InterfacesRemoved
+		monitored.Path, monitored.Interfaces, err = parseInterfacesRemoved(sig.Body)
+	case bus.Properties + "." + bus.PropertiesFuncs.PropertiesChanged:
+		monitored.Name = bus.PropertiesFuncs.PropertiesChanged
+		monitored.Path = sig.Path
+		var iface string
+		var changed map[string]dbus.Variant
+		iface, changed, monitored.Invalidated, err = parsePropertiesChanged(sig.Body)
+		monitored.Interfaces = []string{iface}
+		monitored.Properties = map[string]map[string]dbus.Variant{iface: changed}
+	default:
+		return monitored, false, nil
+	}
+	if err != nil {
+		return monitored, false, fmt.Errorf("%s: %s", sig.Name, err)
+	}
+	if monitored.Path != BluezRootPath &&
+		!strings.HasPrefix(string(monitored.Path), string(BluezRootPath)+"/") {
+		return monitored, false, nil
+	}
+
+	return monitored, true, nil
+}
+
+func (r *monitorRegistry) add() *signalMonitor {
+	m := &signalMonitor{
+		ch:   make(chan MonitoredSignal, MonitorBufferSize),
+		done: make(chan struct{}),
+	}
+	r.mux.Lock()
+	r.monitors[m] = struct{}{}
+	r.mux.Unlock()
+
+	return m
+}
+
+func (r *monitorRegistry) remove(m *signalMonitor) {
+	close(m.done)
+	r.mux.Lock()
+	delete(r.monitors, m)
+	r.mux.Unlock()
+
+	m.sendMux.Lock()
+	m.closed = true
+	close(m.ch)
+	m.sendMux.Unlock()
+}
+
+// publish sends the signal to the monitors, if it's one they want. Like the events, we
+// don't hold the lock while we send.
+func (r *monitorRegistry) publish(sig *dbus.Signal) {
+	r.mux.RLock()
+	monitors := make([]*signalMonitor, 0, len(r.monitors))
+	for m := range r.monitors {
+		monitors = append(monitors, m)
+	}
+	r.mux.RUnlock()
+	if len(monitors) == 0 {
+		return
+	}
+
+	monitored, ok, err := newMonitoredSignal(sig)
+	if err != nil {
+		logger.Info("Unable to monitor signal: %s", err)
+		return
+	}
+	if !ok {
+		return
+	}
+	for _, m := range monitors {
+		m.send(monitored)
+	}
+}
+
+// send doesn't wait for the reader. If the buffer is full, the signal is dropped, and
+// counted in the next one that is sent.
+func (m *signalMonitor) send(monitored MonitoredSignal) {
+	m.sendMux.RLock()
+	defer m.sendMux.RUnlock()
+	if m.closed {
+		return
+	}
+	monitored.Dropped = m.dropped
+	select {
+	case m.ch <- monitored:
+		m.dropped = 0
+	default:
+		m.dropped++
+	}
+}
+
+// Monitor returns the InterfacesAdded, InterfacesRemoved and PropertiesChanged signals for
+// all of the bluez objects. The channel is closed when the context is done. The signals are
+// dropped if the reader falls behind by MonitorBufferSize, and MonitoredSignal.Dropped
+// counts them.
+func (b *bluezConn) Monitor(ctx context.Context) (<-chan MonitoredSignal, error) {
+	// PropertiesChanged is always watched, for the cache. The ObjectManager signals are
+	// shared with the watches.
+	b.watches.mux.Lock()
+	err := b.watches.addRules(BluezRootPath, objectManagerSignals)
+	b.watches.mux.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	m := b.monitors.add()
+	go func() {
+		<-ctx.Done()
+		b.monitors.remove(m)
+		b.watches.mux.Lock()
+		b.watches.removeRules(BluezRootPath, objectManagerSignals)
+		b.watches.mux.Unlock()
+	}()
+
+	return m.ch, nil
+}
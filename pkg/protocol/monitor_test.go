@@ -0,0 +1,97 @@
+package protocol
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/shigmas/bluezog/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func receiveSignal(t *testing.T, ch <-chan MonitoredSignal) MonitoredSignal {
+	select {
+	case monitored, ok := <-ch:
+		assert.True(t, ok, "Monitor channel closed")
+		return monitored
+	case <-time.After(2 * time.Second):
+		assert.FailNow(t, "No signal received")
+	}
+	return MonitoredSignal{}
+}
+
+func TestMonitor(t *testing.T) {
+	bluez, cancel := createBluez(t, "gatt")
+	defer cancel()
+	sendSignal := func(fname string) {
+		sig, err := test.UnmarshalSignal(fname)
+		assert.NoError(t, err, "Unexpected error reading %s", fname)
+		bluez.(*bluezConn).busSignalCh <- sig
+	}
+
+	ctx, monitorCancel := context.WithCancel(context.Background())
+	signals, err := bluez.Monitor(ctx)
+	assert.NoError(t, err, "Unexpected error in Monitor")
+
+	devicePath := dbus.ObjectPath("/org/bluez/hci0/dev_D1_40_FD_DE_C6_1C")
+	sendSignal("signal-PropertiesChanged-rssi")
+	monitored := receiveSignal(t, signals)
+	assert.Equal(t, "PropertiesChanged", monitored.Name)
+	assert.Equal(t, devicePath, monitored.Path)
+	assert.Equal(t, []string{BluezInterface.Device}, monitored.Interfaces)
+	assert.Equal(t, int16(-52), monitored.Properties[BluezInterface.Device]["RSSI"].Value())
+
+	// Only the bluez objects
+	bluez.(*bluezConn).busSignalCh <- &dbus.Signal{
+		Path: "/org/freedesktop/other",
+		Name: "org.freedesktop.DBus.Properties.PropertiesChanged",
+		Body: []interface{}{"org.freedesktop.Other1", map[string]dbus.Variant{}, []string{}},
+	}
+	sendSignal("signal-InterfacesRemoved-device")
+	monitored = receiveSignal(t, signals)
+	assert.Equal(t, "InterfacesRemoved", monitored.Name)
+	assert.Equal(t, devicePath, monitored.Path, "The path is from the body")
+	assert.Contains(t, monitored.Interfaces, BluezInterface.Device)
+
+	sendSignal("signal-InterfacesAdded-741522808")
+	monitored = receiveSignal(t, signals)
+	assert.Equal(t, "InterfacesAdded", monitored.Name)
+	if assert.NotEmpty(t, monitored.Interfaces) {
+		assert.Contains(t, monitored.Properties, monitored.Interfaces[0])
+	}
+
+	monitorCancel()
+	for range signals {
+	}
+}
+
+func TestMonitorSlowReader(t *testing.T) {
+	bluez, cancel := createBluez(t, "gatt")
+	defer cancel()
+	rssi, err := test.UnmarshalSignal("signal-PropertiesChanged-rssi")
+	assert.NoError(t, err, "Unexpected error reading the signal")
+
+	ctx, monitorCancel := context.WithCancel(context.Background())
+	defer monitorCancel()
+	signals, err := bluez.Monitor(ctx)
+	assert.NoError(t, err, "Unexpected error in Monitor")
+	events, err := bluez.Subscribe(context.Background(), EventFilter{})
+	assert.NoError(t, err, "Unexpected error in Subscribe")
+
+	// Nobody reads the monitor, but the signals are still handled
+	for i := 0; i < MonitorBufferSize+2; i++ {
+		bluez.(*bluezConn).busSignalCh <- rssi
+		select {
+		case <-events:
+		case <-time.After(2 * time.Second):
+			assert.FailNow(t, "The monitor held up the signals")
+		}
+	}
+
+	for i := 0; i < MonitorBufferSize; i++ {
+		assert.Zero(t, receiveSignal(t, signals).Dropped)
+	}
+	bluez.(*bluezConn).busSignalCh <- rssi
+	assert.Equal(t, 2, receiveSignal(t, signals).Dropped, "Expected the dropped signals")
+}
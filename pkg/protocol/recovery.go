@@ -0,0 +1,163 @@
+package protocol
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/shigmas/bluezog/pkg/base"
+	"github.com/shigmas/bluezog/pkg/bus"
+	"github.com/shigmas/bluezog/pkg/logger"
+)
+
+// NameOwnerChanged has the bus name, the old owner and the new owner. The owners are empty
+// when the name is acquired or released.
+func parseNameOwnerChanged(signalBody []interface{}) (string, string, string, error) {
+	if len(signalBody) != 3 {
+		return "", "", "", fmt.Errorf("NameOwnerChanged body had %d items, not 3", len(signalBody))
+	}
+	strs := make([]string, 3)
+	for i, item := range signalBody {
+		str, ok := item.(string)
+		if !ok {
+			return "", "", "", fmt.Errorf("NameOwnerChanged item %d was %s", i, reflect.TypeOf(item))
+		}
+		strs[i] = str
+	}
+
+	return strs[0], strs[1], strs[2], nil
+}
+
+// handleNameOwnerChanged marks the registry unavailable when bluez stops, and rebuilds it
+// when bluez starts again.
+func (b *bluezConn) handleNameOwnerChanged(ctx context.Context, sigData *dbus.Signal) {
+	name, oldOwner, newOwner, err := parseNameOwnerChanged(sigData.Body)
+	if err != nil {
+		logger.Info("Signal Body unhandled: %s: %s", err, sigData.Body)
+		return
+	}
+	if name != BluezDest {
+		return
+	}
+	if oldOwner != "" {
+		b.serviceLost()
+	}
+	if newOwner != "" {
+		err = b.serviceRestored(ctx)
+		if err != nil {
+			logger.Error("Unable to restore %s: %s", BluezDest, err)
+		}
+	}
+}
+
+// serviceLost moves the objects out of the registry, so no one finds the stale objects. We
+// keep them, so the objects that come back are the same ones that our users have.
+func (b *bluezConn) serviceLost() {
+	b.registryMux.Lock()
+	if !b.available {
+		b.registryMux.Unlock()
+		return
+	}
+	b.available = false
+	b.lostRegistry = b.objectRegistry
+	b.objectRegistry = make(map[dbus.ObjectPath]Base, len(b.lostRegistry))
+	b.registryMux.Unlock()
+
+	logger.Info("%s is no longer available", BluezDest)
+	b.events.publish(Event{
+		Kind: EventServiceLost,
+		Path: BluezRootPath,
+		Time: time.Now(),
+	})
+}
+
+// serviceRestored rebuilds the registry, and re-applies the watches, notifications and
+// discovery.
+func (b *bluezConn) serviceRestored(ctx context.Context) error {
+	objMap, err := b.ops.GetManagedObjects(BluezDest, bus.RootPath)
+	if err != nil {
+		return err
+	}
+
+	found := make(map[dbus.ObjectPath]Base)
+	b.registryMux.Lock()
+	lost := b.lostRegistry
+	if b.available {
+		// We didn't see it go away, but the objects are stale anyway
+		lost = b.objectRegistry
+	}
+	registry := make(map[dbus.ObjectPath]Base, len(objMap))
+	for path, ifaceMap := range objMap {
+		if obj, ok := lost[path]; ok {
+			if resetter, ok := obj.(interface{ reset(base.ObjectMap) bool }); ok &&
+				resetter.reset(ifaceMap) {
+				registry[path] = obj
+				delete(lost, path)
+				continue
+			}
+		}
+		newObj := b.createObject(path, ifaceMap)
+		if newObj == nil {
+			logger.Debug("No interface constructor found: %s", path)
+			continue
+		}
+		registry[path] = newObj
+		found[path] = newObj
+	}
+	b.objectRegistry = registry
+	b.lostRegistry = nil
+	b.available = true
+	b.registryMux.Unlock()
+
+	for path, obj := range lost {
+		b.events.publish(deviceEvent(EventDeviceLost, path, obj)...)
+	}
+	for path, obj := range found {
+		b.events.publish(deviceEvent(EventDeviceFound, path, obj)...)
+	}
+
+	err = b.watches.reapply()
+	if err != nil {
+		return err
+	}
+	for _, obj := range registry {
+		switch o := obj.(type) {
+		case *Adapter:
+			err = o.restartDiscovery(ctx)
+		case *GattCharacteristic:
+			err = o.restartNotify(ctx)
+		default:
+			continue
+		}
+		if err != nil {
+			logger.Error("Unable to restart %s: %s", obj.GetPath(), err)
+		}
+	}
+
+	logger.Info("%s is available", BluezDest)
+	b.events.publish(Event{
+		Kind: EventServiceRestored,
+		Path: BluezRootPath,
+		Time: time.Now(),
+	})
+
+	return nil
+}
+
+// reapply adds the match rules to the bus again. They are removed first, so the bus
+// doesn't count them twice.
+func (r *watchRegistry) reapply() error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	for rule := range r.rules {
+		r.ops.UnWatch(rule.path, rule.iface, rule.signal)
+		err := r.ops.Watch(rule.path, rule.iface, rule.signal)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package protocol
+
+import (
+	"context"
+	"testing"
+
+	"github.com/shigmas/bluezog/pkg/bus"
+	"github.com/shigmas/bluezog/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServiceRestart(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mock := test.NewBusMock("gatt")
+	ops := &watchCounter{Operations: mock, rules: make(map[string]int)}
+	bluez, err := InitializeBluez(ctx, ops)
+	assert.NoError(t, err, "Unexpected error initializing bluez")
+
+	events, err := bluez.Subscribe(ctx, EventFilter{
+		Kinds: []EventKind{EventServiceLost, EventServiceRestored},
+	})
+	assert.NoError(t, err, "Unexpected error in Subscribe")
+
+	adapter := bluez.FindAdapters()[0]
+	assert.NoError(t, adapter.SetDiscoveryFilter(ctx, DiscoveryFilter{Transport: TransportLE}))
+	_, err = adapter.StartDiscovery()
+	assert.NoError(t, err, "Unexpected error in StartDiscovery")
+	characteristic, _ := findGattObjects(t, bluez)
+	_, err = characteristic.StartNotify(ctx)
+	assert.NoError(t, err, "Unexpected error in StartNotify")
+	rulesAdded := ops.addCount()
+
+	assert.NoError(t, test.SetNameOwner(mock, ""))
+	event := receiveEvent(t, events)
+	assert.Equal(t, EventServiceLost, event.Kind)
+	assert.False(t, bluez.Available(), "Bluez should be unavailable")
+	assert.Empty(t, bluez.FindAdapters(), "Registry should be empty while bluez is gone")
+
+	assert.NoError(t, test.SetNameOwner(mock, ":1.2000"))
+	event = receiveEvent(t, events)
+	assert.Equal(t, EventServiceRestored, event.Kind)
+	assert.True(t, bluez.Available(), "Bluez should be available again")
+	assert.Equal(t, 2, test.CallCount(mock, "GetManagedObjects"))
+
+	// Our users still have the same objects
+	assert.Same(t, adapter, bluez.FindAdapters()[0])
+	found := bluez.FindObjects(testCharPath, true)
+	assert.Len(t, found, 1)
+	assert.Same(t, characteristic, found[0])
+
+	assert.Equal(t, 2, test.CallCount(mock, BluezAdapter.SetDiscoveryFilter))
+	assert.Equal(t, 2, test.CallCount(mock, BluezAdapter.StartDiscovery))
+	assert.Equal(t, 2, test.CallCount(mock, BluezGATTCharacteristic.StartNotify))
+	assert.Greater(t, ops.addCount(), rulesAdded, "Watches should have been added again")
+	assert.Equal(t, 1, ops.count(testCharPath, bus.Properties, bus.PropertiesFuncs.PropertiesChanged))
+}
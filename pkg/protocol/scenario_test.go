@@ -0,0 +1,83 @@
+package protocol
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/shigmas/bluezog/test/scenario"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	thermometerPath = dbus.ObjectPath("/org/bluez/hci0/dev_C4_7C_8D_6A_3F_01")
+	temperaturePath = thermometerPath + "/service0010/char0011"
+)
+
+func TestScenario(t *testing.T) {
+	ops, err := scenario.LoadScenarioOperations("../../testdata/scenario-thermometer.yaml")
+	assert.NoError(t, err, "Unexpected error loading scenario")
+	defer ops.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bluez, err := InitializeBluez(ctx, ops)
+	assert.NoError(t, err, "Unexpected error initializing bluez")
+	deviceEvents, err := bluez.Subscribe(ctx, EventFilter{PathPrefix: thermometerPath})
+	assert.NoError(t, err, "Unexpected error in Subscribe")
+
+	// The RSSI is sent after a short time
+	event := receiveEvent(t, deviceEvents)
+	assert.Equal(t, EventPropertyChanged, event.Kind)
+	assert.Equal(t, int16(-70), event.Old)
+	assert.Equal(t, int16(-58), event.New)
+
+	objs := bluez.FindObjects(string(thermometerPath), true)
+	assert.Len(t, objs, 1)
+	device := objs[0].(*Device)
+	assert.NoError(t, device.Connect(ctx), "Unexpected error in Connect")
+	connected := false
+	for !connected {
+		event = receiveEvent(t, deviceEvents)
+		connected = event.Kind == EventConnected
+	}
+	err = device.Pair(ctx)
+	assert.True(t, errors.Is(err, ErrAuthenticationFailed), "Expected AuthenticationFailed, not %v", err)
+
+	objs = bluez.FindObjects(string(temperaturePath), true)
+	assert.Len(t, objs, 1)
+	characteristic := objs[0].(*GattCharacteristic)
+	value, err := characteristic.ReadValue(ctx, ReadOptions{})
+	assert.NoError(t, err, "Unexpected error in ReadValue")
+	assert.Equal(t, []byte{0x00, 0x6c, 0x01, 0x00, 0xff}, value)
+
+	notifications, err := characteristic.StartNotify(ctx)
+	assert.NoError(t, err, "Unexpected error in StartNotify")
+	n := <-notifications
+	assert.Equal(t, []byte{0x00, 0x6d, 0x01, 0x00, 0xff}, n.Value)
+	assert.NoError(t, characteristic.StopNotify(ctx), "Unexpected error in StopNotify")
+
+	assert.NoError(t, ops.Emit("gone"))
+	for event.Kind != EventDeviceLost {
+		event = receiveEvent(t, deviceEvents)
+	}
+
+	ops.AssertCalled(t, temperaturePath, "StartNotify")
+	ops.AssertNotCalled(t, thermometerPath, "Disconnect")
+	assert.Len(t, ops.Calls("", BluezDevice.Connect), 1)
+	ops.AssertExpectations(t)
+
+	assert.Error(t, device.Disconnect(ctx), "Unexpected calls should fail")
+	failT := &failRecorder{}
+	assert.False(t, ops.AssertExpectations(failT), "Unexpected call should fail the expectations")
+	assert.True(t, failT.failed)
+}
+
+// failRecorder is an assert.TestingT that only records the failure
+type failRecorder struct {
+	failed bool
+}
+
+func (f *failRecorder) Errorf(format string, args ...interface{}) {
+	f.failed = true
+}
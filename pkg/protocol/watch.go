@@ -0,0 +1,251 @@
+package protocol
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/shigmas/bluezog/pkg/base"
+	"github.com/shigmas/bluezog/pkg/bus"
+	"github.com/shigmas/bluezog/pkg/logger"
+)
+
+type (
+	// Subscription is one watcher of the signals on a path. Many subscriptions can watch
+	// the same path and signals. It is removed when Unsubscribe is called, or when the
+	// context passed to Watch is done.
+	Subscription struct {
+		// C receives the changes. It is closed when the subscription is removed. It holds
+		// SubscriberBufferSize changes, and the rest are dropped until there is room, so
+		// read it promptly.
+		C ObjectChangedChan
+
+		path     dbus.ObjectPath
+		signals  []InterfaceSignalPair
+		registry *watchRegistry
+		// closed when the subscription is removed, so a blocked send gives up
+		done     chan struct{}
+		doneOnce sync.Once
+		// held for reading while sending on C, so we don't close C during a send
+		sendMux sync.RWMutex
+		closed  bool
+		// dropped is only used by the signal goroutine
+		dropped int
+	}
+
+	// matchRule is a match rule that we've added to the bus.
+	matchRule struct {
+		path   dbus.ObjectPath
+		iface  string
+		signal string
+	}
+
+	// watchRegistry holds the subscriptions, and reference counts the match rules, so a
+	// rule is only removed when the last subscription that needs it is removed.
+	watchRegistry struct {
+		ops           base.Operations
+		mux           sync.RWMutex
+		subscriptions map[*Subscription]struct{}
+		rules         map[matchRule]int
+	}
+)
+
+func newWatchRegistry(ops base.Operations) *watchRegistry {
+	return &watchRegistry{
+		ops:           ops,
+		subscriptions: make(map[*Subscription]struct{}),
+		rules:         make(map[matchRule]int),
+	}
+}
+
+// matchPath is the path for the match rule. The ObjectManager signals come from the root,
+// but PropertiesChanged comes from the object itself.
+func matchPath(path dbus.ObjectPath, pair InterfaceSignalPair) dbus.ObjectPath {
+	if pair.Interface == bus.Properties {
+		return path
+	}
+	return bus.RootPath
+}
+
+func newMatchRule(path dbus.ObjectPath, pair InterfaceSignalPair) matchRule {
+	return matchRule{
+		path:   matchPath(path, pair),
+		iface:  pair.Interface,
+		signal: pair.SignalName,
+	}
+}
+
+// addRules adds the match rules to the bus if no one is using them yet. The lock must be
+// held.
+func (r *watchRegistry) addRules(path dbus.ObjectPath, signals []InterfaceSignalPair) error {
+	for i, pair := range signals {
+		rule := newMatchRule(path, pair)
+		if r.rules[rule] == 0 {
+			err := r.ops.Watch(rule.path, rule.iface, rule.signal)
+			if err != nil {
+				// Undo the ones we've added, so the counts are right
+				r.removeRules(path, signals[:i])
+				return err
+			}
+		}
+		r.rules[rule]++
+	}
+
+	return nil
+}
+
+// removeRules removes the match rules from the bus if no one else is using them. The lock
+// must be held.
+func (r *watchRegistry) removeRules(path dbus.ObjectPath, signals []InterfaceSignalPair) error {
+	var firstErr error
+	for _, pair := range signals {
+		rule := newMatchRule(path, pair)
+		count, ok := r.rules[rule]
+		if !ok {
+			continue
+		}
+		if count > 1 {
+			r.rules[rule] = count - 1
+			continue
+		}
+		delete(r.rules, rule)
+		err := r.ops.UnWatch(rule.path, rule.iface, rule.signal)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// subscribe adds the subscription, and the match rules that it needs.
+func (r *watchRegistry) subscribe(
+	ctx context.Context,
+	path dbus.ObjectPath,
+	signals []InterfaceSignalPair) (*Subscription, error) {
+	sub := &Subscription{
+		C:        make(ObjectChangedChan, SubscriberBufferSize),
+		path:     path,
+		signals:  signals,
+		registry: r,
+		done:     make(chan struct{}),
+	}
+
+	r.mux.Lock()
+	err := r.addRules(path, signals)
+	if err != nil {
+		r.mux.Unlock()
+		return nil, err
+	}
+	r.subscriptions[sub] = struct{}{}
+	r.mux.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			sub.Unsubscribe()
+		case <-sub.done:
+		}
+	}()
+
+	return sub, nil
+}
+
+// find returns the subscription with the channel on the path
+func (r *watchRegistry) find(path dbus.ObjectPath, ch ObjectChangedChan) *Subscription {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	for sub := range r.subscriptions {
+		if sub.path == path && sub.C == ch {
+			return sub
+		}
+	}
+
+	return nil
+}
+
+// matching returns the subscriptions that the match function accepts. We don't hold the
+// lock while sending, so a slow subscriber doesn't block the others from unsubscribing.
+func (r *watchRegistry) matching(match func(sub *Subscription) bool) []*Subscription {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	subs := make([]*Subscription, 0)
+	for sub := range r.subscriptions {
+		if match(sub) {
+			subs = append(subs, sub)
+		}
+	}
+
+	return subs
+}
+
+// Path is the path that the subscription is watching
+func (s *Subscription) Path() dbus.ObjectPath {
+	return s.path
+}
+
+// Unsubscribe removes the subscription, and closes C. The match rules are removed if no
+// other subscription needs them. It is safe to call more than once.
+func (s *Subscription) Unsubscribe() error {
+	var err error
+	removed := false
+	s.doneOnce.Do(func() {
+		removed = true
+		// Wake up any send that is waiting on us
+		close(s.done)
+		s.registry.mux.Lock()
+		delete(s.registry.subscriptions, s)
+		err = s.registry.removeRules(s.path, s.signals)
+		s.registry.mux.Unlock()
+
+		s.sendMux.Lock()
+		s.closed = true
+		close(s.C)
+		s.sendMux.Unlock()
+	})
+	if !removed {
+		return fmt.Errorf("Subscription to %s already removed", s.path)
+	}
+	logger.Info("Unsubscribe %s", s.path)
+
+	return err
+}
+
+// wants returns true if the subscription is watching the signal
+func (s *Subscription) wants(iface, signal string) bool {
+	for _, pair := range s.signals {
+		if pair.Interface == iface && pair.SignalName == signal {
+			return true
+		}
+	}
+
+	return false
+}
+
+// watchesAncestor returns true if the subscription's path is the path, or one of its
+// parents. e.g. the adapter watches for the devices.
+func (s *Subscription) watchesAncestor(path dbus.ObjectPath) bool {
+	return s.path == path || strings.HasPrefix(string(path), string(s.path)+"/")
+}
+
+// send doesn't wait for the subscriber. If C is full, the data is dropped, and counted in
+// the next one that is sent.
+func (s *Subscription) send(data ObjectChangedData) {
+	s.sendMux.RLock()
+	defer s.sendMux.RUnlock()
+	if s.closed {
+		return
+	}
+	data.Dropped = s.dropped
+	select {
+	case s.C <- data:
+		s.dropped = 0
+	default:
+		if s.dropped == 0 {
+			logger.Warn("Subscription to %s is full. Dropping changes", s.path)
+		}
+		s.dropped++
+	}
+}
@@ -0,0 +1,167 @@
+package protocol
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/shigmas/bluezog/pkg/base"
+	"github.com/shigmas/bluezog/pkg/bus"
+	"github.com/shigmas/bluezog/test"
+	"github.com/stretchr/testify/assert"
+)
+
+// watchCounter counts the match rules that are on the bus
+type watchCounter struct {
+	base.Operations
+	mux   sync.Mutex
+	rules map[string]int
+	// the number of times any rule was added
+	added int
+}
+
+func (w *watchCounter) Watch(path dbus.ObjectPath, iface string, method string) error {
+	w.mux.Lock()
+	w.rules[string(path)+":"+iface+"."+method]++
+	w.added++
+	w.mux.Unlock()
+	return w.Operations.Watch(path, iface, method)
+}
+
+func (w *watchCounter) UnWatch(path dbus.ObjectPath, iface string, method string) error {
+	w.mux.Lock()
+	w.rules[string(path)+":"+iface+"."+method]--
+	w.mux.Unlock()
+	return w.Operations.UnWatch(path, iface, method)
+}
+
+func (w *watchCounter) addCount() int {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	return w.added
+}
+
+func (w *watchCounter) count(path dbus.ObjectPath, iface string, method string) int {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	return w.rules[string(path)+":"+iface+"."+method]
+}
+
+func TestWatchSubscribers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ops := &watchCounter{Operations: test.NewBusMock("gatt"), rules: make(map[string]int)}
+	bluez, err := InitializeBluez(ctx, ops)
+	assert.NoError(t, err, "Unexpected error initializing bluez")
+
+	pairs := []InterfaceSignalPair{
+		InterfaceSignalPair{bus.Properties, bus.PropertiesFuncs.PropertiesChanged},
+	}
+	first, err := bluez.Watch(ctx, testCharPath, pairs)
+	assert.NoError(t, err, "Unexpected error in Watch")
+	subCtx, subCancel := context.WithCancel(ctx)
+	second, err := bluez.Watch(subCtx, testCharPath, pairs)
+	assert.NoError(t, err, "Unexpected error in Watch")
+	assert.Equal(t, 1, ops.count(testCharPath, bus.Properties, bus.PropertiesFuncs.PropertiesChanged),
+		"Match rule should only be added once")
+
+	bluez.(*bluezConn).busSignalCh <- &dbus.Signal{
+		Path: testCharPath,
+		Name: "org.freedesktop.DBus.Properties.PropertiesChanged",
+		Body: []interface{}{
+			BluezInterface.GATTCharacteristic,
+			map[string]dbus.Variant{"Value": dbus.MakeVariant([]byte{0x01})},
+			[]string{},
+		},
+	}
+	for _, sub := range []*Subscription{first, second} {
+		select {
+		case data := <-sub.C:
+			assert.Equal(t, ObjectPropertiesChanged, data.Type)
+		case <-time.After(time.Second):
+			assert.Fail(t, "Subscriber didn't receive the change")
+		}
+	}
+
+	// Cancelling the context removes the subscription, but not the rule
+	subCancel()
+	select {
+	case _, ok := <-second.C:
+		assert.False(t, ok, "Channel should be closed when the context is done")
+	case <-time.After(time.Second):
+		assert.Fail(t, "Subscription wasn't removed when the context was done")
+	}
+	assert.Error(t, second.Unsubscribe(), "Expected error unsubscribing twice")
+	assert.Equal(t, 1, ops.count(testCharPath, bus.Properties, bus.PropertiesFuncs.PropertiesChanged),
+		"Match rule should remain for the other subscriber")
+
+	assert.NoError(t, first.Unsubscribe(), "Unexpected error in Unsubscribe")
+	assert.Equal(t, 0, ops.count(testCharPath, bus.Properties, bus.PropertiesFuncs.PropertiesChanged),
+		"Match rule should be removed with the last subscriber")
+}
+
+func TestWatchSlowSubscriber(t *testing.T) {
+	bluez, cancel := createBluez(t, "gatt")
+	defer cancel()
+
+	pairs := []InterfaceSignalPair{
+		InterfaceSignalPair{bus.Properties, bus.PropertiesFuncs.PropertiesChanged},
+	}
+	ch, err := bluez.AddWatch(testCharPath, pairs)
+	assert.NoError(t, err, "Unexpected error in AddWatch")
+	prompt, err := bluez.AddWatch(testCharPath, pairs)
+	assert.NoError(t, err, "Unexpected error in AddWatch")
+	// No one reads ch, so its changes are dropped once the buffer is full, but the other
+	// subscriber still gets them
+	for i := 0; i < SubscriberBufferSize+2; i++ {
+		bluez.(*bluezConn).busSignalCh <- &dbus.Signal{
+			Path: testCharPath,
+			Name: "org.freedesktop.DBus.Properties.PropertiesChanged",
+			Body: []interface{}{
+				BluezInterface.GATTCharacteristic,
+				map[string]dbus.Variant{"Value": dbus.MakeVariant([]byte{byte(i)})},
+				[]string{},
+			},
+		}
+		select {
+		case <-prompt:
+		case <-time.After(time.Second):
+			assert.FailNow(t, "The slow subscriber held up the signals")
+		}
+	}
+
+	for i := 0; i < SubscriberBufferSize; i++ {
+		data := <-ch
+		assert.Equal(t, []byte{byte(i)}, data.Properties["Value"].Value())
+		assert.Zero(t, data.Dropped)
+	}
+	bluez.(*bluezConn).busSignalCh <- &dbus.Signal{
+		Path: testCharPath,
+		Name: "org.freedesktop.DBus.Properties.PropertiesChanged",
+		Body: []interface{}{
+			BluezInterface.GATTCharacteristic,
+			map[string]dbus.Variant{"Value": dbus.MakeVariant([]byte{0xff})},
+			[]string{},
+		},
+	}
+	select {
+	case data := <-ch:
+		assert.Equal(t, 2, data.Dropped, "Expected the dropped changes")
+	case <-time.After(time.Second):
+		assert.Fail(t, "Expected the change after the dropped ones")
+	}
+	assert.NoError(t, bluez.RemoveWatch(testCharPath, prompt, pairs))
+
+	removed := make(chan error)
+	go func() {
+		removed <- bluez.RemoveWatch(testCharPath, ch, pairs)
+	}()
+	select {
+	case err := <-removed:
+		assert.NoError(t, err, "Unexpected error in RemoveWatch")
+	case <-time.After(time.Second):
+		assert.Fail(t, "RemoveWatch blocked on a slow subscriber")
+	}
+}
@@ -0,0 +1,137 @@
+package zog
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/shigmas/bluezog/pkg/logger"
+	"github.com/shigmas/bluezog/pkg/protocol"
+)
+
+const (
+	// AgentPath is where we export our agent on the bus
+	AgentPath = dbus.ObjectPath("/org/bluezog/agent")
+)
+
+type (
+	// Prompter asks the user a question and returns the answer. It should return an error
+	// when the context is done, which is how the agent handles Cancel from bluez.
+	Prompter func(ctx context.Context, question string) (string, error)
+
+	// promptAgent is the protocol.Agent for the shell. It asks the user through the
+	// Prompter, and writes what it shows through the Formatter.
+	promptAgent struct {
+		prompter Prompter
+		out      *Formatter
+		mux      sync.Mutex
+		cancel   func()
+	}
+)
+
+var (
+	_ protocol.Agent = (*promptAgent)(nil)
+)
+
+func newPromptAgent(prompter Prompter, out *Formatter) *promptAgent {
+	return &promptAgent{
+		prompter: prompter,
+		out:      out,
+	}
+}
+
+// tell writes the message like an event, since it comes in the middle of a command
+func (a *promptAgent) tell(format string, args ...interface{}) {
+	if err := a.out.WriteEvent(&Message{fmt.Sprintf(format, args...)}); err != nil {
+		logger.Error("Unable to write agent message: %s", err)
+	}
+}
+
+func (a *promptAgent) ask(question string) (string, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	a.mux.Lock()
+	a.cancel = cancel
+	a.mux.Unlock()
+	defer func() {
+		a.mux.Lock()
+		a.cancel = nil
+		a.mux.Unlock()
+		cancel()
+	}()
+
+	answer, err := a.prompter(ctx, question)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", protocol.ErrCanceled
+		}
+		return "", err
+	}
+	return strings.TrimSpace(answer), nil
+}
+
+func (a *promptAgent) confirm(question string) error {
+	answer, err := a.ask(question + " (yes/no):")
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(answer) {
+	case "y", "yes":
+		return nil
+	}
+	return protocol.ErrRejected
+}
+
+func (a *promptAgent) Release() {
+	a.tell("Agent released")
+}
+
+func (a *promptAgent) RequestPinCode(device dbus.ObjectPath) (string, error) {
+	return a.ask(fmt.Sprintf("Enter PIN code for %s:", device))
+}
+
+func (a *promptAgent) DisplayPinCode(device dbus.ObjectPath, pinCode string) error {
+	a.tell("PIN code for %s: %s", device, pinCode)
+	return nil
+}
+
+func (a *promptAgent) RequestPasskey(device dbus.ObjectPath) (uint32, error) {
+	answer, err := a.ask(fmt.Sprintf("Enter passkey for %s:", device))
+	if err != nil {
+		return 0, err
+	}
+	passkey, err := strconv.ParseUint(answer, 10, 32)
+	if err != nil || passkey > 999999 {
+		return 0, fmt.Errorf("Passkey must be a number from 0 to 999999")
+	}
+	return uint32(passkey), nil
+}
+
+func (a *promptAgent) DisplayPasskey(device dbus.ObjectPath, passkey uint32, entered uint16) error {
+	a.tell("Passkey for %s: %06d (%d entered)", device, passkey, entered)
+	return nil
+}
+
+func (a *promptAgent) RequestConfirmation(device dbus.ObjectPath, passkey uint32) error {
+	return a.confirm(fmt.Sprintf("Confirm passkey %06d for %s", passkey, device))
+}
+
+func (a *promptAgent) RequestAuthorization(device dbus.ObjectPath) error {
+	return a.confirm(fmt.Sprintf("Authorize pairing with %s", device))
+}
+
+func (a *promptAgent) AuthorizeService(device dbus.ObjectPath, uuid string) error {
+	return a.confirm(fmt.Sprintf("Authorize service %s for %s", uuid, device))
+}
+
+// Cancel cancels the question that we're waiting on
+func (a *promptAgent) Cancel() {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	if a.cancel != nil {
+		a.tell("Request canceled")
+		a.cancel()
+	}
+}
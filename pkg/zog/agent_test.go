@@ -0,0 +1,64 @@
+package zog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/shigmas/bluezog/pkg/protocol"
+	"github.com/shigmas/bluezog/test/scenario"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAgentPair(t *testing.T) {
+	b, closer := newFakeBus(t, "simple")
+	defer closer()
+	assert.NoError(t, errOf(b.GetInterface()), "Unexpected error setting adapter")
+
+	// Like the shell, the question is answered on another goroutine while the pair command
+	// is waiting.
+	asked := make(chan string)
+	answers := make(chan string)
+	b.SetPrompter(func(ctx context.Context, question string) (string, error) {
+		asked <- question
+		select {
+		case answer := <-answers:
+			return answer, nil
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	})
+	reply := func(answer string) {
+		go func() {
+			question := <-asked
+			assert.Contains(t, question, fmt.Sprintf("%06d", scenario.FakePasskey))
+			answers <- answer
+		}()
+	}
+	assert.NoError(t, errOf(b.Agent("on")), "Unexpected error registering the agent")
+
+	reply("yes")
+	assert.NoError(t, errOf(b.ObjectCommands("/org/bluez/hci0/dev_08_EB_ED_9D_D6_C7", "pair")),
+		"Unexpected error pairing")
+	result, err := b.ObjectCommands("/org/bluez/hci0/dev_08_EB_ED_9D_D6_C7", "pair")
+	assert.NoError(t, err, "Unexpected error pairing again")
+	assert.IsType(t, &Message{}, result, "Expected already paired")
+
+	reply("no")
+	err = errOf(b.ObjectCommands("/org/bluez/hci0/dev_D1_40_FD_DE_C6_1C", "pair"))
+	assert.True(t, errors.Is(err, protocol.ErrAuthenticationRejected),
+		"Expected rejected, not %v", err)
+
+	assert.NoError(t, errOf(b.Agent("off")), "Unexpected error unregistering the agent")
+}
+
+func TestPromptAgentFormat(t *testing.T) {
+	var out bytes.Buffer
+	agent := newPromptAgent(nil, NewFormatter(&out, FormatJSONL))
+	assert.NoError(t, agent.DisplayPasskey("/org/bluez/hci0/dev_08_EB_ED_9D_D6_C7", 1234, 2))
+	assert.Equal(t,
+		`{"message":"Passkey for /org/bluez/hci0/dev_08_EB_ED_9D_D6_C7: 001234 (2 entered)"}`+"\n",
+		out.String())
+}
@@ -0,0 +1,81 @@
+package zog
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// The shell converts the arguments with the CommandSpecs, but the zogctl commands call the
+// Bus with strings. These accept both.
+
+func stringArg(arg interface{}) (string, error) {
+	str, ok := arg.(string)
+	if !ok {
+		return "", fmt.Errorf("Unable to convert %v to string", arg)
+	}
+	return str, nil
+}
+
+// stringArgs joins the arguments, like the words of a name
+func stringArgs(args []interface{}) ([]string, error) {
+	strs := make([]string, len(args))
+	for i, a := range args {
+		str, err := stringArg(a)
+		if err != nil {
+			return nil, err
+		}
+		strs[i] = str
+	}
+	return strs, nil
+}
+
+func boolArg(arg interface{}) (bool, error) {
+	switch val := arg.(type) {
+	case bool:
+		return val, nil
+	case string:
+		switch val {
+		case "on":
+			return true, nil
+		case "off":
+			return false, nil
+		}
+	}
+	return false, fmt.Errorf("Expected on or off, not %v", arg)
+}
+
+func intArg(arg interface{}, bitSize int) (int64, error) {
+	switch val := arg.(type) {
+	case int64:
+		if bitSize < 64 && (val < -1<<(bitSize-1) || val >= 1<<(bitSize-1)) {
+			return 0, fmt.Errorf("%d is out of range", val)
+		}
+		return val, nil
+	case string:
+		return strconv.ParseInt(val, 0, bitSize)
+	}
+	return 0, fmt.Errorf("Unable to convert %v to a number", arg)
+}
+
+func uintArg(arg interface{}, bitSize int) (uint64, error) {
+	switch val := arg.(type) {
+	case uint64:
+		if bitSize < 64 && val >= 1<<bitSize {
+			return 0, fmt.Errorf("%d is out of range", val)
+		}
+		return val, nil
+	case string:
+		return strconv.ParseUint(val, 0, bitSize)
+	}
+	return 0, fmt.Errorf("Unable to convert %v to a number", arg)
+}
+
+func bytesArg(arg interface{}) ([]byte, error) {
+	switch val := arg.(type) {
+	case []byte:
+		return val, nil
+	case string:
+		return ParseBytes(val)
+	}
+	return nil, fmt.Errorf("Unable to convert %v to bytes", arg)
+}
@@ -0,0 +1,228 @@
+package zog
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/shigmas/bluezog/pkg/protocol"
+)
+
+// The shell completes the command names, the verbs, and the arguments from the
+// CommandSpecs. The arguments are the live object paths, device addresses and names,
+// property names, and UUIDs from the registry.
+
+// Complete returns the candidates for the last word of the line. If the line ends with a
+// space, the candidates are for the next word.
+func (b *BusImpl) Complete(line string) []string {
+	words, err := Tokenize(line)
+	if err != nil {
+		// Quotes aren't completed
+		return nil
+	}
+	if len(words) == 0 || strings.HasSuffix(line, " ") {
+		words = append(words, "")
+	}
+	partial := words[len(words)-1]
+	if len(words) == 1 {
+		return matching(commandNames(), partial)
+	}
+	spec, ok := CommandSpecs[words[0]]
+	if !ok {
+		return nil
+	}
+	seen := make(map[ArgType]string)
+	arg, _, ok := walkArgs(spec.Args, words[1:len(words)-1], seen)
+	if !ok || arg == nil {
+		return nil
+	}
+	return matching(b.candidates(arg, seen), partial)
+}
+
+// walkArgs follows the tokens through the specs, like parseArgs. It returns the spec of the
+// token after them, or, when the specs are done, the tokens that are left. seen has the first
+// token of each type, so a property can be completed for the object before it.
+func walkArgs(specs []ArgSpec, tokens []string, seen map[ArgType]string) (
+	*ArgSpec, []string, bool) {
+	for i := range specs {
+		spec := &specs[i]
+		for {
+			if len(tokens) == 0 {
+				return spec, nil, true
+			}
+			if spec.Type == ArgVerb {
+				verb := spec.verb(tokens[0])
+				if verb == nil {
+					return nil, nil, false
+				}
+				next, rest, ok := walkArgs(verb.Args, tokens[1:], seen)
+				if !ok || next != nil {
+					return next, nil, ok
+				}
+				tokens = rest
+			} else {
+				if _, ok := seen[spec.Type]; !ok {
+					seen[spec.Type] = tokens[0]
+				}
+				tokens = tokens[1:]
+			}
+			if !spec.Variadic {
+				break
+			}
+		}
+	}
+	return nil, tokens, true
+}
+
+// candidates are the values the argument can have
+func (b *BusImpl) candidates(arg *ArgSpec, seen map[ArgType]string) []string {
+	switch arg.Type {
+	case ArgObject:
+		return append(b.objectPaths(), b.deviceAliases()...)
+	case ArgDevice:
+		return append(b.objectPaths(protocol.BluezInterface.Device), b.deviceAliases()...)
+	case ArgGatt:
+		return b.objectPaths(protocol.BluezInterface.GATTService,
+			protocol.BluezInterface.GATTCharacteristic, protocol.BluezInterface.GATTDescriptor)
+	case ArgInterface:
+		var interfaces []string
+		for _, obj := range b.bluez.FindObjects(string(protocol.BluezRootPath)+"*", false) {
+			interfaces = append(interfaces, obj.GetInterfaces()...)
+		}
+		return interfaces
+	case ArgProperty:
+		if iface, ok := seen[ArgInterface]; ok {
+			var names []string
+			for _, obj := range b.bluez.GetObjectsByInterface(iface) {
+				for name := range obj.AllProperties() {
+					names = append(names, name)
+				}
+			}
+			return names
+		}
+		return b.propertyNames(seen[ArgObject])
+	case ArgUUID:
+		return b.uuids(seen[ArgObject])
+	case ArgOnOff:
+		return []string{"on", "off"}
+	case ArgChoice:
+		return arg.Choices
+	case ArgVerb:
+		names := make([]string, len(arg.Verbs))
+		for i, verb := range arg.Verbs {
+			names[i] = verb.Name
+		}
+		return names
+	case ArgCommand:
+		return commandNames()
+	}
+	return nil
+}
+
+func commandNames() []string {
+	names := make([]string, 0, len(CommandSpecs))
+	for name := range CommandSpecs {
+		names = append(names, name)
+	}
+	return names
+}
+
+// matching returns the sorted candidates that start with the partial word. Paths are
+// completed one element at a time, like a shell completes directories.
+func matching(candidates []string, partial string) []string {
+	found := make(map[string]bool)
+	for _, c := range candidates {
+		if !strings.HasPrefix(c, partial) {
+			continue
+		}
+		if strings.HasPrefix(c, "/") {
+			if i := strings.Index(c[len(partial):], "/"); i >= 0 {
+				// The parent is a candidate, so complete to the next element
+				c = c[:len(partial)+i+1]
+			}
+		}
+		found[c] = true
+	}
+	results := make([]string, 0, len(found))
+	for c := range found {
+		results = append(results, c)
+	}
+	sort.Strings(results)
+	return results
+}
+
+// objectPaths are the paths of the objects with any of the interfaces, or all objects
+func (b *BusImpl) objectPaths(interfaces ...string) []string {
+	var paths []string
+	for _, obj := range b.bluez.FindObjects(string(protocol.BluezRootPath)+"*", false) {
+		if len(interfaces) > 0 && !hasInterface(obj, interfaces) {
+			continue
+		}
+		paths = append(paths, string(obj.GetPath()))
+	}
+	return paths
+}
+
+func hasInterface(obj protocol.Base, interfaces []string) bool {
+	for _, have := range obj.GetInterfaces() {
+		for _, want := range interfaces {
+			if have == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// deviceAliases are the addresses, and the names that can be completed without quotes
+func (b *BusImpl) deviceAliases() []string {
+	var aliases []string
+	for _, obj := range b.bluez.GetObjectsByInterface(protocol.BluezInterface.Device) {
+		device, ok := obj.(*protocol.Device)
+		if !ok {
+			continue
+		}
+		aliases = append(aliases, device.Address())
+		name, _ := device.Name()
+		for _, n := range []string{name, device.Alias()} {
+			if n != "" && !strings.ContainsAny(n, " \t") {
+				aliases = append(aliases, n)
+			}
+		}
+	}
+	return aliases
+}
+
+// propertyNames are the names of the cached properties of the object
+func (b *BusImpl) propertyNames(arg string) []string {
+	if arg == "" {
+		return nil
+	}
+	obj, err := b.findObject(arg)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for name := range obj.AllProperties() {
+		names = append(names, name)
+	}
+	return names
+}
+
+// uuids are the UUIDs of the device, or of all the devices if arg is empty
+func (b *BusImpl) uuids(arg string) []string {
+	var devices []*protocol.Device
+	if arg == "" {
+		for _, obj := range b.bluez.GetObjectsByInterface(protocol.BluezInterface.Device) {
+			if device, ok := obj.(*protocol.Device); ok {
+				devices = append(devices, device)
+			}
+		}
+	} else if device, err := b.findDevice(arg); err == nil {
+		devices = append(devices, device)
+	}
+	var uuids []string
+	for _, device := range devices {
+		uuids = append(uuids, device.UUIDs()...)
+	}
+	return uuids
+}
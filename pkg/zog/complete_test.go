@@ -0,0 +1,40 @@
+package zog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComplete(t *testing.T) {
+	b, closer := newFakeBus(t, "gatt")
+	defer closer()
+	assert.NoError(t, errOf(b.GetInterface()), "Unexpected error setting adapter")
+
+	assert.Equal(t, []string{"adapter", "adapters", "agent"}, b.Complete("a"))
+	assert.Equal(t, []string{"disconnect", "dump"}, b.Complete("object /org/bluez/hci0 d"))
+	assert.Equal(t, []string{"off", "on"}, b.Complete("adapter power "))
+	assert.Empty(t, b.Complete("nope "), "Unknown commands have no completions")
+
+	// Paths are completed an element at a time
+	assert.Equal(t, []string{"/org/bluez/hci0/dev_D1_40_FD_DE_C6_1C",
+		"/org/bluez/hci0/dev_D1_40_FD_DE_C6_1C/"},
+		b.Complete("object /org/bluez/hci0/dev_D1"))
+	assert.Equal(t, []string{"/org/bluez/hci0/dev_D1_40_FD_DE_C6_1C/service0017/char0018",
+		"/org/bluez/hci0/dev_D1_40_FD_DE_C6_1C/service0017/char0018/"},
+		b.Complete("gatt /org/bluez/hci0/dev_D1_40_FD_DE_C6_1C/service0017/char0018"))
+	assert.Equal(t, []string{"/org/bluez/hci0/dev_D1_40_FD_DE_C6_1C/"},
+		b.Complete("gatt /org/bluez/hci0/dev_D1"), "Only the devices with GATT objects")
+
+	// Devices can be their address or name
+	assert.Equal(t, []string{"D1:40:FD:DE:C6:1C"}, b.Complete("tree D1"))
+	assert.Equal(t, []string{"dev_D1_40_FD_DE_C6_1C"}, b.Complete("object dev_D1"))
+
+	assert.Equal(t, []string{"Adapter", "Address", "AddressType", "Alias"},
+		b.Complete("object D1:40:FD:DE:C6:1C property A"))
+	assert.Equal(t, []string{"org.bluez.GattCharacteristic1", "org.bluez.GattDescriptor1",
+		"org.bluez.GattManager1", "org.bluez.GattService1"}, b.Complete("list all org.bluez.G"))
+	assert.Equal(t, []string{"le"}, b.Complete("filter rssi -70 transport l"))
+	assert.Equal(t, []string{"object"}, b.Complete("help o"))
+	assert.Empty(t, b.Complete(`adapter alias "My`), "Quotes are not completed")
+}
@@ -1,15 +1,22 @@
 package zog
 
-// This is the implementation of the command line functions. So, fmt.Print* is fine, since it's
-// meant to be interactive, with the interactive part controlled by the code in cmd.
+// This is the implementation of the command line functions. The commands return Results, which
+// the code in cmd writes with a Formatter. The event streams, like discovery and notifications,
+// are written to the Bus's Formatter.
 import (
 	"context"
+	"errors"
 	"fmt"
-	"reflect"
+	"os"
+	"os/signal"
+	"path"
+	"sort"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
+	"github.com/godbus/dbus/v5"
 	"github.com/shigmas/bluezog/pkg/base"
 	"github.com/shigmas/bluezog/pkg/logger"
 	"github.com/shigmas/bluezog/pkg/protocol"
@@ -18,25 +25,38 @@ import (
 type (
 	// Bus is the API for the Bluez DBus
 	Bus interface {
-		// GetInterface starts the search for adapters, setting the default adapter
-		GetInterface(...interface{}) error
+		// GetInterface starts the search for adapters, setting the default adapter. It also
+		// controls the default adapter's power, discoverable, pairable and alias settings.
+		GetInterface(...interface{}) (Result, error)
+		// Adapters lists the adapters
+		Adapters(...interface{}) (Result, error)
 		// StartDiscovery starts device discovery
-		StartDiscovery(...interface{}) error
+		StartDiscovery(...interface{}) (Result, error)
 		// StopDiscovery stops discovery
-		StopDiscovery(...interface{}) error
+		StopDiscovery(...interface{}) (Result, error)
 		// DeviceCommands provides API to the device
-		ObjectCommands(...interface{}) error
+		ObjectCommands(...interface{}) (Result, error)
 		// Gatt handles GATT api requests
-		Gatt(...interface{}) error
+		Gatt(...interface{}) (Result, error)
+		// Tree prints the GATT hierarchy of a device
+		Tree(...interface{}) (Result, error)
 		// Close the connection to the bus
-		Close(...interface{}) error
+		Close(...interface{}) (Result, error)
 		// List objects. Can pass a property that we're looking for. Only objects that have that
 		// property will be listed, with that property
-		List(...interface{}) error
-		// Filter is kind of like List, but takes more arguments?
-		Filter(...interface{}) error
+		List(...interface{}) (Result, error)
+		// Filter sets the discovery filter on the default adapter
+		Filter(...interface{}) (Result, error)
+		// Agent registers or unregisters our pairing agent
+		Agent(...interface{}) (Result, error)
+		// Monitor streams the bluez signals until Ctrl-C
+		Monitor(...interface{}) (Result, error)
+		// SetPrompter sets the function the interactive agent uses to ask the user
+		SetPrompter(Prompter)
+		// Complete returns the candidates for the last word of the shell's line
+		Complete(line string) []string
 		// Test
-		Test(...interface{}) error
+		Test(...interface{}) (Result, error)
 	}
 
 	// BusImpl is the implementation of Bus. Exposed for... fun?
@@ -46,13 +66,20 @@ type (
 		cancelFunc     func()
 		deviceRecvCh   protocol.ObjectChangedChan
 		rwMux          sync.RWMutex
+		prompter       Prompter
+		agentActive    bool
+		out            *Formatter
 	}
 	// BusFunc declares the command interface to the shell
-	BusFunc func(Bus, ...interface{}) error
+	BusFunc func(Bus, ...interface{}) (Result, error)
+
+	// Option changes how NewBus sets up the Bus
+	Option func(*BusImpl)
 )
 
 var (
-	// BusCommand is the map for commands to the functions.
+	// BusCommand is the map for commands to the functions. CommandSpecs declares their
+	// arguments.
 	BusCommand map[string]BusFunc = make(map[string]BusFunc)
 )
 
@@ -60,18 +87,31 @@ func init() {
 	// These should be command sets. And some commands in the sets will set the command set.
 	BusCommand["close"] = (Bus).Close
 	BusCommand["adapter"] = (Bus).GetInterface
+	BusCommand["adapters"] = (Bus).Adapters
 	BusCommand["start"] = (Bus).StartDiscovery
 	BusCommand["stop"] = (Bus).StopDiscovery
 	BusCommand["object"] = (Bus).ObjectCommands
 	BusCommand["list"] = (Bus).List
 	BusCommand["filter"] = (Bus).Filter
+	BusCommand["agent"] = (Bus).Agent
 	BusCommand["gatt"] = (Bus).Gatt
+	BusCommand["tree"] = (Bus).Tree
+	BusCommand["monitor"] = (Bus).Monitor
 	BusCommand["test"] = (Bus).Test
+	BusCommand["help"] = help
+}
+
+// WithFormatter sets the Formatter for the event streams, like discovery and notifications.
+// By default, they're written as text to stdout.
+func WithFormatter(formatter *Formatter) Option {
+	return func(b *BusImpl) {
+		b.out = formatter
+	}
 }
 
 // NewBus creates a new bus
-func NewBus(ctx context.Context, ops base.Operations) Bus {
-	fmt.Println("Initializing Bluez")
+func NewBus(ctx context.Context, ops base.Operations, opts ...Option) Bus {
+	logger.Debug("Initializing Bluez")
 	//base.DumpData = true
 	bluez, err := protocol.InitializeBluez(ctx, ops)
 
@@ -82,13 +122,36 @@ func NewBus(ctx context.Context, ops base.Operations) Bus {
 	b := BusImpl{
 		bluez:        bluez,
 		deviceRecvCh: make(protocol.ObjectChangedChan, 3),
+		out:          NewFormatter(os.Stdout, FormatText),
+	}
+	for _, opt := range opts {
+		opt(&b)
 	}
 
 	return &b
 }
 
-// GetInterface searches the bus for adapters
-func (b *BusImpl) GetInterface(...interface{}) error {
+// GetInterface searches the bus for adapters, setting the default adapter. With arguments,
+// it controls the default adapter:
+// adapter power on|off
+// adapter discoverable on|off [timeout]
+// adapter pairable on|off [timeout]
+// adapter alias <name>
+// adapter show
+func (b *BusImpl) GetInterface(args ...interface{}) (Result, error) {
+	if len(args) == 0 || b.defaultAdapter == nil {
+		if err := b.findAdapters(); err != nil {
+			return nil, err
+		}
+	}
+	if len(args) == 0 {
+		return nil, nil
+	}
+
+	return b.adapterCommands(args...)
+}
+
+func (b *BusImpl) findAdapters() error {
 	adapters := b.bluez.FindAdapters()
 	if len(adapters) == 0 {
 		return fmt.Errorf("Failed to FindAdapters")
@@ -102,85 +165,122 @@ func (b *BusImpl) GetInterface(...interface{}) error {
 		if err != nil {
 			return fmt.Errorf("Error fetching %s", protocol.BluezAdapter.AddressProp)
 		}
-		logger.Info("Address: %s", addr)
+		logger.Debug("Address: %s", addr)
 	}
 	return nil
 }
 
+func (b *BusImpl) adapterCommands(args ...interface{}) (Result, error) {
+	command, err := stringArg(args[0])
+	if err != nil {
+		return nil, err
+	}
+	adapter := b.defaultAdapter
+
+	switch command {
+	case "show":
+		info := newAdapterInfo(adapter)
+		return &info, nil
+	case "power":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("adapter power on|off")
+		}
+		on, err := boolArg(args[1])
+		if err != nil {
+			return nil, err
+		}
+		return nil, adapter.SetPowered(on)
+	case "discoverable", "pairable":
+		if len(args) < 2 || len(args) > 3 {
+			return nil, fmt.Errorf("adapter %s on|off [timeout]", command)
+		}
+		on, err := boolArg(args[1])
+		if err != nil {
+			return nil, err
+		}
+		setFn, setTimeoutFn := adapter.SetDiscoverable, adapter.SetDiscoverableTimeout
+		if command == "pairable" {
+			setFn, setTimeoutFn = adapter.SetPairable, adapter.SetPairableTimeout
+		}
+		// Set the timeout first, so it applies as soon as the adapter changes state
+		if len(args) == 3 {
+			timeout, err := uintArg(args[2], 32)
+			if err != nil {
+				return nil, fmt.Errorf("Timeout %v is not a number of seconds", args[2])
+			}
+			if err = setTimeoutFn(uint32(timeout)); err != nil {
+				return nil, err
+			}
+		}
+		return nil, setFn(on)
+	case "alias":
+		if len(args) < 2 {
+			return nil, fmt.Errorf("adapter alias <name>")
+		}
+		// Aliases may have spaces. They can be quoted, or the words are joined
+		words, err := stringArgs(args[1:])
+		if err != nil {
+			return nil, err
+		}
+		return nil, adapter.SetAlias(strings.Join(words, " "))
+	}
+
+	return nil, fmt.Errorf("Unknown adapter command %s", command)
+}
+
+// Adapters lists the adapters with their settings
+func (b *BusImpl) Adapters(...interface{}) (Result, error) {
+	adapters := b.bluez.FindAdapters()
+	if len(adapters) == 0 {
+		return nil, fmt.Errorf("No adapters found")
+	}
+	list := make(AdapterList, len(adapters))
+	for i, adapter := range adapters {
+		list[i] = newAdapterInfo(adapter)
+	}
+	return list, nil
+}
+
 // StartDiscovery : The order would be:
 // 1. get the adapter
 // 2. start discovery
 // 3. stop (when done)
-func (b *BusImpl) StartDiscovery(...interface{}) error {
+func (b *BusImpl) StartDiscovery(...interface{}) (Result, error) {
 	go b.deviceReceiver()
 	var err error
 	b.rwMux.Lock()
 	b.deviceRecvCh, err = b.defaultAdapter.StartDiscovery()
 	b.rwMux.Unlock()
-	if err != nil {
-		return err
-	}
-	return nil
+	return nil, err
 }
 
 // StopDiscovery closes the access to the devices on the default adapter
-func (b *BusImpl) StopDiscovery(...interface{}) error {
-	b.defaultAdapter.StopDiscovery()
-	return nil
-}
-
-func printNode(n *base.Node) string {
-	str := fmt.Sprintf("%s\n", n.Name)
-	str += fmt.Sprintf("Sub Nodes:\n")
-	for _, sub := range n.Nodes {
-		str += fmt.Sprintf("\t%s\n", sub.Name)
-	}
-	str += fmt.Sprintf("Interfaces:\n")
-	for _, sub := range n.Interfaces {
-		str += fmt.Sprintf("\t%s\n", sub.Name)
-		for _, m := range sub.Methods {
-			str += fmt.Sprintf("\t\tMethod: %s(%s)\n", m.Name, m.Args)
-		}
-		for _, s := range sub.Signals {
-			str += fmt.Sprintf("\t\tSignal: %s(%s)\n", s.Name, s.Args)
-		}
-	}
-
-	return str
-}
-
-func isInt(i interface{}) bool {
-	switch v := reflect.ValueOf(i); v.Kind() {
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		return true
-	default:
-		return false
-	}
+func (b *BusImpl) StopDiscovery(...interface{}) (Result, error) {
+	return nil, b.defaultAdapter.StopDiscovery()
 }
 
 // ObjectCommands provide the API to send commands to devices
-func (b *BusImpl) ObjectCommands(args ...interface{}) error {
+func (b *BusImpl) ObjectCommands(args ...interface{}) (Result, error) {
 	// device /org/bluez/hci0/dev_FE_CD_66_43_D8_9E connect 00001800-0000-1000-8000-00805f9b34fb 00001801-0000-1000-8000-00805f9b34fb
 	if len(args) < 2 {
-		return fmt.Errorf("ConnectToDevice needs an address and a command, and any additional arguments. only %d args", len(args))
+		return nil, fmt.Errorf("ConnectToDevice needs an address and a command, and any additional arguments. only %d args", len(args))
 	}
-	addressArg, ok := args[0].(string)
-	if !ok {
-		return fmt.Errorf("Unable to convert %s to string", args[0])
+	addressArg, err := stringArg(args[0])
+	if err != nil {
+		return nil, err
 	}
-	command, ok := args[1].(string)
-	if !ok {
-		return fmt.Errorf("Unable to convert %s to string", args[2])
+	command, err := stringArg(args[1])
+	if err != nil {
+		return nil, err
 	}
 
-	objs := b.bluez.FindObjects(addressArg, true)
-	if len(objs) == 0 {
-		return fmt.Errorf("No devices in registry with address %s", addressArg)
+	base, err := b.findObject(addressArg)
+	if err != nil {
+		return nil, err
 	}
-	base := objs[0]
 	connectable, ok := base.(protocol.Connectable)
 	if !ok && (command == "connect" || command == "disconnect") {
-		return fmt.Errorf("Base is not a Device")
+		return nil, fmt.Errorf("Base is not a Device")
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(),
@@ -189,160 +289,356 @@ func (b *BusImpl) ObjectCommands(args ...interface{}) error {
 
 	switch command {
 	case "dump":
-		fmt.Printf("Path: %s\n", base.GetPath())
-		props := base.AllProperties()
-		for k, variant := range props {
-			val := variant.Value()
-			if isInt(val) {
-				fmt.Printf("%s: %d\n", k, val)
-			} else {
-				fmt.Printf("%s: %s (%s)\n", k, val, reflect.TypeOf(val))
-			}
+		if device, ok := base.(*protocol.Device); ok {
+			return newDeviceInfo(device), nil
 		}
+		info := newObjectInfo(base.GetPath(), base.GetInterfaces(), base.AllProperties())
+		return &info, nil
 	case "introspect":
-		node, err := b.bluez.IntrospectPath(addressArg)
+		node, err := b.bluez.IntrospectPath(string(base.GetPath()))
 		if err != nil {
-			return err
+			return nil, err
 		}
-		fmt.Printf(printNode(node))
+		return &NodeInfo{Node: *node}, nil
 	case "children":
-		managed, err := b.bluez.GetManagedObjects(addressArg)
+		managed, err := b.bluez.GetManagedObjects(string(base.GetPath()))
 		if err != nil {
-			return err
+			return nil, err
 		}
-		fmt.Printf("children: %s\n", managed)
-
+		return newManagedList(managed), nil
 	case "connect":
 		// device /org/bluez/hci0/dev_D7_57_C6_C2_0B_FA connect
 		var err error
 		if connectable == nil {
-			return fmt.Errorf("Object is not connectable")
+			return nil, fmt.Errorf("Object is not connectable")
 		}
 		if len(args) == 3 {
-			uuid, ok := args[2].(string)
-			if !ok {
-				return fmt.Errorf("Unable to convert %s to string", args[2])
+			var uuid string
+			if uuid, err = stringArg(args[2]); err != nil {
+				return nil, err
 			}
 			err = connectable.ConnectProfile(ctx, uuid)
-			fmt.Println("ConnectProfile")
 		} else {
 			err = connectable.Connect(ctx)
 		}
 		if err != nil {
-			return fmt.Errorf("Unable to connect to device %s: %s", addressArg, err)
+			return nil, fmt.Errorf("Unable to connect to device %s: %s", addressArg, err)
 		}
 	case "disconnect":
 		// device /org/bluez/hci0/dev_D7_57_C6_C2_0B_FA disconnect
 		var err error
 		if connectable == nil {
-			return fmt.Errorf("Object is not connectable")
+			return nil, fmt.Errorf("Object is not connectable")
 		}
 		if len(args) == 3 {
-			uuid, ok := args[2].(string)
-			if !ok {
-				return fmt.Errorf("Unable to convert %s to string", args[2])
+			var uuid string
+			if uuid, err = stringArg(args[2]); err != nil {
+				return nil, err
 			}
 			err = connectable.DisconnectProfile(ctx, uuid)
-			fmt.Println("ConnectProfile")
 		} else {
 			err = connectable.Disconnect(ctx)
 		}
 		if err != nil {
-			return fmt.Errorf("Unable to connect to device %s: %s", addressArg, err)
+			return nil, fmt.Errorf("Unable to connect to device %s: %s", addressArg, err)
 		}
 	case "property":
 		if len(args) != 3 {
-			return fmt.Errorf("property needs the property name as an argument")
+			return nil, fmt.Errorf("property needs the property name as an argument")
 		}
-		propName, ok := args[2].(string)
-		if !ok {
-			return fmt.Errorf("Unable to %s to string", args[2])
+		propName, err := stringArg(args[2])
+		if err != nil {
+			return nil, err
 		}
 		prop, err := base.FetchProperty(propName)
 		if err != nil {
-			return fmt.Errorf("Failed to get property [%s]: %s", propName, err)
+			return nil, fmt.Errorf("Failed to get property [%s]: %s", propName, err)
+		}
+		return &ObjectInfo{
+			Path:       base.GetPath(),
+			Properties: map[string]interface{}{propName: jsonValue(prop)},
+		}, nil
+	case "pair", "cancelpair", "trust", "block", "remove":
+		device, ok := base.(*protocol.Device)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a Device", addressArg)
 		}
-		fmt.Printf("Property %s has value %s\n", propName, prop)
+		return b.deviceCommands(ctx, device, command, args[2:]...)
+	default:
+		return nil, fmt.Errorf("Unknown object command %s", command)
 	}
 
-	return nil
+	return nil, nil
+}
+
+// newManagedList converts the result of GetManagedObjects. The properties of all of the
+// interfaces are merged.
+func newManagedList(managed map[dbus.ObjectPath]base.ObjectMap) ObjectList {
+	paths := make([]string, 0, len(managed))
+	for path := range managed {
+		paths = append(paths, string(path))
+	}
+	sort.Strings(paths)
+	list := make(ObjectList, len(paths))
+	for i, path := range paths {
+		objMap := managed[dbus.ObjectPath(path)]
+		interfaces := make([]string, 0, len(objMap))
+		props := make(map[string]dbus.Variant)
+		for iface, ifaceProps := range objMap {
+			interfaces = append(interfaces, iface)
+			for k, v := range ifaceProps {
+				props[k] = v
+			}
+		}
+		sort.Strings(interfaces)
+		list[i] = newObjectInfo(dbus.ObjectPath(path), interfaces, props)
+	}
+	return list
+}
+
+// deviceCommands handles the pairing workflow for the object command:
+// object <path> pair|cancelpair|remove
+// object <path> trust|block [on|off]
+func (b *BusImpl) deviceCommands(ctx context.Context, device *protocol.Device, command string,
+	args ...interface{}) (Result, error) {
+	// trust and block default to on
+	on := true
+	if len(args) > 0 {
+		var err error
+		if on, err = boolArg(args[0]); err != nil {
+			return nil, err
+		}
+	}
+
+	switch command {
+	case "pair":
+		err := device.Pair(ctx)
+		if errors.Is(err, protocol.ErrAlreadyExists) {
+			return &Message{fmt.Sprintf("%s is already paired", device.GetPath())}, nil
+		}
+		return nil, err
+	case "cancelpair":
+		return nil, device.CancelPairing(ctx)
+	case "trust":
+		return nil, device.SetTrusted(on)
+	case "block":
+		return nil, device.SetBlocked(on)
+	case "remove":
+		// The adapter is the parent of the device
+		adapterPath := path.Dir(string(device.GetPath()))
+		objs := b.bluez.FindObjects(adapterPath, true)
+		if len(objs) == 0 {
+			return nil, fmt.Errorf("No adapter in registry with address %s", adapterPath)
+		}
+		adapter, ok := objs[0].(*protocol.Adapter)
+		if !ok {
+			return nil, fmt.Errorf("%s is not an Adapter", adapterPath)
+		}
+		return nil, adapter.RemoveDevice(ctx, device.GetPath())
+	}
+
+	return nil, nil
+}
+
+// parseWriteArgs parses <data> [command|request|reliable]. The data is parsed with
+// ParseBytes, if the shell hasn't already.
+func parseWriteArgs(args ...interface{}) ([]byte, protocol.WriteOptions, error) {
+	var opts protocol.WriteOptions
+	if len(args) < 1 || len(args) > 2 {
+		return nil, opts, fmt.Errorf("write <0xhex|string> [command|request|reliable]")
+	}
+	data, err := bytesArg(args[0])
+	if err != nil {
+		return nil, opts, err
+	}
+	if len(args) == 2 {
+		writeType, err := stringArg(args[1])
+		if err != nil {
+			return nil, opts, err
+		}
+		opts.Type = protocol.WriteType(writeType)
+	}
+
+	return data, opts, nil
+}
+
+// streamNotifications writes the notifications from the characteristic until Ctrl-C or
+// SIGTERM
+func streamNotifications(ctx context.Context, out *Formatter,
+	characteristic *protocol.GattCharacteristic) error {
+	notifications, err := characteristic.StartNotify(ctx)
+	if err != nil {
+		return err
+	}
+	interruptCh := make(chan os.Signal, 1)
+	signal.Notify(interruptCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interruptCh)
+
+	logger.Info("Notifications from %s. Ctrl-C to stop", characteristic.GetPath())
+	for {
+		select {
+		case n, ok := <-notifications:
+			if !ok {
+				return nil
+			}
+			event := &NotificationEvent{Time: n.Time, Path: n.Path, Value: n.Value}
+			if err := out.WriteEvent(event); err != nil {
+				logger.Error("Unable to write notification: %s", err)
+			}
+		case <-interruptCh:
+			stopCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			return characteristic.StopNotify(stopCtx)
+		}
+	}
 }
 
 // Gatt provides access to the GATT functionality
-func (b *BusImpl) Gatt(args ...interface{}) error {
+// gatt <characteristic> [read|notify|stop]
+// gatt <characteristic|descriptor> write <data> [command|request|reliable]
+// Without an operation, the value is read.
+func (b *BusImpl) Gatt(args ...interface{}) (Result, error) {
 	if len(args) < 1 {
-		return fmt.Errorf("gatt needs an address")
+		return nil, fmt.Errorf("gatt needs an address")
 	}
-	addressArg, ok := args[0].(string)
-	if !ok {
-		return fmt.Errorf("Unable to convert %s to string", args[0])
+	addressArg, err := stringArg(args[0])
+	if err != nil {
+		return nil, err
 	}
 
 	op := ""
 	if len(args) >= 2 {
-		opArg, ok := args[1].(string)
-		if !ok {
-			return fmt.Errorf("Unable to convert %s to string", args[1])
+		if op, err = stringArg(args[1]); err != nil {
+			return nil, err
 		}
-		op = opArg
 	}
-	fmt.Printf("Op: %s\n", op)
 
-	parts := strings.Split(addressArg, "/")
-	objs := b.bluez.FindObjects(addressArg, true)
-	if len(objs) == 0 {
-		return fmt.Errorf("No devices in registry with address %s", addressArg)
+	base, err := b.findObject(addressArg)
+	if err != nil {
+		return nil, err
 	}
-	base := objs[0]
 
 	ctx, cancel := context.WithTimeout(context.Background(),
 		30*time.Second)
 	defer cancel()
 
-	// A GATT paths
-	// Service:
-	// /org/bluez/hci0/dev_FF_F2_DF_D8_10_D4/service001f
-	// Characteristic:
-	// /org/bluez/hci0/dev_FF_F2_DF_D8_10_D4/service001f/char0022
-	// and a Descriptor:
-	// /org/bluez/hci0/dev_FF_F2_DF_D8_10_D4/service001f/char0022/desc0024
-	if len(parts) == 6 { // the empty space before the / is included
-		service, ok := base.(*protocol.GattService)
+	switch obj := base.(type) {
+	case *protocol.GattService:
+		info := newServiceInfo(obj)
+		return &info, nil
+	case *protocol.GattCharacteristic:
+		characteristic := obj
+		switch op {
+		case "write":
+			data, opts, err := parseWriteArgs(args[2:]...)
+			if err != nil {
+				return nil, err
+			}
+			return nil, characteristic.WriteValue(ctx, data, opts)
+		case "notify":
+			return nil, streamNotifications(ctx, b.out, characteristic)
+		case "stop":
+			return nil, characteristic.StopNotify(ctx)
+		}
+		val, err := characteristic.ReadValue(ctx, protocol.ReadOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return &ValueInfo{Path: characteristic.GetPath(), Value: val}, nil
+	case *protocol.GattDescriptor:
+		descriptor := obj
+		if op == "write" {
+			data, opts, err := parseWriteArgs(args[2:]...)
+			if err != nil {
+				return nil, err
+			}
+			return nil, descriptor.WriteValue(ctx, data, opts)
+		}
+		val, err := descriptor.ReadValue(ctx, protocol.ReadOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return &ValueInfo{Path: descriptor.GetPath(), Value: val}, nil
+	}
+
+	return nil, fmt.Errorf("Not a GATT path")
+}
+
+// findObject finds the object by path. Devices can also be found by address or name.
+func (b *BusImpl) findObject(arg string) (protocol.Base, error) {
+	if !strings.HasPrefix(arg, "/") {
+		return b.findDevice(arg)
+	}
+	objs := b.bluez.FindObjects(arg, true)
+	if len(objs) == 0 {
+		return nil, fmt.Errorf("No devices in registry with address %s", arg)
+	}
+	return objs[0], nil
+}
+
+// findDevice finds the device by path, address, or name
+func (b *BusImpl) findDevice(arg string) (*protocol.Device, error) {
+	if strings.HasPrefix(arg, "/") {
+		objs := b.bluez.FindObjects(arg, true)
+		if len(objs) == 0 {
+			return nil, fmt.Errorf("No devices in registry with address %s", arg)
+		}
+		device, ok := objs[0].(*protocol.Device)
 		if !ok {
-			return fmt.Errorf("Path appeared to a GATT Service, but not convertible")
+			return nil, fmt.Errorf("%s is not a Device", arg)
 		}
-		fmt.Println(service)
-	} else if len(parts) == 7 {
-		characteristic, ok := base.(*protocol.GattCharacteristic)
+		return device, nil
+	}
+	for _, obj := range b.bluez.GetObjectsByInterface(protocol.BluezInterface.Device) {
+		device, ok := obj.(*protocol.Device)
 		if !ok {
-			return fmt.Errorf("Path appeared to a GATT Characteristic, but not convertible")
+			continue
 		}
-		val, err := characteristic.ReadValue(ctx, 0)
-		if err != nil {
-			return err
+		name, _ := device.Name()
+		if strings.EqualFold(device.Address(), arg) || device.Alias() == arg || name == arg {
+			return device, nil
+		}
+	}
+
+	return nil, fmt.Errorf("No device %s", arg)
+}
+
+// Tree returns the GATT services, characteristics and descriptors of the device. If the
+// services aren't resolved, it connects and waits for them.
+// tree <device path|address|name>
+func (b *BusImpl) Tree(args ...interface{}) (Result, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("tree <device>")
+	}
+	deviceArg, err := stringArg(args[0])
+	if err != nil {
+		return nil, err
+	}
+	device, err := b.findDevice(deviceArg)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if !device.ServicesResolved() {
+		if !device.Connected() {
+			if err := device.Connect(ctx); err != nil {
+				return nil, fmt.Errorf("Unable to connect to device %s: %s", deviceArg, err)
+			}
 		}
-		fmt.Printf("Char: %s\n", val)
-		if op != "" && op == "notify" {
-			fmt.Println("StartNotify")
-			return characteristic.StartNotify()
-		} else if op != "" && op == "stop" {
-			fmt.Println("StopNotify")
-			return characteristic.StopNotify()
+		if err := device.WaitServicesResolved(ctx); err != nil {
+			return nil, fmt.Errorf("Services of %s weren't resolved: %s", deviceArg, err)
 		}
-	} else if len(parts) == 8 {
-		return fmt.Errorf("Path appeared to a GATT Descriptor, but not implemented")
-	} else {
-		return fmt.Errorf("Not a GATT path")
 	}
 
-	return nil
+	return newGattTree(device), nil
 }
 
 // List objects by interface, and, optionally, if they have the specified property.
-func (b *BusImpl) List(args ...interface{}) error {
-	var ok bool
+func (b *BusImpl) List(args ...interface{}) (Result, error) {
 	if len(args) < 2 {
-		return fmt.Errorf("[path|all] <interface name> (property))")
+		return nil, fmt.Errorf("[path|all] <interface name> (property))")
 	}
 
 	onlyPath := false
@@ -352,101 +648,220 @@ func (b *BusImpl) List(args ...interface{}) error {
 		}
 	}
 
-	name := ""
-	if name, ok = args[1].(string); !ok {
-		return fmt.Errorf("interface or property argument was not a string")
+	name, err := stringArg(args[1])
+	if err != nil {
+		return nil, err
 	}
 
 	propName := ""
 	if len(args) >= 3 {
-		if propName, ok = args[2].(string); !ok {
-			return fmt.Errorf("interface or property argument was not a string")
+		if propName, err = stringArg(args[2]); err != nil {
+			return nil, err
 		}
 	}
 
 	objects := b.bluez.GetObjectsByInterface(name)
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].GetPath() < objects[j].GetPath()
+	})
 
-	fmt.Printf("Found %d objects\n", len(objects))
-	if propName != "" {
-		fmt.Printf("Filtering for only objects containing %s\n", propName)
-	}
-
+	list := make(ObjectList, 0, len(objects))
 	for _, o := range objects {
 		if propName != "" {
 			prop, err := o.FetchProperty(propName)
 			if err != nil || prop == nil {
 				continue
 			}
+			list = append(list, ObjectInfo{
+				Path:       o.GetPath(),
+				Properties: map[string]interface{}{propName: jsonValue(o.Property(propName))},
+			})
+		} else if onlyPath {
+			list = append(list, ObjectInfo{Path: o.GetPath()})
+		} else {
+			list = append(list, newObjectInfo(o.GetPath(), nil, o.AllProperties()))
 		}
-		fmt.Printf("Path: %s\n", o.GetPath())
-		if propName != "" {
-			propVal := o.Property(propName)
-			fmt.Printf("%s: %s\n", propName, propVal)
-		} else if !onlyPath {
-			props := o.AllProperties()
-			for k, variant := range props {
-				fmt.Printf("%s: %s\n", k, variant.Value())
+	}
+	return list, nil
+}
+
+// Filter sets the discovery filter on the default adapter. The arguments are key value pairs:
+// filter uuids <uuid>[,<uuid>...] rssi <dBm> pathloss <dB> transport auto|bredr|le
+// duplicates on|off discoverable on|off pattern <prefix>
+// filter clear removes the filter, and filter show lists the supported filters.
+func (b *BusImpl) Filter(args ...interface{}) (Result, error) {
+	if b.defaultAdapter == nil {
+		return nil, fmt.Errorf("No adapter. Run adapter first")
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("filter show|clear|<key> <value>...")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	command, err := stringArg(args[0])
+	if err != nil {
+		return nil, err
+	}
+	switch command {
+	case "show":
+		filters, err := b.defaultAdapter.GetDiscoveryFilters(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return DiscoveryFilters(filters), nil
+	case "clear":
+		return nil, b.defaultAdapter.SetDiscoveryFilter(ctx, protocol.DiscoveryFilter{})
+	}
+
+	if len(args)%2 != 0 {
+		return nil, fmt.Errorf("filter arguments are key value pairs")
+	}
+	var filter protocol.DiscoveryFilter
+	for i := 0; i < len(args); i += 2 {
+		key, err := stringArg(args[i])
+		if err != nil {
+			return nil, err
+		}
+		val := args[i+1]
+		switch key {
+		case "uuids", "transport", "pattern":
+			str, err := stringArg(val)
+			if err != nil {
+				return nil, err
+			}
+			switch key {
+			case "uuids":
+				filter.UUIDs = strings.Split(str, ",")
+			case "transport":
+				filter.Transport = protocol.DiscoveryTransport(str)
+			case "pattern":
+				filter.Pattern = str
 			}
+		case "rssi":
+			rssi, err := intArg(val, 16)
+			if err != nil {
+				return nil, fmt.Errorf("rssi %v is not a number", val)
+			}
+			filter.RSSI = int16(rssi)
+		case "pathloss":
+			pathloss, err := uintArg(val, 16)
+			if err != nil {
+				return nil, fmt.Errorf("pathloss %v is not a number", val)
+			}
+			filter.Pathloss = uint16(pathloss)
+		case "duplicates", "discoverable":
+			on, err := boolArg(val)
+			if err != nil {
+				return nil, err
+			}
+			if key == "duplicates" {
+				filter.DuplicateData = &on
+			} else {
+				filter.Discoverable = &on
+			}
+		default:
+			return nil, fmt.Errorf("Unknown filter %s", key)
 		}
 	}
-	return nil
+
+	return nil, b.defaultAdapter.SetDiscoveryFilter(ctx, filter)
 }
 
-// Filter doesn't do anything
-func (b *BusImpl) Filter(args ...interface{}) error {
-	return nil
+// SetPrompter sets the function for the interactive agent
+func (b *BusImpl) SetPrompter(prompter Prompter) {
+	b.prompter = prompter
+}
+
+// Agent registers our agent, so we can pair with devices that need a passkey or confirmation.
+// agent on [capability] registers the interactive agent, which asks through the Prompter
+// agent auto [capability] registers an agent that accepts everything
+// agent off unregisters the agent
+func (b *BusImpl) Agent(args ...interface{}) (Result, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("agent on|auto|off [capability]")
+	}
+	command, err := stringArg(args[0])
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	manager, err := b.bluez.FindAgentManager()
+	if err != nil {
+		return nil, err
+	}
+
+	if command == "off" {
+		if !b.agentActive {
+			return nil, fmt.Errorf("No agent registered")
+		}
+		b.agentActive = false
+		return nil, manager.UnregisterAgent(ctx, AgentPath)
+	}
+	if b.agentActive {
+		return nil, fmt.Errorf("Agent already registered")
+	}
+
+	var agent protocol.Agent
+	var capability protocol.AgentCapability
+	switch command {
+	case "on":
+		if b.prompter == nil {
+			return nil, fmt.Errorf("No prompter for the interactive agent. Use agent auto")
+		}
+		agent = newPromptAgent(b.prompter, b.out)
+		capability = protocol.CapabilityKeyboardDisplay
+	case "auto":
+		agent = &protocol.AutoAcceptAgent{}
+		capability = protocol.CapabilityNoInputNoOutput
+	default:
+		return nil, fmt.Errorf("Unknown agent command %s", command)
+	}
+	if len(args) > 1 {
+		capabilityArg, err := stringArg(args[1])
+		if err != nil {
+			return nil, err
+		}
+		capability = protocol.AgentCapability(capabilityArg)
+	}
+
+	if err = manager.RegisterAgent(ctx, AgentPath, capability, agent); err != nil {
+		return nil, err
+	}
+	b.agentActive = true
+	return nil, manager.RequestDefaultAgent(ctx, AgentPath)
 }
 
 // Close the connection. Or not
-func (b *BusImpl) Close(...interface{}) error {
+func (b *BusImpl) Close(...interface{}) (Result, error) {
 	//b.conn.Close()
-	return nil
+	return nil, nil
 }
 
 // Test tests
-func (b *BusImpl) Test(args ...interface{}) error {
-	numArgs := 0
-	for a := range args {
-		fmt.Println("arg: ", args[a])
-		numArgs++
+func (b *BusImpl) Test(args ...interface{}) (Result, error) {
+	strs := make([]string, len(args))
+	for i, a := range args {
+		strs[i] = fmt.Sprint(a)
 	}
-	fmt.Println("Num args: ", numArgs)
-	return nil
+	return &Message{fmt.Sprintf("Num args: %d: %s", len(args), strings.Join(strs, ", "))}, nil
 }
 
 func (b *BusImpl) deviceReceiver() {
-	fmt.Printf("Waiting for devices...\n")
+	logger.Debug("Waiting for devices...")
 	b.rwMux.RLock()
 	for d := range b.deviceRecvCh {
-		objs := b.bluez.FindObjects(string(d.Path), true)
-		mfgData := "default"
-		if len(objs) >= 0 {
-			base := objs[0]
-			device, ok := base.(*protocol.Device)
-			if !ok {
-				mfgData = "not device"
-			} else {
-				prop, err := device.FetchProperty("ManufacturerData")
-				if err == nil {
-					var ok bool
-					mfgDataMap, ok := prop.(map[uint16]interface{})
-					if ok {
-						mfgData = fmt.Sprintf("%d: %v", len(mfgDataMap), mfgDataMap)
-					} else {
-						// This may be empty for devices that don't provide this property
-						mfgData = reflect.TypeOf(prop).Name()
-					}
-				} else {
-					fmt.Println("Error: ", err)
-					mfgData = err.Error()
-				}
+		var device *protocol.Device
+		if d.Type != protocol.ObjectRemoved && d.Type != protocol.ObjectInterfacesRemoved {
+			if objs := b.bluez.FindObjects(string(d.Path), true); len(objs) > 0 {
+				device, _ = objs[0].(*protocol.Device)
 			}
-		} else {
-			mfgData = "Not in Cache"
 		}
-
-		fmt.Printf("Received %s (ManufacturerData: %s)\n", d.Path, mfgData)
+		if err := b.out.WriteEvent(newDeviceEvent(d, device)); err != nil {
+			logger.Error("Unable to write device: %s", err)
+		}
 	}
 	b.rwMux.RUnlock()
-	fmt.Printf("Leaving deviceReceiver\n")
+	logger.Debug("Leaving deviceReceiver")
 }
@@ -1,53 +1,151 @@
 package zog
 
 import (
+	"bytes"
 	"context"
 	//	"github.com/shigmas/bluezog/pkg/protocol"
-
+	"strings"
 	"testing"
 
 	"github.com/shigmas/bluezog/pkg/bus"
-	"github.com/shigmas/bluezog/test"
+	"github.com/shigmas/bluezog/test/scenario"
 	"github.com/stretchr/testify/assert"
 )
 
-func TestBus(t *testing.T) {
-	ctx := context.Background()
-	ops := bus.DbusOperations{}
+// newFakeBus starts the fake bluez, and connects a Bus to it. The test is skipped if there's
+// no dbus-daemon.
+func newFakeBus(t *testing.T, managedType string) (Bus, func()) {
+	fake, err := scenario.StartFakeBluez(managedType)
+	if err == scenario.ErrNoDaemon {
+		t.Skip("dbus-daemon is not installed")
+	}
+	if !assert.NoError(t, err, "Unable to start the fake bluez") {
+		t.FailNow()
+	}
+	ops := bus.NewDbusOperations(bus.WithBusAddress(fake.Address))
+	if !assert.NotNil(t, ops, "Unable to connect to the fake bluez") {
+		fake.Close()
+		t.FailNow()
+	}
+
+	return NewBus(context.Background(), ops), func() { fake.Close() }
+}
 
-	bus := NewBus(ctx, &ops)
-	err := bus.List("property", "Name")
+// errOf drops the Result, for the commands that we only check the error of
+func errOf(_ Result, err error) error {
+	return err
+}
+
+func TestBus(t *testing.T) {
+	bus, closer := newFakeBus(t, "simple")
+	defer closer()
+	result, err := bus.List("all", "org.bluez.Device1", "Name")
 	assert.NoError(t, err, "Unexpected error: ", err)
+	list, ok := result.(ObjectList)
+	if assert.True(t, ok, "Expected an ObjectList") && assert.Len(t, list, 3, "Only the devices with a Name") {
+		assert.Equal(t, "/org/bluez/hci0/dev_08_EB_ED_9D_D6_C7", string(list[0].Path))
+		assert.Equal(t, "dev_08_EB_ED_9D_D6_C7", list[0].Properties["Name"])
+	}
 }
 
 func TestGattPath(t *testing.T) {
-	bus := NewBus(context.Background(), test.NewBusMock("gatt"))
-	assert.NoError(t, bus.GetInterface(), "Unexpected error setting adapter")
-	assert.NoError(t, bus.StartDiscovery(), "Unexpected error starting discovery")
+	bus, closer := newFakeBus(t, "gatt")
+	defer closer()
+	assert.NoError(t, errOf(bus.GetInterface()), "Unexpected error setting adapter")
+	assert.NoError(t, errOf(bus.StartDiscovery()), "Unexpected error starting discovery")
 
 	t.Run("TestBadPaths", func(t *testing.T) {
 		devicePath := "/org/bluez/hci0/dev_FF_F2_DF_D8_10_D4"
 		descriptorAndMore := "/org/bluez/hci0/dev_FF_F2_DF_D8_10_D4/service001f/char0022/desc0024/foo"
 
-		assert.Error(t, bus.Gatt(devicePath), "Expected error on path")
-		assert.Error(t, bus.Gatt(descriptorAndMore), "Expected error on path")
+		assert.Error(t, errOf(bus.Gatt(devicePath)), "Expected error on path")
+		assert.Error(t, errOf(bus.Gatt(descriptorAndMore)), "Expected error on path")
 	})
 
 	t.Run("TestGattPaths", func(t *testing.T) {
 		t.Run("TestService", func(t *testing.T) {
 			servicePath := "/org/bluez/hci0/dev_FF_F2_DF_D8_10_D4/service001f"
 			//assert.NoError(t, bus.Gatt(servicePath), "Unexpected error with service")
-			assert.Error(t, bus.Gatt(servicePath), "Unexpected error with service")
+			assert.Error(t, errOf(bus.Gatt(servicePath)), "Unexpected error with service")
 		})
 		t.Run("TestCharacteristic", func(t *testing.T) {
 			characteristicPath := "/org/bluez/hci0/dev_FF_F2_DF_D8_10_D4/service001f/char0022"
 			//assert.NoError(t, bus.Gatt(characteristicPath), "Unexpected error with service")
-			assert.Error(t, bus.Gatt(characteristicPath), "Unexpected error with service")
+			assert.Error(t, errOf(bus.Gatt(characteristicPath)), "Unexpected error with service")
 		})
 		t.Run("TestDescriptor", func(t *testing.T) {
 			descriptorPath := "/org/bluez/hci0/dev_FF_F2_DF_D8_10_D4/service001f/char0022/desc0024"
 			//assert.NoError(t, bus.Gatt(descriptorPath), "Unexpected error with service")
-			assert.Error(t, bus.Gatt(descriptorPath), "Unexpected error with service")
+			assert.Error(t, errOf(bus.Gatt(descriptorPath)), "Unexpected error with service")
 		})
 	})
 }
+
+func TestTree(t *testing.T) {
+	b, closer := newFakeBus(t, "gatt")
+	defer closer()
+	assert.NoError(t, errOf(b.GetInterface()), "Unexpected error setting adapter")
+	impl := b.(*BusImpl)
+
+	_, err := impl.findDevice("00:00:00:00:00:00")
+	assert.Error(t, err, "Expected error for unknown device")
+	device, err := impl.findDevice("d1:40:fd:de:c6:1c")
+	if !assert.NoError(t, err, "Unexpected error finding device by address") {
+		return
+	}
+	byName, err := impl.findDevice("dev_D1_40_FD_DE_C6_1C")
+	assert.NoError(t, err, "Unexpected error finding device by name")
+	assert.Equal(t, device, byName)
+
+	// The fake resolves the services when the device connects
+	result, err := b.Tree("D1:40:FD:DE:C6:1C")
+	if !assert.NoError(t, err, "Unexpected error in tree") {
+		return
+	}
+	tree, ok := result.(*GattTree)
+	if !assert.True(t, ok, "Expected a GattTree") {
+		return
+	}
+	assert.Len(t, tree.Services, 6)
+	assert.Equal(t, uint16(0x0b), tree.Services[0].Characteristics[0].Descriptors[0].Handle)
+
+	var buf bytes.Buffer
+	tree.Text(&buf)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, "/org/bluez/hci0/dev_D1_40_FD_DE_C6_1C D1:40:FD:DE:C6:1C dev_D1_40_FD_DE_C6_1C",
+		lines[0])
+	assert.Equal(t,
+		"  primary service handle = 0x0008, uuid = 00000008-0000-1000-8000-00805f9b34fb",
+		lines[1])
+	assert.Equal(t, "    characteristic handle = 0x0009, uuid = "+
+		"00000009-0000-1000-8000-00805f9b34fb, flags = read,write,notify", lines[2])
+	assert.Equal(t,
+		"      descriptor handle = 0x000b, uuid = 00002902-0000-1000-8000-00805f9b34fb",
+		lines[3])
+	assert.Equal(t,
+		"  primary service handle = 0x000c, uuid = 0000000c-0000-1000-8000-00805f9b34fb",
+		lines[4])
+}
+
+func TestScriptCommands(t *testing.T) {
+	b, closer := newFakeBus(t, "gatt")
+	defer closer()
+	assert.NoError(t, errOf(b.GetInterface()), "Unexpected error setting adapter")
+	result, err := b.Adapters()
+	assert.NoError(t, err, "Unexpected error listing adapters")
+	if adapters, ok := result.(AdapterList); assert.True(t, ok) && assert.Len(t, adapters, 1) {
+		assert.Equal(t, scenario.FakeAdapterAddress, adapters[0].Address)
+	}
+
+	// The commands take addresses as well as paths
+	result, err = b.ObjectCommands("D1:40:FD:DE:C6:1C", "dump")
+	assert.NoError(t, err, "Unexpected error in dump")
+	if device, ok := result.(*DeviceInfo); assert.True(t, ok, "Expected a DeviceInfo") {
+		assert.Equal(t, "D1:40:FD:DE:C6:1C", device.Address)
+	}
+	assert.NoError(t, errOf(b.ObjectCommands("D1:40:FD:DE:C6:1C", "connect")),
+		"Unexpected error in connect")
+	assert.Error(t, errOf(b.ObjectCommands("00:00:00:00:00:00", "connect")),
+		"Expected error for unknown device")
+	assert.Error(t, errOf(b.Gatt("D1:40:FD:DE:C6:1C")), "A device is not a GATT path")
+}
@@ -0,0 +1,163 @@
+package zog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+type (
+	// Format is how the results are written
+	Format string
+
+	// Result is the data a command returns. The Formatter writes it as text, a table, or
+	// JSON. JSON is from encoding/json, so the Results need json tags.
+	Result interface {
+		// Text writes the result for people to read
+		Text(w io.Writer)
+		// Table returns the header and the rows of the table
+		Table() ([]string, [][]string)
+	}
+
+	// Colored is a Result that has colors for the terminal, like the monitor's stream
+	Colored interface {
+		// ColorText is Text, with the terminal colors
+		ColorText(w io.Writer)
+	}
+
+	// Formatter writes the Results in the Format. The commands and the event streams
+	// write to the same Formatter, so the output is consistent.
+	Formatter struct {
+		w      io.Writer
+		format Format
+		mux    sync.Mutex
+		// the last table header of the stream. Events only write the header when it changes.
+		header string
+		color  bool
+	}
+)
+
+const (
+	// FormatText is human readable text
+	FormatText Format = "text"
+	// FormatJSON is indented JSON. Lists are JSON arrays.
+	FormatJSON Format = "json"
+	// FormatJSONL is one JSON object per line. Lists are written one item per line.
+	FormatJSONL Format = "jsonl"
+	// FormatTable is columns, with a header
+	FormatTable Format = "table"
+)
+
+// ParseFormat returns the Format for the --output flag
+func ParseFormat(str string) (Format, error) {
+	switch format := Format(str); format {
+	case FormatText, FormatJSON, FormatJSONL, FormatTable:
+		return format, nil
+	}
+	return "", fmt.Errorf("Unknown output format %s. Use text, json, jsonl or table", str)
+}
+
+// NewFormatter creates a Formatter that writes to w
+func NewFormatter(w io.Writer, format Format) *Formatter {
+	return &Formatter{w: w, format: format}
+}
+
+// SetColor writes the text of the Colored Results with colors. It's for terminals.
+func (f *Formatter) SetColor(color bool) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.color = color
+}
+
+// Format returns the format that the Formatter writes
+func (f *Formatter) Format() Format {
+	return f.format
+}
+
+func isNil(result Result) bool {
+	if result == nil {
+		return true
+	}
+	switch v := reflect.ValueOf(result); v.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map:
+		return v.IsNil()
+	}
+	return false
+}
+
+// Write writes the result of a command. A nil result writes nothing.
+func (f *Formatter) Write(result Result) error {
+	if isNil(result) {
+		return nil
+	}
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	// A command always has the header
+	f.header = ""
+	err := f.write(result)
+	f.header = ""
+	return err
+}
+
+// WriteEvent writes the result from an event stream, like notifications. In a table, the
+// header is only written for the first event.
+func (f *Formatter) WriteEvent(result Result) error {
+	if isNil(result) {
+		return nil
+	}
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return f.write(result)
+}
+
+func (f *Formatter) write(result Result) error {
+	switch f.format {
+	case FormatJSON:
+		data, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(f.w, "%s\n", data)
+		return err
+	case FormatJSONL:
+		items := []interface{}{result}
+		if v := reflect.ValueOf(result); v.Kind() == reflect.Slice {
+			items = make([]interface{}, v.Len())
+			for i := range items {
+				items[i] = v.Index(i).Interface()
+			}
+		}
+		for _, item := range items {
+			data, err := json.Marshal(item)
+			if err != nil {
+				return err
+			}
+			if _, err = fmt.Fprintf(f.w, "%s\n", data); err != nil {
+				return err
+			}
+		}
+	case FormatTable:
+		header, rows := result.Table()
+		w := tabwriter.NewWriter(f.w, 0, 8, 2, ' ', 0)
+		if joined := strings.Join(header, "\t"); joined != f.header {
+			fmt.Fprintln(w, joined)
+			f.header = joined
+		}
+		for _, row := range rows {
+			fmt.Fprintln(w, strings.Join(row, "\t"))
+		}
+		return w.Flush()
+	default:
+		if colored, ok := result.(Colored); ok && f.color {
+			colored.ColorText(f.w)
+			break
+		}
+		result.Text(f.w)
+	}
+
+	return nil
+}
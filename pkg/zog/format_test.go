@@ -0,0 +1,120 @@
+package zog
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/shigmas/bluezog/pkg/beacon"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFormat(t *testing.T) {
+	format, err := ParseFormat("jsonl")
+	assert.NoError(t, err)
+	assert.Equal(t, FormatJSONL, format)
+	_, err = ParseFormat("yaml")
+	assert.Error(t, err, "Expected error for unknown format")
+}
+
+func TestFormatter(t *testing.T) {
+	info := newObjectInfo("/org/bluez/hci0/dev_D1_40_FD_DE_C6_1C", nil,
+		map[string]dbus.Variant{
+			"Paired":           dbus.MakeVariant(false),
+			"RSSI":             dbus.MakeVariant(int16(-60)),
+			"ManufacturerData": dbus.MakeVariant(map[uint16]dbus.Variant{0x4c: dbus.MakeVariant([]byte{2, 0x15})}),
+		})
+	adapters := AdapterList{{Path: "/org/bluez/hci0", Powered: true}, {Path: "/org/bluez/hci1"}}
+
+	t.Run("TestText", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, NewFormatter(&buf, FormatText).Write(&info))
+		assert.Equal(t, "Path: /org/bluez/hci0/dev_D1_40_FD_DE_C6_1C\n"+
+			"ManufacturerData: {76: 0215}\nPaired: false\nRSSI: -60\n", buf.String())
+	})
+	t.Run("TestJSON", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, NewFormatter(&buf, FormatJSON).Write(&info))
+		var decoded map[string]interface{}
+		assert.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+		props := decoded["properties"].(map[string]interface{})
+		assert.Equal(t, false, props["Paired"])
+		assert.Equal(t, -60.0, props["RSSI"])
+		assert.Equal(t, map[string]interface{}{"76": "0215"}, props["ManufacturerData"])
+	})
+	t.Run("TestJSONL", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, NewFormatter(&buf, FormatJSONL).Write(adapters))
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if assert.Len(t, lines, 2, "Expected a line for each adapter") {
+			var adapter AdapterInfo
+			assert.NoError(t, json.Unmarshal([]byte(lines[1]), &adapter))
+			assert.Equal(t, dbus.ObjectPath("/org/bluez/hci1"), adapter.Path)
+		}
+	})
+	t.Run("TestTable", func(t *testing.T) {
+		var buf bytes.Buffer
+		formatter := NewFormatter(&buf, FormatTable)
+		assert.NoError(t, formatter.Write(adapters))
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if assert.Len(t, lines, 3) {
+			assert.Equal(t, []string{"PATH", "ADDRESS", "ALIAS", "POWERED", "DISCOVERABLE",
+				"PAIRABLE"}, strings.Fields(lines[0]))
+			assert.Equal(t, []string{"/org/bluez/hci0", "true", "false", "false"},
+				strings.Fields(lines[1]))
+		}
+
+		// Events only have the header once
+		buf.Reset()
+		now := time.Now()
+		assert.NoError(t, formatter.WriteEvent(&NotificationEvent{Time: now, Value: []byte{1}}))
+		assert.NoError(t, formatter.WriteEvent(&NotificationEvent{Time: now, Value: []byte{2}}))
+		assert.NoError(t, formatter.Write(nil), "Nil results are skipped")
+		lines = strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if assert.Len(t, lines, 3) {
+			assert.Equal(t, []string{"TIME", "PATH", "VALUE"}, strings.Fields(lines[0]))
+		}
+	})
+}
+
+func TestBeaconResults(t *testing.T) {
+	found := beacon.Beacon{
+		Path:         "/org/bluez/hci0/dev_F4_B8_5E_1A_30_6C",
+		Address:      "F4:B8:5E:1A:30:6C",
+		Frames:       []beacon.Frame{&beacon.IBeacon{UUID: "f7826da6-4fa2-4e98-8024-bc5b71e0893e", MeasuredPower: -59}},
+		RSSI:         -70,
+		FilteredRSSI: -69.5,
+		Distance:     3.5,
+		LastSeen:     time.Now(),
+	}
+	now := time.Now()
+
+	var buf bytes.Buffer
+	formatter := NewFormatter(&buf, FormatJSONL)
+	assert.NoError(t, formatter.WriteEvent(NewBeaconEvent(&beacon.ScanEvent{
+		Kind: beacon.BeaconEntered, Beacon: found, Time: now})))
+	assert.NoError(t, formatter.WriteEvent(NewBeaconEvent(&beacon.ScanEvent{
+		Kind: beacon.NearestChanged, Time: now})))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if assert.Len(t, lines, 2, "Expected a line for each event") {
+		var event BeaconEvent
+		assert.NoError(t, json.Unmarshal([]byte(lines[0]), &event))
+		assert.Equal(t, "Entered", event.Event)
+		if assert.NotNil(t, event.Beacon) {
+			assert.Equal(t, "F4:B8:5E:1A:30:6C", event.Beacon.Address)
+			assert.Equal(t, []string{found.Frames[0].String()}, event.Beacon.Frames)
+		}
+		assert.NotContains(t, lines[1], "beacon", "There's no nearest beacon")
+	}
+
+	buf.Reset()
+	assert.NoError(t, NewFormatter(&buf, FormatText).Write(NewBeaconList([]beacon.Beacon{found})))
+	lines = strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if assert.Len(t, lines, 2) {
+		assert.Equal(t, []string{"F4:B8:5E:1A:30:6C", "-70", "-69.5", "3.50m"},
+			strings.Fields(lines[1])[:4])
+	}
+}
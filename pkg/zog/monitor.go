@@ -0,0 +1,185 @@
+package zog
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path"
+	"syscall"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/shigmas/bluezog/pkg/capture"
+	"github.com/shigmas/bluezog/pkg/logger"
+	"github.com/shigmas/bluezog/pkg/protocol"
+)
+
+// monitorFilter selects the signals for Monitor. Like protocol.EventFilter, each field that
+// is empty matches everything, otherwise one of the values must match.
+type monitorFilter struct {
+	// paths are globs. A glob also matches the objects under the paths it matches.
+	paths      []string
+	interfaces []string
+	properties []string
+}
+
+// newMonitorFilter parses the key value pairs of the monitor command. It also returns the
+// capture file, if there is one.
+func newMonitorFilter(args []interface{}) (*monitorFilter, string, error) {
+	if len(args)%2 != 0 {
+		return nil, "", fmt.Errorf("monitor arguments are key value pairs")
+	}
+	filter := &monitorFilter{}
+	captureFile := ""
+	for i := 0; i < len(args); i += 2 {
+		key, err := stringArg(args[i])
+		if err != nil {
+			return nil, "", err
+		}
+		val, err := stringArg(args[i+1])
+		if err != nil {
+			return nil, "", err
+		}
+		switch key {
+		case "path":
+			if _, err := path.Match(val, ""); err != nil {
+				return nil, "", fmt.Errorf("Invalid path glob %s: %s", val, err)
+			}
+			filter.paths = append(filter.paths, val)
+		case "interface":
+			filter.interfaces = append(filter.interfaces, val)
+		case "property":
+			filter.properties = append(filter.properties, val)
+		case "capture":
+			captureFile = val
+		default:
+			return nil, "", fmt.Errorf("Unknown monitor filter %s", key)
+		}
+	}
+	return filter, captureFile, nil
+}
+
+// matchPath is true if a glob matches the path, or one of its parents
+func (f *monitorFilter) matchPath(objPath dbus.ObjectPath) bool {
+	if len(f.paths) == 0 {
+		return true
+	}
+	for p := string(objPath); p != "/" && p != "."; p = path.Dir(p) {
+		for _, glob := range f.paths {
+			if ok, _ := path.Match(glob, p); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// match removes the interfaces and the properties that the filter doesn't want. It returns
+// false if there's nothing left.
+func (f *monitorFilter) match(monitored *protocol.MonitoredSignal) bool {
+	if !f.matchPath(monitored.Path) {
+		return false
+	}
+	if len(f.interfaces) > 0 {
+		monitored.Interfaces = filterStrings(monitored.Interfaces, f.interfaces)
+		if len(monitored.Interfaces) == 0 {
+			return false
+		}
+	}
+	if len(f.properties) == 0 {
+		return true
+	}
+
+	found := false
+	props := make(map[string]map[string]dbus.Variant, len(monitored.Interfaces))
+	for _, iface := range monitored.Interfaces {
+		wanted := make(map[string]dbus.Variant)
+		for name, value := range monitored.Properties[iface] {
+			if containsString(f.properties, name) {
+				wanted[name] = value
+				found = true
+			}
+		}
+		props[iface] = wanted
+	}
+	monitored.Properties = props
+	monitored.Invalidated = filterStrings(monitored.Invalidated, f.properties)
+	return found || len(monitored.Invalidated) > 0
+}
+
+// filterStrings returns the values that are wanted
+func filterStrings(values []string, wanted []string) []string {
+	var filtered []string
+	for _, v := range values {
+		if containsString(wanted, v) {
+			filtered = append(filtered, v)
+		}
+	}
+	return filtered
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Monitor streams the bluez signals, like dbus-monitor, until Ctrl-C or SIGTERM. The
+// arguments are key value pairs, and the keys can be repeated:
+// monitor [path <glob>] [interface <name>] [property <name>] [capture <file>]
+// capture tees the signals that pass the filter to a session log, like --record.
+func (b *BusImpl) Monitor(args ...interface{}) (Result, error) {
+	filter, captureFile, err := newMonitorFilter(args)
+	if err != nil {
+		return nil, err
+	}
+	var signalLog *capture.SignalLog
+	if captureFile != "" {
+		f, err := os.Create(captureFile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		signalLog = capture.NewSignalLog(f)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals, err := b.bluez.Monitor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	interruptCh := make(chan os.Signal, 1)
+	signal.Notify(interruptCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interruptCh)
+
+	logger.Info("Monitoring bluez. Ctrl-C to stop")
+	for {
+		select {
+		case monitored, ok := <-signals:
+			if !ok {
+				return nil, nil
+			}
+			if monitored.Dropped > 0 {
+				logger.Warn("%d signals were dropped. The output is too slow", monitored.Dropped)
+			}
+			if !filter.match(&monitored) {
+				continue
+			}
+			if signalLog != nil {
+				signalLog.Record(monitored.Signal)
+			}
+			if err := b.out.WriteEvent(newMonitorEvent(&monitored)); err != nil {
+				logger.Error("Unable to write signal: %s", err)
+			}
+		case <-interruptCh:
+			if signalLog != nil {
+				return nil, signalLog.Err()
+			}
+			return nil, nil
+		}
+	}
+}
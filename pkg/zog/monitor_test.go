@@ -0,0 +1,108 @@
+package zog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/shigmas/bluezog/pkg/protocol"
+	"github.com/stretchr/testify/assert"
+)
+
+const monitorDevicePath = dbus.ObjectPath("/org/bluez/hci0/dev_D1_40_FD_DE_C6_1C")
+
+func rssiChanged() protocol.MonitoredSignal {
+	return protocol.MonitoredSignal{
+		Name:       "PropertiesChanged",
+		Path:       monitorDevicePath,
+		Interfaces: []string{protocol.BluezInterface.Device},
+		Properties: map[string]map[string]dbus.Variant{
+			protocol.BluezInterface.Device: {
+				"RSSI":             dbus.MakeVariant(int16(-60)),
+				"ManufacturerData": dbus.MakeVariant(map[uint16]dbus.Variant{76: dbus.MakeVariant([]byte{2, 21})}),
+			},
+		},
+		Invalidated: []string{"TxPower"},
+		Time:        time.Date(2020, 6, 1, 12, 30, 15, 0, time.Local),
+	}
+}
+
+func TestMonitorFilter(t *testing.T) {
+	match := func(args ...interface{}) (*protocol.MonitoredSignal, bool) {
+		filter, _, err := newMonitorFilter(args)
+		assert.NoError(t, err, "Unexpected error parsing %v", args)
+		monitored := rssiChanged()
+		return &monitored, filter.match(&monitored)
+	}
+
+	_, ok := match()
+	assert.True(t, ok, "Empty filter should match everything")
+	_, ok = match("path", "/org/bluez/hci0/dev_*")
+	assert.True(t, ok)
+	_, ok = match("path", "/org/bluez/hci0")
+	assert.True(t, ok, "The glob should match the objects under it")
+	_, ok = match("path", "/org/bluez/hci1/*")
+	assert.False(t, ok)
+	_, ok = match("interface", protocol.BluezInterface.Adapter)
+	assert.False(t, ok)
+	_, ok = match("property", "Connected")
+	assert.False(t, ok)
+
+	monitored, ok := match("interface", protocol.BluezInterface.Device, "property", "RSSI",
+		"property", "Alias")
+	if assert.True(t, ok) {
+		assert.Len(t, monitored.Properties[protocol.BluezInterface.Device], 1,
+			"Only the properties in the filter")
+		assert.Empty(t, monitored.Invalidated)
+	}
+	monitored, ok = match("property", "TxPower")
+	if assert.True(t, ok, "Invalidated properties should match") {
+		assert.Empty(t, monitored.Properties[protocol.BluezInterface.Device])
+	}
+
+	filter, captureFile, err := newMonitorFilter([]interface{}{"capture", "session.log"})
+	assert.NoError(t, err)
+	assert.Equal(t, "session.log", captureFile)
+	assert.Empty(t, filter.paths)
+	_, _, err = newMonitorFilter([]interface{}{"path", "[", "interface"})
+	assert.Error(t, err, "Expected error for the missing value")
+	_, _, err = newMonitorFilter([]interface{}{"path", "["})
+	assert.Error(t, err, "Expected error for the bad glob")
+	_, _, err = newMonitorFilter([]interface{}{"sender", ":1.5"})
+	assert.Error(t, err, "Expected error for the unknown filter")
+}
+
+func TestMonitorEvent(t *testing.T) {
+	monitored := rssiChanged()
+	event := newMonitorEvent(&monitored)
+
+	var buf bytes.Buffer
+	formatter := NewFormatter(&buf, FormatText)
+	assert.NoError(t, formatter.WriteEvent(event))
+	assert.Equal(t,
+		"12:30:15.000 [CHG] /org/bluez/hci0/dev_D1_40_FD_DE_C6_1C org.bluez.Device1 ManufacturerData: {76: 0215}\n"+
+			"12:30:15.000 [CHG] /org/bluez/hci0/dev_D1_40_FD_DE_C6_1C org.bluez.Device1 RSSI: -60\n"+
+			"12:30:15.000 [CHG] /org/bluez/hci0/dev_D1_40_FD_DE_C6_1C org.bluez.Device1 TxPower invalidated\n",
+		buf.String())
+
+	buf.Reset()
+	formatter.SetColor(true)
+	assert.NoError(t, formatter.WriteEvent(&MonitorEvent{
+		Time:       monitored.Time,
+		Signal:     "InterfacesRemoved",
+		Path:       monitorDevicePath,
+		Interfaces: []string{protocol.BluezInterface.Device},
+	}))
+	assert.Equal(t, "12:30:15.000 \033[31m[DEL]\033[0m /org/bluez/hci0/dev_D1_40_FD_DE_C6_1C org.bluez.Device1\n",
+		buf.String())
+
+	buf.Reset()
+	assert.NoError(t, NewFormatter(&buf, FormatTable).WriteEvent(event))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if assert.Len(t, lines, 4, "A row for each property") {
+		assert.Equal(t, []string{"12:30:15.000", "[CHG]", string(monitorDevicePath),
+			"org.bluez.Device1", "TxPower", "-"}, strings.Fields(lines[3]))
+	}
+}
@@ -0,0 +1,934 @@
+package zog
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/shigmas/bluezog/pkg/base"
+	"github.com/shigmas/bluezog/pkg/beacon"
+	"github.com/shigmas/bluezog/pkg/protocol"
+)
+
+// These are the Results that the commands return.
+type (
+	// Message is a result that is only text
+	Message struct {
+		Message string `json:"message"`
+	}
+
+	// ObjectInfo has the properties of an object. The values are converted, so bytes are hex
+	// in JSON, and variants are their values.
+	ObjectInfo struct {
+		Path       dbus.ObjectPath        `json:"path"`
+		Interfaces []string               `json:"interfaces,omitempty"`
+		Properties map[string]interface{} `json:"properties,omitempty"`
+	}
+
+	// ObjectList is a list of objects
+	ObjectList []ObjectInfo
+
+	// AdapterInfo has the settings of an adapter
+	AdapterInfo struct {
+		Path                dbus.ObjectPath `json:"path"`
+		Address             string          `json:"address"`
+		Alias               string          `json:"alias"`
+		Powered             bool            `json:"powered"`
+		Discoverable        bool            `json:"discoverable"`
+		DiscoverableTimeout uint32          `json:"discoverableTimeout"`
+		Pairable            bool            `json:"pairable"`
+		PairableTimeout     uint32          `json:"pairableTimeout"`
+	}
+
+	// AdapterList is a list of adapters
+	AdapterList []AdapterInfo
+
+	// DeviceInfo is the snapshot of a device, with the beacons decoded from its
+	// advertisement
+	DeviceInfo struct {
+		protocol.DeviceSnapshot
+		Beacons []string `json:"beacons,omitempty"`
+	}
+
+	// DeviceEvent is written for each device found or removed during discovery
+	DeviceEvent struct {
+		Time time.Time `json:"time"`
+		// Event is added, removed, or interfaces removed
+		Event      string          `json:"event"`
+		Path       dbus.ObjectPath `json:"path"`
+		Interfaces []string        `json:"interfaces,omitempty"`
+		// Device is the device that was added. It's nil if it isn't a device.
+		Device *DeviceInfo `json:"device,omitempty"`
+	}
+
+	// DescriptorInfo is a GATT descriptor
+	DescriptorInfo struct {
+		Path   dbus.ObjectPath `json:"path"`
+		Handle uint16          `json:"handle"`
+		UUID   string          `json:"uuid"`
+	}
+
+	// CharacteristicInfo is a GATT characteristic, with its descriptors
+	CharacteristicInfo struct {
+		Path        dbus.ObjectPath  `json:"path"`
+		Handle      uint16           `json:"handle"`
+		UUID        string           `json:"uuid"`
+		Flags       []string         `json:"flags"`
+		Descriptors []DescriptorInfo `json:"descriptors,omitempty"`
+	}
+
+	// IncludeInfo is a service included by another service
+	IncludeInfo struct {
+		Path   dbus.ObjectPath `json:"path"`
+		Handle uint16          `json:"handle"`
+		UUID   string          `json:"uuid"`
+	}
+
+	// ServiceInfo is a GATT service, with its characteristics
+	ServiceInfo struct {
+		Path            dbus.ObjectPath      `json:"path"`
+		Handle          uint16               `json:"handle"`
+		UUID            string               `json:"uuid"`
+		Primary         bool                 `json:"primary"`
+		Includes        []IncludeInfo        `json:"includes,omitempty"`
+		Characteristics []CharacteristicInfo `json:"characteristics,omitempty"`
+	}
+
+	// GattTree is the GATT hierarchy of a device
+	GattTree struct {
+		Path     dbus.ObjectPath `json:"path"`
+		Address  string          `json:"address"`
+		Name     string          `json:"name,omitempty"`
+		Services []ServiceInfo   `json:"services"`
+	}
+
+	// ValueInfo is the value read from a characteristic or descriptor
+	ValueInfo struct {
+		Path  dbus.ObjectPath   `json:"path"`
+		Value protocol.HexBytes `json:"value"`
+	}
+
+	// NotificationEvent is written for each notification from a characteristic
+	NotificationEvent struct {
+		Time  time.Time         `json:"time"`
+		Path  dbus.ObjectPath   `json:"path"`
+		Value protocol.HexBytes `json:"value"`
+	}
+
+	// NodeInfo is the introspection of an object
+	NodeInfo struct {
+		base.Node
+	}
+
+	// DiscoveryFilters are the filters the adapter supports
+	DiscoveryFilters []string
+
+	// UsageLine is one way to call a command
+	UsageLine struct {
+		Usage   string `json:"usage"`
+		Summary string `json:"summary,omitempty"`
+	}
+
+	// CommandHelp is the help for a shell command
+	CommandHelp struct {
+		Name    string      `json:"name"`
+		Summary string      `json:"summary"`
+		Usage   []UsageLine `json:"usage,omitempty"`
+	}
+
+	// HelpList is the help for all of the commands
+	HelpList []CommandHelp
+
+	// MonitorEvent is a signal from the monitor. Properties are the added or changed
+	// properties, by interface.
+	MonitorEvent struct {
+		Time        time.Time                         `json:"time"`
+		Signal      string                            `json:"signal"`
+		Path        dbus.ObjectPath                   `json:"path"`
+		Interfaces  []string                          `json:"interfaces,omitempty"`
+		Properties  map[string]map[string]interface{} `json:"properties,omitempty"`
+		Invalidated []string                          `json:"invalidated,omitempty"`
+	}
+
+	// BeaconInfo is a beacon that the scanner is tracking. Distance is 0 if it's unknown.
+	BeaconInfo struct {
+		Path         dbus.ObjectPath `json:"path"`
+		Address      string          `json:"address"`
+		Name         string          `json:"name,omitempty"`
+		RSSI         int16           `json:"rssi"`
+		FilteredRSSI float64         `json:"filteredRSSI"`
+		Distance     float64         `json:"distance,omitempty"`
+		LastSeen     time.Time       `json:"lastSeen"`
+		Frames       []string        `json:"frames,omitempty"`
+	}
+
+	// BeaconList is the beacons, nearest first
+	BeaconList []BeaconInfo
+
+	// BeaconEvent is written when a beacon enters, exits, or becomes the nearest. Beacon is
+	// nil when there's no nearest beacon.
+	BeaconEvent struct {
+		Time   time.Time   `json:"time"`
+		Event  string      `json:"event"`
+		Beacon *BeaconInfo `json:"beacon,omitempty"`
+	}
+)
+
+const timeFormat = "15:04:05.000"
+
+// The terminal colors for the monitor, like bluetoothctl
+const (
+	colorReset  = "\033[0m"
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+)
+
+// jsonValue converts the dbus value, so encoding/json writes something readable
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case dbus.Variant:
+		return jsonValue(v.Value())
+	case []byte:
+		return protocol.HexBytes(v)
+	}
+	// Dicts, like ManufacturerData, are maps of variants. Not all of the key types work
+	// in JSON.
+	if v := reflect.ValueOf(value); v.Kind() == reflect.Map {
+		converted := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			converted[fmt.Sprint(iter.Key().Interface())] = jsonValue(iter.Value().Interface())
+		}
+		return converted
+	}
+	return value
+}
+
+// textValue formats the converted value for the text and table formats
+func textValue(value interface{}) string {
+	switch v := value.(type) {
+	case []string:
+		return strings.Join(v, ", ")
+	case map[string]interface{}:
+		keys := sortedKeys(v)
+		entries := make([]string, len(keys))
+		for i, k := range keys {
+			entries[i] = fmt.Sprintf("%s: %s", k, textValue(v[k]))
+		}
+		return "{" + strings.Join(entries, ", ") + "}"
+	}
+	return fmt.Sprint(value)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Text writes the message
+func (m *Message) Text(w io.Writer) {
+	fmt.Fprintln(w, m.Message)
+}
+
+// Table is the message in one column
+func (m *Message) Table() ([]string, [][]string) {
+	return []string{"MESSAGE"}, [][]string{{m.Message}}
+}
+
+func newObjectInfo(path dbus.ObjectPath, interfaces []string,
+	props map[string]dbus.Variant) ObjectInfo {
+	info := ObjectInfo{Path: path, Interfaces: interfaces}
+	if len(props) > 0 {
+		info.Properties = make(map[string]interface{}, len(props))
+		for k, v := range props {
+			info.Properties[k] = jsonValue(v)
+		}
+	}
+	return info
+}
+
+// Text writes the path, and the properties sorted by name
+func (o *ObjectInfo) Text(w io.Writer) {
+	fmt.Fprintf(w, "Path: %s\n", o.Path)
+	if len(o.Interfaces) > 0 {
+		fmt.Fprintf(w, "Interfaces: %s\n", strings.Join(o.Interfaces, ", "))
+	}
+	for _, k := range sortedKeys(o.Properties) {
+		fmt.Fprintf(w, "%s: %s\n", k, textValue(o.Properties[k]))
+	}
+}
+
+// Table has a row for each property
+func (o *ObjectInfo) Table() ([]string, [][]string) {
+	keys := sortedKeys(o.Properties)
+	rows := make([][]string, len(keys))
+	for i, k := range keys {
+		rows[i] = []string{k, textValue(o.Properties[k])}
+	}
+	return []string{"PROPERTY", "VALUE"}, rows
+}
+
+// Text writes each object
+func (l ObjectList) Text(w io.Writer) {
+	for i := range l {
+		l[i].Text(w)
+	}
+}
+
+// Table has a row for each object, with a column for each property
+func (l ObjectList) Table() ([]string, [][]string) {
+	names := make(map[string]interface{})
+	for _, o := range l {
+		for k := range o.Properties {
+			names[k] = nil
+		}
+	}
+	keys := sortedKeys(names)
+	header := append([]string{"PATH"}, keys...)
+	rows := make([][]string, len(l))
+	for i, o := range l {
+		row := []string{string(o.Path)}
+		for _, k := range keys {
+			value, ok := o.Properties[k]
+			if !ok {
+				row = append(row, "-")
+				continue
+			}
+			row = append(row, textValue(value))
+		}
+		rows[i] = row
+	}
+	return header, rows
+}
+
+func newAdapterInfo(adapter *protocol.Adapter) AdapterInfo {
+	info := AdapterInfo{Path: adapter.GetPath()}
+	info.Address, _ = adapter.Property(protocol.BluezAdapter.AddressProp).(string)
+	info.Alias, _ = adapter.Alias()
+	info.Powered, _ = adapter.Powered()
+	info.Discoverable, _ = adapter.Discoverable()
+	info.DiscoverableTimeout, _ = adapter.DiscoverableTimeout()
+	info.Pairable, _ = adapter.Pairable()
+	info.PairableTimeout, _ = adapter.PairableTimeout()
+	return info
+}
+
+func (a *AdapterInfo) row() []string {
+	return []string{string(a.Path), a.Address, a.Alias, strconv.FormatBool(a.Powered),
+		strconv.FormatBool(a.Discoverable), strconv.FormatBool(a.Pairable)}
+}
+
+var adapterHeader = []string{"PATH", "ADDRESS", "ALIAS", "POWERED", "DISCOVERABLE", "PAIRABLE"}
+
+// Text writes the settings
+func (a *AdapterInfo) Text(w io.Writer) {
+	fmt.Fprintf(w, "Path: %s\n", a.Path)
+	fmt.Fprintf(w, "Address: %s\n", a.Address)
+	fmt.Fprintf(w, "Alias: %s\n", a.Alias)
+	fmt.Fprintf(w, "Powered: %t\n", a.Powered)
+	fmt.Fprintf(w, "Discoverable: %t\n", a.Discoverable)
+	fmt.Fprintf(w, "DiscoverableTimeout: %d\n", a.DiscoverableTimeout)
+	fmt.Fprintf(w, "Pairable: %t\n", a.Pairable)
+	fmt.Fprintf(w, "PairableTimeout: %d\n", a.PairableTimeout)
+}
+
+// Table is the adapter in one row
+func (a *AdapterInfo) Table() ([]string, [][]string) {
+	return adapterHeader, [][]string{a.row()}
+}
+
+// Text writes each adapter, separated by an empty line
+func (l AdapterList) Text(w io.Writer) {
+	for i := range l {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		l[i].Text(w)
+	}
+}
+
+// Table has a row for each adapter
+func (l AdapterList) Table() ([]string, [][]string) {
+	rows := make([][]string, len(l))
+	for i := range l {
+		rows[i] = l[i].row()
+	}
+	return adapterHeader, rows
+}
+
+func newDeviceInfo(device *protocol.Device) *DeviceInfo {
+	info := &DeviceInfo{DeviceSnapshot: device.Snapshot()}
+	for _, frame := range beacon.DecodeDevice(device) {
+		info.Beacons = append(info.Beacons, frame.String())
+	}
+	return info
+}
+
+// fields are the name and value of the properties that the device has
+func (d *DeviceInfo) fields() [][2]string {
+	fields := [][2]string{{"Path", string(d.Path)}, {"Address", d.Address}}
+	add := func(name, value string) {
+		if value != "" {
+			fields = append(fields, [2]string{name, value})
+		}
+	}
+	add("AddressType", d.AddressType)
+	add("Name", d.Name)
+	add("Alias", d.Alias)
+	add("Icon", d.Icon)
+	if d.Class != nil {
+		add("Class", fmt.Sprintf("0x%06x", *d.Class))
+	}
+	if d.Appearance != nil {
+		add("Appearance", fmt.Sprintf("0x%04x", *d.Appearance))
+	}
+	add("UUIDs", strings.Join(d.UUIDs, ", "))
+	add("Paired", strconv.FormatBool(d.Paired))
+	add("Trusted", strconv.FormatBool(d.Trusted))
+	add("Blocked", strconv.FormatBool(d.Blocked))
+	add("Connected", strconv.FormatBool(d.Connected))
+	add("ServicesResolved", strconv.FormatBool(d.ServicesResolved))
+	if d.RSSI != nil {
+		add("RSSI", strconv.Itoa(int(*d.RSSI)))
+	}
+	if d.TxPower != nil {
+		add("TxPower", strconv.Itoa(int(*d.TxPower)))
+	}
+	add("ManufacturerData", d.manufacturerData())
+	serviceData := make([]string, 0, len(d.ServiceData))
+	for uuid, data := range d.ServiceData {
+		serviceData = append(serviceData, fmt.Sprintf("%s: % x", uuid, []byte(data)))
+	}
+	sort.Strings(serviceData)
+	add("ServiceData", strings.Join(serviceData, ", "))
+	add("Beacons", strings.Join(d.Beacons, "; "))
+	others := make([]string, 0, len(d.Other))
+	for name := range d.Other {
+		others = append(others, name)
+	}
+	sort.Strings(others)
+	for _, name := range others {
+		add(name, d.Other[name])
+	}
+	return fields
+}
+
+func (d *DeviceInfo) manufacturerData() string {
+	ids := make([]int, 0, len(d.ManufacturerData))
+	for id := range d.ManufacturerData {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+	entries := make([]string, len(ids))
+	for i, id := range ids {
+		entries[i] = fmt.Sprintf("%04x: % x", id, []byte(d.ManufacturerData[uint16(id)]))
+	}
+	return strings.Join(entries, ", ")
+}
+
+func (d *DeviceInfo) displayName() string {
+	if d.Name != "" {
+		return d.Name
+	}
+	return d.Alias
+}
+
+func (d *DeviceInfo) rssi() string {
+	if d.RSSI == nil {
+		return "-"
+	}
+	return strconv.Itoa(int(*d.RSSI))
+}
+
+// Text writes the properties that the device has
+func (d *DeviceInfo) Text(w io.Writer) {
+	for _, field := range d.fields() {
+		fmt.Fprintf(w, "%s: %s\n", field[0], field[1])
+	}
+}
+
+// Table has a row for each property
+func (d *DeviceInfo) Table() ([]string, [][]string) {
+	fields := d.fields()
+	rows := make([][]string, len(fields))
+	for i, field := range fields {
+		rows[i] = []string{field[0], field[1]}
+	}
+	return []string{"PROPERTY", "VALUE"}, rows
+}
+
+func newDeviceEvent(data protocol.ObjectChangedData, device *protocol.Device) *DeviceEvent {
+	event := &DeviceEvent{
+		Time:       time.Now(),
+		Event:      data.Type.String(),
+		Path:       data.Path,
+		Interfaces: data.Interfaces,
+	}
+	if device != nil {
+		event.Device = newDeviceInfo(device)
+	}
+	return event
+}
+
+// Text writes the event on one line
+func (e *DeviceEvent) Text(w io.Writer) {
+	line := fmt.Sprintf("%s %s %s", e.Time.Format(timeFormat), e.Event, e.Path)
+	if len(e.Interfaces) > 0 {
+		line += " " + strings.Join(e.Interfaces, ", ")
+	}
+	if d := e.Device; d != nil {
+		line += fmt.Sprintf(" %s %q RSSI: %s", d.Address, d.displayName(), d.rssi())
+		if mfgData := d.manufacturerData(); mfgData != "" {
+			line += " ManufacturerData: " + mfgData
+		}
+		for _, b := range d.Beacons {
+			line += fmt.Sprintf(" [%s]", b)
+		}
+	}
+	fmt.Fprintln(w, line)
+}
+
+// Table is the event in one row
+func (e *DeviceEvent) Table() ([]string, [][]string) {
+	row := []string{e.Time.Format(timeFormat), e.Event, string(e.Path), "-", "-", "-", "-"}
+	if d := e.Device; d != nil {
+		row[3], row[4], row[5] = d.Address, d.displayName(), d.rssi()
+		if len(d.Beacons) > 0 {
+			row[6] = strings.Join(d.Beacons, "; ")
+		}
+	}
+	return []string{"TIME", "EVENT", "PATH", "ADDRESS", "NAME", "RSSI", "BEACONS"},
+		[][]string{row}
+}
+
+func newServiceInfo(service *protocol.GattService) ServiceInfo {
+	info := ServiceInfo{
+		Path:    service.GetPath(),
+		Handle:  service.Handle(),
+		UUID:    service.UUID(),
+		Primary: service.Primary(),
+	}
+	for _, included := range service.IncludedServices() {
+		info.Includes = append(info.Includes, IncludeInfo{
+			Path:   included.GetPath(),
+			Handle: included.Handle(),
+			UUID:   included.UUID(),
+		})
+	}
+	for _, characteristic := range service.Characteristics() {
+		charInfo := CharacteristicInfo{
+			Path:   characteristic.GetPath(),
+			Handle: characteristic.Handle(),
+			UUID:   characteristic.UUID(),
+			Flags:  characteristic.Flags(),
+		}
+		for _, descriptor := range characteristic.Descriptors() {
+			charInfo.Descriptors = append(charInfo.Descriptors, DescriptorInfo{
+				Path:   descriptor.GetPath(),
+				Handle: descriptor.Handle(),
+				UUID:   descriptor.UUID(),
+			})
+		}
+		info.Characteristics = append(info.Characteristics, charInfo)
+	}
+	return info
+}
+
+func (s *ServiceInfo) text(w io.Writer, indent string) {
+	kind := "secondary"
+	if s.Primary {
+		kind = "primary"
+	}
+	fmt.Fprintf(w, "%s%s service handle = 0x%04x, uuid = %s\n", indent, kind, s.Handle, s.UUID)
+	for _, included := range s.Includes {
+		fmt.Fprintf(w, "%s  include handle = 0x%04x, uuid = %s\n", indent, included.Handle,
+			included.UUID)
+	}
+	for _, c := range s.Characteristics {
+		fmt.Fprintf(w, "%s  characteristic handle = 0x%04x, uuid = %s, flags = %s\n", indent,
+			c.Handle, c.UUID, strings.Join(c.Flags, ","))
+		for _, d := range c.Descriptors {
+			fmt.Fprintf(w, "%s    descriptor handle = 0x%04x, uuid = %s\n", indent,
+				d.Handle, d.UUID)
+		}
+	}
+}
+
+func (s *ServiceInfo) rows() [][]string {
+	handle := func(h uint16) string { return fmt.Sprintf("0x%04x", h) }
+	kind := "secondary"
+	if s.Primary {
+		kind = "primary"
+	}
+	rows := [][]string{{kind, handle(s.Handle), s.UUID, "-", string(s.Path)}}
+	for _, included := range s.Includes {
+		rows = append(rows, []string{"include", handle(included.Handle), included.UUID, "-",
+			string(included.Path)})
+	}
+	for _, c := range s.Characteristics {
+		rows = append(rows, []string{"characteristic", handle(c.Handle), c.UUID,
+			strings.Join(c.Flags, ","), string(c.Path)})
+		for _, d := range c.Descriptors {
+			rows = append(rows, []string{"descriptor", handle(d.Handle), d.UUID, "-",
+				string(d.Path)})
+		}
+	}
+	return rows
+}
+
+var gattHeader = []string{"TYPE", "HANDLE", "UUID", "FLAGS", "PATH"}
+
+// Text writes the service like gatttool's primary and characteristics listings
+func (s *ServiceInfo) Text(w io.Writer) {
+	s.text(w, "")
+}
+
+// Table has a row for the service, and each characteristic and descriptor
+func (s *ServiceInfo) Table() ([]string, [][]string) {
+	return gattHeader, s.rows()
+}
+
+func newGattTree(device *protocol.Device) *GattTree {
+	tree := &GattTree{
+		Path:     device.GetPath(),
+		Address:  device.Address(),
+		Services: []ServiceInfo{},
+	}
+	tree.Name, _ = device.Name()
+	for _, service := range device.Services() {
+		tree.Services = append(tree.Services, newServiceInfo(service))
+	}
+	return tree
+}
+
+// Text writes the hierarchy like gatttool's primary and characteristics listings
+func (t *GattTree) Text(w io.Writer) {
+	fmt.Fprintf(w, "%s %s %s\n", t.Path, t.Address, t.Name)
+	for i := range t.Services {
+		t.Services[i].text(w, "  ")
+	}
+}
+
+// Table has a row for each service, characteristic and descriptor
+func (t *GattTree) Table() ([]string, [][]string) {
+	var rows [][]string
+	for i := range t.Services {
+		rows = append(rows, t.Services[i].rows()...)
+	}
+	return gattHeader, rows
+}
+
+// Text writes the value in hex
+func (v *ValueInfo) Text(w io.Writer) {
+	fmt.Fprintf(w, "% x\n", []byte(v.Value))
+}
+
+// Table is the value in one row
+func (v *ValueInfo) Table() ([]string, [][]string) {
+	return []string{"PATH", "VALUE"}, [][]string{{string(v.Path), v.Value.String()}}
+}
+
+// Text writes the time and the value in hex
+func (n *NotificationEvent) Text(w io.Writer) {
+	fmt.Fprintf(w, "%s % x\n", n.Time.Format(timeFormat), []byte(n.Value))
+}
+
+// Table is the notification in one row
+func (n *NotificationEvent) Table() ([]string, [][]string) {
+	return []string{"TIME", "PATH", "VALUE"},
+		[][]string{{n.Time.Format(timeFormat), string(n.Path), n.Value.String()}}
+}
+
+// Text writes the nodes, and the methods and signals of the interfaces
+func (n *NodeInfo) Text(w io.Writer) {
+	fmt.Fprintf(w, "%s\n", n.Name)
+	fmt.Fprintf(w, "Sub Nodes:\n")
+	for _, sub := range n.Nodes {
+		fmt.Fprintf(w, "\t%s\n", sub.Name)
+	}
+	fmt.Fprintf(w, "Interfaces:\n")
+	for _, iface := range n.Interfaces {
+		fmt.Fprintf(w, "\t%s\n", iface.Name)
+		for _, m := range iface.Methods {
+			fmt.Fprintf(w, "\t\tMethod: %s(%s)\n", m.Name, argsString(m.Args))
+		}
+		for _, s := range iface.Signals {
+			fmt.Fprintf(w, "\t\tSignal: %s(%s)\n", s.Name, argsString(s.Args))
+		}
+	}
+}
+
+// Table has a row for each node, interface, method and signal
+func (n *NodeInfo) Table() ([]string, [][]string) {
+	var rows [][]string
+	for _, sub := range n.Nodes {
+		rows = append(rows, []string{"node", "-", sub.Name, "-"})
+	}
+	for _, iface := range n.Interfaces {
+		rows = append(rows, []string{"interface", iface.Name, "-", "-"})
+		for _, m := range iface.Methods {
+			rows = append(rows, []string{"method", iface.Name, m.Name, argsString(m.Args)})
+		}
+		for _, s := range iface.Signals {
+			rows = append(rows, []string{"signal", iface.Name, s.Name, argsString(s.Args)})
+		}
+	}
+	return []string{"TYPE", "INTERFACE", "NAME", "ARGS"}, rows
+}
+
+func argsString(args []base.Arg) string {
+	strs := make([]string, len(args))
+	for i, a := range args {
+		strs[i] = strings.TrimSpace(fmt.Sprintf("%s %s %s", a.Direction, a.Name, a.Type))
+	}
+	return strings.Join(strs, ", ")
+}
+
+// Text writes the filters on one line
+func (f DiscoveryFilters) Text(w io.Writer) {
+	fmt.Fprintf(w, "Supported filters: %s\n", strings.Join(f, ", "))
+}
+
+// Table has a row for each filter
+func (f DiscoveryFilters) Table() ([]string, [][]string) {
+	rows := make([][]string, len(f))
+	for i, filter := range f {
+		rows[i] = []string{filter}
+	}
+	return []string{"FILTER"}, rows
+}
+
+// Text writes the summary, and the usage lines with the summaries of the verbs
+func (c *CommandHelp) Text(w io.Writer) {
+	fmt.Fprintf(w, "%s\nUsage:\n", c.Summary)
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, line := range c.Usage {
+		if line.Summary == "" {
+			fmt.Fprintf(tw, "  %s\n", line.Usage)
+			continue
+		}
+		fmt.Fprintf(tw, "  %s\t%s\n", line.Usage, line.Summary)
+	}
+	tw.Flush()
+}
+
+// Table has a row for each usage line
+func (c *CommandHelp) Table() ([]string, [][]string) {
+	rows := make([][]string, len(c.Usage))
+	for i, line := range c.Usage {
+		rows[i] = []string{line.Usage, line.Summary}
+	}
+	return []string{"USAGE", "SUMMARY"}, rows
+}
+
+// Text writes the commands and their summaries
+func (l HelpList) Text(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, c := range l {
+		fmt.Fprintf(tw, "%s\t%s\n", c.Name, c.Summary)
+	}
+	fmt.Fprintf(tw, "\nhelp <command> shows the usage of the command\n")
+	tw.Flush()
+}
+
+// Table has a row for each command
+func (l HelpList) Table() ([]string, [][]string) {
+	rows := make([][]string, len(l))
+	for i, c := range l {
+		rows[i] = []string{c.Name, c.Summary}
+	}
+	return []string{"COMMAND", "SUMMARY"}, rows
+}
+
+func newMonitorEvent(monitored *protocol.MonitoredSignal) *MonitorEvent {
+	event := &MonitorEvent{
+		Time:        monitored.Time,
+		Signal:      monitored.Name,
+		Path:        monitored.Path,
+		Interfaces:  monitored.Interfaces,
+		Invalidated: monitored.Invalidated,
+	}
+	if len(monitored.Properties) > 0 {
+		event.Properties = make(map[string]map[string]interface{}, len(monitored.Properties))
+		for iface, props := range monitored.Properties {
+			converted := make(map[string]interface{}, len(props))
+			for k, v := range props {
+				converted[k] = jsonValue(v)
+			}
+			event.Properties[iface] = converted
+		}
+	}
+	return event
+}
+
+// tag is the label and color of the signal, like bluetoothctl's
+func (e *MonitorEvent) tag() (string, string) {
+	switch e.Signal {
+	case "InterfacesAdded":
+		return "[NEW]", colorGreen
+	case "InterfacesRemoved":
+		return "[DEL]", colorRed
+	}
+	return "[CHG]", colorYellow
+}
+
+func (e *MonitorEvent) text(w io.Writer, color bool) {
+	label, labelColor := e.tag()
+	if color {
+		label = labelColor + label + colorReset
+	}
+	prefix := fmt.Sprintf("%s %s %s", e.Time.Format(timeFormat), label, e.Path)
+	switch e.Signal {
+	case "InterfacesAdded":
+		for _, iface := range e.Interfaces {
+			fmt.Fprintf(w, "%s %s\n", prefix, iface)
+			props := e.Properties[iface]
+			for _, k := range sortedKeys(props) {
+				fmt.Fprintf(w, "    %s: %s\n", k, textValue(props[k]))
+			}
+		}
+	case "InterfacesRemoved":
+		fmt.Fprintf(w, "%s %s\n", prefix, strings.Join(e.Interfaces, ", "))
+	default:
+		for _, iface := range e.Interfaces {
+			props := e.Properties[iface]
+			for _, k := range sortedKeys(props) {
+				fmt.Fprintf(w, "%s %s %s: %s\n", prefix, iface, k, textValue(props[k]))
+			}
+			for _, k := range e.Invalidated {
+				fmt.Fprintf(w, "%s %s %s invalidated\n", prefix, iface, k)
+			}
+		}
+	}
+}
+
+// Text writes a line for each property, with [NEW], [DEL] or [CHG]
+func (e *MonitorEvent) Text(w io.Writer) {
+	e.text(w, false)
+}
+
+// ColorText is Text with the colors of bluetoothctl
+func (e *MonitorEvent) ColorText(w io.Writer) {
+	e.text(w, true)
+}
+
+// Table has a row for each property, or for each interface that was removed
+func (e *MonitorEvent) Table() ([]string, [][]string) {
+	label, _ := e.tag()
+	newRow := func(iface, property, value string) []string {
+		return []string{e.Time.Format(timeFormat), label, string(e.Path), iface, property, value}
+	}
+	var rows [][]string
+	for _, iface := range e.Interfaces {
+		props := e.Properties[iface]
+		if e.Signal == "InterfacesRemoved" || len(props) == 0 && len(e.Invalidated) == 0 {
+			rows = append(rows, newRow(iface, "-", "-"))
+			continue
+		}
+		for _, k := range sortedKeys(props) {
+			rows = append(rows, newRow(iface, k, textValue(props[k])))
+		}
+		if e.Signal == "PropertiesChanged" {
+			for _, k := range e.Invalidated {
+				rows = append(rows, newRow(iface, k, "-"))
+			}
+		}
+	}
+	return []string{"TIME", "SIGNAL", "PATH", "INTERFACE", "PROPERTY", "VALUE"}, rows
+}
+
+// NewBeaconList converts the scanner's beacons
+func NewBeaconList(beacons []beacon.Beacon) BeaconList {
+	list := make(BeaconList, len(beacons))
+	for i := range beacons {
+		list[i] = *newBeaconInfo(&beacons[i])
+	}
+	return list
+}
+
+func newBeaconInfo(b *beacon.Beacon) *BeaconInfo {
+	info := &BeaconInfo{
+		Path:         b.Path,
+		Address:      b.Address,
+		Name:         b.Name,
+		RSSI:         b.RSSI,
+		FilteredRSSI: b.FilteredRSSI,
+		Distance:     b.Distance,
+		LastSeen:     b.LastSeen,
+	}
+	for _, frame := range b.Frames {
+		info.Frames = append(info.Frames, frame.String())
+	}
+	return info
+}
+
+var beaconHeader = []string{"ADDRESS", "NAME", "RSSI", "FILTERED", "DISTANCE", "LAST SEEN",
+	"FRAMES"}
+
+func (b *BeaconInfo) row() []string {
+	distance := "-"
+	if b.Distance > 0 {
+		distance = fmt.Sprintf("%.2fm", b.Distance)
+	}
+	return []string{b.Address, b.Name, strconv.Itoa(int(b.RSSI)),
+		fmt.Sprintf("%.1f", b.FilteredRSSI), distance,
+		fmt.Sprintf("%s ago", time.Since(b.LastSeen).Truncate(100*time.Millisecond)),
+		strings.Join(b.Frames, "; ")}
+}
+
+// Text is the table, since the beacons are compared with each other
+func (l BeaconList) Text(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(beaconHeader, "\t"))
+	for i := range l {
+		fmt.Fprintln(tw, strings.Join(l[i].row(), "\t"))
+	}
+	tw.Flush()
+}
+
+// Table has a row for each beacon
+func (l BeaconList) Table() ([]string, [][]string) {
+	rows := make([][]string, len(l))
+	for i := range l {
+		rows[i] = l[i].row()
+	}
+	return beaconHeader, rows
+}
+
+// NewBeaconEvent converts the scanner's event
+func NewBeaconEvent(event *beacon.ScanEvent) *BeaconEvent {
+	beaconEvent := &BeaconEvent{Time: event.Time, Event: event.Kind.String()}
+	if event.Beacon.Path != "" {
+		beaconEvent.Beacon = newBeaconInfo(&event.Beacon)
+	}
+	return beaconEvent
+}
+
+func (e *BeaconEvent) address() string {
+	if e.Beacon == nil {
+		return "none"
+	}
+	return e.Beacon.Address
+}
+
+// Text writes the event on one line
+func (e *BeaconEvent) Text(w io.Writer) {
+	fmt.Fprintf(w, "%s %-14s %s\n", e.Time.Format(timeFormat), e.Event, e.address())
+}
+
+// Table is one row
+func (e *BeaconEvent) Table() ([]string, [][]string) {
+	return []string{"TIME", "EVENT", "ADDRESS"},
+		[][]string{{e.Time.Format(timeFormat), e.Event, e.address()}}
+}
@@ -0,0 +1,404 @@
+package zog
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/shigmas/bluezog/pkg/protocol"
+)
+
+// The shell commands declare their arguments. The declarations check and convert the
+// arguments before the BusFunc is called, generate the usage for help, and tell the
+// completion what to complete.
+
+type (
+	// ArgType is the kind of argument. Most are strings, which are completed differently.
+	ArgType int
+
+	// ArgSpec declares an argument of a command
+	ArgSpec struct {
+		Name string
+		Type ArgType
+		// Optional arguments can be left off the end of the line
+		Optional bool
+		// Variadic arguments repeat to the end of the line. For a verb, the verb and its
+		// arguments repeat.
+		Variadic bool
+		// Choices for ArgChoice
+		Choices []string
+		// Verbs for ArgVerb. The verb's arguments follow it.
+		Verbs []*CommandSpec
+	}
+
+	// CommandSpec declares a shell command, or a verb of one
+	CommandSpec struct {
+		Name    string
+		Summary string
+		Args    []ArgSpec
+	}
+)
+
+const (
+	// ArgString is any string
+	ArgString ArgType = iota
+	// ArgObject is an object path, or a device address or name
+	ArgObject
+	// ArgDevice is a device path, address or name
+	ArgDevice
+	// ArgGatt is the path of a GATT service, characteristic or descriptor
+	ArgGatt
+	// ArgInterface is a D-Bus interface name
+	ArgInterface
+	// ArgProperty is a property of the object or interface before it
+	ArgProperty
+	// ArgUUID is a UUID of the device before it, or of any device
+	ArgUUID
+	// ArgOnOff is on or off, converted to a bool
+	ArgOnOff
+	// ArgInt is converted to an int64
+	ArgInt
+	// ArgUint is converted to a uint64
+	ArgUint
+	// ArgBytes is converted to []byte with ParseBytes
+	ArgBytes
+	// ArgChoice is one of the Choices
+	ArgChoice
+	// ArgVerb is the name of one of the Verbs
+	ArgVerb
+	// ArgCommand is the name of a shell command
+	ArgCommand
+)
+
+var (
+	onOffArg = ArgSpec{Name: "on|off", Type: ArgOnOff}
+
+	writeTypes = []string{string(protocol.WriteTypeCommand), string(protocol.WriteTypeRequest),
+		string(protocol.WriteTypeReliable)}
+	transports = []string{string(protocol.TransportAuto), string(protocol.TransportBREDR),
+		string(protocol.TransportLE)}
+	capabilities = []string{string(protocol.CapabilityDisplayOnly),
+		string(protocol.CapabilityDisplayYesNo), string(protocol.CapabilityKeyboardOnly),
+		string(protocol.CapabilityNoInputNoOutput), string(protocol.CapabilityKeyboardDisplay)}
+
+	// CommandSpecs declares the arguments of the commands in BusCommand
+	CommandSpecs = map[string]*CommandSpec{
+		"close": {Summary: "Close the connection"},
+		"adapter": {
+			Summary: "Find the adapters, or control the default adapter",
+			Args: []ArgSpec{{Name: "command", Type: ArgVerb, Optional: true, Verbs: []*CommandSpec{
+				{Name: "show", Summary: "Show the settings"},
+				{Name: "power", Summary: "Turn the power on or off", Args: []ArgSpec{onOffArg}},
+				{Name: "discoverable", Summary: "Make it discoverable, for timeout seconds",
+					Args: []ArgSpec{onOffArg, {Name: "timeout", Type: ArgUint, Optional: true}}},
+				{Name: "pairable", Summary: "Make it pairable, for timeout seconds",
+					Args: []ArgSpec{onOffArg, {Name: "timeout", Type: ArgUint, Optional: true}}},
+				{Name: "alias", Summary: "Set the name",
+					Args: []ArgSpec{{Name: "name", Type: ArgString, Variadic: true}}},
+			}}},
+		},
+		"adapters": {Summary: "List the adapters"},
+		"start":    {Summary: "Start discovery"},
+		"stop":     {Summary: "Stop discovery"},
+		"object": {
+			Summary: "Show or control an object",
+			Args: []ArgSpec{{Name: "object", Type: ArgObject},
+				{Name: "command", Type: ArgVerb, Verbs: []*CommandSpec{
+					{Name: "dump", Summary: "Show the properties"},
+					{Name: "introspect", Summary: "Show the introspection data"},
+					{Name: "children", Summary: "Show the objects under it"},
+					{Name: "property", Summary: "Fetch the property",
+						Args: []ArgSpec{{Name: "property", Type: ArgProperty}}},
+					{Name: "connect", Summary: "Connect to the device, or one of its profiles",
+						Args: []ArgSpec{{Name: "uuid", Type: ArgUUID, Optional: true}}},
+					{Name: "disconnect", Summary: "Disconnect the device, or one of its profiles",
+						Args: []ArgSpec{{Name: "uuid", Type: ArgUUID, Optional: true}}},
+					{Name: "pair", Summary: "Pair with the device"},
+					{Name: "cancelpair", Summary: "Cancel pairing"},
+					{Name: "trust", Summary: "Trust the device",
+						Args: []ArgSpec{{Name: "on|off", Type: ArgOnOff, Optional: true}}},
+					{Name: "block", Summary: "Block the device",
+						Args: []ArgSpec{{Name: "on|off", Type: ArgOnOff, Optional: true}}},
+					{Name: "remove", Summary: "Remove the device from the adapter"},
+				}}},
+		},
+		"list": {
+			Summary: "List the objects with the interface, and the property",
+			Args: []ArgSpec{{Name: "path|all", Type: ArgChoice, Choices: []string{"path", "all"}},
+				{Name: "interface", Type: ArgInterface},
+				{Name: "property", Type: ArgProperty, Optional: true}},
+		},
+		"filter": {
+			Summary: "Show, clear or set the discovery filter",
+			Args: []ArgSpec{{Name: "filter", Type: ArgVerb, Variadic: true, Verbs: []*CommandSpec{
+				{Name: "show", Summary: "Show the supported filters"},
+				{Name: "clear", Summary: "Remove the filter"},
+				{Name: "uuids", Summary: "Only devices with the UUIDs",
+					Args: []ArgSpec{{Name: "uuid,...", Type: ArgUUID}}},
+				{Name: "rssi", Summary: "Only devices stronger than the RSSI",
+					Args: []ArgSpec{{Name: "dBm", Type: ArgInt}}},
+				{Name: "pathloss", Summary: "Only devices with less pathloss",
+					Args: []ArgSpec{{Name: "dB", Type: ArgUint}}},
+				{Name: "transport", Summary: "The type of scan",
+					Args: []ArgSpec{{Name: "transport", Type: ArgChoice, Choices: transports}}},
+				{Name: "duplicates", Summary: "Report the duplicate advertisements",
+					Args: []ArgSpec{onOffArg}},
+				{Name: "discoverable", Summary: "Only discoverable devices",
+					Args: []ArgSpec{onOffArg}},
+				{Name: "pattern", Summary: "Only devices with the address or name prefix",
+					Args: []ArgSpec{{Name: "prefix", Type: ArgString}}},
+			}}},
+		},
+		"agent": {
+			Summary: "Register the pairing agent",
+			Args: []ArgSpec{{Name: "command", Type: ArgVerb, Verbs: []*CommandSpec{
+				{Name: "on", Summary: "Ask in the shell for passkeys and confirmations",
+					Args: []ArgSpec{{Name: "capability", Type: ArgChoice, Optional: true,
+						Choices: capabilities}}},
+				{Name: "auto", Summary: "Accept everything",
+					Args: []ArgSpec{{Name: "capability", Type: ArgChoice, Optional: true,
+						Choices: capabilities}}},
+				{Name: "off", Summary: "Unregister the agent"},
+			}}},
+		},
+		"gatt": {
+			Summary: "Read, write or stream a GATT attribute. A service shows its tree",
+			Args: []ArgSpec{{Name: "attribute", Type: ArgGatt},
+				{Name: "command", Type: ArgVerb, Optional: true, Verbs: []*CommandSpec{
+					{Name: "read", Summary: "Read the value"},
+					{Name: "write", Summary: "Write hex, like 0x0102ff or 01:02:ff, or a string",
+						Args: []ArgSpec{{Name: "data", Type: ArgBytes},
+							{Name: "type", Type: ArgChoice, Optional: true, Choices: writeTypes}}},
+					{Name: "notify", Summary: "Stream the notifications until Ctrl-C"},
+					{Name: "stop", Summary: "Stop the notifications"},
+				}}},
+		},
+		"tree": {
+			Summary: "Show the GATT tree of the device",
+			Args:    []ArgSpec{{Name: "device", Type: ArgDevice}},
+		},
+		"monitor": {
+			Summary: "Stream the bluez signals until Ctrl-C. A path glob also matches the objects under it",
+			Args: []ArgSpec{{Name: "filter", Type: ArgVerb, Optional: true, Variadic: true,
+				Verbs: []*CommandSpec{
+					{Name: "path", Summary: "Only the objects that match the glob",
+						Args: []ArgSpec{{Name: "glob", Type: ArgString}}},
+					{Name: "interface", Summary: "Only the interface",
+						Args: []ArgSpec{{Name: "interface", Type: ArgInterface}}},
+					{Name: "property", Summary: "Only the property",
+						Args: []ArgSpec{{Name: "property", Type: ArgProperty}}},
+					{Name: "capture", Summary: "Tee the signals to a session log",
+						Args: []ArgSpec{{Name: "file", Type: ArgString}}},
+				}}},
+		},
+		"test": {
+			Summary: "Echo the arguments",
+			Args:    []ArgSpec{{Name: "arg", Type: ArgString, Optional: true, Variadic: true}},
+		},
+		"help": {
+			Summary: "List the commands, or show the usage of one",
+			Args:    []ArgSpec{{Name: "command", Type: ArgCommand, Optional: true}},
+		},
+	}
+)
+
+func init() {
+	for name, spec := range CommandSpecs {
+		spec.Name = name
+	}
+}
+
+// ParseCommand splits the line, and checks and converts the arguments for the command.
+func ParseCommand(line string) (string, []interface{}, error) {
+	tokens, err := Tokenize(line)
+	if err != nil || len(tokens) == 0 {
+		return "", nil, err
+	}
+	spec, ok := CommandSpecs[tokens[0]]
+	if !ok {
+		return tokens[0], nil, fmt.Errorf("No command [%s]", tokens[0])
+	}
+	args, err := spec.Parse(tokens[1:])
+	if err != nil {
+		return spec.Name, nil, fmt.Errorf("%s\nUsage:\n  %s", err,
+			strings.Join(spec.Usage(), "\n  "))
+	}
+	return spec.Name, args, nil
+}
+
+// Parse checks the arguments, and converts on|off, numbers and bytes
+func (c *CommandSpec) Parse(tokens []string) ([]interface{}, error) {
+	args, rest, err := parseArgs(c.Args, tokens)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("Too many arguments: %s", strings.Join(rest, " "))
+	}
+	return args, nil
+}
+
+// parseArgs converts the tokens for the specs. It returns the tokens that are left.
+func parseArgs(specs []ArgSpec, tokens []string) ([]interface{}, []string, error) {
+	var args []interface{}
+	for i := range specs {
+		spec := &specs[i]
+		if len(tokens) == 0 {
+			if spec.Optional {
+				break
+			}
+			return nil, nil, fmt.Errorf("Missing %s", spec.usage())
+		}
+		for len(tokens) > 0 {
+			if spec.Type == ArgVerb {
+				verb := spec.verb(tokens[0])
+				if verb == nil {
+					return nil, nil, fmt.Errorf("Unknown %s %s", spec.Name, tokens[0])
+				}
+				verbArgs, rest, err := parseArgs(verb.Args, tokens[1:])
+				if err != nil {
+					return nil, nil, fmt.Errorf("%s: %s", verb.Name, err)
+				}
+				args = append(append(args, verb.Name), verbArgs...)
+				tokens = rest
+			} else {
+				arg, err := spec.convert(tokens[0])
+				if err != nil {
+					return nil, nil, err
+				}
+				args = append(args, arg)
+				tokens = tokens[1:]
+			}
+			if !spec.Variadic {
+				break
+			}
+		}
+	}
+	return args, tokens, nil
+}
+
+func (a *ArgSpec) verb(name string) *CommandSpec {
+	for _, verb := range a.Verbs {
+		if verb.Name == name {
+			return verb
+		}
+	}
+	return nil
+}
+
+func (a *ArgSpec) convert(token string) (interface{}, error) {
+	switch a.Type {
+	case ArgOnOff:
+		return boolArg(token)
+	case ArgInt:
+		val, err := strconv.ParseInt(token, 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s is not a number", a.Name, token)
+		}
+		return val, nil
+	case ArgUint:
+		val, err := strconv.ParseUint(token, 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s is not a positive number", a.Name, token)
+		}
+		return val, nil
+	case ArgBytes:
+		return ParseBytes(token)
+	case ArgChoice:
+		for _, choice := range a.Choices {
+			if choice == token {
+				return token, nil
+			}
+		}
+		return nil, fmt.Errorf("Expected %s, not %s", strings.Join(a.Choices, "|"), token)
+	case ArgCommand:
+		if _, ok := CommandSpecs[token]; !ok {
+			return nil, fmt.Errorf("No command [%s]", token)
+		}
+	}
+	return token, nil
+}
+
+// usage is the argument in the usage line, like <device>, on|off, or [uuid]
+func (a *ArgSpec) usage() string {
+	var usage string
+	switch a.Type {
+	case ArgOnOff:
+		usage = "on|off"
+	case ArgChoice:
+		usage = strings.Join(a.Choices, "|")
+	default:
+		usage = "<" + a.Name + ">"
+	}
+	if a.Variadic {
+		usage += "..."
+	}
+	if a.Optional {
+		usage = "[" + usage + "]"
+	}
+	return usage
+}
+
+// Usage returns the usage lines of the command. Each verb has its own line.
+func (c *CommandSpec) Usage() []string {
+	lines := usageLines([]string{c.Name}, c.Args, "")
+	usage := make([]string, len(lines))
+	for i, line := range lines {
+		usage[i] = line.Usage
+	}
+	return usage
+}
+
+// usageLines follows the words with the arguments. The summary is the verb's.
+func usageLines(words []string, args []ArgSpec, summary string) []UsageLine {
+	for i := range args {
+		arg := &args[i]
+		if arg.Type != ArgVerb {
+			words = append(words, arg.usage())
+			continue
+		}
+		var lines []UsageLine
+		if arg.Optional {
+			lines = append(lines, UsageLine{Usage: strings.Join(words, " "), Summary: summary})
+		}
+		for _, verb := range arg.Verbs {
+			verbWords := append(append([]string{}, words...), verb.Name)
+			for _, line := range usageLines(verbWords, verb.Args, verb.Summary) {
+				if arg.Variadic {
+					line.Usage += " ..."
+				}
+				lines = append(lines, line)
+			}
+		}
+		return lines
+	}
+	return []UsageLine{{Usage: strings.Join(words, " "), Summary: summary}}
+}
+
+// help lists the commands, or shows the usage of one
+// help [command]
+func help(_ Bus, args ...interface{}) (Result, error) {
+	if len(args) == 0 {
+		names := make([]string, 0, len(CommandSpecs))
+		for name := range CommandSpecs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		list := make(HelpList, len(names))
+		for i, name := range names {
+			list[i] = CommandHelp{Name: name, Summary: CommandSpecs[name].Summary}
+		}
+		return list, nil
+	}
+
+	name, err := stringArg(args[0])
+	if err != nil {
+		return nil, err
+	}
+	spec, ok := CommandSpecs[name]
+	if !ok {
+		return nil, fmt.Errorf("No command [%s]", name)
+	}
+	return &CommandHelp{Name: name, Summary: spec.Summary, Usage: usageLines([]string{name}, spec.Args, "")}, nil
+}
@@ -0,0 +1,78 @@
+package zog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandSpecs(t *testing.T) {
+	for name := range BusCommand {
+		assert.Contains(t, CommandSpecs, name, "Every command has a spec")
+	}
+	for name := range CommandSpecs {
+		assert.Contains(t, BusCommand, name, "Every spec has a command")
+	}
+}
+
+func TestParseCommand(t *testing.T) {
+	command, args, err := ParseCommand(`gatt  /org/bluez/hci0/dev_D1/char0018 write "0x01 0x02" request`)
+	assert.NoError(t, err)
+	assert.Equal(t, "gatt", command)
+	assert.Equal(t, []interface{}{"/org/bluez/hci0/dev_D1/char0018", "write", []byte{1, 2},
+		"request"}, args)
+
+	_, args, err = ParseCommand("filter rssi -70 duplicates on pathloss 0x10")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"rssi", int64(-70), "duplicates", true, "pathloss",
+		uint64(16)}, args)
+
+	_, args, err = ParseCommand(`adapter alias "My Pi"`)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"alias", "My Pi"}, args)
+
+	command, args, err = ParseCommand("  ")
+	assert.NoError(t, err)
+	assert.Equal(t, "", command, "Empty lines have no command")
+
+	for _, line := range []string{
+		"nope",
+		"tree",
+		"tree a b",
+		"adapter power maybe",
+		"adapter fly",
+		"filter rssi loud",
+		"gatt /path write 0x01 slowly",
+		"agent on Telepathy",
+		"help nope",
+	} {
+		_, _, err = ParseCommand(line)
+		assert.Error(t, err, line)
+	}
+}
+
+func TestHelp(t *testing.T) {
+	assert.Equal(t, []string{"tree <device>"}, CommandSpecs["tree"].Usage())
+	assert.Equal(t, []string{
+		"gatt <attribute>",
+		"gatt <attribute> read",
+		"gatt <attribute> write <data> [command|request|reliable]",
+		"gatt <attribute> notify",
+		"gatt <attribute> stop",
+	}, CommandSpecs["gatt"].Usage())
+	assert.Contains(t, CommandSpecs["filter"].Usage(), "filter rssi <dBm> ...")
+	assert.Contains(t, CommandSpecs["test"].Usage(), "test [<arg>...]")
+
+	result, err := help(nil)
+	assert.NoError(t, err)
+	if list, ok := result.(HelpList); assert.True(t, ok) {
+		assert.Len(t, list, len(CommandSpecs))
+		assert.Equal(t, "adapter", list[0].Name)
+	}
+	result, err = help(nil, "object")
+	assert.NoError(t, err)
+	if usage, ok := result.(*CommandHelp); assert.True(t, ok) {
+		assert.Contains(t, usage.Usage, UsageLine{Usage: "object <object> trust [on|off]",
+			Summary: "Trust the device"})
+	}
+}
@@ -0,0 +1,103 @@
+package zog
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Tokenize splits the shell's line into words. Words are separated by any amount of white
+// space. Single and double quotes keep the spaces in a word, and a backslash escapes the
+// next character, except in single quotes.
+func Tokenize(line string) ([]string, error) {
+	var tokens []string
+	var current strings.Builder
+	inToken := false
+	escaped := false
+	var quote rune
+	for _, r := range line {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inToken = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inToken = true
+		case unicode.IsSpace(r):
+			if inToken {
+				tokens = append(tokens, current.String())
+				current.Reset()
+				inToken = false
+			}
+		default:
+			current.WriteRune(r)
+			inToken = true
+		}
+	}
+	if escaped {
+		return nil, fmt.Errorf("Nothing to escape at the end of the line")
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("Missing the closing %c", quote)
+	}
+	if inToken {
+		tokens = append(tokens, current.String())
+	}
+
+	return tokens, nil
+}
+
+// ParseBytes parses the data for a write. 0x starts hex, like 0x0102ff. The bytes can be
+// separated by spaces, colons or commas, like 0x01:02:ff, or "0x01 0x02 0xff". Without 0x,
+// two or more separated hex bytes, like 01:02:ff, are hex too. Anything else is the string.
+func ParseBytes(arg string) ([]byte, error) {
+	fields := strings.FieldsFunc(arg, func(r rune) bool {
+		return r == ' ' || r == ':' || r == ','
+	})
+	if !hasHexPrefix(arg) && (len(fields) < 2 || !hexPairs(fields)) {
+		return []byte(arg), nil
+	}
+
+	var data []byte
+	for _, field := range fields {
+		if hasHexPrefix(field) {
+			field = field[2:]
+		}
+		if len(field)%2 == 1 {
+			field = "0" + field
+		}
+		b, err := hex.DecodeString(field)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid hex data %s: %s", arg, err)
+		}
+		data = append(data, b...)
+	}
+	return data, nil
+}
+
+func hasHexPrefix(str string) bool {
+	return strings.HasPrefix(str, "0x") || strings.HasPrefix(str, "0X")
+}
+
+// hexPairs is true if all of the fields are a byte in hex
+func hexPairs(fields []string) bool {
+	for _, field := range fields {
+		if len(field) != 2 {
+			return false
+		}
+		if _, err := hex.DecodeString(field); err != nil {
+			return false
+		}
+	}
+	return true
+}
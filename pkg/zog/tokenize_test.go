@@ -0,0 +1,42 @@
+package zog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenize(t *testing.T) {
+	tokens, err := Tokenize(`  adapter   alias "My Pi" 'it''s' a\ b "\"q\"" ""`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"adapter", "alias", "My Pi", "its", "a b", `"q"`, ""}, tokens)
+
+	tokens, err = Tokenize("   ")
+	assert.NoError(t, err)
+	assert.Empty(t, tokens)
+
+	_, err = Tokenize(`adapter alias "My Pi`)
+	assert.Error(t, err, "Expected error for the missing quote")
+	_, err = Tokenize(`adapter alias \`)
+	assert.Error(t, err, "Expected error for the escape at the end")
+}
+
+func TestParseBytes(t *testing.T) {
+	for arg, expected := range map[string][]byte{
+		"0x0102ff":       {1, 2, 0xff},
+		"0X1":            {1},
+		"0x01:02:ff":     {1, 2, 0xff},
+		"0x01 0x02 0xff": {1, 2, 0xff},
+		"01:02:ff":       {1, 2, 0xff},
+		"01 02":          {1, 2},
+		"cafe":           []byte("cafe"),
+		"ab:cde":         []byte("ab:cde"),
+		"hello world":    []byte("hello world"),
+	} {
+		data, err := ParseBytes(arg)
+		assert.NoError(t, err, arg)
+		assert.Equal(t, expected, data, arg)
+	}
+	_, err := ParseBytes("0xzz")
+	assert.Error(t, err, "Expected error for invalid hex")
+}
@@ -3,7 +3,10 @@ package test
 import (
 	"context"
 	"fmt"
+	"os"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/godbus/dbus/v5"
@@ -16,6 +19,20 @@ type (
 		sigCh       chan<- *dbus.Signal
 		sigStopper  map[string]func()
 		managedType string
+		// properties that have been set through SetObjectProperty, keyed by path, then
+		// interface.property
+		properties map[dbus.ObjectPath]map[string]interface{}
+		propMux    sync.Mutex
+		// exported objects, keyed by path, then interface
+		exported map[dbus.ObjectPath]map[string]interface{}
+		// values written to characteristics and descriptors, keyed by path
+		values map[dbus.ObjectPath][]byte
+		// our end of the sockets returned from CallFunctionForFd, keyed by path
+		peers map[dbus.ObjectPath]*os.File
+		// the number of times each function was called
+		calls map[string]int
+		// the unique name that owns org.bluez
+		owner string
 	}
 )
 
@@ -23,6 +40,9 @@ var (
 	// BusSignalInterval is the time between simulated signals
 	BusSignalInterval                 = time.Second
 	_                 base.Operations = (*busMock)(nil)
+
+	discoveryFilters = []string{"UUIDs", "RSSI", "Pathloss", "Transport", "DuplicateData",
+		"Discoverable", "Pattern"}
 )
 
 // NewBusMock creates a mock bus (base.Operations implementation). The
@@ -30,7 +50,54 @@ var (
 func NewBusMock(managedType string) base.Operations {
 	return &busMock{
 		managedType: managedType,
+		properties:  make(map[dbus.ObjectPath]map[string]interface{}),
+		exported:    make(map[dbus.ObjectPath]map[string]interface{}),
+		values:      make(map[dbus.ObjectPath][]byte),
+		peers:       make(map[dbus.ObjectPath]*os.File),
+		calls:       make(map[string]int),
+		owner:       ":1.1119",
+	}
+}
+
+func (b *busMock) countCall(funcName string) {
+	b.propMux.Lock()
+	b.calls[funcName]++
+	b.propMux.Unlock()
+}
+
+// CallCount returns the number of times the function was called on the mock
+func CallCount(ops base.Operations, funcName string) int {
+	b, ok := ops.(*busMock)
+	if !ok {
+		return 0
 	}
+	b.propMux.Lock()
+	defer b.propMux.Unlock()
+	return b.calls[funcName]
+}
+
+// SetNameOwner simulates bluetoothd stopping (with an empty owner) or starting, by sending
+// NameOwnerChanged for org.bluez.
+func SetNameOwner(ops base.Operations, owner string) error {
+	b, ok := ops.(*busMock)
+	if !ok {
+		return fmt.Errorf("Operations are not the mock")
+	}
+	b.propMux.Lock()
+	oldOwner := b.owner
+	b.owner = owner
+	b.propMux.Unlock()
+	if b.sigCh == nil {
+		return fmt.Errorf("No signal channel registered")
+	}
+	b.sigCh <- &dbus.Signal{
+		Sender: "org.freedesktop.DBus",
+		Path:   "/org/freedesktop/DBus",
+		Name:   "org.freedesktop.DBus.NameOwnerChanged",
+		Body:   []interface{}{"org.bluez", oldOwner, owner},
+	}
+
+	return nil
 }
 
 // IntrospectObject fetches the XML for Introspection and parses it into a Node hierarchy
@@ -41,13 +108,34 @@ func (b *busMock) IntrospectObject(dest string, objPath dbus.ObjectPath) (*base.
 
 // GetObjectProperty for the specified object and property name
 func (b *busMock) GetObjectProperty(dest string, objPath dbus.ObjectPath, propName string) (interface{}, error) {
+	b.propMux.Lock()
+	defer b.propMux.Unlock()
+	if props, ok := b.properties[objPath]; ok {
+		if val, ok := props[propName]; ok {
+			return val, nil
+		}
+	}
 
 	return nil, fmt.Errorf("GetObjectProperty not yet mocked")
 }
 
+// SetObjectProperty stores the value so a later GetObjectProperty will return it
+func (b *busMock) SetObjectProperty(dest string, objPath dbus.ObjectPath, propName string, value interface{}) error {
+	b.propMux.Lock()
+	defer b.propMux.Unlock()
+	props, ok := b.properties[objPath]
+	if !ok {
+		props = make(map[string]interface{})
+		b.properties[objPath] = props
+	}
+	props[propName] = value
+
+	return nil
+}
+
 // GetManagedObjects retrieves the paths of the objects managed by this object
 func (b *busMock) GetManagedObjects(dest string, objPath dbus.ObjectPath) (map[dbus.ObjectPath]base.ObjectMap, error) {
-
+	b.countCall("GetManagedObjects")
 	return UnmarshalManagedObjects("managed-" + b.managedType)
 }
 
@@ -57,12 +145,26 @@ func (b *busMock) CallFunction(
 	dest string,
 	objPath dbus.ObjectPath,
 	funcName string) error {
+	b.countCall(funcName)
 	if strings.HasSuffix(funcName, "StartDiscovery") {
 		return nil
 	}
 	if strings.HasSuffix(funcName, "StopDiscovery") {
 		return nil
 	}
+	if strings.HasSuffix(funcName, "Pair") {
+		return nil
+	}
+	if strings.HasSuffix(funcName, "StartNotify") || strings.HasSuffix(funcName, "StopNotify") {
+		return nil
+	}
+	if strings.HasSuffix(funcName, "CancelPairing") {
+		// We never have a pairing in progress
+		return dbus.Error{
+			Name: "org.bluez.Error.DoesNotExist",
+			Body: []interface{}{"Does Not Exist"},
+		}
+	}
 	return fmt.Errorf("CallFunction(%s) not yet mocked", funcName)
 }
 
@@ -74,9 +176,157 @@ func (b *busMock) CallFunctionWithArgs(
 	objPath dbus.ObjectPath,
 	funcName string,
 	args ...interface{}) error {
+	b.countCall(funcName)
+	if strings.HasSuffix(funcName, "SetDiscoveryFilter") {
+		if len(args) != 1 {
+			return fmt.Errorf("SetDiscoveryFilter takes one argument, not %d", len(args))
+		}
+		filter, ok := args[0].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("SetDiscoveryFilter argument was %T, not a{sv}", args[0])
+		}
+		// Like bluez, UUIDs that don't parse are invalid
+		if uuids, ok := filter["UUIDs"].([]string); ok {
+			for _, uuid := range uuids {
+				if len(uuid) != 4 && len(uuid) != 8 && len(uuid) != 36 {
+					return dbus.Error{Name: "org.bluez.Error.InvalidArguments",
+						Body: []interface{}{"Invalid arguments in method call"}}
+				}
+			}
+		}
+		return nil
+	}
+	if strings.HasSuffix(funcName, "ReadValue") {
+		if len(args) != 1 {
+			return fmt.Errorf("ReadValue takes one argument, not %d", len(args))
+		}
+		opts, ok := args[0].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("ReadValue options were %T, not a{sv}", args[0])
+		}
+		b.propMux.Lock()
+		data, ok := b.values[objPath]
+		b.propMux.Unlock()
+		if !ok {
+			// Nothing has been written, so we have nothing to read.
+			return dbus.Error{Name: "org.bluez.Error.NotPermitted", Body: []interface{}{"Read not permitted"}}
+		}
+		var offset uint16
+		if o, ok := opts["offset"]; ok {
+			offset = o.(uint16)
+		}
+		if int(offset) > len(data) {
+			return dbus.Error{Name: "org.bluez.Error.InvalidOffset", Body: []interface{}{"Invalid offset"}}
+		}
+		return dbus.Store([]interface{}{data[offset:]}, retVal)
+	}
+	if strings.HasSuffix(funcName, "WriteValue") {
+		if len(args) != 2 {
+			return fmt.Errorf("WriteValue takes two arguments, not %d", len(args))
+		}
+		data, ok := args[0].([]byte)
+		if !ok {
+			return fmt.Errorf("WriteValue argument was %T, not ay", args[0])
+		}
+		if _, ok := args[1].(map[string]interface{}); !ok {
+			return fmt.Errorf("WriteValue options were %T, not a{sv}", args[1])
+		}
+		b.propMux.Lock()
+		b.values[objPath] = append([]byte(nil), data...)
+		b.propMux.Unlock()
+		return nil
+	}
+	if strings.HasSuffix(funcName, "RemoveDevice") {
+		return nil
+	}
+	if strings.HasSuffix(funcName, "RegisterAgent") ||
+		strings.HasSuffix(funcName, "UnregisterAgent") ||
+		strings.HasSuffix(funcName, "RequestDefaultAgent") {
+		path, ok := args[0].(dbus.ObjectPath)
+		if !ok {
+			return fmt.Errorf("%s argument was %T, not an object path", funcName, args[0])
+		}
+		b.propMux.Lock()
+		_, exported := b.exported[path]
+		b.propMux.Unlock()
+		if !exported {
+			return dbus.Error{Name: "org.bluez.Error.DoesNotExist"}
+		}
+		return nil
+	}
+	if strings.HasSuffix(funcName, "GetDiscoveryFilters") {
+		return dbus.Store([]interface{}{discoveryFilters}, retVal)
+	}
 	return fmt.Errorf("CallFunctionWithArgs not yet mocked")
 }
 
+// Export stores the object. Nothing will call it, since there's no bus
+func (b *busMock) Export(obj interface{}, path dbus.ObjectPath, iface string) error {
+	b.propMux.Lock()
+	defer b.propMux.Unlock()
+	ifaces, ok := b.exported[path]
+	if !ok {
+		ifaces = make(map[string]interface{})
+		b.exported[path] = ifaces
+	}
+	ifaces[iface] = obj
+
+	return nil
+}
+
+// Unexport removes the exported object
+func (b *busMock) Unexport(path dbus.ObjectPath, iface string) error {
+	b.propMux.Lock()
+	defer b.propMux.Unlock()
+	if ifaces, ok := b.exported[path]; ok {
+		delete(ifaces, iface)
+	}
+
+	return nil
+}
+
+// MockMTU is the MTU returned from CallFunctionForFd
+const MockMTU = 23
+
+// CallFunctionForFd returns one end of a socketpair, like bluez does for AcquireNotify and
+// AcquireWrite. The other end is available through PeerSocket.
+func (b *busMock) CallFunctionForFd(
+	_ context.Context,
+	dest string,
+	objPath dbus.ObjectPath,
+	funcName string,
+	args ...interface{}) (*os.File, uint16, error) {
+	if !strings.HasSuffix(funcName, "AcquireNotify") && !strings.HasSuffix(funcName, "AcquireWrite") {
+		return nil, 0, fmt.Errorf("CallFunctionForFd(%s) not yet mocked", funcName)
+	}
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_SEQPACKET, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+	b.propMux.Lock()
+	b.peers[objPath] = os.NewFile(uintptr(fds[1]), string(objPath)+"-peer")
+	b.propMux.Unlock()
+
+	return os.NewFile(uintptr(fds[0]), string(objPath)), MockMTU, nil
+}
+
+// PeerSocket returns the other end of the socket that was returned from CallFunctionForFd for
+// the path. This is the bluez end, so writing to it sends a notification.
+func PeerSocket(ops base.Operations, objPath dbus.ObjectPath) (*os.File, error) {
+	b, ok := ops.(*busMock)
+	if !ok {
+		return nil, fmt.Errorf("Operations are not the mock")
+	}
+	b.propMux.Lock()
+	defer b.propMux.Unlock()
+	peer, ok := b.peers[objPath]
+	if !ok {
+		return nil, fmt.Errorf("No socket for %s", objPath)
+	}
+
+	return peer, nil
+}
+
 // RegisterSignalChannel passes the signal to DBus.
 func (b *busMock) RegisterSignalChannel(ch chan<- *dbus.Signal) {
 	b.sigCh = ch
@@ -141,3 +391,13 @@ func (b *busMock) UnWatch(path dbus.ObjectPath, iface string, method string) err
 	delete(b.sigStopper, getWatchKey(iface, method))
 	return nil
 }
+
+// WatchNameOwner does nothing. SetNameOwner sends the signal.
+func (b *busMock) WatchNameOwner(name string) error {
+	return nil
+}
+
+// WatchNamespace doesn't have any stored signals, so nothing will be sent
+func (b *busMock) WatchNamespace(namespace dbus.ObjectPath, iface string, method string) error {
+	return nil
+}
@@ -12,16 +12,6 @@ import (
 	"github.com/shigmas/bluezog/pkg/logger"
 )
 
-func writeBytes(b []byte, prefix string) (string, error) {
-	f, err := ioutil.TempFile("./testdata", prefix)
-	if err != nil {
-		return "", err
-	}
-
-	_, err = f.Write(b)
-	return f.Name(), err
-}
-
 func readBytes(data interface{}, n string) error {
 	path := filepath.Join("../..", "testdata", n)
 	fmt.Println("Opening ", path)
@@ -33,21 +23,6 @@ func readBytes(data interface{}, n string) error {
 	return json.Unmarshal(b, data)
 }
 
-// MarshalRaw writes the raw bytes and returns the file name or error
-func MarshalRaw(b []byte, prefix string) (string, error) {
-	return writeBytes(b, fmt.Sprintf("raw-%s-", prefix))
-}
-
-// MarshalIntrospect writes the introspect data and returns the file name or error
-func MarshalIntrospect(n *base.Node) (string, error) {
-	introBytes, err := json.Marshal(n)
-	if err != nil {
-		return "", err
-	}
-
-	return writeBytes(introBytes, "introspect-")
-}
-
 // UnmarshalIntrospect reads the introspect data and returns the data or error
 func UnmarshalIntrospect(fname string) (base.Node, error) {
 	var introspectData base.Node
@@ -55,16 +30,6 @@ func UnmarshalIntrospect(fname string) (base.Node, error) {
 	return introspectData, err
 }
 
-// MarshalManagedObjects writes the managed object data and returns the file name or error
-func MarshalManagedObjects(s map[dbus.ObjectPath]base.ObjectMap) (string, error) {
-	mged, err := json.Marshal(s)
-	if err != nil {
-		return "", err
-	}
-
-	return writeBytes(mged, "managed-")
-}
-
 // UnmarshalManagedObjects reads the managed object data and returns the object data or error
 func UnmarshalManagedObjects(fname string) (map[dbus.ObjectPath]base.ObjectMap, error) {
 	var s map[dbus.ObjectPath]base.ObjectMap
@@ -72,20 +37,20 @@ func UnmarshalManagedObjects(fname string) (map[dbus.ObjectPath]base.ObjectMap,
 	return s, err
 }
 
-// MarshalSignal writes the signal data and returns the file name or error
-func MarshalSignal(signal *dbus.Signal) (string, error) {
-	sigBytes, err := json.Marshal(signal)
-	if err != nil {
-		return "", err
-	}
-
-	return writeBytes(sigBytes, "signal-")
-}
+// propertiesChangedSignal is the name of the PropertiesChanged signal. The body is the
+// interface, the changed properties, and the invalidated properties.
+const propertiesChangedSignal = "org.freedesktop.DBus.Properties.PropertiesChanged"
 
 // UnmarshalSignal reads the signal data and returns the signal or error
 func UnmarshalSignal(fname string) (*dbus.Signal, error) {
 	var signal dbus.Signal
 	err := readBytes(&signal, fname)
+	if err != nil {
+		return nil, err
+	}
+	if signal.Name == propertiesChangedSignal {
+		return unmarshalPropertiesChanged(&signal)
+	}
 	ifaceArray := make([]interface{}, len(signal.Body))
 	for index, val := range signal.Body {
 		if str, ok := val.(string); ok {
@@ -109,6 +74,13 @@ func UnmarshalSignal(fname string) (*dbus.Signal, error) {
 
 			}
 			ifaceArray[index] = trueMap
+		} else if names, ok := val.([]interface{}); ok {
+			// InterfacesRemoved has the names of the interfaces
+			strs := make([]string, len(names))
+			for i, n := range names {
+				strs[i], _ = n.(string)
+			}
+			ifaceArray[index] = strs
 		} else {
 			fmt.Printf("Unhandled Unmarshal signal data: %s\n", val)
 		}
@@ -117,3 +89,41 @@ func UnmarshalSignal(fname string) (*dbus.Signal, error) {
 
 	return &signal, err
 }
+
+// unmarshalPropertiesChanged converts the body that was written by bus.MarshalSignal
+func unmarshalPropertiesChanged(signal *dbus.Signal) (*dbus.Signal, error) {
+	if len(signal.Body) != 3 {
+		return nil, fmt.Errorf("PropertiesChanged body has %d elements", len(signal.Body))
+	}
+	iface, ok := signal.Body[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("PropertiesChanged interface is %T", signal.Body[0])
+	}
+	varStrings, ok := signal.Body[1].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("PropertiesChanged properties are %T", signal.Body[1])
+	}
+	changed := make(map[string]dbus.Variant)
+	for k, v := range varStrings {
+		str, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("Property %s is %T, not a variant string", k, v)
+		}
+		variant, err := dbus.ParseVariant(str, dbus.Signature{})
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse property %s: %s", k, err)
+		}
+		changed[k] = variant
+	}
+	invalidated := make([]string, 0)
+	if names, ok := signal.Body[2].([]interface{}); ok {
+		for _, n := range names {
+			if str, ok := n.(string); ok {
+				invalidated = append(invalidated, str)
+			}
+		}
+	}
+	signal.Body = []interface{}{iface, changed, invalidated}
+
+	return signal, nil
+}
@@ -0,0 +1,753 @@
+package scenario
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+
+	"github.com/shigmas/bluezog/pkg/base"
+	"github.com/shigmas/bluezog/test"
+)
+
+// The fake bluez doesn't import the bus package, since the bus tests import us.
+const (
+	fakeBluezDest    = "org.bluez"
+	fakeAdapterIface = "org.bluez.Adapter1"
+	fakeDeviceIface  = "org.bluez.Device1"
+	fakeCharIface    = "org.bluez.GattCharacteristic1"
+	fakeDescIface    = "org.bluez.GattDescriptor1"
+	fakeAgentMgr     = "org.bluez.AgentManager1"
+	fakeAgentIface   = "org.bluez.Agent1"
+	fakeObjectMgr    = "org.freedesktop.DBus.ObjectManager"
+	fakeProperties   = "org.freedesktop.DBus.Properties"
+	fakeIntrospect   = "org.freedesktop.DBus.Introspectable"
+
+	// FakeAdapterAddress is the Address of the adapters in the fake bluez
+	FakeAdapterAddress = "00:1A:7D:DA:71:13"
+	// FakePasskey is the passkey that Pair asks the agent to confirm
+	FakePasskey = 123456
+
+	// the bus configuration, with the directory for the socket
+	fakeBusConfig = `<!DOCTYPE busconfig PUBLIC "-//freedesktop//DTD D-Bus Bus Configuration 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/busconfig.dtd">
+<busconfig>
+  <type>session</type>
+  <listen>unix:dir=%s</listen>
+  <auth>EXTERNAL</auth>
+  <policy context="default">
+    <allow send_destination="*" eavesdrop="true"/>
+    <allow eavesdrop="true"/>
+    <allow own="*"/>
+  </policy>
+</busconfig>
+`
+)
+
+type (
+	// FakeBluez is a simulated org.bluez service on a private dbus-daemon. The objects come
+	// from the managed object fixtures in testdata. The fixtures only have the property
+	// names, so the values are made up from the path and property name.
+	FakeBluez struct {
+		// Address of the private bus, for bus.WithBusAddress
+		Address string
+		daemon  *exec.Cmd
+		dir     string
+		conn    *dbus.Conn
+		mux     sync.Mutex
+		// the properties of each object, keyed by path, then interface
+		objects map[dbus.ObjectPath]map[string]map[string]dbus.Variant
+		// the agent that was registered with the AgentManager
+		agent *fakeAgent
+	}
+
+	// fakeAgent is the agent that Pair calls
+	fakeAgent struct {
+		sender     dbus.Sender
+		path       dbus.ObjectPath
+		capability string
+	}
+
+	// The exported types. Each interface is a different type, so godbus only exports the
+	// methods for that interface.
+	fakeObject struct {
+		f    *FakeBluez
+		path dbus.ObjectPath
+	}
+	fakeObjectManager  fakeObject
+	fakeProps          fakeObject
+	fakeAdapter        fakeObject
+	fakeDevice         fakeObject
+	fakeCharacteristic fakeObject
+	fakeDescriptor     fakeObject
+	fakeAgentManager   fakeObject
+)
+
+var (
+	// ErrNoDaemon is returned from StartFakeBluez when dbus-daemon can't be found. Tests
+	// should skip instead of failing.
+	ErrNoDaemon = errors.New("dbus-daemon not found")
+
+	// DaemonStartTimeout is how long we wait for dbus-daemon to print its address
+	DaemonStartTimeout = 5 * time.Second
+
+	// the filters from GetDiscoveryFilters, the same as the bus mock
+	fakeDiscoveryFilters = []string{"UUIDs", "RSSI", "Pathloss", "Transport", "DuplicateData",
+		"Discoverable", "Pattern"}
+)
+
+func fakeError(name, message string) *dbus.Error {
+	return dbus.NewError(name, []interface{}{message})
+}
+
+// StartFakeBluez starts a private dbus-daemon, and exports the objects from the managed
+// object fixture as org.bluez. The parameter is either "simple" or "gatt", like NewBusMock.
+// The daemon is found from $DBUS_DAEMON, or the PATH.
+func StartFakeBluez(managedType string) (*FakeBluez, error) {
+	managed, err := test.UnmarshalManagedObjects("managed-" + managedType)
+	if err != nil {
+		return nil, err
+	}
+	daemonPath := os.Getenv("DBUS_DAEMON")
+	if daemonPath == "" {
+		daemonPath, err = exec.LookPath("dbus-daemon")
+		if err != nil {
+			return nil, ErrNoDaemon
+		}
+	}
+
+	f := &FakeBluez{
+		objects: make(map[dbus.ObjectPath]map[string]map[string]dbus.Variant),
+	}
+	err = f.startDaemon(daemonPath)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	err = f.connect()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	for path, ifaceMap := range managed {
+		err = f.AddObject(path, ifaceMap)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	err = f.conn.Export(&fakeObjectManager{f, "/"}, "/", fakeObjectMgr)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	reply, err := f.conn.RequestName(fakeBluezDest, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		f.Close()
+		return nil, fmt.Errorf("Unable to own %s: %d", fakeBluezDest, reply)
+	}
+
+	return f, nil
+}
+
+func (f *FakeBluez) startDaemon(daemonPath string) error {
+	dir, err := ioutil.TempDir("", "fakebluez")
+	if err != nil {
+		return err
+	}
+	f.dir = dir
+	config := filepath.Join(dir, "bus.conf")
+	err = ioutil.WriteFile(config, []byte(fmt.Sprintf(fakeBusConfig, dir)), 0600)
+	if err != nil {
+		return err
+	}
+
+	f.daemon = exec.Command(daemonPath, "--config-file="+config, "--nofork", "--print-address=1")
+	stdout, err := f.daemon.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	err = f.daemon.Start()
+	if err != nil {
+		f.daemon = nil
+		return err
+	}
+
+	addrCh := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(stdout).ReadString('\n')
+		addrCh <- strings.TrimSpace(line)
+	}()
+	select {
+	case f.Address = <-addrCh:
+	case <-time.After(DaemonStartTimeout):
+	}
+	if f.Address == "" {
+		return fmt.Errorf("dbus-daemon didn't print its address")
+	}
+
+	return nil
+}
+
+func (f *FakeBluez) connect() error {
+	conn, err := dbus.Dial(f.Address)
+	if err != nil {
+		return err
+	}
+	f.conn = conn
+	err = conn.Auth(nil)
+	if err != nil {
+		return err
+	}
+	return conn.Hello()
+}
+
+// Close stops the daemon and removes its socket
+func (f *FakeBluez) Close() error {
+	var err error
+	if f.conn != nil {
+		err = f.conn.Close()
+	}
+	if f.daemon != nil {
+		f.daemon.Process.Kill()
+		f.daemon.Wait()
+	}
+	if f.dir != "" {
+		os.RemoveAll(f.dir)
+	}
+
+	return err
+}
+
+// AddObject exports the object, and sends InterfacesAdded. Properties without a value, like
+// the ones in the fixtures, are given a value made up from the path and name.
+func (f *FakeBluez) AddObject(path dbus.ObjectPath, ifaceMap base.ObjectMap) error {
+	props := make(map[string]map[string]dbus.Variant, len(ifaceMap))
+	for iface, propMap := range ifaceMap {
+		values := make(map[string]dbus.Variant, len(propMap))
+		for name, value := range propMap {
+			if value.Signature().String() == "" {
+				var ok bool
+				value, ok = fakeValue(path, iface, name)
+				if !ok {
+					continue
+				}
+			}
+			values[name] = value
+		}
+		props[iface] = values
+	}
+
+	exports := map[string]interface{}{
+		fakeProperties: &fakeProps{f, path},
+	}
+	for iface := range props {
+		switch iface {
+		case fakeAdapterIface:
+			exports[iface] = &fakeAdapter{f, path}
+		case fakeDeviceIface:
+			exports[iface] = &fakeDevice{f, path}
+		case fakeCharIface:
+			exports[iface] = &fakeCharacteristic{f, path}
+		case fakeDescIface:
+			exports[iface] = &fakeDescriptor{f, path}
+		case fakeAgentMgr:
+			exports[iface] = &fakeAgentManager{f, path}
+		}
+	}
+	for iface, obj := range exports {
+		err := f.conn.Export(obj, path, iface)
+		if err != nil {
+			return err
+		}
+	}
+
+	f.mux.Lock()
+	f.objects[path] = props
+	err := f.conn.Emit("/", fakeObjectMgr+".InterfacesAdded", path, props)
+	f.mux.Unlock()
+	f.exportIntrospection()
+
+	return err
+}
+
+// RemoveObject unexports the object and the objects under it, and sends InterfacesRemoved
+// for each of them.
+func (f *FakeBluez) RemoveObject(path dbus.ObjectPath) error {
+	f.mux.Lock()
+	removed := make(map[dbus.ObjectPath][]string)
+	for p, props := range f.objects {
+		if p != path && !strings.HasPrefix(string(p), string(path)+"/") {
+			continue
+		}
+		ifaces := make([]string, 0, len(props))
+		for iface := range props {
+			ifaces = append(ifaces, iface)
+		}
+		removed[p] = ifaces
+		delete(f.objects, p)
+	}
+	f.mux.Unlock()
+	if len(removed) == 0 {
+		return fmt.Errorf("No object at %s", path)
+	}
+
+	// Like bluez, the children are removed before their parents
+	paths := make([]string, 0, len(removed))
+	for p := range removed {
+		paths = append(paths, string(p))
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(paths)))
+	for _, p := range paths {
+		ifaces := removed[dbus.ObjectPath(p)]
+		for _, iface := range append(ifaces, fakeProperties) {
+			f.conn.Export(nil, dbus.ObjectPath(p), iface)
+		}
+		err := f.conn.Emit("/", fakeObjectMgr+".InterfacesRemoved", dbus.ObjectPath(p), ifaces)
+		if err != nil {
+			return err
+		}
+	}
+	f.exportIntrospection()
+
+	return nil
+}
+
+// SetProperty changes the property, and sends PropertiesChanged, like bluez would when the
+// device changes.
+func (f *FakeBluez) SetProperty(path dbus.ObjectPath, iface, name string, value interface{}) error {
+	variant, ok := value.(dbus.Variant)
+	if !ok {
+		variant = dbus.MakeVariant(value)
+	}
+	return f.setProperties(path, iface, map[string]dbus.Variant{name: variant})
+}
+
+// Property returns the current value of the property
+func (f *FakeBluez) Property(path dbus.ObjectPath, iface, name string) (interface{}, bool) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	value, ok := f.objects[path][iface][name]
+	if !ok {
+		return nil, false
+	}
+	return value.Value(), true
+}
+
+func (f *FakeBluez) setProperties(path dbus.ObjectPath, iface string, changed map[string]dbus.Variant) error {
+	f.mux.Lock()
+	props, ok := f.objects[path][iface]
+	if !ok {
+		f.mux.Unlock()
+		return fmt.Errorf("No interface %s at %s", iface, path)
+	}
+	for name, value := range changed {
+		props[name] = value
+	}
+	f.mux.Unlock()
+
+	return f.conn.Emit(path, fakeProperties+".PropertiesChanged", iface, changed, []string{})
+}
+
+// boolProperty is for the state of the methods, like Connected or Notifying
+func (f *FakeBluez) boolProperty(path dbus.ObjectPath, iface, name string) bool {
+	value, _ := f.Property(path, iface, name)
+	b, _ := value.(bool)
+	return b
+}
+
+// exportIntrospection exports Introspectable on every object, and on the nodes above them,
+// so the tree can be walked from the root.
+func (f *FakeBluez) exportIntrospection() {
+	f.mux.Lock()
+	nodes := map[dbus.ObjectPath][]string{"/": nil}
+	for path := range f.objects {
+		nodes[path] = nil
+		for p := path; p != "/"; {
+			parent := dbus.ObjectPath(filepath.Dir(string(p)))
+			nodes[parent] = nil
+			p = parent
+		}
+	}
+	xml := make(map[dbus.ObjectPath]string, len(nodes))
+	for path := range nodes {
+		node := &introspect.Node{
+			Interfaces: []introspect.Interface{introspect.IntrospectData},
+		}
+		ifaces := make([]string, 0)
+		for iface := range f.objects[path] {
+			ifaces = append(ifaces, iface)
+		}
+		if path == "/" {
+			ifaces = append(ifaces, fakeObjectMgr)
+		}
+		if _, ok := f.objects[path]; ok {
+			ifaces = append(ifaces, fakeProperties)
+		}
+		sort.Strings(ifaces)
+		for _, iface := range ifaces {
+			node.Interfaces = append(node.Interfaces, introspect.Interface{Name: iface})
+		}
+		for child := range nodes {
+			if child != path && dbus.ObjectPath(filepath.Dir(string(child))) == path {
+				node.Children = append(node.Children, introspect.Node{Name: filepath.Base(string(child))})
+			}
+		}
+		sort.Slice(node.Children, func(i, j int) bool {
+			return node.Children[i].Name < node.Children[j].Name
+		})
+		xml[path] = string(introspect.NewIntrospectable(node))
+	}
+	f.mux.Unlock()
+
+	for path, data := range xml {
+		f.conn.Export(introspect.Introspectable(data), path, fakeIntrospect)
+	}
+}
+
+// fakeValue makes up a value for the property. The paths in the fixtures have the address
+// and the handles, so we use those where we can.
+func fakeValue(path dbus.ObjectPath, iface, name string) (dbus.Variant, bool) {
+	parent := dbus.ObjectPath(filepath.Dir(string(path)))
+	element := filepath.Base(string(path))
+	handle := fakeHandle(element)
+	var value interface{}
+	switch name {
+	case "Address":
+		value = FakeAdapterAddress
+		if strings.HasPrefix(element, "dev_") {
+			value = strings.Replace(strings.TrimPrefix(element, "dev_"), "_", ":", -1)
+		}
+	case "AddressType":
+		value = "public"
+	case "Alias", "Name":
+		value = element
+	case "Modalias":
+		value = "usb:v1D6Bp0246d0537"
+	case "Icon":
+		value = "computer"
+	case "Class", "DiscoverableTimeout", "PairableTimeout":
+		value = uint32(0)
+	case "Powered", "Pairable", "Primary":
+		value = true
+	case "Discoverable", "Discovering", "Blocked", "Connected", "LegacyPairing", "Paired",
+		"ServicesResolved", "Trusted", "Notifying", "NotifyAcquired":
+		value = false
+	case "UUIDs", "SupportedIncludes":
+		value = []string{}
+	case "Flags":
+		value = []string{"read", "write", "notify"}
+	case "ActiveInstances":
+		value = byte(0)
+	case "SupportedInstances":
+		value = byte(5)
+	case "Adapter", "Device", "Service", "Characteristic":
+		value = parent
+	case "Includes":
+		value = []dbus.ObjectPath{}
+	case "Value":
+		value = []byte{}
+	case "UUID":
+		if iface == fakeDescIface {
+			// Client Characteristic Configuration
+			value = "00002902-0000-1000-8000-00805f9b34fb"
+		} else {
+			value = fmt.Sprintf("0000%04x-0000-1000-8000-00805f9b34fb", handle)
+		}
+	case "Handle":
+		value = handle
+	case "RSSI":
+		value = int16(-60)
+	case "TxPower":
+		value = int16(0)
+	default:
+		return dbus.Variant{}, false
+	}
+
+	return dbus.MakeVariant(value), true
+}
+
+// fakeHandle is the handle from the end of the path element, like service0008
+func fakeHandle(element string) uint16 {
+	if len(element) < 4 {
+		return 0
+	}
+	handle, err := strconv.ParseUint(element[len(element)-4:], 16, 16)
+	if err != nil {
+		return 0
+	}
+	return uint16(handle)
+}
+
+// GetManagedObjects is org.freedesktop.DBus.ObjectManager.GetManagedObjects
+func (o *fakeObjectManager) GetManagedObjects() (map[dbus.ObjectPath]map[string]map[string]dbus.Variant, *dbus.Error) {
+	o.f.mux.Lock()
+	defer o.f.mux.Unlock()
+	objects := make(map[dbus.ObjectPath]map[string]map[string]dbus.Variant, len(o.f.objects))
+	for path, props := range o.f.objects {
+		ifaces := make(map[string]map[string]dbus.Variant, len(props))
+		for iface, values := range props {
+			copied := make(map[string]dbus.Variant, len(values))
+			for name, value := range values {
+				copied[name] = value
+			}
+			ifaces[iface] = copied
+		}
+		objects[path] = ifaces
+	}
+
+	return objects, nil
+}
+
+// Get is org.freedesktop.DBus.Properties.Get
+func (p *fakeProps) Get(iface, name string) (dbus.Variant, *dbus.Error) {
+	p.f.mux.Lock()
+	defer p.f.mux.Unlock()
+	value, ok := p.f.objects[p.path][iface][name]
+	if !ok {
+		return dbus.Variant{}, fakeError("org.freedesktop.DBus.Error.InvalidArgs",
+			"No such property '"+name+"'")
+	}
+	return value, nil
+}
+
+// GetAll is org.freedesktop.DBus.Properties.GetAll
+func (p *fakeProps) GetAll(iface string) (map[string]dbus.Variant, *dbus.Error) {
+	p.f.mux.Lock()
+	defer p.f.mux.Unlock()
+	values, ok := p.f.objects[p.path][iface]
+	if !ok {
+		return nil, fakeError("org.freedesktop.DBus.Error.InvalidArgs",
+			"No such interface '"+iface+"'")
+	}
+	copied := make(map[string]dbus.Variant, len(values))
+	for name, value := range values {
+		copied[name] = value
+	}
+	return copied, nil
+}
+
+// Set is org.freedesktop.DBus.Properties.Set. The value must have the same type as before.
+func (p *fakeProps) Set(iface, name string, value dbus.Variant) *dbus.Error {
+	p.f.mux.Lock()
+	current, ok := p.f.objects[p.path][iface][name]
+	p.f.mux.Unlock()
+	if !ok {
+		return fakeError("org.freedesktop.DBus.Error.InvalidArgs", "No such property '"+name+"'")
+	}
+	if current.Signature() != value.Signature() {
+		return fakeError("org.freedesktop.DBus.Error.InvalidArgs", "Invalid arguments in method call")
+	}
+	err := p.f.setProperties(p.path, iface, map[string]dbus.Variant{name: value})
+	if err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	return nil
+}
+
+// StartDiscovery is org.bluez.Adapter1.StartDiscovery
+func (a *fakeAdapter) StartDiscovery() *dbus.Error {
+	if a.f.boolProperty(a.path, fakeAdapterIface, "Discovering") {
+		return fakeError("org.bluez.Error.InProgress", "Operation already in progress")
+	}
+	a.f.SetProperty(a.path, fakeAdapterIface, "Discovering", true)
+	return nil
+}
+
+// StopDiscovery is org.bluez.Adapter1.StopDiscovery. Like bluez, it fails if discovery
+// wasn't started.
+func (a *fakeAdapter) StopDiscovery() *dbus.Error {
+	if !a.f.boolProperty(a.path, fakeAdapterIface, "Discovering") {
+		return fakeError("org.bluez.Error.Failed", "No discovery started")
+	}
+	a.f.SetProperty(a.path, fakeAdapterIface, "Discovering", false)
+	return nil
+}
+
+// SetDiscoveryFilter is org.bluez.Adapter1.SetDiscoveryFilter. The filter is ignored.
+func (a *fakeAdapter) SetDiscoveryFilter(filter map[string]dbus.Variant) *dbus.Error {
+	return nil
+}
+
+// GetDiscoveryFilters is org.bluez.Adapter1.GetDiscoveryFilters
+func (a *fakeAdapter) GetDiscoveryFilters() ([]string, *dbus.Error) {
+	return fakeDiscoveryFilters, nil
+}
+
+// RemoveDevice is org.bluez.Adapter1.RemoveDevice
+func (a *fakeAdapter) RemoveDevice(device dbus.ObjectPath) *dbus.Error {
+	if filepath.Dir(string(device)) != string(a.path) ||
+		a.f.RemoveObject(device) != nil {
+		return fakeError("org.bluez.Error.DoesNotExist", "Does Not Exist")
+	}
+	return nil
+}
+
+// Connect is org.bluez.Device1.Connect. The services are resolved immediately.
+func (d *fakeDevice) Connect() *dbus.Error {
+	if d.f.boolProperty(d.path, fakeDeviceIface, "Connected") {
+		return fakeError("org.bluez.Error.AlreadyConnected", "Already Connected")
+	}
+	d.f.setProperties(d.path, fakeDeviceIface, map[string]dbus.Variant{
+		"Connected":        dbus.MakeVariant(true),
+		"ServicesResolved": dbus.MakeVariant(true),
+	})
+	return nil
+}
+
+// Disconnect is org.bluez.Device1.Disconnect
+func (d *fakeDevice) Disconnect() *dbus.Error {
+	if !d.f.boolProperty(d.path, fakeDeviceIface, "Connected") {
+		return fakeError("org.bluez.Error.NotConnected", "Not Connected")
+	}
+	d.f.setProperties(d.path, fakeDeviceIface, map[string]dbus.Variant{
+		"Connected":        dbus.MakeVariant(false),
+		"ServicesResolved": dbus.MakeVariant(false),
+	})
+	return nil
+}
+
+// ConnectProfile is org.bluez.Device1.ConnectProfile
+func (d *fakeDevice) ConnectProfile(uuid string) *dbus.Error {
+	return d.Connect()
+}
+
+// DisconnectProfile is org.bluez.Device1.DisconnectProfile
+func (d *fakeDevice) DisconnectProfile(uuid string) *dbus.Error {
+	return d.Disconnect()
+}
+
+// Pair is org.bluez.Device1.Pair. If an agent that can confirm is registered, it's asked to
+// confirm FakePasskey, like numeric comparison.
+func (d *fakeDevice) Pair() *dbus.Error {
+	if d.f.boolProperty(d.path, fakeDeviceIface, "Paired") {
+		return fakeError("org.bluez.Error.AlreadyExists", "Already Exists")
+	}
+	d.f.mux.Lock()
+	agent := d.f.agent
+	d.f.mux.Unlock()
+	if agent != nil && agent.capability != "NoInputNoOutput" {
+		call := d.f.conn.Object(string(agent.sender), agent.path).Call(
+			fakeAgentIface+".RequestConfirmation", 0, d.path, uint32(FakePasskey))
+		if call.Err != nil {
+			if dbusErr, ok := call.Err.(dbus.Error); ok && dbusErr.Name == "org.bluez.Error.Canceled" {
+				return fakeError("org.bluez.Error.AuthenticationCanceled", "Authentication Canceled")
+			}
+			return fakeError("org.bluez.Error.AuthenticationRejected", "Authentication Rejected")
+		}
+	}
+	d.f.SetProperty(d.path, fakeDeviceIface, "Paired", true)
+	return nil
+}
+
+// CancelPairing is org.bluez.Device1.CancelPairing. We never have a pairing in progress.
+func (d *fakeDevice) CancelPairing() *dbus.Error {
+	return fakeError("org.bluez.Error.DoesNotExist", "Does Not Exist")
+}
+
+// RegisterAgent is org.bluez.AgentManager1.RegisterAgent. There is only one agent.
+func (m *fakeAgentManager) RegisterAgent(sender dbus.Sender, agent dbus.ObjectPath,
+	capability string) *dbus.Error {
+	m.f.mux.Lock()
+	defer m.f.mux.Unlock()
+	if m.f.agent != nil {
+		return fakeError("org.bluez.Error.AlreadyExists", "Already Exists")
+	}
+	if capability == "" {
+		capability = "KeyboardDisplay"
+	}
+	m.f.agent = &fakeAgent{sender: sender, path: agent, capability: capability}
+	return nil
+}
+
+// UnregisterAgent is org.bluez.AgentManager1.UnregisterAgent
+func (m *fakeAgentManager) UnregisterAgent(sender dbus.Sender, agent dbus.ObjectPath) *dbus.Error {
+	m.f.mux.Lock()
+	defer m.f.mux.Unlock()
+	if m.f.agent == nil || m.f.agent.sender != sender || m.f.agent.path != agent {
+		return fakeError("org.bluez.Error.DoesNotExist", "Does Not Exist")
+	}
+	m.f.agent = nil
+	return nil
+}
+
+// RequestDefaultAgent is org.bluez.AgentManager1.RequestDefaultAgent. The agent is always
+// the default.
+func (m *fakeAgentManager) RequestDefaultAgent(sender dbus.Sender, agent dbus.ObjectPath) *dbus.Error {
+	m.f.mux.Lock()
+	defer m.f.mux.Unlock()
+	if m.f.agent == nil || m.f.agent.sender != sender || m.f.agent.path != agent {
+		return fakeError("org.bluez.Error.DoesNotExist", "Does Not Exist")
+	}
+	return nil
+}
+
+// ReadValue is org.bluez.GattCharacteristic1.ReadValue
+func (c *fakeCharacteristic) ReadValue(options map[string]dbus.Variant) ([]byte, *dbus.Error) {
+	return readFakeValue(c.f, c.path, fakeCharIface, options)
+}
+
+// WriteValue is org.bluez.GattCharacteristic1.WriteValue. The new value is sent with
+// PropertiesChanged, like a notification.
+func (c *fakeCharacteristic) WriteValue(value []byte, options map[string]dbus.Variant) *dbus.Error {
+	c.f.SetProperty(c.path, fakeCharIface, "Value", value)
+	return nil
+}
+
+// StartNotify is org.bluez.GattCharacteristic1.StartNotify
+func (c *fakeCharacteristic) StartNotify() *dbus.Error {
+	if !c.f.boolProperty(c.path, fakeCharIface, "Notifying") {
+		c.f.SetProperty(c.path, fakeCharIface, "Notifying", true)
+	}
+	return nil
+}
+
+// StopNotify is org.bluez.GattCharacteristic1.StopNotify
+func (c *fakeCharacteristic) StopNotify() *dbus.Error {
+	if !c.f.boolProperty(c.path, fakeCharIface, "Notifying") {
+		return fakeError("org.bluez.Error.Failed", "No notify session started")
+	}
+	c.f.SetProperty(c.path, fakeCharIface, "Notifying", false)
+	return nil
+}
+
+// ReadValue is org.bluez.GattDescriptor1.ReadValue
+func (d *fakeDescriptor) ReadValue(options map[string]dbus.Variant) ([]byte, *dbus.Error) {
+	return readFakeValue(d.f, d.path, fakeDescIface, options)
+}
+
+// WriteValue is org.bluez.GattDescriptor1.WriteValue
+func (d *fakeDescriptor) WriteValue(value []byte, options map[string]dbus.Variant) *dbus.Error {
+	d.f.SetProperty(d.path, fakeDescIface, "Value", value)
+	return nil
+}
+
+// readFakeValue returns the Value property, starting at the offset option
+func readFakeValue(f *FakeBluez, path dbus.ObjectPath, iface string,
+	options map[string]dbus.Variant) ([]byte, *dbus.Error) {
+	value, _ := f.Property(path, iface, "Value")
+	data, _ := value.([]byte)
+	if offset, ok := options["offset"]; ok {
+		off, ok := offset.Value().(uint16)
+		if !ok || int(off) > len(data) {
+			return nil, fakeError("org.bluez.Error.InvalidOffset", "Invalid offset")
+		}
+		data = data[off:]
+	}
+	return data, nil
+}
@@ -0,0 +1,709 @@
+package scenario
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+
+	"github.com/shigmas/bluezog/pkg/base"
+	"github.com/shigmas/bluezog/test"
+)
+
+type (
+	// Scenario is the script for ScenarioOperations. It is loaded from YAML or JSON.
+	//
+	// Property values are in the text format that dbus.ParseVariant reads, like "@n -60",
+	// "true", "@o '/org/bluez/hci0'" or "@ay [0x01, 0x02]". A value that doesn't parse is a
+	// string, so "00:11:22:33:44:55" or "Thermometer" can be written as they are.
+	Scenario struct {
+		Name string `yaml:"name"`
+		// Objects are the objects returned from GetManagedObjects, keyed by path, then
+		// interface, then property.
+		Objects map[string]map[string]map[string]string `yaml:"objects"`
+		// Calls are the expected method calls. Any other call returns an error.
+		Calls []CallExpectation `yaml:"calls"`
+		// Signals are sent after a time, or when a call or Emit triggers them.
+		Signals []ScriptedSignal `yaml:"signals"`
+	}
+
+	// CallExpectation is a method call that we expect, and what we reply with
+	CallExpectation struct {
+		// Path of the object. Empty matches any path.
+		Path string `yaml:"path"`
+		// Method is the full name, like org.bluez.Device1.Connect, or just the method name.
+		Method string `yaml:"method"`
+		// Reply are the values returned from the call
+		Reply []string `yaml:"reply"`
+		// Error is the name of the error to return. A name without a '.' is a bluez error,
+		// like NotPermitted.
+		Error string `yaml:"error"`
+		// Message for the error
+		Message string `yaml:"message"`
+		// Times is how many times the call is expected. Zero means any number of times.
+		Times int `yaml:"times"`
+		// Emit are the names of the signals to send after the call
+		Emit []string `yaml:"emit"`
+	}
+
+	// ScriptedSignal is a signal from bluez. Type is InterfacesAdded, InterfacesRemoved,
+	// PropertiesChanged or NameOwnerChanged. The objects are updated with the signal, so
+	// GetManagedObjects and GetObjectProperty are consistent with it.
+	ScriptedSignal struct {
+		// Name is used by CallExpectation.Emit and Emit
+		Name string `yaml:"name"`
+		// After is the time after RegisterSignalChannel to send the signal, like "500ms".
+		// If it's empty, the signal is only sent when it's triggered.
+		After string `yaml:"after"`
+		Type  string `yaml:"type"`
+		// Path of the object
+		Path string `yaml:"path"`
+		// Interfaces are the interfaces and properties, for InterfacesAdded
+		Interfaces map[string]map[string]string `yaml:"interfaces"`
+		// Interface and Properties are the changed properties, for PropertiesChanged
+		Interface  string            `yaml:"interface"`
+		Properties map[string]string `yaml:"properties"`
+		// Removed are the interfaces for InterfacesRemoved, or the invalidated properties
+		// for PropertiesChanged
+		Removed []string `yaml:"removed"`
+		// Owner is the new owner of org.bluez, for NameOwnerChanged. Empty means bluez
+		// stopped.
+		Owner string `yaml:"owner"`
+	}
+
+	// Call is a method call that ScenarioOperations received
+	Call struct {
+		Path   dbus.ObjectPath
+		Method string
+		Args   []interface{}
+		// Expected is false if there was no expectation for the call
+		Expected bool
+	}
+
+	// ScenarioOperations is a base.Operations that follows a Scenario
+	ScenarioOperations struct {
+		scenario *Scenario
+		mux      sync.Mutex
+		objects  map[dbus.ObjectPath]base.ObjectMap
+		// the number of times each expectation was called, by index
+		callCounts []int
+		calls      []Call
+		signals    map[string]*ScriptedSignal
+		owner      string
+		sigCh      chan<- *dbus.Signal
+		timers     []*time.Timer
+		exported   map[dbus.ObjectPath]map[string]interface{}
+		peers      map[dbus.ObjectPath]*os.File
+	}
+)
+
+const (
+	propertiesChangedName = "org.freedesktop.DBus.Properties.PropertiesChanged"
+	interfacesAddedName   = "org.freedesktop.DBus.ObjectManager.InterfacesAdded"
+	interfacesRemovedName = "org.freedesktop.DBus.ObjectManager.InterfacesRemoved"
+	nameOwnerChangedName  = "org.freedesktop.DBus.NameOwnerChanged"
+)
+
+var (
+	_ base.Operations = (*ScenarioOperations)(nil)
+
+	// variantText is a value that looks like variant text. The parser accepts a prefix, so
+	// "00:11:22:33:44:55" would be 0 if we didn't check.
+	variantText = regexp.MustCompile(`^([@\[{<'"]|true$|false$|-?[0-9]+$|-?[0-9]*\.[0-9]+$|0x[0-9a-fA-F]+$)`)
+)
+
+// LoadScenario reads the scenario from the file. JSON is read as YAML.
+func LoadScenario(fname string) (*Scenario, error) {
+	b, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	var scenario Scenario
+	err = yaml.Unmarshal(b, &scenario)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse scenario %s: %s", fname, err)
+	}
+
+	return &scenario, nil
+}
+
+// NewScenarioOperations creates the operations for the scenario. The values in the
+// scenario are checked, so errors are found before the test runs.
+func NewScenarioOperations(scenario *Scenario) (*ScenarioOperations, error) {
+	s := &ScenarioOperations{
+		scenario:   scenario,
+		objects:    make(map[dbus.ObjectPath]base.ObjectMap),
+		callCounts: make([]int, len(scenario.Calls)),
+		signals:    make(map[string]*ScriptedSignal),
+		owner:      ":1.1",
+		exported:   make(map[dbus.ObjectPath]map[string]interface{}),
+		peers:      make(map[dbus.ObjectPath]*os.File),
+	}
+	for path, ifaces := range scenario.Objects {
+		objMap, err := parseInterfaces(ifaces)
+		if err != nil {
+			return nil, fmt.Errorf("Object %s: %s", path, err)
+		}
+		s.objects[dbus.ObjectPath(path)] = objMap
+	}
+	for i := range scenario.Calls {
+		for _, name := range scenario.Calls[i].Emit {
+			if !scenario.hasSignal(name) {
+				return nil, fmt.Errorf("Call %s emits unknown signal %s", scenario.Calls[i].Method, name)
+			}
+		}
+	}
+	for i := range scenario.Signals {
+		sig := &scenario.Signals[i]
+		if _, err := s.buildSignal(sig, false); err != nil {
+			return nil, fmt.Errorf("Signal %s: %s", sig.Name, err)
+		}
+		if sig.After != "" {
+			if _, err := time.ParseDuration(sig.After); err != nil {
+				return nil, fmt.Errorf("Signal %s: %s", sig.Name, err)
+			}
+		}
+		if sig.Name != "" {
+			s.signals[sig.Name] = sig
+		}
+	}
+
+	return s, nil
+}
+
+// LoadScenarioOperations loads the scenario file and creates the operations for it
+func LoadScenarioOperations(fname string) (*ScenarioOperations, error) {
+	scenario, err := LoadScenario(fname)
+	if err != nil {
+		return nil, err
+	}
+	return NewScenarioOperations(scenario)
+}
+
+func (s *Scenario) hasSignal(name string) bool {
+	for _, sig := range s.Signals {
+		if sig.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseValue parses the variant text. Anything that doesn't parse is a string.
+func parseValue(value string) dbus.Variant {
+	if !variantText.MatchString(strings.TrimSpace(value)) {
+		return dbus.MakeVariant(value)
+	}
+	v, err := dbus.ParseVariant(value, dbus.Signature{})
+	if err != nil {
+		return dbus.MakeVariant(value)
+	}
+	return v
+}
+
+func parseProperties(props map[string]string) map[string]dbus.Variant {
+	parsed := make(map[string]dbus.Variant, len(props))
+	for name, value := range props {
+		parsed[name] = parseValue(value)
+	}
+	return parsed
+}
+
+func parseInterfaces(ifaces map[string]map[string]string) (base.ObjectMap, error) {
+	if len(ifaces) == 0 {
+		return nil, fmt.Errorf("No interfaces")
+	}
+	objMap := make(base.ObjectMap, len(ifaces))
+	for iface, props := range ifaces {
+		objMap[iface] = parseProperties(props)
+	}
+	return objMap, nil
+}
+
+// splitProperty splits org.bluez.Device1.RSSI into the interface and property
+func splitProperty(propName string) (string, string) {
+	index := strings.LastIndex(propName, ".")
+	if index < 0 {
+		return "", propName
+	}
+	return propName[:index], propName[index+1:]
+}
+
+// buildSignal creates the dbus signal. If apply is true, the objects are updated. The lock
+// must be held when applying.
+func (s *ScenarioOperations) buildSignal(sig *ScriptedSignal, apply bool) (*dbus.Signal, error) {
+	path := dbus.ObjectPath(sig.Path)
+	switch sig.Type {
+	case "InterfacesAdded":
+		objMap, err := parseInterfaces(sig.Interfaces)
+		if err != nil {
+			return nil, err
+		}
+		if apply {
+			existing, ok := s.objects[path]
+			if !ok {
+				existing = make(base.ObjectMap)
+				s.objects[path] = existing
+			}
+			for iface, props := range objMap {
+				existing[iface] = props
+			}
+		}
+		return &dbus.Signal{
+			Path: "/",
+			Name: interfacesAddedName,
+			Body: []interface{}{path, map[string]map[string]dbus.Variant(objMap)},
+		}, nil
+	case "InterfacesRemoved":
+		if apply {
+			for _, iface := range sig.Removed {
+				delete(s.objects[path], iface)
+			}
+			if len(s.objects[path]) == 0 {
+				delete(s.objects, path)
+			}
+		}
+		return &dbus.Signal{
+			Path: "/",
+			Name: interfacesRemovedName,
+			Body: []interface{}{path, append([]string{}, sig.Removed...)},
+		}, nil
+	case "PropertiesChanged":
+		if sig.Interface == "" {
+			return nil, fmt.Errorf("PropertiesChanged needs the interface")
+		}
+		changed := parseProperties(sig.Properties)
+		if apply {
+			s.updateProperties(path, sig.Interface, changed, sig.Removed)
+		}
+		return &dbus.Signal{
+			Path: path,
+			Name: propertiesChangedName,
+			Body: []interface{}{sig.Interface, changed, append([]string{}, sig.Removed...)},
+		}, nil
+	case "NameOwnerChanged":
+		oldOwner := s.owner
+		if apply {
+			s.owner = sig.Owner
+		}
+		return &dbus.Signal{
+			Path: "/org/freedesktop/DBus",
+			Name: nameOwnerChangedName,
+			Body: []interface{}{"org.bluez", oldOwner, sig.Owner},
+		}, nil
+	}
+
+	return nil, fmt.Errorf("Unknown signal type %s", sig.Type)
+}
+
+// updateProperties changes the properties of the object. The lock must be held.
+func (s *ScenarioOperations) updateProperties(
+	path dbus.ObjectPath,
+	iface string,
+	changed map[string]dbus.Variant,
+	invalidated []string) {
+	objMap, ok := s.objects[path]
+	if !ok {
+		return
+	}
+	props, ok := objMap[iface]
+	if !ok {
+		props = make(map[string]dbus.Variant)
+		objMap[iface] = props
+	}
+	for name, value := range changed {
+		props[name] = value
+	}
+	for _, name := range invalidated {
+		delete(props, name)
+	}
+}
+
+// send sends the signals in order, without blocking the caller, which might be the one
+// reading the channel.
+func (s *ScenarioOperations) send(signals ...*dbus.Signal) {
+	s.mux.Lock()
+	ch := s.sigCh
+	s.mux.Unlock()
+	if ch == nil || len(signals) == 0 {
+		return
+	}
+	go func() {
+		for _, sig := range signals {
+			ch <- sig
+		}
+	}()
+}
+
+// Emit sends the named signal from the scenario
+func (s *ScenarioOperations) Emit(name string) error {
+	sig, ok := s.signals[name]
+	if !ok {
+		return fmt.Errorf("No signal named %s", name)
+	}
+	s.mux.Lock()
+	dbusSig, err := s.buildSignal(sig, true)
+	s.mux.Unlock()
+	if err != nil {
+		return err
+	}
+	s.send(dbusSig)
+
+	return nil
+}
+
+// Close stops the timed signals
+func (s *ScenarioOperations) Close() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for _, timer := range s.timers {
+		timer.Stop()
+	}
+	s.timers = nil
+}
+
+// IntrospectObject returns a node with the children of the path
+func (s *ScenarioOperations) IntrospectObject(dest string, objPath dbus.ObjectPath) (*base.Node, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	prefix := strings.TrimSuffix(string(objPath), "/") + "/"
+	children := make(map[string]bool)
+	for path := range s.objects {
+		if !strings.HasPrefix(string(path), prefix) {
+			continue
+		}
+		children[strings.SplitN(strings.TrimPrefix(string(path), prefix), "/", 2)[0]] = true
+	}
+	node := &base.Node{Name: string(objPath)}
+	for name := range children {
+		node.Nodes = append(node.Nodes, base.Node{Name: name})
+	}
+	sort.Slice(node.Nodes, func(i, j int) bool { return node.Nodes[i].Name < node.Nodes[j].Name })
+
+	return node, nil
+}
+
+// GetObjectProperty returns the property of the object in the scenario
+func (s *ScenarioOperations) GetObjectProperty(dest string, objPath dbus.ObjectPath, propName string) (interface{}, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	iface, name := splitProperty(propName)
+	if value, ok := s.objects[objPath][iface][name]; ok {
+		return value.Value(), nil
+	}
+
+	return nil, dbus.Error{
+		Name: "org.freedesktop.DBus.Error.InvalidArgs",
+		Body: []interface{}{fmt.Sprintf("No property %s on %s", propName, objPath)},
+	}
+}
+
+// SetObjectProperty changes the property, and sends PropertiesChanged like bluez
+func (s *ScenarioOperations) SetObjectProperty(dest string, objPath dbus.ObjectPath, propName string, value interface{}) error {
+	iface, name := splitProperty(propName)
+	s.mux.Lock()
+	s.calls = append(s.calls, Call{
+		Path:     objPath,
+		Method:   "org.freedesktop.DBus.Properties.Set",
+		Args:     []interface{}{iface, name, value},
+		Expected: true,
+	})
+	if _, ok := s.objects[objPath][iface]; !ok {
+		s.mux.Unlock()
+		return dbus.Error{
+			Name: "org.freedesktop.DBus.Error.InvalidArgs",
+			Body: []interface{}{fmt.Sprintf("No interface %s on %s", iface, objPath)},
+		}
+	}
+	changed := map[string]dbus.Variant{name: dbus.MakeVariant(value)}
+	s.updateProperties(objPath, iface, changed, nil)
+	s.mux.Unlock()
+
+	s.send(&dbus.Signal{
+		Path: objPath,
+		Name: propertiesChangedName,
+		Body: []interface{}{iface, changed, []string{}},
+	})
+	return nil
+}
+
+// GetManagedObjects returns the objects in the scenario, as they are now
+func (s *ScenarioOperations) GetManagedObjects(dest string, objPath dbus.ObjectPath) (map[dbus.ObjectPath]base.ObjectMap, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	managed := make(map[dbus.ObjectPath]base.ObjectMap, len(s.objects))
+	for path, objMap := range s.objects {
+		copied := make(base.ObjectMap, len(objMap))
+		for iface, props := range objMap {
+			copiedProps := make(map[string]dbus.Variant, len(props))
+			for name, value := range props {
+				copiedProps[name] = value
+			}
+			copied[iface] = copiedProps
+		}
+		managed[path] = copied
+	}
+
+	return managed, nil
+}
+
+// call finds the expectation and records the call. The reply is returned, and the
+// signals to emit are sent.
+func (s *ScenarioOperations) call(objPath dbus.ObjectPath, funcName string, args []interface{}) (*CallExpectation, error) {
+	s.mux.Lock()
+	var expectation *CallExpectation
+	for i := range s.scenario.Calls {
+		exp := &s.scenario.Calls[i]
+		if exp.Path != "" && exp.Path != string(objPath) {
+			continue
+		}
+		if exp.Method != funcName && !strings.HasSuffix(funcName, "."+exp.Method) {
+			continue
+		}
+		if exp.Times > 0 && s.callCounts[i] >= exp.Times {
+			continue
+		}
+		s.callCounts[i]++
+		expectation = exp
+		break
+	}
+	s.calls = append(s.calls, Call{
+		Path:     objPath,
+		Method:   funcName,
+		Args:     args,
+		Expected: expectation != nil,
+	})
+	if expectation == nil {
+		s.mux.Unlock()
+		return nil, dbus.Error{
+			Name: "org.freedesktop.DBus.Error.UnknownMethod",
+			Body: []interface{}{fmt.Sprintf("Unexpected call %s on %s", funcName, objPath)},
+		}
+	}
+	signals := make([]*dbus.Signal, 0, len(expectation.Emit))
+	for _, name := range expectation.Emit {
+		sig, err := s.buildSignal(s.signals[name], true)
+		if err == nil {
+			signals = append(signals, sig)
+		}
+	}
+	s.mux.Unlock()
+	s.send(signals...)
+
+	if expectation.Error != "" {
+		name := expectation.Error
+		if !strings.Contains(name, ".") {
+			name = "org.bluez.Error." + name
+		}
+		var body []interface{}
+		if expectation.Message != "" {
+			body = []interface{}{expectation.Message}
+		}
+		return expectation, dbus.Error{Name: name, Body: body}
+	}
+
+	return expectation, nil
+}
+
+// CallFunction calls the function in the scenario
+func (s *ScenarioOperations) CallFunction(
+	_ context.Context,
+	dest string,
+	objPath dbus.ObjectPath,
+	funcName string) error {
+	_, err := s.call(objPath, funcName, nil)
+	return err
+}
+
+// CallFunctionWithArgs calls the function in the scenario, and stores the reply in retVal
+func (s *ScenarioOperations) CallFunctionWithArgs(
+	_ context.Context,
+	retVal interface{},
+	dest string,
+	objPath dbus.ObjectPath,
+	funcName string,
+	args ...interface{}) error {
+	expectation, err := s.call(objPath, funcName, args)
+	if err != nil || retVal == nil {
+		return err
+	}
+	reply := make([]interface{}, len(expectation.Reply))
+	for i, value := range expectation.Reply {
+		reply[i] = parseValue(value).Value()
+	}
+
+	return dbus.Store(reply, retVal)
+}
+
+// CallFunctionForFd calls the function in the scenario. The reply is the MTU, which is
+// test.MockMTU if there isn't one. The other end of the socket is returned from Peer.
+func (s *ScenarioOperations) CallFunctionForFd(
+	_ context.Context,
+	dest string,
+	objPath dbus.ObjectPath,
+	funcName string,
+	args ...interface{}) (*os.File, uint16, error) {
+	expectation, err := s.call(objPath, funcName, args)
+	if err != nil {
+		return nil, 0, err
+	}
+	mtu := uint16(test.MockMTU)
+	if len(expectation.Reply) > 0 {
+		if v, ok := parseValue(expectation.Reply[0]).Value().(uint16); ok {
+			mtu = v
+		}
+	}
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_SEQPACKET, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+	s.mux.Lock()
+	s.peers[objPath] = os.NewFile(uintptr(fds[1]), string(objPath)+"-peer")
+	s.mux.Unlock()
+
+	return os.NewFile(uintptr(fds[0]), string(objPath)), mtu, nil
+}
+
+// Peer returns the other end of the socket from CallFunctionForFd for the path
+func (s *ScenarioOperations) Peer(objPath dbus.ObjectPath) (*os.File, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	peer, ok := s.peers[objPath]
+	if !ok {
+		return nil, fmt.Errorf("No socket for %s", objPath)
+	}
+	return peer, nil
+}
+
+// Export stores the object, so the test can call it with Exported
+func (s *ScenarioOperations) Export(obj interface{}, path dbus.ObjectPath, iface string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	ifaces, ok := s.exported[path]
+	if !ok {
+		ifaces = make(map[string]interface{})
+		s.exported[path] = ifaces
+	}
+	ifaces[iface] = obj
+
+	return nil
+}
+
+// Unexport removes the exported object
+func (s *ScenarioOperations) Unexport(path dbus.ObjectPath, iface string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	delete(s.exported[path], iface)
+
+	return nil
+}
+
+// Exported returns the object exported on the path, or nil
+func (s *ScenarioOperations) Exported(path dbus.ObjectPath, iface string) interface{} {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.exported[path][iface]
+}
+
+// RegisterSignalChannel stores the channel, and starts the timers for the signals that
+// have After.
+func (s *ScenarioOperations) RegisterSignalChannel(ch chan<- *dbus.Signal) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.sigCh = ch
+	for i := range s.scenario.Signals {
+		sig := &s.scenario.Signals[i]
+		if sig.After == "" {
+			continue
+		}
+		after, _ := time.ParseDuration(sig.After)
+		s.timers = append(s.timers, time.AfterFunc(after, func() {
+			s.mux.Lock()
+			dbusSig, err := s.buildSignal(sig, true)
+			s.mux.Unlock()
+			if err == nil {
+				s.send(dbusSig)
+			}
+		}))
+	}
+}
+
+// Watch does nothing. All signals are sent.
+func (s *ScenarioOperations) Watch(path dbus.ObjectPath, iface string, method string) error {
+	return nil
+}
+
+// UnWatch does nothing
+func (s *ScenarioOperations) UnWatch(path dbus.ObjectPath, iface string, method string) error {
+	return nil
+}
+
+// WatchNamespace does nothing
+func (s *ScenarioOperations) WatchNamespace(namespace dbus.ObjectPath, iface string, method string) error {
+	return nil
+}
+
+// WatchNameOwner does nothing
+func (s *ScenarioOperations) WatchNameOwner(name string) error {
+	return nil
+}
+
+// Calls returns the calls of the method on the path. The method can be the full name or
+// just the method name. An empty path matches any path.
+func (s *ScenarioOperations) Calls(path dbus.ObjectPath, method string) []Call {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	calls := make([]Call, 0)
+	for _, c := range s.calls {
+		if path != "" && c.Path != path {
+			continue
+		}
+		if c.Method != method && !strings.HasSuffix(c.Method, "."+method) {
+			continue
+		}
+		calls = append(calls, c)
+	}
+	return calls
+}
+
+// AssertCalled asserts that the method was called on the path
+func (s *ScenarioOperations) AssertCalled(t assert.TestingT, path dbus.ObjectPath, method string) bool {
+	return assert.NotEmpty(t, s.Calls(path, method), "%s was not called on %s", method, path)
+}
+
+// AssertNotCalled asserts that the method was not called on the path
+func (s *ScenarioOperations) AssertNotCalled(t assert.TestingT, path dbus.ObjectPath, method string) bool {
+	return assert.Empty(t, s.Calls(path, method), "%s was called on %s", method, path)
+}
+
+// AssertExpectations asserts that the calls with Times were called that many times, and
+// that there were no unexpected calls.
+func (s *ScenarioOperations) AssertExpectations(t assert.TestingT) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	ok := true
+	for i, exp := range s.scenario.Calls {
+		if exp.Times > 0 && s.callCounts[i] != exp.Times {
+			ok = assert.Fail(t, "Expectation not met",
+				"%s on %s was called %d times, expected %d", exp.Method, exp.Path,
+				s.callCounts[i], exp.Times) && ok
+		}
+	}
+	for _, c := range s.calls {
+		if !c.Expected {
+			ok = assert.Fail(t, "Unexpected call", "%s on %s", c.Method, c.Path) && ok
+		}
+	}
+
+	return ok
+}